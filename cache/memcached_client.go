@@ -212,6 +212,12 @@ func NewMemcachedClientWithConfig(logger log.Logger, name string, config Memcach
 	client.MaxIdleConns = config.MaxIdleConnections
 
 	if config.TLSEnabled {
+		if config.TLS.Logger == nil {
+			config.TLS.Logger = logger
+		}
+		if config.TLS.Registerer == nil && reg != nil {
+			config.TLS.Registerer = prometheus.WrapRegistererWith(prometheus.Labels{labelCacheName: name}, reg)
+		}
 		cfg, err := config.TLS.GetTLSConfig()
 		if err != nil {
 			return nil, errors.Wrapf(err, "TLS configuration")
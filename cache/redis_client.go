@@ -178,6 +178,12 @@ func NewRedisClient(logger log.Logger, name string, config RedisClientConfig, re
 	}
 
 	if config.TLSEnabled {
+		if config.TLS.Logger == nil {
+			config.TLS.Logger = logger
+		}
+		if config.TLS.Registerer == nil && reg != nil {
+			config.TLS.Registerer = prometheus.WrapRegistererWith(prometheus.Labels{labelCacheName: name}, reg)
+		}
 		tlsClientConfig, err := config.TLS.GetTLSConfig()
 		if err != nil {
 			return nil, err
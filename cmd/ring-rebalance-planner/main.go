@@ -0,0 +1,140 @@
+// ring-rebalance-planner computes the token moves needed to bring the ownership spread of the zones of a ring
+// below a target, using ring.PlanRebalance.
+//
+// The ring is read from a file containing a ring.Desc, either encoded in JSON, as exported by the memberlist
+// KV status page, or in protobuf, as stored in the KV store.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/grafana/dskit/ring"
+)
+
+func main() {
+	var (
+		ringFile     string
+		inputFormat  string
+		outputFormat string
+		outputRing   string
+		targetSpread float64
+		maxMoves     int
+	)
+	flag.StringVar(&ringFile, "ring-file", "", "Path to the file containing the ring.")
+	flag.StringVar(&inputFormat, "input-format", "json", "Format of the ring file. Supported values: json, proto.")
+	flag.StringVar(&outputFormat, "output-format", "text", "Format of the computed plan. Supported values: text, json.")
+	flag.StringVar(&outputRing, "output-ring-file", "", "If set, the ring with the planned moves applied is written to this path, in the input format.")
+	flag.Float64Var(&targetSpread, "target-spread", 0.05, "Target ownership spread of each zone, between 0 and 1. The spread of a zone is the difference between the highest and the lowest ownership of its instances, divided by the highest ownership.")
+	flag.IntVar(&maxMoves, "max-moves", 0, "Maximum number of token moves. 0 means no limit.")
+	flag.Parse()
+
+	if err := run(ringFile, inputFormat, outputFormat, outputRing, targetSpread, maxMoves, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ringFile, inputFormat, outputFormat, outputRing string, targetSpread float64, maxMoves int, out io.Writer) error {
+	if ringFile == "" {
+		return fmt.Errorf("the ring file is required")
+	}
+	data, err := os.ReadFile(ringFile)
+	if err != nil {
+		return err
+	}
+	desc, err := decodeRing(data, inputFormat)
+	if err != nil {
+		return fmt.Errorf("failed to decode ring: %w", err)
+	}
+
+	plan, err := ring.PlanRebalance(desc, targetSpread, maxMoves)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(plan)
+	case "text":
+		err = writePlan(out, plan, targetSpread)
+	default:
+		err = fmt.Errorf("unsupported output format %q", outputFormat)
+	}
+	if err != nil || outputRing == "" {
+		return err
+	}
+
+	if err := plan.Apply(desc); err != nil {
+		return err
+	}
+	data, err = encodeRing(desc, inputFormat)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputRing, data, 0o644)
+}
+
+func decodeRing(data []byte, format string) (*ring.Desc, error) {
+	desc := ring.NewDesc()
+	switch format {
+	case "json":
+		return desc, json.Unmarshal(data, desc)
+	case "proto":
+		return desc, desc.Unmarshal(data)
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", format)
+	}
+}
+
+func encodeRing(desc *ring.Desc, format string) ([]byte, error) {
+	if format == "proto" {
+		return desc.Marshal()
+	}
+	return json.MarshalIndent(desc, "", "  ")
+}
+
+func writePlan(out io.Writer, plan *ring.RebalancePlan, targetSpread float64) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "MOVES: %d\n", len(plan.Moves))
+	fmt.Fprintln(w, "#\tTOKEN\tZONE\tFROM\tTO\tOWNERSHIP")
+	for i, move := range plan.Moves {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%.4f%%\n", i+1, move.Token, move.Zone, move.From, move.To, move.Ownership*100)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "ZONE\tINSTANCES\tSPREAD BEFORE\tSPREAD AFTER\tMIN OWNERSHIP\tMAX OWNERSHIP")
+	for _, name := range sortedKeys(plan.Zones) {
+		zone := plan.Zones[name]
+		fmt.Fprintf(w, "%s\t%d\t%.4f%%\t%.4f%%\t%.4f%%\t%.4f%%\n", name, zone.Instances, zone.SpreadBefore*100, zone.SpreadAfter*100, zone.MinAfter*100, zone.MaxAfter*100)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "INSTANCE\tZONE\tOWNERSHIP BEFORE\tOWNERSHIP AFTER")
+	for _, id := range sortedKeys(plan.Instances) {
+		instance := plan.Instances[id]
+		fmt.Fprintf(w, "%s\t%s\t%.4f%%\t%.4f%%\n", id, instance.Zone, instance.Before*100, instance.After*100)
+	}
+
+	if !plan.TargetReached(targetSpread) {
+		fmt.Fprintf(w, "\nWARNING: the target spread %.4f%% can't be reached with the given moves budget\n", targetSpread*100)
+	}
+	return w.Flush()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
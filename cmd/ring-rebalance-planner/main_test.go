@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/ring"
+)
+
+const quarter = 1 << 30
+
+func writeTestRing(t *testing.T, format string) string {
+	t.Helper()
+
+	// instance-1 owns 3/4 of the token space of zone-a, instance-2 owns 1/4.
+	desc := ring.NewDesc()
+	desc.AddIngester("instance-1", "", "zone-a", []uint32{quarter, 2 * quarter, 3 * quarter}, ring.ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-2", "", "zone-a", []uint32{0}, ring.ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	data, err := encodeRing(desc, format)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ring."+format)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestRun_TextOutput(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, run(writeTestRing(t, "json"), "json", "text", "", 0.1, 0, out))
+
+	assert.Equal(t, `MOVES: 1
+#  TOKEN       ZONE    FROM        TO          OWNERSHIP
+1  1073741824  zone-a  instance-1  instance-2  25.0000%
+
+ZONE    INSTANCES  SPREAD BEFORE  SPREAD AFTER  MIN OWNERSHIP  MAX OWNERSHIP
+zone-a  2          66.6667%       0.0000%       50.0000%       50.0000%
+
+INSTANCE    ZONE    OWNERSHIP BEFORE  OWNERSHIP AFTER
+instance-1  zone-a  75.0000%          50.0000%
+instance-2  zone-a  25.0000%          50.0000%
+`, out.String())
+}
+
+func TestRun_JSONOutputAndRingFile(t *testing.T) {
+	for _, format := range []string{"json", "proto"} {
+		t.Run(format, func(t *testing.T) {
+			outputRing := filepath.Join(t.TempDir(), "output")
+			out := &bytes.Buffer{}
+			require.NoError(t, run(writeTestRing(t, format), format, "json", outputRing, 0.1, 0, out))
+
+			plan := ring.RebalancePlan{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &plan))
+			require.Len(t, plan.Moves, 1)
+			assert.Equal(t, "instance-1", plan.Moves[0].From)
+			assert.Equal(t, "instance-2", plan.Moves[0].To)
+
+			// The output ring is written in the input format, with the moves applied.
+			data, err := os.ReadFile(outputRing)
+			require.NoError(t, err)
+			desc, err := decodeRing(data, format)
+			require.NoError(t, err)
+			assert.Len(t, desc.Ingesters["instance-1"].Tokens, 2)
+			assert.Len(t, desc.Ingesters["instance-2"].Tokens, 2)
+		})
+	}
+}
+
+func TestRun_InvalidInput(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.EqualError(t, run("", "json", "text", "", 0.1, 0, out), "the ring file is required")
+	assert.EqualError(t, run(writeTestRing(t, "json"), "yaml", "text", "", 0.1, 0, out), `failed to decode ring: unsupported input format "yaml"`)
+	assert.EqualError(t, run(writeTestRing(t, "json"), "json", "yaml", "", 0.1, 0, out), `unsupported output format "yaml"`)
+	assert.ErrorContains(t, run(writeTestRing(t, "json"), "proto", "text", "", 0.1, 0, out), "failed to decode ring")
+}
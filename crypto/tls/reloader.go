@@ -0,0 +1,329 @@
+package tls
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// CertReloaderConfig configures a CertReloader.
+type CertReloaderConfig struct {
+	// CertPath and KeyPath are the paths to the certificate and its key. Both are optional, but must be set together.
+	CertPath string
+	KeyPath  string
+
+	// CAPath is the path to the CA certificates. Optional.
+	CAPath string
+
+	// Reader reads the files. Defaults to reading from the file system.
+	Reader SecretReader
+
+	// ReloadInterval is the minimum time between two checks of the files for changes. Files are checked lazily,
+	// when a certificate is needed for a handshake. Zero means files are checked on every handshake.
+	ReloadInterval time.Duration
+}
+
+// CertReloader keeps a certificate and CA certificates loaded from files, and reloads them when the files change,
+// so that rotated short-lived certificates are used without restarting. It plugs into tls.Config through
+// GetCertificate, GetClientCertificate, VerifyConnection and GetConfigForClient.
+//
+// If reloading fails, for example because the certificate and key files are being rotated, the previous
+// certificates are kept until the next successful reload.
+type CertReloader struct {
+	cfg    CertReloaderConfig
+	logger log.Logger
+
+	mtx       sync.RWMutex
+	cert      *tls.Certificate
+	caPool    *x509.CertPool
+	hash      [sha256.Size]byte
+	lastCheck time.Time
+
+	// Only one handshake at a time checks the files.
+	checking atomic.Bool
+
+	reloadsTotal      prometheus.Counter
+	reloadErrorsTotal prometheus.Counter
+	expiryTimestamp   *prometheus.GaugeVec
+}
+
+// NewCertReloader creates a CertReloader, and loads the certificates. Metrics are registered with reg, which
+// should be wrapped with a distinct "name" label by callers creating reloaders for different files, the only
+// label used by the reloaders of this module. Reloaders registering with the same labels, such as the ones
+// created for each connection by gRPC clients, share their metrics.
+func NewCertReloader(cfg CertReloaderConfig, logger log.Logger, reg prometheus.Registerer) (*CertReloader, error) {
+	if cfg.CertPath != "" && cfg.KeyPath == "" {
+		return nil, errKeyMissing
+	}
+	if cfg.KeyPath != "" && cfg.CertPath == "" {
+		return nil, errCertMissing
+	}
+	if cfg.Reader == nil {
+		cfg.Reader = &fileReader{}
+	}
+
+	r := &CertReloader{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	var err error
+	if r.reloadsTotal, err = registerOrExisting(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tls_certificate_reloads_total",
+		Help: "Total number of times TLS certificates have been reloaded after a change of their files.",
+	})); err != nil {
+		return nil, err
+	}
+	if r.reloadErrorsTotal, err = registerOrExisting(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tls_certificate_reload_errors_total",
+		Help: "Total number of failures reloading TLS certificates.",
+	})); err != nil {
+		return nil, err
+	}
+	if r.expiryTimestamp, err = registerOrExisting(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_certificate_expiry_timestamp_seconds",
+		Help: "Timestamp when the loaded TLS certificate expires. For CA certificates, the earliest expiry.",
+	}, []string{"certificate"})); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.load(time.Now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// registerOrExisting registers c with reg, or returns the collector already registered with the same
+// descriptor. If reg is nil, c is not registered.
+func registerOrExisting[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	if reg == nil {
+		return c, nil
+	}
+	if err := reg.Register(c); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, errors.Wrap(err, "failed to register TLS certificate reloader metrics")
+	}
+	return c, nil
+}
+
+// Reload checks the files for changes, and reloads the certificates if they changed. If reloading fails, the
+// previous certificates are kept.
+func (r *CertReloader) Reload() error {
+	return r.reload(time.Now())
+}
+
+func (r *CertReloader) reload(now time.Time) error {
+	changed, err := r.load(now)
+	if err != nil {
+		r.reloadErrorsTotal.Inc()
+		level.Warn(r.logger).Log("msg", "failed to reload TLS certificates, keeping the previous ones", "cert", r.cfg.CertPath, "ca", r.cfg.CAPath, "err", err)
+		return err
+	}
+	if changed {
+		r.reloadsTotal.Inc()
+		level.Info(r.logger).Log("msg", "reloaded TLS certificates", "cert", r.cfg.CertPath, "ca", r.cfg.CAPath)
+	}
+	return nil
+}
+
+// maybeReload reloads the certificates if the reload interval elapsed since the last check.
+func (r *CertReloader) maybeReload(now time.Time) {
+	r.mtx.RLock()
+	due := now.Sub(r.lastCheck) >= r.cfg.ReloadInterval
+	r.mtx.RUnlock()
+
+	if !due || !r.checking.CompareAndSwap(false, true) {
+		return
+	}
+	defer r.checking.Store(false)
+
+	// Errors are logged and tracked by reload, and the previous certificates are used meanwhile.
+	_ = r.reload(now)
+}
+
+// load reads the files, and replaces the certificates if the files changed.
+func (r *CertReloader) load(now time.Time) (bool, error) {
+	defer func() {
+		r.mtx.Lock()
+		r.lastCheck = now
+		r.mtx.Unlock()
+	}()
+
+	var certPEM, keyPEM, caPEM []byte
+	var err error
+	if r.cfg.CertPath != "" {
+		if certPEM, err = r.cfg.Reader.ReadSecret(r.cfg.CertPath); err != nil {
+			return false, errors.Wrapf(err, "error loading cert: %s", r.cfg.CertPath)
+		}
+		if keyPEM, err = r.cfg.Reader.ReadSecret(r.cfg.KeyPath); err != nil {
+			return false, errors.Wrapf(err, "error loading key: %s", r.cfg.KeyPath)
+		}
+	}
+	if r.cfg.CAPath != "" {
+		if caPEM, err = r.cfg.Reader.ReadSecret(r.cfg.CAPath); err != nil {
+			return false, errors.Wrapf(err, "error loading ca cert: %s", r.cfg.CAPath)
+		}
+	}
+
+	h := sha256.New()
+	for _, data := range [][]byte{certPEM, keyPEM, caPEM} {
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	var hash [sha256.Size]byte
+	copy(hash[:], h.Sum(nil))
+
+	r.mtx.RLock()
+	unchanged := hash == r.hash
+	r.mtx.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CertPath != "" {
+		c, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to load TLS certificate %s,%s", r.cfg.CertPath, r.cfg.KeyPath)
+		}
+		leaf, err := x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to parse TLS certificate %s", r.cfg.CertPath)
+		}
+		c.Leaf = leaf
+		cert = &c
+	}
+
+	var caPool *x509.CertPool
+	var caExpiry time.Time
+	if r.cfg.CAPath != "" {
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caPEM) {
+			return false, errors.Errorf("no CA certificates found in %s", r.cfg.CAPath)
+		}
+		caExpiry = earliestExpiry(caPEM)
+	}
+
+	r.mtx.Lock()
+	r.cert = cert
+	r.caPool = caPool
+	r.hash = hash
+	r.mtx.Unlock()
+
+	if cert != nil {
+		r.expiryTimestamp.WithLabelValues("cert").Set(float64(cert.Leaf.NotAfter.Unix()))
+	}
+	if !caExpiry.IsZero() {
+		r.expiryTimestamp.WithLabelValues("ca").Set(float64(caExpiry.Unix()))
+	}
+	return true, nil
+}
+
+// earliestExpiry returns the earliest expiry of the certificates in data, or zero if there are none.
+func earliestExpiry(data []byte) time.Time {
+	var result time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return result
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if result.IsZero() || c.NotAfter.Before(result) {
+			result = c.NotAfter
+		}
+	}
+}
+
+// Certificate returns the current certificate, or nil if no certificate is configured.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.maybeReload(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert
+}
+
+// CAPool returns the current CA certificates, or nil if no CA certificates are configured.
+func (r *CertReloader) CAPool() *x509.CertPool {
+	r.maybeReload(time.Now())
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.caPool
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate, to serve the current certificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("no TLS certificate configured")
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate, to authenticate with the current certificate.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	// An empty certificate means no client certificate is sent.
+	return &tls.Certificate{}, nil
+}
+
+// VerifyConnection can be used as tls.Config.VerifyConnection by clients, to verify the server certificate against
+// the current CA certificates. Since the standard verification uses tls.Config.RootCAs, which can't be reloaded,
+// InsecureSkipVerify must be set to skip it. Connections without peer certificates, such as connections accepted
+// by a server using the same config, aren't verified.
+func (r *CertReloader) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.CAPool(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// GetConfigForClient returns a function which can be used as tls.Config.GetConfigForClient by servers, to serve the
+// current certificate and verify client certificates against the current CA certificates. Returned configs are
+// copies of base.
+func (r *CertReloader) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		if r.cfg.CertPath != "" {
+			c.GetCertificate = r.GetCertificate
+		}
+		if r.cfg.CAPath != "" {
+			c.ClientCAs = r.CAPool()
+		}
+		return c, nil
+	}
+}
@@ -0,0 +1,282 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{name}},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// newCertificate returns a certificate for localhost signed by the CA, and its key.
+func (ca *testCA) newCertificate(t *testing.T, serial int64, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeTestX509Files(t *testing.T, paths x509Paths, cert, key, ca []byte) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(paths.cert, cert, 0600))
+	require.NoError(t, os.WriteFile(paths.key, key, 0600))
+	require.NoError(t, os.WriteFile(paths.ca, ca, 0600))
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	expiry1 := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	cert1, key1 := ca.newCertificate(t, 1, expiry1)
+	paths := newTestX509Files(t, cert1, key1, ca.certPEM)
+
+	reg := prometheus.NewPedanticRegistry()
+	r, err := NewCertReloader(CertReloaderConfig{
+		CertPath: paths.cert,
+		KeyPath:  paths.key,
+		CAPath:   paths.ca,
+	}, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+
+	require.Equal(t, int64(1), r.Certificate().Leaf.SerialNumber.Int64())
+	require.NotNil(t, r.CAPool())
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP tls_certificate_expiry_timestamp_seconds Timestamp when the loaded TLS certificate expires. For CA certificates, the earliest expiry.
+		# TYPE tls_certificate_expiry_timestamp_seconds gauge
+		tls_certificate_expiry_timestamp_seconds{certificate="ca"} `+strconv.FormatInt(ca.cert.NotAfter.Unix(), 10)+`
+		tls_certificate_expiry_timestamp_seconds{certificate="cert"} `+strconv.FormatInt(expiry1.Unix(), 10)+`
+	`), "tls_certificate_expiry_timestamp_seconds"))
+
+	// A key not matching the certificate, as seen while files are being rotated, keeps the previous certificate.
+	_, key2 := ca.newCertificate(t, 2, expiry1)
+	require.NoError(t, os.WriteFile(paths.key, key2, 0600))
+	require.Equal(t, int64(1), r.Certificate().Leaf.SerialNumber.Int64())
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.reloadErrorsTotal))
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.reloadsTotal))
+
+	cert3, key3 := ca.newCertificate(t, 3, expiry1.Add(time.Hour))
+	writeTestX509Files(t, paths, cert3, key3, ca.certPEM)
+	require.Equal(t, int64(3), r.Certificate().Leaf.SerialNumber.Int64())
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.reloadErrorsTotal))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.reloadsTotal))
+	assert.Equal(t, float64(expiry1.Add(time.Hour).Unix()), testutil.ToFloat64(r.expiryTimestamp.WithLabelValues("cert")))
+
+	// Unchanged files are not reloaded.
+	require.Equal(t, int64(3), r.Certificate().Leaf.SerialNumber.Int64())
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.reloadsTotal))
+}
+
+func TestCertReloader_ReloadInterval(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	cert1, key1 := ca.newCertificate(t, 1, time.Now().Add(time.Hour))
+	paths := newTestX509Files(t, cert1, key1, ca.certPEM)
+
+	r, err := NewCertReloader(CertReloaderConfig{
+		CertPath:       paths.cert,
+		KeyPath:        paths.key,
+		ReloadInterval: time.Minute,
+	}, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	cert2, key2 := ca.newCertificate(t, 2, time.Now().Add(time.Hour))
+	writeTestX509Files(t, paths, cert2, key2, ca.certPEM)
+	r.maybeReload(time.Now())
+	require.Equal(t, int64(1), r.Certificate().Leaf.SerialNumber.Int64())
+
+	r.maybeReload(time.Now().Add(time.Minute))
+	require.Equal(t, int64(2), r.Certificate().Leaf.SerialNumber.Int64())
+}
+
+func TestCertReloader_SharedRegisterer(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	cert, key := ca.newCertificate(t, 1, time.Now().Add(time.Hour))
+	paths := newTestX509Files(t, cert, key, ca.certPEM)
+
+	// Clients, like gRPC clients, create a reloader for each connection with the same registerer.
+	reg := prometheus.NewPedanticRegistry()
+	cfg := ClientConfig{CertPath: paths.cert, KeyPath: paths.key, ReloadInterval: time.Minute, Registerer: reg}
+	for i := 0; i < 2; i++ {
+		_, err := cfg.GetGRPCDialOptions(true)
+		require.NoError(t, err)
+	}
+
+	r1, err := NewCertReloader(CertReloaderConfig{CertPath: paths.cert, KeyPath: paths.key}, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	r2, err := NewCertReloader(CertReloaderConfig{CertPath: paths.cert, KeyPath: paths.key}, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	assert.Same(t, r1.reloadsTotal, r2.reloadsTotal, "reloaders registering with the same labels share their metrics")
+
+	count, err := testutil.GatherAndCount(reg, "tls_certificate_reloads_total")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestCertReloader_RegisterersWithDistinctNames(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	cert, key := ca.newCertificate(t, 1, time.Now().Add(time.Hour))
+	paths := newTestX509Files(t, cert, key, ca.certPEM)
+	cfg := CertReloaderConfig{CertPath: paths.cert, KeyPath: paths.key}
+
+	// Like the server, memberlist and cache clients sharing a registry.
+	reg := prometheus.NewPedanticRegistry()
+	for _, name := range []string{"grpc", "memberlist", "results-cache"} {
+		_, err := NewCertReloader(cfg, log.NewNopLogger(), prometheus.WrapRegistererWith(prometheus.Labels{"name": name}, reg))
+		require.NoError(t, err)
+	}
+	count, err := testutil.GatherAndCount(reg, "tls_certificate_reloads_total")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Inconsistent label names are rejected with an error.
+	_, err = NewCertReloader(cfg, log.NewNopLogger(), prometheus.WrapRegistererWith(prometheus.Labels{"name": "cache", "backend": "redis"}, reg))
+	assert.ErrorContains(t, err, "failed to register TLS certificate reloader metrics")
+}
+
+func TestCertReloader_InvalidFiles(t *testing.T) {
+	paths := newTestX509Files(t, []byte(certPEM), []byte(keyPEM), []byte("not a certificate"))
+
+	_, err := NewCertReloader(CertReloaderConfig{CertPath: paths.cert}, log.NewNopLogger(), nil)
+	assert.EqualError(t, err, errKeyMissing.Error())
+
+	_, err = NewCertReloader(CertReloaderConfig{CAPath: paths.ca}, log.NewNopLogger(), nil)
+	assert.ErrorContains(t, err, "no CA certificates found")
+
+	_, err = NewCertReloader(CertReloaderConfig{CertPath: paths.key, KeyPath: paths.cert}, log.NewNopLogger(), nil)
+	assert.ErrorContains(t, err, "failed to load TLS certificate")
+}
+
+func TestGetTLSConfig_ReloadInterval(t *testing.T) {
+	ca1 := newTestCA(t, "ca1")
+	serverCert1, serverKey1 := ca1.newCertificate(t, 1, time.Now().Add(time.Hour))
+	clientCert1, clientKey1 := ca1.newCertificate(t, 2, time.Now().Add(time.Hour))
+	serverPaths := newTestX509Files(t, serverCert1, serverKey1, ca1.certPEM)
+	clientPaths := newTestX509Files(t, clientCert1, clientKey1, ca1.certPEM)
+
+	// The server requires client certificates signed by the reloaded CA.
+	serverReloader, err := NewCertReloader(CertReloaderConfig{
+		CertPath: serverPaths.cert,
+		KeyPath:  serverPaths.key,
+		CAPath:   serverPaths.ca,
+	}, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetConfigForClient: serverReloader.GetConfigForClient(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	serverErrs := make(chan error)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			serverErrs <- conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	cfg := ClientConfig{
+		CertPath:       clientPaths.cert,
+		KeyPath:        clientPaths.key,
+		CAPath:         clientPaths.ca,
+		ServerName:     "localhost",
+		ReloadInterval: time.Nanosecond,
+	}
+	clientConfig, err := cfg.GetTLSConfig()
+	require.NoError(t, err)
+
+	handshake := func() error {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err != nil {
+			<-serverErrs
+			return err
+		}
+		defer conn.Close()
+		return <-serverErrs
+	}
+	require.NoError(t, handshake())
+
+	// Rotate all certificates to a new CA. Existing configs use the new certificates.
+	ca2 := newTestCA(t, "ca2")
+	serverCert2, serverKey2 := ca2.newCertificate(t, 3, time.Now().Add(time.Hour))
+	clientCert2, clientKey2 := ca2.newCertificate(t, 4, time.Now().Add(time.Hour))
+	writeTestX509Files(t, serverPaths, serverCert2, serverKey2, ca2.certPEM)
+	writeTestX509Files(t, clientPaths, clientCert2, clientKey2, ca2.certPEM)
+	require.NoError(t, handshake())
+
+	// A server certificate signed by a CA which is not trusted anymore is rejected.
+	writeTestX509Files(t, serverPaths, serverCert1, serverKey1, ca2.certPEM)
+	require.Error(t, handshake())
+}
+
+func TestGetTLSConfig_ReloadIntervalInsecureSkipVerify(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	paths := newTestX509Files(t, nil, nil, ca.certPEM)
+
+	cfg := ClientConfig{CAPath: paths.ca, InsecureSkipVerify: true, ReloadInterval: time.Minute}
+	tlsConfig, err := cfg.GetTLSConfig()
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.VerifyConnection, "server certificates are not verified")
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
@@ -34,7 +37,14 @@ type ClientConfig struct {
 	CipherSuites       string `yaml:"tls_cipher_suites" category:"advanced" doc:"description_method=GetTLSCipherSuitesLongDescription"`
 	MinVersion         string `yaml:"tls_min_version" category:"advanced"`
 
+	ReloadInterval time.Duration `yaml:"tls_reload_interval" category:"experimental"`
+
 	Reader SecretReader `yaml:"-"`
+
+	// Logger and Registerer are used by the certificate reloader, when ReloadInterval is set. Registerer should
+	// be wrapped with a "name" label distinguishing this config from other ones registering with the same registry.
+	Logger     log.Logger            `yaml:"-"`
+	Registerer prometheus.Registerer `yaml:"-"`
 }
 
 var (
@@ -61,6 +71,7 @@ func (cfg *ClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet)
 	f.BoolVar(&cfg.InsecureSkipVerify, prefix+".tls-insecure-skip-verify", false, "Skip validating server certificate.")
 	f.StringVar(&cfg.CipherSuites, prefix+".tls-cipher-suites", "", cfg.GetTLSCipherSuitesShortDescription())
 	f.StringVar(&cfg.MinVersion, prefix+".tls-min-version", "", "Override the default minimum TLS version. Allowed values: VersionTLS10, VersionTLS11, VersionTLS12, VersionTLS13")
+	f.DurationVar(&cfg.ReloadInterval, prefix+".tls-reload-interval", 0, "How often to check the certificate, key and CA files for changes, and reload them. Files are checked when establishing connections. 0 to load the certificates only once.")
 }
 
 func (cfg *ClientConfig) GetTLSCipherSuitesShortDescription() string {
@@ -172,9 +183,47 @@ func (cfg *ClientConfig) GetTLSConfig() (*tls.Config, error) {
 		config.CipherSuites = cipherSuites
 	}
 
+	if cfg.ReloadInterval > 0 {
+		if err := cfg.setupReloader(config, reader); err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
 
+// setupReloader makes config use certificates reloaded when their files change.
+func (cfg *ClientConfig) setupReloader(config *tls.Config, reader SecretReader) error {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	reloader, err := NewCertReloader(CertReloaderConfig{
+		CertPath:       cfg.CertPath,
+		KeyPath:        cfg.KeyPath,
+		CAPath:         cfg.CAPath,
+		Reader:         reader,
+		ReloadInterval: cfg.ReloadInterval,
+	}, logger, cfg.Registerer)
+	if err != nil {
+		return err
+	}
+
+	if cfg.CertPath != "" {
+		config.GetClientCertificate = reloader.GetClientCertificate
+		// Servers prefer GetCertificate over Certificates.
+		config.GetCertificate = reloader.GetCertificate
+	}
+	if cfg.CAPath != "" && !cfg.InsecureSkipVerify {
+		// The standard verification only uses the CA certificates loaded initially into RootCAs, so it's replaced by
+		// a verification against the reloaded ones.
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = reloader.VerifyConnection
+	}
+	return nil
+}
+
 // GetGRPCDialOptions creates GRPC DialOptions for TLS
 func (cfg *ClientConfig) GetGRPCDialOptions(enabled bool) ([]grpc.DialOption, error) {
 	if !enabled {
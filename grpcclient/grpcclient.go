@@ -37,8 +37,10 @@ type Config struct {
 	InitialStreamWindowSize     flagext.Bytes `yaml:"initial_stream_window_size" category:"experimental"`
 	InitialConnectionWindowSize flagext.Bytes `yaml:"initial_connection_window_size" category:"experimental"`
 
-	TLSEnabled bool             `yaml:"tls_enabled" category:"advanced"`
-	TLS        tls.ClientConfig `yaml:",inline"`
+	TLSEnabled bool `yaml:"tls_enabled" category:"advanced"`
+	// TLS.Logger and TLS.Registerer are used when certificate reloading is enabled. Clients created with the same
+	// registerer share their certificate reloading metrics, unless it's wrapped with a distinct "name" label.
+	TLS tls.ClientConfig `yaml:",inline"`
 
 	ConnectTimeout time.Duration `yaml:"connect_timeout" category:"advanced"`
 	// https://github.com/grpc/grpc/blob/master/doc/connection-backoff.md
@@ -144,11 +146,12 @@ func (cfg *Config) DialOption(unaryClientInterceptors []grpc.UnaryClientIntercep
 		unaryClientInterceptors = append([]grpc.UnaryClientInterceptor{NewRateLimiter(cfg)}, unaryClientInterceptors...)
 	}
 
-	// If cluster validation is enabled, ClusterUnaryClientInterceptor must be the last UnaryClientInterceptor
-	// to wrap the real call.
+	// If cluster validation is enabled, ClusterUnaryClientInterceptor and ClusterStreamClientInterceptor must be
+	// the last interceptors to wrap the real call.
 	if cfg.ClusterValidation.Label != "" {
 		cfg.clusterUnaryClientInterceptor = middleware.ClusterUnaryClientInterceptor(cfg.ClusterValidation.Label, invalidClusterValidationReporter)
 		unaryClientInterceptors = append(unaryClientInterceptors, cfg.clusterUnaryClientInterceptor)
+		streamClientInterceptors = append(streamClientInterceptors, middleware.ClusterStreamClientInterceptor(cfg.ClusterValidation.Label, invalidClusterValidationReporter))
 	}
 
 	if cfg.ConnectTimeout > 0 {
@@ -0,0 +1,826 @@
+package memberlist
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/memberlist"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/dskit/grpcclient"
+	"github.com/grafana/dskit/netutil"
+)
+
+// grpcTransportMaxChunkSize is the max size of the data carried by a single TransportMessage.
+// Larger packets and stream writes are split into multiple messages, so that they fit within
+// the gRPC max message size limits.
+const grpcTransportMaxChunkSize = 1 << 20
+
+// grpcConnCloseTimeout is the max time to wait for the other side to terminate a stream after it has been closed locally.
+const grpcConnCloseTimeout = 5 * time.Second
+
+// GRPCTransportConfig is a configuration structure for creating new GRPCTransport.
+type GRPCTransportConfig struct {
+	// Timeout used when making connections to other nodes to send packet.
+	// Zero = no timeout
+	PacketDialTimeout time.Duration `yaml:"packet_dial_timeout" category:"advanced"`
+
+	// Timeout for writing packet data. Zero = no timeout.
+	PacketWriteTimeout time.Duration `yaml:"packet_write_timeout" category:"advanced"`
+
+	// Maximum number of concurrent writes to other nodes.
+	MaxConcurrentWrites int `yaml:"max_concurrent_writes" category:"advanced"`
+
+	// Timeout for acquiring one of the concurrent write slots.
+	AcquireWriterTimeout time.Duration `yaml:"acquire_writer_timeout" category:"advanced"`
+
+	// Transport logs lots of messages at debug level, so it deserves an extra flag for turning it on
+	TransportDebug bool `yaml:"-" category:"advanced"`
+
+	// Where to put custom metrics. nil = don't register.
+	MetricsNamespace string `yaml:"-"`
+
+	// Configures the gRPC clients used to connect to other nodes, including TLS and cluster validation.
+	GRPCClientConfig grpcclient.Config `yaml:"grpc_client_config"`
+}
+
+func (cfg *GRPCTransportConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.RegisterFlagsWithPrefix(f, "")
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *GRPCTransportConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.DurationVar(&cfg.PacketDialTimeout, prefix+"memberlist.grpc-transport.packet-dial-timeout", 2*time.Second, "Timeout used when connecting to other nodes to send packet.")
+	f.DurationVar(&cfg.PacketWriteTimeout, prefix+"memberlist.grpc-transport.packet-write-timeout", 5*time.Second, "Timeout for writing 'packet' data.")
+	f.IntVar(&cfg.MaxConcurrentWrites, prefix+"memberlist.grpc-transport.max-concurrent-writes", 3, "Maximum number of concurrent writes to other nodes.")
+	f.DurationVar(&cfg.AcquireWriterTimeout, prefix+"memberlist.grpc-transport.acquire-writer-timeout", 250*time.Millisecond, "Timeout for acquiring one of the concurrent write slots. After this time, the message will be dropped.")
+	f.BoolVar(&cfg.TransportDebug, prefix+"memberlist.grpc-transport.transport-debug", false, "Log debug transport messages. Note: global log.level must be at debug level as well.")
+
+	cfg.GRPCClientConfig.RegisterFlagsWithPrefix(prefix+"memberlist.grpc-transport.grpc-client", f)
+}
+
+func (cfg *GRPCTransportConfig) Validate() error {
+	return cfg.GRPCClientConfig.Validate()
+}
+
+// GRPCTransportStreamMethod is the full name of the gRPC method used by GRPCTransport.
+const GRPCTransportStreamMethod = "/memberlist.MemberlistTransport/Stream"
+
+// GRPCTransport is a memberlist.Transport implementation that tunnels both packet and stream
+// operations ("packet" and "stream" are terms used by memberlist) over bidirectional gRPC streams.
+// It registers the MemberlistTransport service on an existing gRPC server, typically the one
+// of server.Server, so that memberlist doesn't need its own listening port. The TLS configured on
+// that gRPC server applies to memberlist traffic too, and so does the gRPC cluster validation of
+// server.Server, which always checks GRPCTransportStreamMethod when enabled.
+//
+// Each packet and each memberlist stream is sent over a new gRPC stream, while gRPC connections
+// to other nodes are reused.
+type GRPCTransport struct {
+	cfg        GRPCTransportConfig
+	logger     log.Logger
+	listenAddr net.Addr
+	dialOpts   []grpc.DialOption
+	packetCh   chan *memberlist.Packet
+	connCh     chan net.Conn
+
+	shutdownMu sync.RWMutex
+	shutdown   bool
+	shutdownCh chan struct{}     // closed on shutdown, protected by shutdownMu
+	writeCh    chan writeRequest // this channel is protected by shutdownMu
+
+	writeWG sync.WaitGroup
+
+	connsMu sync.Mutex
+	conns   map[string]*grpc.ClientConn
+
+	advertiseMu   sync.RWMutex
+	advertiseAddr string
+
+	// metrics
+	incomingStreams      prometheus.Counter
+	outgoingStreams      prometheus.Counter
+	outgoingStreamErrors prometheus.Counter
+
+	receivedPackets       prometheus.Counter
+	receivedPacketsBytes  prometheus.Counter
+	receivedPacketsErrors prometheus.Counter
+	sentPackets           prometheus.Counter
+	sentPacketsBytes      prometheus.Counter
+	sentPacketsErrors     prometheus.Counter
+	droppedPackets        prometheus.Counter
+	unknownConnections    prometheus.Counter
+}
+
+// NewGRPCTransport returns a new gRPC-based transport with the given configuration, and registers
+// it on the given gRPC server. listenAddr is the address the gRPC server is listening on, and is
+// used to compute the address advertised to other members.
+//
+// NewGRPCTransport must be called before the gRPC server starts serving requests.
+func NewGRPCTransport(config GRPCTransportConfig, grpcServer *grpc.Server, listenAddr net.Addr, logger log.Logger, registerer prometheus.Registerer) (*GRPCTransport, error) {
+	if grpcServer == nil {
+		return nil, errors.New("no gRPC server provided")
+	}
+	if listenAddr == nil {
+		return nil, errors.New("no listen address provided")
+	}
+
+	concurrentWrites := config.MaxConcurrentWrites
+	if concurrentWrites <= 0 {
+		concurrentWrites = 1
+	}
+
+	t := &GRPCTransport{
+		cfg:        config,
+		logger:     log.With(logger, "component", "memberlist GRPCTransport"),
+		listenAddr: listenAddr,
+		packetCh:   make(chan *memberlist.Packet),
+		connCh:     make(chan net.Conn),
+		shutdownCh: make(chan struct{}),
+		writeCh:    make(chan writeRequest),
+		conns:      map[string]*grpc.ClientConn{},
+	}
+
+	var err error
+	t.dialOpts, err = config.GRPCClientConfig.DialOption(nil, nil, t.reportInvalidClusterValidation)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create gRPC dial options")
+	}
+
+	t.registerMetrics(registerer)
+
+	for i := 0; i < concurrentWrites; i++ {
+		t.writeWG.Add(1)
+		go t.writeWorker()
+	}
+
+	RegisterMemberlistTransportServer(grpcServer, t)
+	return t, nil
+}
+
+func (t *GRPCTransport) reportInvalidClusterValidation(msg string, method string) {
+	level.Warn(t.logger).Log("msg", msg, "method", method)
+}
+
+func (t *GRPCTransport) debugLog() log.Logger {
+	if t.cfg.TransportDebug {
+		return level.Debug(t.logger)
+	}
+	return noopLogger
+}
+
+// Stream implements MemberlistTransportServer.
+func (t *GRPCTransport) Stream(stream MemberlistTransport_StreamServer) error {
+	if t.isShutdown() {
+		return status.Error(codes.Unavailable, "transport is shutting down")
+	}
+
+	remote := addr("unknown")
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remote = addr(p.Addr.String())
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		level.Warn(t.logger).Log("msg", "failed to read message type", "err", err, "remote", remote)
+		return err
+	}
+
+	switch msg.Type {
+	case STREAM_MESSAGE:
+		return t.handleStream(stream, msg, remote)
+	case PACKET_MESSAGE:
+		return t.handlePacket(stream, msg, remote)
+	default:
+		t.unknownConnections.Inc()
+		level.Error(t.logger).Log("msg", "unknown message type", "msgType", msg.Type, "remote", remote)
+		return status.Errorf(codes.InvalidArgument, "unknown message type %v", msg.Type)
+	}
+}
+
+func (t *GRPCTransport) handleStream(stream MemberlistTransport_StreamServer, first *TransportMessage, remote addr) error {
+	t.debugLog().Log("msg", "New stream", "addr", remote)
+	t.incomingStreams.Inc()
+
+	conn := newGRPCConn(stream, t.listenAddr, remote)
+	conn.readBuf = first.Data
+
+	// Hand over this connection to memberlist.
+	select {
+	case t.connCh <- conn:
+	case <-t.shutdownCh:
+		return status.Error(codes.Unavailable, "transport is shutting down")
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+
+	// The gRPC stream is terminated as soon as this handler returns, so we wait until memberlist
+	// is done with the connection.
+	select {
+	case <-conn.closed:
+	case <-stream.Context().Done():
+		_ = conn.Close()
+	}
+	return nil
+}
+
+func (t *GRPCTransport) handlePacket(stream MemberlistTransport_StreamServer, first *TransportMessage, remote addr) error {
+	// It's a memberlist "packet", which contains the address of the sender and data, possibly
+	// split across multiple messages.
+	t.receivedPackets.Inc()
+
+	from := first.From
+	buf := first.Data
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.receivedPacketsErrors.Inc()
+			level.Warn(t.logger).Log("msg", "error while reading packet data", "err", err, "remote", remote)
+			return err
+		}
+		buf = append(buf, msg.Data...)
+	}
+
+	if from == "" {
+		t.receivedPacketsErrors.Inc()
+		level.Warn(t.logger).Log("msg", "received packet without node address", "remote", remote)
+		return status.Error(codes.InvalidArgument, "missing node address")
+	}
+
+	t.debugLog().Log("msg", "Received packet", "addr", from, "size", len(buf))
+	t.receivedPacketsBytes.Add(float64(len(buf)))
+
+	select {
+	case t.packetCh <- &memberlist.Packet{
+		Buf:       buf,
+		From:      addr(from),
+		Timestamp: time.Now(),
+	}:
+	case <-t.shutdownCh:
+		return status.Error(codes.Unavailable, "transport is shutting down")
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+	return nil
+}
+
+func (t *GRPCTransport) isShutdown() bool {
+	t.shutdownMu.RLock()
+	defer t.shutdownMu.RUnlock()
+	return t.shutdown
+}
+
+// getClient returns a client for the given address, reusing an existing gRPC connection if there's one.
+func (t *GRPCTransport) getClient(addr string) (MemberlistTransportClient, error) {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+
+	if t.conns == nil {
+		return nil, errors.New("transport is shutting down")
+	}
+
+	conn, ok := t.conns[addr]
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(addr, t.dialOpts...)
+		if err != nil {
+			return nil, err
+		}
+		t.conns[addr] = conn
+	}
+	return NewMemberlistTransportClient(conn), nil
+}
+
+// handleClientError closes the gRPC connection to the given address if the error means that the
+// node is unavailable. This prevents connections to nodes that left the cluster from piling up.
+func (t *GRPCTransport) handleClientError(addr string, err error) {
+	if status.Code(err) != codes.Unavailable {
+		return
+	}
+
+	t.connsMu.Lock()
+	conn, ok := t.conns[addr]
+	delete(t.conns, addr)
+	t.connsMu.Unlock()
+
+	if ok {
+		_ = conn.Close()
+	}
+}
+
+// FinalAdvertiseAddr is given the user's configured values (which
+// might be empty) and returns the desired IP and port to advertise to
+// the rest of the cluster.
+func (t *GRPCTransport) FinalAdvertiseAddr(ip string, port int) (net.IP, int, error) {
+	listenAddr, ok := t.listenAddr.(*net.TCPAddr)
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported listen address %q", t.listenAddr)
+	}
+
+	var advertiseAddr net.IP
+	advertisePort := listenAddr.Port
+	if ip != "" {
+		// If they've supplied an address, use that.
+		advertiseAddr = net.ParseIP(ip)
+		if advertiseAddr == nil {
+			return nil, 0, fmt.Errorf("failed to parse advertise address %q", ip)
+		}
+		if port > 0 {
+			advertisePort = port
+		}
+	} else if listenAddr.IP.IsUnspecified() {
+		// Otherwise, if we're not bound to a specific IP, let's use a suitable private IP address,
+		// falling back to an inet6 address.
+		var err error
+		ip, err = sockaddr.GetPrivateIP()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get interface addresses: %v", err)
+		}
+		if ip == "" {
+			ip, err = netutil.GetFirstAddressOf(nil, t.logger, true)
+			if err != nil {
+				return nil, 0, fmt.Errorf("no private IP address found, and explicit IP not provided: %w", err)
+			}
+		}
+
+		advertiseAddr = net.ParseIP(ip)
+		if advertiseAddr == nil {
+			return nil, 0, fmt.Errorf("failed to parse advertise address %q", ip)
+		}
+	} else {
+		// Use the IP that the gRPC server is bound to.
+		advertiseAddr = listenAddr.IP
+	}
+
+	level.Debug(t.logger).Log("msg", "FinalAdvertiseAddr", "advertiseAddr", advertiseAddr.String(), "advertisePort", advertisePort)
+
+	t.advertiseMu.Lock()
+	defer t.advertiseMu.Unlock()
+	t.advertiseAddr = net.JoinHostPort(advertiseAddr.String(), fmt.Sprint(advertisePort))
+	return advertiseAddr, advertisePort, nil
+}
+
+func (t *GRPCTransport) getAdvertisedAddr() string {
+	t.advertiseMu.RLock()
+	defer t.advertiseMu.RUnlock()
+	return t.advertiseAddr
+}
+
+// WriteTo is a packet-oriented interface that fires off the given
+// payload to the given address.
+func (t *GRPCTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+	t.shutdownMu.RLock()
+	defer t.shutdownMu.RUnlock() // Unlock at the end to protect the chan
+	if t.shutdown {
+		return time.Time{}, errors.New("transport is shutting down")
+	}
+
+	// Send the packet to the write workers
+	// If this blocks for too long (as configured), abort and log an error.
+	select {
+	case <-time.After(t.cfg.AcquireWriterTimeout):
+		// Dropped packets are not an issue, the memberlist protocol will retry later.
+		level.Debug(t.logger).Log("msg", "WriteTo failed to acquire a writer. Dropping message", "timeout", t.cfg.AcquireWriterTimeout, "addr", addr)
+		t.droppedPackets.Inc()
+		// WriteTo is used to send "UDP" packets, and memberlist library doesn't cope very well
+		// with errors returned here. That is why we return nil instead.
+		return time.Now(), nil
+	case t.writeCh <- writeRequest{b: b, addr: addr}:
+		// OK
+	}
+
+	return time.Now(), nil
+}
+
+func (t *GRPCTransport) writeWorker() {
+	defer t.writeWG.Done()
+	for req := range t.writeCh {
+		b, addr := req.b, req.addr
+		t.sentPackets.Inc()
+		t.sentPacketsBytes.Add(float64(len(b)))
+		err := t.writeTo(b, addr)
+		if err != nil {
+			t.sentPacketsErrors.Inc()
+			t.handleClientError(addr, err)
+
+			logLevel := level.Warn(t.logger)
+			if status.Code(err) == codes.Unavailable || strings.Contains(err.Error(), "connection refused") {
+				// The node being unavailable is a common error that could happen during normal operations when a node
+				// shutdown (or crash). It shouldn't be considered a warning condition on the sender side.
+				logLevel = t.debugLog()
+			}
+			logLevel.Log("msg", "WriteTo failed", "addr", addr, "err", err)
+		}
+	}
+}
+
+func (t *GRPCTransport) writeTo(b []byte, addr string) error {
+	client, err := t.getClient(addr)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if timeout := t.cfg.PacketDialTimeout + t.cfg.PacketWriteTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	stream, err := client.Stream(ctx)
+	if err != nil {
+		return err
+	}
+
+	// We need to send our address to the other side, otherwise other side can only see IP and port
+	// of the gRPC connection, which doesn't match our node address and confuses memberlist.
+	first := &TransportMessage{Type: PACKET_MESSAGE, From: t.getAdvertisedAddr()}
+	if err := sendChunked(stream, first, b); err != nil {
+		return fmt.Errorf("sending data: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	// Wait until the other side has received the whole packet.
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("receiving ack: %w", err)
+	}
+
+	t.debugLog().Log("msg", "WriteTo: packet sent", "addr", addr, "size", len(b))
+	return nil
+}
+
+// PacketCh returns a channel that can be read to receive incoming
+// packets from other peers.
+func (t *GRPCTransport) PacketCh() <-chan *memberlist.Packet {
+	return t.packetCh
+}
+
+// DialTimeout is used to create a connection that allows memberlist to perform
+// two-way communication with a peer.
+func (t *GRPCTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	t.outgoingStreams.Inc()
+
+	conn, err := t.dialStream(addr, timeout)
+	if err != nil {
+		t.outgoingStreamErrors.Inc()
+		t.handleClientError(addr, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *GRPCTransport) dialStream(remote string, timeout time.Duration) (net.Conn, error) {
+	client, err := t.getClient(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// The context lives as long as the connection, so we can't use a context with timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+
+	stream, err := client.Stream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := stream.Send(&TransportMessage{Type: STREAM_MESSAGE, From: t.getAdvertisedAddr()}); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	conn := newGRPCConn(stream, addr(t.getAdvertisedAddr()), addr(remote))
+	conn.closeSend = stream.CloseSend
+	conn.cancel = cancel
+	return conn, nil
+}
+
+// StreamCh returns a channel that can be read to handle incoming stream
+// connections from other peers.
+func (t *GRPCTransport) StreamCh() <-chan net.Conn {
+	return t.connCh
+}
+
+// Shutdown is called when memberlist is shutting down; this gives the
+// transport a chance to clean up the gRPC connections to other nodes.
+// The MemberlistTransport service remains registered on the gRPC server,
+// but rejects all requests after shutdown.
+func (t *GRPCTransport) Shutdown() error {
+	t.shutdownMu.Lock()
+	if t.shutdown {
+		t.shutdownMu.Unlock()
+		return nil // already shut down
+	}
+
+	// Set the shutdown flag and close the write channel.
+	t.shutdown = true
+	close(t.writeCh)
+	close(t.shutdownCh)
+	t.shutdownMu.Unlock()
+
+	// Wait until all write workers have finished.
+	t.writeWG.Wait()
+
+	t.connsMu.Lock()
+	conns := t.conns
+	t.conns = nil
+	t.connsMu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	return nil
+}
+
+func (t *GRPCTransport) registerMetrics(registerer prometheus.Registerer) {
+	const subsystem = "memberlist_grpc_transport"
+
+	t.incomingStreams = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "incoming_streams_total",
+		Help:      "Number of incoming memberlist streams",
+	})
+
+	t.outgoingStreams = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "outgoing_streams_total",
+		Help:      "Number of outgoing streams",
+	})
+
+	t.outgoingStreamErrors = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "outgoing_stream_errors_total",
+		Help:      "Number of errors when opening memberlist stream to another node",
+	})
+
+	t.receivedPackets = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_received_total",
+		Help:      "Number of received memberlist packets",
+	})
+
+	t.receivedPacketsBytes = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_received_bytes_total",
+		Help:      "Total bytes received as packets",
+	})
+
+	t.receivedPacketsErrors = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_received_errors_total",
+		Help:      "Number of errors when receiving memberlist packets",
+	})
+
+	t.droppedPackets = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_dropped_total",
+		Help:      "Number of dropped memberlist packets. These packets were not sent due to timeout waiting for a writer.",
+	})
+
+	t.sentPackets = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_sent_total",
+		Help:      "Number of memberlist packets sent",
+	})
+
+	t.sentPacketsBytes = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_sent_bytes_total",
+		Help:      "Total bytes sent as packets",
+	})
+
+	t.sentPacketsErrors = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "packets_sent_errors_total",
+		Help:      "Number of errors when sending memberlist packets",
+	})
+
+	t.unknownConnections = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: t.cfg.MetricsNamespace,
+		Subsystem: subsystem,
+		Name:      "unknown_connections_total",
+		Help:      "Number of unknown gRPC streams (not a packet or stream)",
+	})
+}
+
+// transportStream is implemented by both the client and server side of the MemberlistTransport gRPC stream.
+type transportStream interface {
+	Send(*TransportMessage) error
+	Recv() (*TransportMessage, error)
+}
+
+// sendChunked sends data over the stream, split in chunks of at most grpcTransportMaxChunkSize bytes.
+// The first message sent is the given one, with the first chunk of data attached.
+func sendChunked(stream transportStream, first *TransportMessage, data []byte) error {
+	msg := first
+	for {
+		chunk := data
+		if len(chunk) > grpcTransportMaxChunkSize {
+			chunk = chunk[:grpcTransportMaxChunkSize]
+		}
+		msg.Data = chunk
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			return nil
+		}
+		msg = &TransportMessage{}
+	}
+}
+
+// grpcConn adapts a MemberlistTransport gRPC stream to net.Conn, as required by memberlist streams.
+type grpcConn struct {
+	stream        transportStream
+	local, remote net.Addr
+
+	// Only set on the client side of the stream.
+	closeSend func() error
+	cancel    context.CancelFunc
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	readMu  sync.Mutex
+	readBuf []byte
+
+	writeMu sync.Mutex
+
+	deadlineMu       sync.Mutex
+	deadlineTimer    *time.Timer
+	deadlineExceeded bool
+}
+
+func newGRPCConn(stream transportStream, local, remote net.Addr) *grpcConn {
+	return &grpcConn{
+		stream: stream,
+		local:  local,
+		remote: remote,
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *grpcConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.readBuf) == 0 {
+		if err := c.checkOpen(); err != nil {
+			return 0, err
+		}
+
+		msg, err := c.stream.Recv()
+		if err != nil {
+			if cerr := c.checkOpen(); cerr != nil {
+				return 0, cerr
+			}
+			return 0, err
+		}
+		c.readBuf = msg.Data
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *grpcConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	if err := sendChunked(c.stream, &TransportMessage{}, b); err != nil {
+		if cerr := c.checkOpen(); cerr != nil {
+			return 0, cerr
+		}
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// checkOpen returns an error if the connection has been closed, or its deadline has been exceeded.
+func (c *grpcConn) checkOpen() error {
+	c.deadlineMu.Lock()
+	exceeded := c.deadlineExceeded
+	c.deadlineMu.Unlock()
+	if exceeded {
+		return os.ErrDeadlineExceeded
+	}
+
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+		return nil
+	}
+}
+
+func (c *grpcConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.deadlineMu.Lock()
+		if c.deadlineTimer != nil {
+			c.deadlineTimer.Stop()
+		}
+		c.deadlineMu.Unlock()
+
+		// On the server side, closing the channel releases the gRPC handler, which terminates the stream.
+		close(c.closed)
+
+		if c.cancel != nil {
+			// On the client side, half-close the stream and wait until the other side is done with it before
+			// cancelling the context, otherwise data not yet received by the other side may be discarded.
+			timer := time.AfterFunc(grpcConnCloseTimeout, c.cancel)
+			go func() {
+				defer c.cancel()
+				defer timer.Stop()
+				c.drain()
+			}()
+		}
+	})
+	return nil
+}
+
+func (c *grpcConn) drain() {
+	// Sending and receiving messages is not safe for concurrent use, so wait for in-flight writes and reads.
+	c.writeMu.Lock()
+	_ = c.closeSend()
+	c.writeMu.Unlock()
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for {
+		if _, err := c.stream.Recv(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *grpcConn) LocalAddr() net.Addr  { return c.local }
+func (c *grpcConn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline sets the read and write deadline of the connection. Since a blocked gRPC stream
+// operation can't be interrupted without terminating the stream, the connection is closed once
+// the deadline is exceeded.
+func (c *grpcConn) SetDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+
+	if c.deadlineTimer != nil {
+		c.deadlineTimer.Stop()
+		c.deadlineTimer = nil
+	}
+	if t.IsZero() {
+		return nil
+	}
+
+	c.deadlineTimer = time.AfterFunc(time.Until(t), func() {
+		c.deadlineMu.Lock()
+		c.deadlineExceeded = true
+		c.deadlineMu.Unlock()
+		_ = c.Close()
+	})
+	return nil
+}
+
+// SetReadDeadline sets the deadline for both reads and writes, see SetDeadline.
+func (c *grpcConn) SetReadDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// SetWriteDeadline sets the deadline for both reads and writes, see SetDeadline.
+func (c *grpcConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
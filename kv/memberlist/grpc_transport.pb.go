@@ -0,0 +1,671 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: grpc_transport.proto
+
+package memberlist
+
+import (
+	bytes "bytes"
+	context "context"
+	fmt "fmt"
+	_ "github.com/gogo/protobuf/gogoproto"
+	proto "github.com/gogo/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+	reflect "reflect"
+	strconv "strconv"
+	strings "strings"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+type TransportMessageType int32
+
+const (
+	UNKNOWN_MESSAGE TransportMessageType = 0
+	PACKET_MESSAGE  TransportMessageType = 1
+	STREAM_MESSAGE  TransportMessageType = 2
+)
+
+var TransportMessageType_name = map[int32]string{
+	0: "UNKNOWN_MESSAGE",
+	1: "PACKET_MESSAGE",
+	2: "STREAM_MESSAGE",
+}
+
+var TransportMessageType_value = map[string]int32{
+	"UNKNOWN_MESSAGE": 0,
+	"PACKET_MESSAGE":  1,
+	"STREAM_MESSAGE":  2,
+}
+
+func (TransportMessageType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_9967cba66243d37d, []int{0}
+}
+
+type TransportMessage struct {
+	// Type of the gRPC stream. Only set in the first message sent by the client.
+	Type TransportMessageType `protobuf:"varint,1,opt,name=type,proto3,enum=memberlist.TransportMessageType" json:"type,omitempty"`
+	// Advertised address of the sender. Only set in the first message sent by the client.
+	From string `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	// Packet or stream data.
+	Data []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *TransportMessage) Reset()      { *m = TransportMessage{} }
+func (*TransportMessage) ProtoMessage() {}
+func (*TransportMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_9967cba66243d37d, []int{0}
+}
+func (m *TransportMessage) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TransportMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TransportMessage.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TransportMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransportMessage.Merge(m, src)
+}
+func (m *TransportMessage) XXX_Size() int {
+	return m.Size()
+}
+func (m *TransportMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransportMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransportMessage proto.InternalMessageInfo
+
+func (m *TransportMessage) GetType() TransportMessageType {
+	if m != nil {
+		return m.Type
+	}
+	return UNKNOWN_MESSAGE
+}
+
+func (m *TransportMessage) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *TransportMessage) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("memberlist.TransportMessageType", TransportMessageType_name, TransportMessageType_value)
+	proto.RegisterType((*TransportMessage)(nil), "memberlist.TransportMessage")
+}
+
+func init() { proto.RegisterFile("grpc_transport.proto", fileDescriptor_9967cba66243d37d) }
+
+var fileDescriptor_9967cba66243d37d = []byte{
+	// 307 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x90, 0xc1, 0x4a, 0xeb, 0x40,
+	0x14, 0x86, 0xe7, 0xf4, 0x96, 0xc2, 0x1d, 0xa4, 0x96, 0x69, 0x17, 0xa5, 0xc8, 0x21, 0x74, 0x15,
+	0x04, 0x53, 0xa9, 0x7d, 0x81, 0x2a, 0x41, 0xb0, 0xa4, 0x4a, 0x12, 0x71, 0x59, 0x92, 0x3a, 0x8d,
+	0x05, 0xe3, 0x84, 0xc9, 0x74, 0xd1, 0x9d, 0x8f, 0xe0, 0x63, 0xf8, 0x28, 0x2e, 0xbb, 0xec, 0xd2,
+	0x4e, 0x36, 0x2e, 0xfb, 0x08, 0xd2, 0x11, 0x23, 0x88, 0x74, 0xf7, 0x9f, 0x6f, 0xfe, 0xf9, 0x98,
+	0x39, 0xb4, 0x95, 0xc8, 0x6c, 0x3a, 0x51, 0x32, 0x7a, 0xca, 0x33, 0x21, 0x95, 0x93, 0x49, 0xa1,
+	0x04, 0xa3, 0x29, 0x4f, 0x63, 0x2e, 0x1f, 0xe7, 0xb9, 0xea, 0x9c, 0x24, 0x73, 0xf5, 0xb0, 0x88,
+	0x9d, 0xa9, 0x48, 0x7b, 0x89, 0x48, 0x44, 0xcf, 0x54, 0xe2, 0xc5, 0xcc, 0x4c, 0x66, 0x30, 0xe9,
+	0xeb, 0x6a, 0x37, 0xa3, 0x8d, 0xf0, 0xdb, 0xe6, 0xf1, 0x3c, 0x8f, 0x12, 0xce, 0x06, 0xb4, 0xaa,
+	0x96, 0x19, 0x6f, 0x83, 0x05, 0x76, 0xbd, 0x6f, 0x39, 0x3f, 0x76, 0xe7, 0x77, 0x37, 0x5c, 0x66,
+	0xdc, 0x37, 0x6d, 0xc6, 0x68, 0x75, 0x26, 0x45, 0xda, 0xae, 0x58, 0x60, 0xff, 0xf7, 0x4d, 0xde,
+	0xb1, 0xfb, 0x48, 0x45, 0xed, 0x7f, 0x16, 0xd8, 0x07, 0xbe, 0xc9, 0xc7, 0x01, 0x6d, 0xfd, 0x65,
+	0x61, 0x4d, 0x7a, 0x78, 0x3b, 0x1e, 0x8d, 0xaf, 0xef, 0xc6, 0x13, 0xcf, 0x0d, 0x82, 0xe1, 0xa5,
+	0xdb, 0x20, 0x8c, 0xd1, 0xfa, 0xcd, 0xf0, 0x62, 0xe4, 0x86, 0x25, 0x83, 0x1d, 0x0b, 0x42, 0xdf,
+	0x1d, 0x7a, 0x25, 0xab, 0xf4, 0x23, 0xda, 0xf4, 0xca, 0x57, 0x96, 0x7a, 0x76, 0x45, 0x6b, 0x81,
+	0x92, 0x3c, 0x4a, 0xd9, 0xd1, 0xbe, 0x5f, 0x74, 0xf6, 0x9e, 0x76, 0x89, 0x0d, 0xa7, 0x70, 0x3e,
+	0x58, 0x6d, 0x90, 0xac, 0x37, 0x48, 0xb6, 0x1b, 0x84, 0x67, 0x8d, 0xf0, 0xaa, 0x11, 0xde, 0x34,
+	0xc2, 0x4a, 0x23, 0xbc, 0x6b, 0x84, 0x0f, 0x8d, 0x64, 0xab, 0x11, 0x5e, 0x0a, 0x24, 0xab, 0x02,
+	0xc9, 0xba, 0x40, 0x12, 0xd7, 0xcc, 0x9a, 0xcf, 0x3e, 0x07, 0x00, 0xdc, 0x28, 0x4b, 0xc7, 0xb9,
+	0x01, 0x00, 0x00,
+}
+
+func (x TransportMessageType) String() string {
+	s, ok := TransportMessageType_name[int32(x)]
+	if ok {
+		return s
+	}
+	return strconv.Itoa(int(x))
+}
+func (this *TransportMessage) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*TransportMessage)
+	if !ok {
+		that2, ok := that.(TransportMessage)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Type != that1.Type {
+		return false
+	}
+	if this.From != that1.From {
+		return false
+	}
+	if !bytes.Equal(this.Data, that1.Data) {
+		return false
+	}
+	return true
+}
+func (this *TransportMessage) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 7)
+	s = append(s, "&memberlist.TransportMessage{")
+	s = append(s, "Type: "+fmt.Sprintf("%#v", this.Type)+",\n")
+	s = append(s, "From: "+fmt.Sprintf("%#v", this.From)+",\n")
+	s = append(s, "Data: "+fmt.Sprintf("%#v", this.Data)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func valueToGoStringGrpcTransport(v interface{}, typ string) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("func(v %v) *%v { return &v } ( %#v )", typ, typ, pv)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// MemberlistTransportClient is the client API for MemberlistTransport service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type MemberlistTransportClient interface {
+	// Stream opens a bidirectional stream. The first message sent by the client
+	// defines whether the stream carries a single packet or a stream connection.
+	Stream(ctx context.Context, opts ...grpc.CallOption) (MemberlistTransport_StreamClient, error)
+}
+
+type memberlistTransportClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewMemberlistTransportClient(cc *grpc.ClientConn) MemberlistTransportClient {
+	return &memberlistTransportClient{cc}
+}
+
+func (c *memberlistTransportClient) Stream(ctx context.Context, opts ...grpc.CallOption) (MemberlistTransport_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MemberlistTransport_serviceDesc.Streams[0], "/memberlist.MemberlistTransport/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &memberlistTransportStreamClient{stream}
+	return x, nil
+}
+
+type MemberlistTransport_StreamClient interface {
+	Send(*TransportMessage) error
+	Recv() (*TransportMessage, error)
+	grpc.ClientStream
+}
+
+type memberlistTransportStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *memberlistTransportStreamClient) Send(m *TransportMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *memberlistTransportStreamClient) Recv() (*TransportMessage, error) {
+	m := new(TransportMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MemberlistTransportServer is the server API for MemberlistTransport service.
+type MemberlistTransportServer interface {
+	// Stream opens a bidirectional stream. The first message sent by the client
+	// defines whether the stream carries a single packet or a stream connection.
+	Stream(MemberlistTransport_StreamServer) error
+}
+
+// UnimplementedMemberlistTransportServer can be embedded to have forward compatible implementations.
+type UnimplementedMemberlistTransportServer struct {
+}
+
+func (*UnimplementedMemberlistTransportServer) Stream(srv MemberlistTransport_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+
+func RegisterMemberlistTransportServer(s *grpc.Server, srv MemberlistTransportServer) {
+	s.RegisterService(&_MemberlistTransport_serviceDesc, srv)
+}
+
+func _MemberlistTransport_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MemberlistTransportServer).Stream(&memberlistTransportStreamServer{stream})
+}
+
+type MemberlistTransport_StreamServer interface {
+	Send(*TransportMessage) error
+	Recv() (*TransportMessage, error)
+	grpc.ServerStream
+}
+
+type memberlistTransportStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *memberlistTransportStreamServer) Send(m *TransportMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *memberlistTransportStreamServer) Recv() (*TransportMessage, error) {
+	m := new(TransportMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _MemberlistTransport_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "memberlist.MemberlistTransport",
+	HandlerType: (*MemberlistTransportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _MemberlistTransport_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "grpc_transport.proto",
+}
+
+func (m *TransportMessage) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TransportMessage) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TransportMessage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Data) > 0 {
+		i -= len(m.Data)
+		copy(dAtA[i:], m.Data)
+		i = encodeVarintGrpcTransport(dAtA, i, uint64(len(m.Data)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.From) > 0 {
+		i -= len(m.From)
+		copy(dAtA[i:], m.From)
+		i = encodeVarintGrpcTransport(dAtA, i, uint64(len(m.From)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.Type != 0 {
+		i = encodeVarintGrpcTransport(dAtA, i, uint64(m.Type))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintGrpcTransport(dAtA []byte, offset int, v uint64) int {
+	offset -= sovGrpcTransport(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *TransportMessage) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Type != 0 {
+		n += 1 + sovGrpcTransport(uint64(m.Type))
+	}
+	l = len(m.From)
+	if l > 0 {
+		n += 1 + l + sovGrpcTransport(uint64(l))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovGrpcTransport(uint64(l))
+	}
+	return n
+}
+
+func sovGrpcTransport(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozGrpcTransport(x uint64) (n int) {
+	return sovGrpcTransport(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (this *TransportMessage) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&TransportMessage{`,
+		`Type:` + fmt.Sprintf("%v", this.Type) + `,`,
+		`From:` + fmt.Sprintf("%v", this.From) + `,`,
+		`Data:` + fmt.Sprintf("%v", this.Data) + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func valueToStringGrpcTransport(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("*%v", pv)
+}
+func (m *TransportMessage) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGrpcTransport
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TransportMessage: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TransportMessage: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpcTransport
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Type |= TransportMessageType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field From", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpcTransport
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.From = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGrpcTransport
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGrpcTransport(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGrpcTransport
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipGrpcTransport(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowGrpcTransport
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowGrpcTransport
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowGrpcTransport
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthGrpcTransport
+			}
+			iNdEx += length
+			if iNdEx < 0 {
+				return 0, ErrInvalidLengthGrpcTransport
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowGrpcTransport
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipGrpcTransport(dAtA[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+				if iNdEx < 0 {
+					return 0, ErrInvalidLengthGrpcTransport
+				}
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthGrpcTransport = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowGrpcTransport   = fmt.Errorf("proto: integer overflow")
+)
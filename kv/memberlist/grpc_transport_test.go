@@ -0,0 +1,139 @@
+package memberlist
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/kv/codec"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+)
+
+func TestGRPCTransport_KVReplication(t *testing.T) {
+	kv1 := startKVWithGRPCTransport(t, nil, "", "")
+	kv2 := startKVWithGRPCTransport(t, []string{kv1.cfg.Transport.(*GRPCTransport).getAdvertisedAddr()}, "", "")
+
+	client1, err := NewClient(kv1, dataCodec{})
+	require.NoError(t, err)
+	client2, err := NewClient(kv2, dataCodec{})
+	require.NoError(t, err)
+
+	test.Poll(t, 5*time.Second, 2, func() interface{} {
+		return kv1.memberlist.NumMembers()
+	})
+
+	// A value written on the first node should eventually be visible on the second one.
+	require.NoError(t, cas(client1, key, updateFn("member")))
+	test.Poll(t, 5*time.Second, JOINING, func() interface{} {
+		d := getData(t, client2, key)
+		if d == nil {
+			return nil
+		}
+		return d.Members["member"].State
+	})
+
+	// Large values are split in multiple messages.
+	tokens := make([]uint32, grpcTransportMaxChunkSize/4+1)
+	for i := range tokens {
+		tokens[i] = uint32(i)
+	}
+	require.NoError(t, cas(client2, key, func(in *data) (*data, bool, error) {
+		m := in.Members["member"]
+		m.Tokens = tokens
+		m.Timestamp++
+		in.Members["member"] = m
+		return in, true, nil
+	}))
+	test.Poll(t, 10*time.Second, len(tokens), func() interface{} {
+		return len(getData(t, client1, key).Members["member"].Tokens)
+	})
+}
+
+func TestGRPCTransport_ClusterValidation(t *testing.T) {
+	kv1 := startKVWithGRPCTransport(t, nil, "cluster-1", "cluster-1")
+	addr1 := kv1.cfg.Transport.(*GRPCTransport).getAdvertisedAddr()
+
+	// A node sending the wrong cluster validation label can't join.
+	cfg := grpcTransportKVConfig()
+	cfg.JoinMembers = []string{addr1}
+	cfg.AbortIfFastJoinFails = true
+	cfg.Transport = newTestGRPCTransport(t, "", "cluster-2")
+	kv2 := NewKV(cfg, log.NewNopLogger(), &staticDNSProviderMock{}, prometheus.NewPedanticRegistry())
+	require.Error(t, services.StartAndAwaitRunning(context.Background(), kv2))
+
+	// A node sending the right cluster validation label can join.
+	kv3 := startKVWithGRPCTransport(t, []string{addr1}, "", "cluster-1")
+	test.Poll(t, 5*time.Second, 2, func() interface{} {
+		return kv3.memberlist.NumMembers()
+	})
+}
+
+func TestGRPCTransportStreamMethod(t *testing.T) {
+	// server.Server checks the cluster validation label of this method.
+	desc := _MemberlistTransport_serviceDesc
+	require.Len(t, desc.Streams, 1)
+	require.Equal(t, "/"+desc.ServiceName+"/"+desc.Streams[0].StreamName, GRPCTransportStreamMethod)
+}
+
+func grpcTransportKVConfig() KVConfig {
+	var cfg KVConfig
+	flagext.DefaultValues(&cfg)
+	cfg.GossipInterval = 100 * time.Millisecond
+	cfg.PushPullInterval = 1 * time.Second
+	cfg.StreamTimeout = 10 * time.Second
+	cfg.Codecs = []codec.Codec{dataCodec{}}
+	return cfg
+}
+
+// startKVWithGRPCTransport starts a KV using a GRPCTransport. serverCluster is the cluster label
+// validated by the gRPC server, clientCluster is the cluster label sent by the gRPC clients.
+func startKVWithGRPCTransport(t *testing.T, joinMembers []string, serverCluster, clientCluster string) *KV {
+	cfg := grpcTransportKVConfig()
+	cfg.JoinMembers = joinMembers
+	cfg.AbortIfFastJoinFails = len(joinMembers) > 0
+
+	cfg.Transport = newTestGRPCTransport(t, serverCluster, clientCluster)
+
+	kv := NewKV(cfg, log.NewNopLogger(), &staticDNSProviderMock{}, prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), kv))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), kv))
+	})
+	return kv
+}
+
+func newTestGRPCTransport(t *testing.T, serverCluster, clientCluster string) *GRPCTransport {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var opts []grpc.ServerOption
+	if serverCluster != "" {
+		opts = append(opts, grpc.StreamInterceptor(middleware.ClusterStreamServerInterceptor(
+			serverCluster, false, middleware.NewInvalidClusterRequests(prometheus.NewPedanticRegistry(), "test"), log.NewNopLogger(),
+		)))
+	}
+	grpcServer := grpc.NewServer(opts...)
+
+	var cfg GRPCTransportConfig
+	flagext.DefaultValues(&cfg)
+	cfg.GRPCClientConfig.ClusterValidation.Label = clientCluster
+
+	tr, err := NewGRPCTransport(cfg, grpcServer, listener.Addr(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	return tr
+}
@@ -178,6 +178,10 @@ type KVConfig struct {
 
 	TCPTransport TCPTransportConfig `yaml:",inline"`
 
+	// Transport to use instead of the TCPTransport configured above, eg. a GRPCTransport. If set, the
+	// TCPTransport config is ignored. The transport is shut down when memberlist shuts down.
+	Transport memberlist.Transport `yaml:"-"`
+
 	MetricsNamespace string `yaml:"-"`
 
 	// Codecs to register. Codecs need to be registered before joining other members.
@@ -433,9 +437,13 @@ func defaultMemberlistConfig() *memberlist.Config {
 }
 
 func (m *KV) buildMemberlistConfig() (*memberlist.Config, error) {
-	tr, err := NewTCPTransport(m.cfg.TCPTransport, m.logger, m.registerer)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transport: %v", err)
+	tr := m.cfg.Transport
+	if tr == nil {
+		tcpTransport, err := NewTCPTransport(m.cfg.TCPTransport, m.logger, m.registerer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transport: %v", err)
+		}
+		tr = tcpTransport
 	}
 
 	mlCfg := defaultMemberlistConfig()
@@ -155,6 +155,12 @@ func NewTCPTransport(config TCPTransportConfig, logger log.Logger, registerer pr
 
 	var err error
 	if config.TLSEnabled {
+		if config.TLS.Logger == nil {
+			config.TLS.Logger = t.logger
+		}
+		if config.TLS.Registerer == nil && registerer != nil {
+			config.TLS.Registerer = prometheus.WrapRegistererWith(prometheus.Labels{"name": "memberlist"}, registerer)
+		}
 		t.tlsConfig, err = config.TLS.GetTLSConfig()
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to create TLS config")
@@ -0,0 +1,412 @@
+package limiter
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// AlgorithmAIMD increases the limit by one while requests succeed, and decreases it by a ratio when requests are
+	// dropped or slower than a threshold.
+	AlgorithmAIMD = "aimd"
+
+	// AlgorithmGradient adjusts the limit by the ratio between the long-term and the current latency.
+	AlgorithmGradient = "gradient"
+
+	// AlgorithmVegas estimates the queue size from the ratio between the minimum and the current latency, and keeps
+	// it between thresholds, like TCP Vegas.
+	AlgorithmVegas = "vegas"
+)
+
+var (
+	supportedAlgorithms = []string{AlgorithmAIMD, AlgorithmGradient, AlgorithmVegas}
+
+	errUnsupportedAlgorithm   = errors.New("unsupported concurrency limit algorithm")
+	errInvalidLimits          = errors.New("concurrency limits must satisfy 1 <= min limit <= initial limit <= max limit")
+	errInvalidBackoffRatio    = errors.New("AIMD backoff ratio must be between 0 and 1")
+	errInvalidRTTTolerance    = errors.New("gradient RTT tolerance must be at least 1")
+	errInvalidLongWindow      = errors.New("gradient long window must be greater than 0")
+	errInvalidQueueSize       = errors.New("gradient queue size must not be negative")
+	errInvalidSmoothing       = errors.New("gradient smoothing must be greater than 0 and at most 1")
+	errInvalidProbeMultiplier = errors.New("vegas probe multiplier must be greater than 0")
+)
+
+// AdaptiveConcurrencyLimiterConfig configures an AdaptiveConcurrencyLimiter.
+type AdaptiveConcurrencyLimiterConfig struct {
+	Algorithm    string `yaml:"algorithm" category:"experimental"`
+	InitialLimit int    `yaml:"initial_limit" category:"experimental"`
+	MinLimit     int    `yaml:"min_limit" category:"experimental"`
+	MaxLimit     int    `yaml:"max_limit" category:"experimental"`
+
+	AIMDBackoffRatio     float64       `yaml:"aimd_backoff_ratio" category:"experimental"`
+	AIMDLatencyThreshold time.Duration `yaml:"aimd_latency_threshold" category:"experimental"`
+	GradientRTTTolerance float64       `yaml:"gradient_rtt_tolerance" category:"experimental"`
+	GradientLongWindow   int           `yaml:"gradient_long_window" category:"experimental"`
+	GradientQueueSize    int           `yaml:"gradient_queue_size" category:"experimental"`
+	GradientSmoothing    float64       `yaml:"gradient_smoothing" category:"experimental"`
+	VegasProbeMultiplier int           `yaml:"vegas_probe_multiplier" category:"experimental"`
+}
+
+// RegisterFlagsWithPrefix registers flags with provided prefix.
+func (cfg *AdaptiveConcurrencyLimiterConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.StringVar(&cfg.Algorithm, prefix+"algorithm", AlgorithmAIMD, fmt.Sprintf("Algorithm adjusting the concurrency limit from the latency and outcome of requests. Supported values are: %s.", strings.Join(supportedAlgorithms, ", ")))
+	f.IntVar(&cfg.InitialLimit, prefix+"initial-limit", 20, "Initial limit of concurrent requests.")
+	f.IntVar(&cfg.MinLimit, prefix+"min-limit", 1, "Minimum limit of concurrent requests.")
+	f.IntVar(&cfg.MaxLimit, prefix+"max-limit", 1000, "Maximum limit of concurrent requests.")
+	f.Float64Var(&cfg.AIMDBackoffRatio, prefix+"aimd-backoff-ratio", 0.9, "Ratio the limit is multiplied by when a request is dropped or too slow, when using the aimd algorithm.")
+	f.DurationVar(&cfg.AIMDLatencyThreshold, prefix+"aimd-latency-threshold", 0, "Requests slower than this are handled like dropped requests, when using the aimd algorithm. 0 to disable.")
+	f.Float64Var(&cfg.GradientRTTTolerance, prefix+"gradient-rtt-tolerance", 1.5, "Ratio between the current and the long-term latency tolerated before decreasing the limit, when using the gradient algorithm.")
+	f.IntVar(&cfg.GradientLongWindow, prefix+"gradient-long-window", 600, "Number of requests the long-term latency is averaged over, when using the gradient algorithm.")
+	f.IntVar(&cfg.GradientQueueSize, prefix+"gradient-queue-size", 4, "Number of requests allowed to queue on top of the limit derived from latencies, when using the gradient algorithm.")
+	f.Float64Var(&cfg.GradientSmoothing, prefix+"gradient-smoothing", 0.2, "Weight of a new limit in the moving average of limits, when using the gradient algorithm.")
+	f.IntVar(&cfg.VegasProbeMultiplier, prefix+"vegas-probe-multiplier", 30, "The minimum latency is measured again after this number of requests times the limit, when using the vegas algorithm.")
+}
+
+func (cfg *AdaptiveConcurrencyLimiterConfig) Validate() error {
+	if !slices.Contains(supportedAlgorithms, cfg.Algorithm) {
+		return errUnsupportedAlgorithm
+	}
+	if cfg.MinLimit < 1 || cfg.InitialLimit < cfg.MinLimit || cfg.MaxLimit < cfg.InitialLimit {
+		return errInvalidLimits
+	}
+
+	// Only the parameters of the configured algorithm are validated.
+	switch cfg.Algorithm {
+	case AlgorithmAIMD:
+		if cfg.AIMDBackoffRatio <= 0 || cfg.AIMDBackoffRatio >= 1 {
+			return errInvalidBackoffRatio
+		}
+	case AlgorithmGradient:
+		if cfg.GradientRTTTolerance < 1 {
+			return errInvalidRTTTolerance
+		}
+		if cfg.GradientLongWindow < 1 {
+			return errInvalidLongWindow
+		}
+		if cfg.GradientQueueSize < 0 {
+			return errInvalidQueueSize
+		}
+		if cfg.GradientSmoothing <= 0 || cfg.GradientSmoothing > 1 {
+			return errInvalidSmoothing
+		}
+	case AlgorithmVegas:
+		if cfg.VegasProbeMultiplier < 1 {
+			return errInvalidProbeMultiplier
+		}
+	}
+	return nil
+}
+
+// Outcome is the outcome of a request admitted by an AdaptiveConcurrencyLimiter.
+type Outcome int
+
+const (
+	// OutcomeSuccess means the request was handled, successfully or not.
+	OutcomeSuccess Outcome = iota
+
+	// OutcomeDropped means the request failed because of overload, for example because it timed out.
+	OutcomeDropped
+
+	// OutcomeIgnored means the request must not be used to adjust the limit, for example because it was canceled by
+	// the client.
+	OutcomeIgnored
+)
+
+// Sample is the measurement of a request, used to adjust the concurrency limit.
+type Sample struct {
+	// Latency of the request.
+	Latency time.Duration
+
+	// Inflight is the number of in-flight requests when the request was admitted, including itself.
+	Inflight int
+
+	// Dropped is true if the request failed because of overload.
+	Dropped bool
+}
+
+// LimitAlgorithm computes the concurrency limit from samples. Update is called sequentially.
+type LimitAlgorithm interface {
+	// Update returns the new limit after the request measured by the sample finished. The returned limit is
+	// clamped between the minimum and maximum limits by the caller.
+	Update(limit float64, sample Sample) float64
+}
+
+// NewLimitAlgorithm returns the algorithm configured in cfg.
+func NewLimitAlgorithm(cfg AdaptiveConcurrencyLimiterConfig) (LimitAlgorithm, error) {
+	switch cfg.Algorithm {
+	case AlgorithmAIMD:
+		return &AIMDAlgorithm{BackoffRatio: cfg.AIMDBackoffRatio, LatencyThreshold: cfg.AIMDLatencyThreshold}, nil
+	case AlgorithmGradient:
+		return NewGradientAlgorithm(cfg.GradientRTTTolerance, cfg.GradientLongWindow, cfg.GradientQueueSize, cfg.GradientSmoothing), nil
+	case AlgorithmVegas:
+		return NewVegasAlgorithm(cfg.VegasProbeMultiplier), nil
+	default:
+		return nil, errUnsupportedAlgorithm
+	}
+}
+
+// AdaptiveConcurrencyLimiter limits the number of concurrent requests, with a limit adjusted by a LimitAlgorithm
+// from the latency and outcome of requests. Requests over the limit are rejected immediately rather than queued,
+// so that an overloaded server sheds load instead of accumulating latency.
+type AdaptiveConcurrencyLimiter struct {
+	algorithm LimitAlgorithm
+	minLimit  float64
+	maxLimit  float64
+
+	mtx      sync.Mutex
+	limit    float64
+	inflight int
+
+	limitGauge    prometheus.Gauge
+	inflightGauge prometheus.Gauge
+	rejected      prometheus.Counter
+}
+
+// NewAdaptiveConcurrencyLimiter makes a new AdaptiveConcurrencyLimiter using the algorithm configured in cfg. Metrics
+// are registered with reg, labelled with name.
+func NewAdaptiveConcurrencyLimiter(cfg AdaptiveConcurrencyLimiterConfig, name string, reg prometheus.Registerer) (*AdaptiveConcurrencyLimiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	algorithm, err := NewLimitAlgorithm(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewAdaptiveConcurrencyLimiterWithAlgorithm(algorithm, cfg.InitialLimit, cfg.MinLimit, cfg.MaxLimit, name, reg), nil
+}
+
+// NewAdaptiveConcurrencyLimiterWithAlgorithm makes a new AdaptiveConcurrencyLimiter using a custom algorithm.
+func NewAdaptiveConcurrencyLimiterWithAlgorithm(algorithm LimitAlgorithm, initialLimit, minLimit, maxLimit int, name string, reg prometheus.Registerer) *AdaptiveConcurrencyLimiter {
+	l := &AdaptiveConcurrencyLimiter{
+		algorithm: algorithm,
+		minLimit:  float64(minLimit),
+		maxLimit:  float64(maxLimit),
+		limit:     float64(initialLimit),
+		limitGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "adaptive_concurrency_limit",
+			Help:        "Current limit of concurrent requests.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		inflightGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "adaptive_concurrency_inflight_requests",
+			Help:        "Current number of in-flight requests admitted by the concurrency limiter.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		rejected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "adaptive_concurrency_rejected_requests_total",
+			Help:        "Total number of requests rejected because the concurrency limit was reached.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+	l.limitGauge.Set(float64(initialLimit))
+	return l
+}
+
+// Acquire admits a request if the number of in-flight requests is below the current limit. If the request is
+// admitted, release must be called exactly once when the request finishes.
+func (l *AdaptiveConcurrencyLimiter) Acquire() (release func(Outcome), ok bool) {
+	releaseAt, ok := l.acquire(time.Now())
+	if !ok {
+		return nil, false
+	}
+	return func(outcome Outcome) {
+		releaseAt(outcome, time.Now())
+	}, true
+}
+
+// acquire is like Acquire, with the start and end times of the request passed explicitly.
+func (l *AdaptiveConcurrencyLimiter) acquire(start time.Time) (release func(Outcome, time.Time), ok bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.inflight >= int(l.limit) {
+		l.rejected.Inc()
+		return nil, false
+	}
+	l.inflight++
+	l.inflightGauge.Set(float64(l.inflight))
+
+	inflight := l.inflight
+	var once sync.Once
+	return func(outcome Outcome, end time.Time) {
+		once.Do(func() {
+			l.release(Sample{Latency: end.Sub(start), Inflight: inflight, Dropped: outcome == OutcomeDropped}, outcome != OutcomeIgnored)
+		})
+	}, true
+}
+
+func (l *AdaptiveConcurrencyLimiter) release(sample Sample, update bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.inflight--
+	l.inflightGauge.Set(float64(l.inflight))
+	if !update {
+		return
+	}
+
+	limit := math.Min(l.maxLimit, math.Max(l.minLimit, l.algorithm.Update(l.limit, sample)))
+	if int(limit) != int(l.limit) {
+		l.limitGauge.Set(float64(int(limit)))
+	}
+	l.limit = limit
+}
+
+// Limit returns the current limit of concurrent requests.
+func (l *AdaptiveConcurrencyLimiter) Limit() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return int(l.limit)
+}
+
+// Inflight returns the current number of in-flight requests.
+func (l *AdaptiveConcurrencyLimiter) Inflight() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.inflight
+}
+
+// AIMDAlgorithm is an additive increase / multiplicative decrease LimitAlgorithm. The limit increases by one after
+// each successful request while at least half of it is used, and is multiplied by BackoffRatio after a request is
+// dropped or slower than LatencyThreshold.
+type AIMDAlgorithm struct {
+	BackoffRatio float64
+
+	// LatencyThreshold is disabled if zero.
+	LatencyThreshold time.Duration
+}
+
+func (a *AIMDAlgorithm) Update(limit float64, sample Sample) float64 {
+	if sample.Dropped || (a.LatencyThreshold > 0 && sample.Latency > a.LatencyThreshold) {
+		return math.Floor(limit * a.BackoffRatio)
+	}
+	// The limit only increases when it's actually the bottleneck.
+	if float64(sample.Inflight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// GradientAlgorithm is a LimitAlgorithm adjusting the limit by the gradient between the long-term average latency
+// and the latency of the current request: the limit shrinks when latency increases beyond the tolerance, because
+// requests are queuing, and grows by the queue size otherwise.
+type GradientAlgorithm struct {
+	rttTolerance float64
+	longWindow   int
+	queueSize    float64
+	smoothing    float64
+
+	samples int
+	longRTT float64
+}
+
+// NewGradientAlgorithm returns a GradientAlgorithm. rttTolerance is the ratio between the current and the long-term
+// latency tolerated before decreasing the limit, longWindow the number of requests the long-term latency is averaged
+// over, queueSize the growth of the limit while latency is stable, and smoothing the weight of a new limit in the
+// moving average of limits.
+func NewGradientAlgorithm(rttTolerance float64, longWindow, queueSize int, smoothing float64) *GradientAlgorithm {
+	return &GradientAlgorithm{
+		rttTolerance: rttTolerance,
+		longWindow:   max(1, longWindow),
+		queueSize:    float64(queueSize),
+		smoothing:    smoothing,
+	}
+}
+
+func (a *GradientAlgorithm) Update(limit float64, sample Sample) float64 {
+	rtt := float64(sample.Latency)
+	if rtt <= 0 {
+		return limit
+	}
+
+	// Average over the first samples, then exponentially over the window.
+	a.samples++
+	if a.samples <= a.longWindow {
+		a.longRTT += (rtt - a.longRTT) / float64(a.samples)
+	} else {
+		factor := 2 / float64(a.longWindow+1)
+		a.longRTT = a.longRTT*(1-factor) + rtt*factor
+	}
+
+	// Recover faster from a long-term latency driven up by a past overload.
+	if a.longRTT/rtt > 2 {
+		a.longRTT *= 0.95
+	}
+
+	// Don't grow the limit while it's not the bottleneck.
+	if float64(sample.Inflight) < limit/2 {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, a.rttTolerance*a.longRTT/rtt))
+	if sample.Dropped {
+		gradient = 0.5
+	}
+	newLimit := limit*gradient + a.queueSize
+	return limit*(1-a.smoothing) + newLimit*a.smoothing
+}
+
+// VegasAlgorithm is a LimitAlgorithm estimating the number of queued requests from the ratio between the minimum
+// latency, measured without load, and the latency of the current request. The limit increases while the estimated
+// queue is small, and decreases when it's large, like TCP Vegas.
+type VegasAlgorithm struct {
+	probeMultiplier int
+
+	minRTT          time.Duration
+	samplesToProbe  int
+	samplesSinceMin int
+}
+
+// NewVegasAlgorithm returns a VegasAlgorithm. The minimum latency is measured again after probeMultiplier times the
+// limit requests, to adapt to changes of the latency without load.
+func NewVegasAlgorithm(probeMultiplier int) *VegasAlgorithm {
+	return &VegasAlgorithm{probeMultiplier: max(1, probeMultiplier)}
+}
+
+func (a *VegasAlgorithm) Update(limit float64, sample Sample) float64 {
+	if sample.Latency <= 0 {
+		return limit
+	}
+
+	a.samplesSinceMin++
+	if a.samplesToProbe > 0 && a.samplesSinceMin >= a.samplesToProbe {
+		a.minRTT = 0
+	}
+	if a.minRTT == 0 || sample.Latency < a.minRTT {
+		a.minRTT = sample.Latency
+		a.samplesSinceMin = 0
+		a.samplesToProbe = a.probeMultiplier * int(limit)
+		return limit
+	}
+
+	log10 := math.Max(1, math.Floor(math.Log10(limit)))
+	if sample.Dropped {
+		return limit - log10
+	}
+	// Don't grow the limit while it's not the bottleneck.
+	if float64(sample.Inflight)*2 < limit {
+		return limit
+	}
+
+	queue := math.Ceil(limit * (1 - float64(a.minRTT)/float64(sample.Latency)))
+	alpha, beta := 3*log10, 6*log10
+	switch {
+	case queue <= log10:
+		return limit + beta
+	case queue < alpha:
+		return limit + log10
+	case queue > beta:
+		return limit - log10
+	default:
+		return limit
+	}
+}
@@ -0,0 +1,216 @@
+package limiter
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAlgorithm records samples, and returns the limit set by the test.
+type recordingAlgorithm struct {
+	samples []Sample
+	limit   float64
+}
+
+func (a *recordingAlgorithm) Update(_ float64, sample Sample) float64 {
+	a.samples = append(a.samples, sample)
+	return a.limit
+}
+
+func defaultAdaptiveConcurrencyLimiterConfig() AdaptiveConcurrencyLimiterConfig {
+	cfg := AdaptiveConcurrencyLimiterConfig{}
+	cfg.RegisterFlagsWithPrefix(flag.NewFlagSet("", flag.PanicOnError), "")
+	return cfg
+}
+
+func TestAdaptiveConcurrencyLimiterConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		update   func(cfg *AdaptiveConcurrencyLimiterConfig)
+		expected error
+	}{
+		"default config": {
+			update: func(*AdaptiveConcurrencyLimiterConfig) {},
+		},
+		"unsupported algorithm": {
+			update:   func(cfg *AdaptiveConcurrencyLimiterConfig) { cfg.Algorithm = "reno" },
+			expected: errUnsupportedAlgorithm,
+		},
+		"min limit zero": {
+			update:   func(cfg *AdaptiveConcurrencyLimiterConfig) { cfg.MinLimit = 0 },
+			expected: errInvalidLimits,
+		},
+		"initial limit above max limit": {
+			update:   func(cfg *AdaptiveConcurrencyLimiterConfig) { cfg.InitialLimit = cfg.MaxLimit + 1 },
+			expected: errInvalidLimits,
+		},
+		"invalid backoff ratio": {
+			update:   func(cfg *AdaptiveConcurrencyLimiterConfig) { cfg.AIMDBackoffRatio = 1 },
+			expected: errInvalidBackoffRatio,
+		},
+		"gradient RTT tolerance below 1": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmGradient
+				cfg.GradientRTTTolerance = 0.5
+			},
+			expected: errInvalidRTTTolerance,
+		},
+		"gradient long window zero": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmGradient
+				cfg.GradientLongWindow = 0
+			},
+			expected: errInvalidLongWindow,
+		},
+		"gradient negative queue size": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmGradient
+				cfg.GradientQueueSize = -1
+			},
+			expected: errInvalidQueueSize,
+		},
+		"gradient smoothing zero": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmGradient
+				cfg.GradientSmoothing = 0
+			},
+			expected: errInvalidSmoothing,
+		},
+		"gradient smoothing above 1": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmGradient
+				cfg.GradientSmoothing = 1.5
+			},
+			expected: errInvalidSmoothing,
+		},
+		"vegas probe multiplier zero": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmVegas
+				cfg.VegasProbeMultiplier = 0
+			},
+			expected: errInvalidProbeMultiplier,
+		},
+		"backoff ratio ignored by other algorithms": {
+			update: func(cfg *AdaptiveConcurrencyLimiterConfig) {
+				cfg.Algorithm = AlgorithmVegas
+				cfg.AIMDBackoffRatio = 1
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultAdaptiveConcurrencyLimiterConfig()
+			tc.update(&cfg)
+			assert.Equal(t, tc.expected, cfg.Validate())
+		})
+	}
+}
+
+func TestAdaptiveConcurrencyLimiter(t *testing.T) {
+	algorithm := &recordingAlgorithm{limit: 2}
+	reg := prometheus.NewPedanticRegistry()
+	l := NewAdaptiveConcurrencyLimiterWithAlgorithm(algorithm, 2, 1, 3, "test", reg)
+
+	now := time.Now()
+	release1, ok := l.acquire(now)
+	require.True(t, ok)
+	release2, ok := l.acquire(now)
+	require.True(t, ok)
+	_, ok = l.acquire(now)
+	require.False(t, ok, "requests over the limit are rejected")
+	assert.Equal(t, 2, l.Inflight())
+
+	release1(OutcomeSuccess, now.Add(time.Second))
+	release1(OutcomeDropped, now.Add(time.Second))
+	assert.Equal(t, []Sample{{Latency: time.Second, Inflight: 1}}, algorithm.samples, "releasing twice has no effect")
+	assert.Equal(t, 1, l.Inflight())
+
+	// Ignored requests don't adjust the limit.
+	release2(OutcomeIgnored, now)
+	assert.Len(t, algorithm.samples, 1)
+	assert.Equal(t, 0, l.Inflight())
+
+	// The limit is clamped between the min and max limits.
+	algorithm.limit = 10
+	release, ok := l.acquire(now)
+	require.True(t, ok)
+	release(OutcomeDropped, now)
+	assert.Equal(t, Sample{Inflight: 1, Dropped: true}, algorithm.samples[1])
+	assert.Equal(t, 3, l.Limit())
+
+	algorithm.limit = 0
+	release, ok = l.acquire(now)
+	require.True(t, ok)
+	release(OutcomeSuccess, now)
+	assert.Equal(t, 1, l.Limit())
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP adaptive_concurrency_inflight_requests Current number of in-flight requests admitted by the concurrency limiter.
+		# TYPE adaptive_concurrency_inflight_requests gauge
+		adaptive_concurrency_inflight_requests{name="test"} 0
+		# HELP adaptive_concurrency_limit Current limit of concurrent requests.
+		# TYPE adaptive_concurrency_limit gauge
+		adaptive_concurrency_limit{name="test"} 1
+		# HELP adaptive_concurrency_rejected_requests_total Total number of requests rejected because the concurrency limit was reached.
+		# TYPE adaptive_concurrency_rejected_requests_total counter
+		adaptive_concurrency_rejected_requests_total{name="test"} 1
+	`)))
+}
+
+func TestNewAdaptiveConcurrencyLimiter_InvalidConfig(t *testing.T) {
+	cfg := defaultAdaptiveConcurrencyLimiterConfig()
+	cfg.Algorithm = "reno"
+	_, err := NewAdaptiveConcurrencyLimiter(cfg, "test", nil)
+	assert.Equal(t, errUnsupportedAlgorithm, err)
+}
+
+func TestAIMDAlgorithm(t *testing.T) {
+	a := &AIMDAlgorithm{BackoffRatio: 0.9, LatencyThreshold: time.Second}
+
+	assert.Equal(t, 11.0, a.Update(10, Sample{Latency: time.Millisecond, Inflight: 5}))
+	assert.Equal(t, 10.0, a.Update(10, Sample{Latency: time.Millisecond, Inflight: 4}), "limit not increased while not used")
+	assert.Equal(t, 9.0, a.Update(10, Sample{Latency: time.Millisecond, Inflight: 10, Dropped: true}))
+	assert.Equal(t, 9.0, a.Update(10, Sample{Latency: 2 * time.Second, Inflight: 10}))
+}
+
+func TestGradientAlgorithm(t *testing.T) {
+	cfg := defaultAdaptiveConcurrencyLimiterConfig()
+	a := NewGradientAlgorithm(cfg.GradientRTTTolerance, cfg.GradientLongWindow, cfg.GradientQueueSize, cfg.GradientSmoothing)
+
+	// The limit grows while latency is stable.
+	limit := 20.0
+	for i := 0; i < 100; i++ {
+		limit = a.Update(limit, Sample{Latency: 10 * time.Millisecond, Inflight: int(limit)})
+	}
+	assert.Greater(t, limit, 100.0)
+
+	// The limit shrinks when requests start queuing.
+	grown := limit
+	for i := 0; i < 20; i++ {
+		limit = a.Update(limit, Sample{Latency: 50 * time.Millisecond, Inflight: int(limit)})
+	}
+	assert.Less(t, limit, grown/2)
+
+	// The limit doesn't grow while it's not used.
+	assert.Equal(t, limit, a.Update(limit, Sample{Latency: time.Millisecond, Inflight: 1}))
+}
+
+func TestVegasAlgorithm(t *testing.T) {
+	a := NewVegasAlgorithm(30)
+
+	// The first sample measures the minimum latency.
+	assert.Equal(t, 20.0, a.Update(20, Sample{Latency: 10 * time.Millisecond, Inflight: 20}))
+
+	assert.Equal(t, 26.0, a.Update(20, Sample{Latency: 10 * time.Millisecond, Inflight: 20}), "no queue, increased by beta")
+	assert.Equal(t, 21.0, a.Update(20, Sample{Latency: 11 * time.Millisecond, Inflight: 20}), "small queue, increased by log10")
+	assert.Equal(t, 20.0, a.Update(20, Sample{Latency: 14 * time.Millisecond, Inflight: 20}), "queue between alpha and beta")
+	assert.Equal(t, 19.0, a.Update(20, Sample{Latency: 20 * time.Millisecond, Inflight: 20}), "large queue, decreased by log10")
+	assert.Equal(t, 19.0, a.Update(20, Sample{Latency: 10 * time.Millisecond, Inflight: 20, Dropped: true}))
+	assert.Equal(t, 20.0, a.Update(20, Sample{Latency: 20 * time.Millisecond, Inflight: 5}), "limit not changed while not used")
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+
+	"github.com/grafana/dskit/limiter"
+)
+
+// NewConcurrencyLimitMiddleware returns a middleware admitting requests through the AdaptiveConcurrencyLimiter.
+// Requests over the limit are rejected with 429 Too Many Requests. Responses with status 503 Service Unavailable
+// or 504 Gateway Timeout, or requests whose context deadline exceeded, count as dropped, while requests canceled
+// by the client are not used to adjust the limit.
+func NewConcurrencyLimitMiddleware(l *limiter.AdaptiveConcurrencyLimiter) Func {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, ok := l.Acquire()
+			if !ok {
+				http.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+				return
+			}
+
+			// The request is released even if the handler panics.
+			outcome := limiter.OutcomeIgnored
+			defer func() { release(outcome) }()
+
+			respMetrics := httpsnoop.CaptureMetricsFn(w, func(ww http.ResponseWriter) {
+				next.ServeHTTP(ww, r)
+			})
+			outcome = httpOutcome(r.Context(), respMetrics.Code)
+		})
+	}
+}
+
+func httpOutcome(ctx context.Context, code int) limiter.Outcome {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return limiter.OutcomeDropped
+	case errors.Is(ctx.Err(), context.Canceled):
+		return limiter.OutcomeIgnored
+	case code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout:
+		return limiter.OutcomeDropped
+	default:
+		return limiter.OutcomeSuccess
+	}
+}
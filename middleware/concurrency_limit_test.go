@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/limiter"
+)
+
+type recordingLimitAlgorithm struct {
+	samples []limiter.Sample
+}
+
+func (a *recordingLimitAlgorithm) Update(limit float64, sample limiter.Sample) float64 {
+	a.samples = append(a.samples, sample)
+	return limit
+}
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	algorithm := &recordingLimitAlgorithm{}
+	l := limiter.NewAdaptiveConcurrencyLimiterWithAlgorithm(algorithm, 1, 1, 1, "test", nil)
+
+	block := make(chan struct{})
+	handler := NewConcurrencyLimitMiddleware(l).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/block":
+			<-block
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/panic":
+			panic("test")
+		}
+	}))
+
+	serve := func(ctx context.Context, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		return rec.Code
+	}
+
+	// Requests over the limit are rejected.
+	done := make(chan int)
+	go func() { done <- serve(context.Background(), "/block") }()
+	require.Eventually(t, func() bool { return l.Inflight() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, serve(context.Background(), "/"))
+	close(block)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	assert.Equal(t, http.StatusServiceUnavailable, serve(context.Background(), "/unavailable"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, http.StatusOK, serve(ctx, "/"))
+
+	assert.Panics(t, func() { serve(context.Background(), "/panic") })
+	assert.Equal(t, 0, l.Inflight(), "requests are released when the handler panics")
+
+	require.Len(t, algorithm.samples, 2, "canceled requests and panics don't adjust the limit")
+	assert.False(t, algorithm.samples[0].Dropped)
+	assert.True(t, algorithm.samples[1].Dropped)
+}
@@ -37,6 +37,33 @@ func ClusterUnaryClientInterceptor(cluster string, invalidClusterValidationRepor
 	}
 }
 
+// ClusterStreamClientInterceptor propagates the given cluster label to gRPC metadata, before calling the next streamer.
+// If an empty cluster label, or a nil InvalidClusterValidationReporter are provided, ClusterStreamClientInterceptor panics.
+// In case of an error related to the cluster label validation, returned either when the stream is created or when
+// a message is received from it, InvalidClusterValidationReporter is called, and the error is returned.
+func ClusterStreamClientInterceptor(cluster string, invalidClusterValidationReporter InvalidClusterValidationReporter) grpc.StreamClientInterceptor {
+	validateClusterClientInterceptorInputParameters(cluster, invalidClusterValidationReporter)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = clusterutil.PutClusterIntoOutgoingContext(ctx, cluster)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, handleClusterValidationError(err, method, invalidClusterValidationReporter)
+		}
+		return &clusterValidationClientStream{ClientStream: stream, method: method, reporter: invalidClusterValidationReporter}, nil
+	}
+}
+
+// clusterValidationClientStream translates cluster validation errors returned by the server when receiving messages.
+type clusterValidationClientStream struct {
+	grpc.ClientStream
+	method   string
+	reporter InvalidClusterValidationReporter
+}
+
+func (s *clusterValidationClientStream) RecvMsg(m interface{}) error {
+	return handleClusterValidationError(s.ClientStream.RecvMsg(m), s.method, s.reporter)
+}
+
 func validateClusterClientInterceptorInputParameters(cluster string, invalidClusterValidationReporter InvalidClusterValidationReporter) {
 	if cluster == "" {
 		panic("no cluster label provided")
@@ -86,6 +113,27 @@ func ClusterUnaryServerInterceptor(cluster string, softValidation bool, invalidC
 	}
 }
 
+// ClusterStreamServerInterceptor is the streaming counterpart of ClusterUnaryServerInterceptor: it checks the cluster
+// label found in the incoming gRPC metadata of a stream before calling the handler.
+// If an empty cluster label or nil logger are provided, ClusterStreamServerInterceptor panics.
+// If the softValidation parameter is true, errors related to the cluster label validation are logged, but not returned.
+// Otherwise, an error is returned.
+func ClusterStreamServerInterceptor(cluster string, softValidation bool, invalidClusterRequests *prometheus.CounterVec, logger log.Logger) grpc.StreamServerInterceptor {
+	validateClusterServerInterceptorInputParameters(cluster, logger)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		// We skip the gRPC health check.
+		if _, ok := srv.(healthpb.HealthServer); ok {
+			return handler(srv, ss)
+		}
+
+		if err := checkClusterFromIncomingContext(ss.Context(), info.FullMethod, cluster, softValidation, invalidClusterRequests, logger); err != nil {
+			stat := grpcutil.Status(codes.FailedPrecondition, err.Error(), &grpcutil.ErrorDetails{Cause: grpcutil.WRONG_CLUSTER_VALIDATION_LABEL})
+			return stat.Err()
+		}
+		return handler(srv, ss)
+	}
+}
+
 func validateClusterServerInterceptorInputParameters(cluster string, logger log.Logger) {
 	if cluster == "" {
 		panic("no cluster label provided")
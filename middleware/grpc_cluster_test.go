@@ -273,6 +273,140 @@ func TestClusterUnaryServerInterceptorWithHealthServer(t *testing.T) {
 	}
 }
 
+func TestClusterStreamClientInterceptor(t *testing.T) {
+	wrongClusterErr := grpcutil.Status(codes.FailedPrecondition, `request intended for cluster "cluster" - this is cluster "another-cluster"`, &grpcutil.ErrorDetails{Cause: grpcutil.WRONG_CLUSTER_VALIDATION_LABEL}).Err()
+	expectedErr := grpcutil.Status(codes.Internal, `request rejected by the server: request intended for cluster "cluster" - this is cluster "another-cluster"`).Err()
+
+	testCases := map[string]struct {
+		streamerErr     error
+		recvErr         error
+		expectedErr     error
+		expectedRecvErr error
+		expectedReports int
+	}{
+		"if the streamer succeeds the cluster label is propagated": {},
+		"if the streamer returns a wrong cluster error it is handled by the interceptor": {
+			streamerErr:     wrongClusterErr,
+			expectedErr:     expectedErr,
+			expectedReports: 1,
+		},
+		"if the stream returns a wrong cluster error on receive it is handled by the interceptor": {
+			recvErr:         wrongClusterErr,
+			expectedRecvErr: expectedErr,
+			expectedReports: 1,
+		},
+		"if the stream returns a generic error on receive the error is propagated": {
+			recvErr:         errors.New("generic error"),
+			expectedRecvErr: errors.New("generic error"),
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			reports := 0
+			interceptor := ClusterStreamClientInterceptor("cluster", func(string, string) { reports++ })
+			streamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+				md, ok := metadata.FromOutgoingContext(ctx)
+				require.True(t, ok)
+				require.Equal(t, []string{"cluster"}, md[clusterutil.MetadataClusterValidationLabelKey])
+				if testCase.streamerErr != nil {
+					return nil, testCase.streamerErr
+				}
+				return &mockClientStream{recvErr: testCase.recvErr}, nil
+			}
+
+			stream, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/Test/Me", streamer)
+			if testCase.expectedErr != nil {
+				require.Equal(t, testCase.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				err = stream.RecvMsg(nil)
+				if testCase.expectedRecvErr != nil {
+					require.Equal(t, testCase.expectedRecvErr, err)
+				} else {
+					require.NoError(t, err)
+				}
+			}
+			require.Equal(t, testCase.expectedReports, reports)
+		})
+	}
+}
+
+func TestClusterStreamServerInterceptor(t *testing.T) {
+	testCases := map[string]struct {
+		srv             interface{}
+		incomingContext context.Context
+		softValidation  bool
+		expectedErr     error
+		expectedMetrics string
+	}{
+		"equal request and server clusters give no error": {
+			incomingContext: newIncomingContext(true, "cluster"),
+		},
+		"different request and server clusters give an error if soft validation disabled": {
+			incomingContext: newIncomingContext(true, "wrong-cluster"),
+			expectedErr:     grpcutil.Status(codes.FailedPrecondition, `rejected request with wrong cluster validation label "wrong-cluster" - it should be "cluster"`, &grpcutil.ErrorDetails{Cause: grpcutil.WRONG_CLUSTER_VALIDATION_LABEL}).Err(),
+			expectedMetrics: `
+				# HELP test_server_invalid_cluster_validation_label_requests_total Number of requests received by server with invalid cluster validation label.
+				# TYPE test_server_invalid_cluster_validation_label_requests_total counter
+				test_server_invalid_cluster_validation_label_requests_total{cluster_validation_label="cluster",method="/Test/Me",protocol="grpc",request_cluster_validation_label="wrong-cluster"} 1
+			`,
+		},
+		"different request and server clusters give no error if soft validation enabled": {
+			incomingContext: newIncomingContext(true, "wrong-cluster"),
+			softValidation:  true,
+			expectedMetrics: `
+				# HELP test_server_invalid_cluster_validation_label_requests_total Number of requests received by server with invalid cluster validation label.
+				# TYPE test_server_invalid_cluster_validation_label_requests_total counter
+				test_server_invalid_cluster_validation_label_requests_total{cluster_validation_label="cluster",method="/Test/Me",protocol="grpc",request_cluster_validation_label="wrong-cluster"} 1
+			`,
+		},
+		"healthpb.HealthServer does no cluster check": {
+			srv:             health.NewServer(),
+			incomingContext: newIncomingContext(true, "wrong-cluster"),
+		},
+	}
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			interceptor := ClusterStreamServerInterceptor("cluster", testCase.softValidation, NewInvalidClusterRequests(reg, "test"), log.NewNopLogger())
+			handlerCalled := false
+			handler := func(interface{}, grpc.ServerStream) error {
+				handlerCalled = true
+				return nil
+			}
+
+			err := interceptor(testCase.srv, &mockServerStream{ctx: testCase.incomingContext}, &grpc.StreamServerInfo{FullMethod: "/Test/Me"}, handler)
+			if testCase.expectedErr != nil {
+				require.Equal(t, testCase.expectedErr, err)
+				require.False(t, handlerCalled)
+			} else {
+				require.NoError(t, err)
+				require.True(t, handlerCalled)
+			}
+			err = testutil.GatherAndCompare(reg, strings.NewReader(testCase.expectedMetrics), "test_server_invalid_cluster_validation_label_requests_total")
+			require.NoError(t, err)
+		})
+	}
+}
+
+type mockClientStream struct {
+	grpc.ClientStream
+	recvErr error
+}
+
+func (s *mockClientStream) RecvMsg(interface{}) error {
+	return s.recvErr
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *mockServerStream) Context() context.Context {
+	return s.ctx
+}
+
 func createLogger(t *testing.T, buf *bytes.Buffer) log.Logger {
 	var lvl dskitlog.Level
 	require.NoError(t, lvl.Set("warn"))
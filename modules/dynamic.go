@@ -0,0 +1,265 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/dskit/services"
+)
+
+var (
+	errModuleServicesNotInitialised = errors.New("module services have not been initialised")
+	errModuleServicesStopping       = errors.New("module services are stopping")
+)
+
+// dynamicModules tracks the modules started at runtime by EnableModule, on top of the module services initialised
+// by InitModuleServices.
+type dynamicModules struct {
+	registry *serviceRegistry
+	shutdown *shutdown
+
+	// mtx serializes enabling and disabling modules.
+	mtx     sync.Mutex
+	enabled map[string]bool
+
+	// Dynamic modules are stopped as soon as any of the initial module services stops.
+	watchOnce sync.Once
+	stopping  atomic.Bool
+}
+
+func newDynamicModules(registry *serviceRegistry, shutdown *shutdown) *dynamicModules {
+	return &dynamicModules{
+		registry: registry,
+		shutdown: shutdown,
+		enabled:  map[string]bool{},
+	}
+}
+
+func (m *Manager) setDynamicModules(d *dynamicModules) {
+	m.dynamicMtx.Lock()
+	defer m.dynamicMtx.Unlock()
+	m.dynamic = d
+}
+
+func (m *Manager) dynamicModules() (*dynamicModules, error) {
+	m.dynamicMtx.Lock()
+	defer m.dynamicMtx.Unlock()
+	if m.dynamic == nil {
+		return nil, errModuleServicesNotInitialised
+	}
+	return m.dynamic, nil
+}
+
+// EnableModule initialises and starts the module at runtime, together with those of its dependencies which are not
+// running yet, on top of the module services returned by the last call to InitModuleServices. It returns once the
+// module is Running. If the module fails to start, the module services started by this call are stopped again.
+//
+// Modules enabled at runtime are stopped as soon as any of the module services returned by InitModuleServices
+// stops, so that they don't prevent the modules they depend on from stopping.
+func (m *Manager) EnableModule(ctx context.Context, name string) error {
+	d, err := m.dynamicModules()
+	if err != nil {
+		return err
+	}
+	if _, ok := m.modules[name]; !ok {
+		return fmt.Errorf("unrecognised module name: %s", name)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.stopping.Load() {
+		return errModuleServicesStopping
+	}
+	// A module enabled earlier whose services have stopped since, e.g. because one failed, is enabled again.
+	if d.enabled[name] && d.running(append(m.orderedDeps(name), name)) {
+		return nil
+	}
+	d.watchInitialServices()
+
+	var started []string
+	for _, n := range append(m.orderedDeps(name), name) {
+		if s := d.registry.get(n); s != nil {
+			switch state := s.State(); state {
+			case services.New, services.Starting, services.Running:
+				continue
+			case services.Stopping:
+				_ = d.stopModules(context.Background(), started)
+				return fmt.Errorf("module %s is still stopping", n)
+			default:
+				// Only services of modules enabled at runtime are started again, the initial ones are gone for good.
+				if !d.registry.isDynamic(n) {
+					_ = d.stopModules(context.Background(), started)
+					return fmt.Errorf("module %s is %v", n, state)
+				}
+			}
+		}
+
+		serv, err := m.initModuleService(n, d.registry, d.shutdown, true)
+		if err != nil {
+			_ = d.stopModules(context.Background(), started)
+			return err
+		}
+		if serv != nil {
+			d.registry.set(n, serv, true)
+			started = append(started, n)
+		}
+	}
+
+	// Module services wait for their dependencies, so they can all be started at once.
+	for _, n := range started {
+		if err := d.registry.get(n).StartAsync(context.Background()); err != nil {
+			_ = d.stopModules(context.Background(), started)
+			return errors.Wrapf(err, "error starting module: %s", n)
+		}
+	}
+	for _, n := range started {
+		if err := d.registry.get(n).AwaitRunning(ctx); err != nil {
+			_ = d.stopModules(context.Background(), started)
+			return errors.Wrapf(err, "starting module %s", n)
+		}
+	}
+
+	// Initial module services may have started stopping meanwhile, before new services were registered.
+	if d.stopping.Load() {
+		_ = d.stopModules(context.Background(), started)
+		return errModuleServicesStopping
+	}
+
+	level.Info(m.logger).Log("msg", "module enabled", "module", name, "started", fmt.Sprintf("%v", started))
+	d.enabled[name] = true
+	return nil
+}
+
+// DisableModule stops a module enabled with EnableModule, together with those of its dependencies which were
+// started at runtime and are not needed by any other module enabled at runtime anymore. Modules initialised by
+// InitModuleServices can't be disabled.
+func (m *Manager) DisableModule(ctx context.Context, name string) error {
+	d, err := m.dynamicModules()
+	if err != nil {
+		return err
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if !d.enabled[name] {
+		return fmt.Errorf("module %s has not been enabled at runtime", name)
+	}
+	delete(d.enabled, name)
+
+	needed := map[string]bool{}
+	for n := range d.enabled {
+		needed[n] = true
+		for _, dep := range m.listDeps(n) {
+			needed[dep] = true
+		}
+	}
+
+	dynamic := d.registry.snapshot(true)
+	var toStop []string
+	for _, n := range append(m.orderedDeps(name), name) {
+		if _, ok := dynamic[n]; ok && !needed[n] {
+			toStop = append(toStop, n)
+		}
+	}
+
+	if err := d.stopModules(ctx, toStop); err != nil {
+		return err
+	}
+	level.Info(m.logger).Log("msg", "module disabled", "module", name, "stopped", fmt.Sprintf("%v", toStop))
+	return nil
+}
+
+// EnabledModules returns the modules enabled with EnableModule, sorted by name.
+func (m *Manager) EnabledModules() []string {
+	d, err := m.dynamicModules()
+	if err != nil {
+		return nil
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	result := make([]string, 0, len(d.enabled))
+	for n := range d.enabled {
+		result = append(result, n)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// stopModules stops the services of the given dynamic modules, and removes them from the registry once terminated.
+// Module services wait for the modules depending on them to stop first.
+func (d *dynamicModules) stopModules(ctx context.Context, names []string) error {
+	names = slices.Clone(names)
+	slices.Reverse(names)
+
+	for _, n := range names {
+		if s := d.registry.get(n); s != nil {
+			s.StopAsync()
+		}
+	}
+
+	for _, n := range names {
+		s := d.registry.get(n)
+		if s == nil {
+			continue
+		}
+		// We don't care *how* service stops, as long as it is done.
+		_ = s.AwaitTerminated(ctx)
+		if state := s.State(); state != services.Terminated && state != services.Failed {
+			return ctx.Err()
+		}
+		d.registry.delete(n)
+	}
+	return nil
+}
+
+// running returns whether the services of the given modules are all starting or running.
+func (d *dynamicModules) running(names []string) bool {
+	for _, n := range names {
+		if s := d.registry.get(n); s != nil {
+			if state := s.State(); state != services.New && state != services.Starting && state != services.Running {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// watchInitialServices stops the dynamic modules once any of the initial module services stops.
+func (d *dynamicModules) watchInitialServices() {
+	d.watchOnce.Do(func() {
+		stopAll := func() {
+			if !d.stopping.CompareAndSwap(false, true) {
+				return
+			}
+			for _, s := range d.registry.snapshot(true) {
+				s.StopAsync()
+			}
+		}
+
+		for _, s := range d.registry.snapshot(false) {
+			s.AddListener(services.NewListener(nil, nil, func(services.State) {
+				stopAll()
+			}, func(services.State) {
+				stopAll()
+			}, func(services.State, error) {
+				stopAll()
+			}))
+
+			// The service may have stopped before the listener was added.
+			if state := s.State(); state == services.Stopping || state == services.Terminated || state == services.Failed {
+				stopAll()
+			}
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+// trackedModules registers modules whose latest underlying services can be inspected.
+type trackedModules struct {
+	mtx      sync.Mutex
+	services map[string]services.Service
+}
+
+func (tm *trackedModules) initFn(name string, startErr error) func() (services.Service, error) {
+	return func() (services.Service, error) {
+		s := services.NewIdleService(func(context.Context) error { return startErr }, nil)
+
+		tm.mtx.Lock()
+		defer tm.mtx.Unlock()
+		tm.services[name] = s
+		return s, nil
+	}
+}
+
+func (tm *trackedModules) state(name string) services.State {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	return tm.services[name].State()
+}
+
+func newDynamicTestManager(t *testing.T) (*Manager, *trackedModules, *services.Manager) {
+	tm := &trackedModules{services: map[string]services.Service{}}
+
+	m := NewManager(log.NewNopLogger())
+	m.RegisterModule("server", tm.initFn("server", nil))
+	m.RegisterModule("exporter", tm.initFn("exporter", nil))
+	m.RegisterModule("store", tm.initFn("store", nil))
+	m.RegisterModule("compactor", tm.initFn("compactor", nil))
+	m.RegisterModule("reader", tm.initFn("reader", nil))
+	m.RegisterModule("broken", tm.initFn("broken", errors.New("failed to start")))
+	require.NoError(t, m.AddDependency("exporter", "server"))
+	require.NoError(t, m.AddDependency("store", "server"))
+	require.NoError(t, m.AddDependency("compactor", "store"))
+	require.NoError(t, m.AddDependency("reader", "store"))
+	require.NoError(t, m.AddDependency("broken", "store"))
+
+	servs, err := m.InitModuleServices("server")
+	require.NoError(t, err)
+	require.Len(t, servs, 1)
+
+	manager, err := services.NewManager(servs["server"])
+	require.NoError(t, err)
+	require.NoError(t, services.StartManagerAndAwaitHealthy(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopManagerAndAwaitStopped(context.Background(), manager))
+	})
+	return m, tm, manager
+}
+
+func TestManager_EnableDisableModule(t *testing.T) {
+	ctx := context.Background()
+	m, tm, _ := newDynamicTestManager(t)
+
+	require.NoError(t, m.EnableModule(ctx, "compactor"))
+	assert.Equal(t, services.Running, tm.state("store"))
+	assert.Equal(t, services.Running, tm.state("compactor"))
+
+	// Enabling a module twice is a no-op.
+	require.NoError(t, m.EnableModule(ctx, "compactor"))
+	require.NoError(t, m.EnableModule(ctx, "reader"))
+	assert.Equal(t, []string{"compactor", "reader"}, m.EnabledModules())
+
+	// The store is still needed by the reader.
+	require.NoError(t, m.DisableModule(ctx, "compactor"))
+	assert.Equal(t, services.Terminated, tm.state("compactor"))
+	assert.Equal(t, services.Running, tm.state("store"))
+
+	require.NoError(t, m.DisableModule(ctx, "reader"))
+	assert.Equal(t, services.Terminated, tm.state("reader"))
+	assert.Equal(t, services.Terminated, tm.state("store"))
+	assert.Equal(t, services.Running, tm.state("server"))
+	assert.Empty(t, m.EnabledModules())
+
+	// Disabled modules can be enabled again, with new services.
+	require.NoError(t, m.EnableModule(ctx, "compactor"))
+	assert.Equal(t, services.Running, tm.state("store"))
+	assert.Equal(t, services.Running, tm.state("compactor"))
+	require.NoError(t, m.DisableModule(ctx, "compactor"))
+
+	require.ErrorContains(t, m.DisableModule(ctx, "server"), "has not been enabled at runtime")
+	require.ErrorContains(t, m.EnableModule(ctx, "unknown"), "unrecognised module name")
+}
+
+func TestManager_EnableModuleFailure(t *testing.T) {
+	ctx := context.Background()
+	m, tm, _ := newDynamicTestManager(t)
+
+	require.ErrorContains(t, m.EnableModule(ctx, "broken"), "failed to start")
+	assert.Equal(t, services.Terminated, tm.state("store"))
+	assert.Empty(t, m.EnabledModules())
+
+	require.NoError(t, m.EnableModule(ctx, "reader"))
+	require.NoError(t, m.DisableModule(ctx, "reader"))
+}
+
+func TestManager_EnableModuleAgainAfterStopping(t *testing.T) {
+	ctx := context.Background()
+	m, tm, _ := newDynamicTestManager(t)
+
+	require.NoError(t, m.EnableModule(ctx, "reader"))
+	reader := tm.services["reader"]
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, reader))
+	require.NoError(t, m.dynamic.registry.get("reader").AwaitTerminated(ctx))
+
+	// The reader has stopped on its own, so it's started again with a new service.
+	require.NoError(t, m.EnableModule(ctx, "reader"))
+	assert.NotSame(t, reader, tm.services["reader"])
+	assert.Equal(t, services.Running, tm.state("reader"))
+	assert.Equal(t, []string{"reader"}, m.EnabledModules())
+	require.NoError(t, m.DisableModule(ctx, "reader"))
+}
+
+func TestManager_DisableModuleDoesntStartShutdownDeadline(t *testing.T) {
+	ctx := context.Background()
+	const timeout = 100 * time.Millisecond
+
+	m := NewManager(log.NewNopLogger())
+	m.SetShutdownConfig(ShutdownConfig{Timeout: timeout, OnStopTimeout: AbortOnStopTimeout})
+	m.RegisterModule("server", func() (services.Service, error) {
+		// The server takes a while to stop, so that it can't stop once the deadline has passed.
+		return services.NewIdleService(nil, func(error) error {
+			time.Sleep(timeout / 2)
+			return nil
+		}), nil
+	})
+	m.RegisterModule("store", mockInitFunc)
+	require.NoError(t, m.AddDependency("store", "server"))
+
+	servs, err := m.InitModuleServices("server")
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, servs["server"]))
+
+	require.NoError(t, m.EnableModule(ctx, "store"))
+	require.NoError(t, m.DisableModule(ctx, "store"))
+	time.Sleep(2 * timeout)
+
+	// The shutdown deadline starts when the server stops, not when the store was disabled.
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, servs["server"]))
+	assert.NoError(t, servs["server"].FailureCase())
+}
+
+func TestManager_EnableModuleStoppedOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	m, tm, manager := newDynamicTestManager(t)
+
+	require.NoError(t, m.EnableModule(ctx, "exporter"))
+	require.NoError(t, m.EnableModule(ctx, "compactor"))
+
+	// The server waits for the modules enabled at runtime to stop.
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, services.StopManagerAndAwaitStopped(stopCtx, manager))
+	assert.Equal(t, services.Terminated, tm.state("exporter"))
+	assert.Equal(t, services.Terminated, tm.state("compactor"))
+	assert.Equal(t, services.Terminated, tm.state("store"))
+
+	require.ErrorIs(t, m.EnableModule(ctx, "reader"), errModuleServicesStopping)
+}
+
+func TestManager_EnableModuleNotInitialised(t *testing.T) {
+	m := NewManager(log.NewNopLogger())
+	m.RegisterModule("module", mockInitFunc)
+
+	require.ErrorIs(t, m.EnableModule(context.Background(), "module"), errModuleServicesNotInitialised)
+}
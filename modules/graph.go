@@ -0,0 +1,287 @@
+package modules
+
+import (
+	_ "embed" // Used to embed html template
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/grafana/dskit/services"
+)
+
+//go:embed graph.gohtml
+var graphPageContent string
+var graphPageTemplate = template.Must(template.New("webpage").Parse(graphPageContent))
+
+// GraphFormat is a format the module dependency graph can be exported to.
+type GraphFormat string
+
+// Supported graph formats.
+const (
+	GraphFormatDOT     GraphFormat = "dot"
+	GraphFormatMermaid GraphFormat = "mermaid"
+	GraphFormatJSON    GraphFormat = "json"
+)
+
+// DependencyGraph is the dependency graph of modules.
+type DependencyGraph struct {
+	Modules []GraphModule `json:"modules"`
+}
+
+// GraphModule is a module in a DependencyGraph.
+type GraphModule struct {
+	Name string `json:"name"`
+
+	// Dependencies are the direct dependencies of the module, sorted by name.
+	Dependencies []string `json:"dependencies"`
+
+	UserVisible bool `json:"user_visible"`
+	Targetable  bool `json:"targetable"`
+
+	// State is the state of the module service, if known.
+	State string `json:"state,omitempty"`
+}
+
+// DependencyGraph returns the dependency graph of the given target modules and all their dependencies, or of all
+// the registered modules if no target is given. Modules are sorted by name. The states of the module services
+// are set from servicesMap, as returned by InitModuleServices, if not nil.
+func (m *Manager) DependencyGraph(servicesMap map[string]services.Service, targets ...string) (DependencyGraph, error) {
+	names := map[string]bool{}
+	if len(targets) == 0 {
+		for name := range m.modules {
+			names[name] = true
+		}
+	}
+	for _, target := range targets {
+		if _, ok := m.modules[target]; !ok {
+			return DependencyGraph{}, fmt.Errorf("unrecognised module name: %s", target)
+		}
+		names[target] = true
+		for _, dep := range m.listDeps(target) {
+			names[dep] = true
+		}
+	}
+
+	graph := DependencyGraph{Modules: make([]GraphModule, 0, len(names))}
+	for name := range names {
+		mod := m.modules[name]
+
+		deps := slices.Clone(mod.deps)
+		sort.Strings(deps)
+
+		gm := GraphModule{
+			Name:         name,
+			Dependencies: slices.Compact(deps),
+			UserVisible:  mod.userVisible,
+			Targetable:   mod.targetable,
+		}
+		if s, ok := servicesMap[name]; ok && s != nil {
+			gm.State = s.State().String()
+		}
+		graph.Modules = append(graph.Modules, gm)
+	}
+
+	sort.Slice(graph.Modules, func(i, j int) bool {
+		return graph.Modules[i].Name < graph.Modules[j].Name
+	})
+	return graph, nil
+}
+
+// Export returns the graph in the given format.
+func (g DependencyGraph) Export(format GraphFormat) (string, error) {
+	switch format {
+	case GraphFormatDOT:
+		return g.dot(), nil
+	case GraphFormatMermaid:
+		return g.mermaid(), nil
+	case GraphFormatJSON:
+		out, err := json.MarshalIndent(g, "", "  ")
+		return string(out), err
+	default:
+		return "", fmt.Errorf("unsupported graph format: %s", format)
+	}
+}
+
+func (g DependencyGraph) dot() string {
+	sb := strings.Builder{}
+	sb.WriteString("digraph modules {\n")
+	for _, mod := range g.Modules {
+		label := mod.Name
+		if mod.State != "" {
+			label += "\n" + mod.State
+		}
+		style := ""
+		if !mod.UserVisible {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "  %q [label=%q%s];\n", mod.Name, label, style)
+	}
+	for _, mod := range g.Modules {
+		for _, dep := range mod.Dependencies {
+			fmt.Fprintf(&sb, "  %q -> %q;\n", mod.Name, dep)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (g DependencyGraph) mermaid() string {
+	// Module names may contain characters not allowed in Mermaid node IDs, so nodes are identified by index.
+	ids := make(map[string]string, len(g.Modules))
+	for i, mod := range g.Modules {
+		ids[mod.Name] = fmt.Sprintf("m%d", i)
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("graph TD\n")
+	for _, mod := range g.Modules {
+		label := mod.Name
+		if mod.State != "" {
+			label += " (" + mod.State + ")"
+		}
+		fmt.Fprintf(&sb, "  %s[\"%s\"]\n", ids[mod.Name], strings.ReplaceAll(label, `"`, "#quot;"))
+	}
+	for _, mod := range g.Modules {
+		for _, dep := range mod.Dependencies {
+			fmt.Fprintf(&sb, "  %s --> %s\n", ids[mod.Name], ids[dep])
+		}
+	}
+	return sb.String()
+}
+
+// DependencyGraphHandler returns an HTTP handler showing the dependency graph of the target modules, with the
+// state of their services from servicesMap, as returned by InitModuleServices. The graph is exported in the
+// format given by the "format" query parameter, or returned as JSON if requested via the Accept header, or as
+// an HTML page otherwise.
+func (m *Manager) DependencyGraphHandler(servicesMap map[string]services.Service, targets ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		graph, err := m.DependencyGraph(servicesMap, targets...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := GraphFormat(req.URL.Query().Get("format"))
+		if format == "" && strings.Contains(req.Header.Get("Accept"), "application/json") {
+			format = GraphFormatJSON
+		}
+
+		if format != "" {
+			out, err := graph.Export(format)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if format == GraphFormatJSON {
+				w.Header().Set("Content-Type", "application/json")
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			_, _ = w.Write([]byte(out))
+			return
+		}
+
+		data := graphPageData{
+			Targets: targets,
+			Modules: graph.Modules,
+			Issues:  m.ValidateDependencyGraph(),
+			Mermaid: graph.mermaid(),
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err := graphPageTemplate.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+type graphPageData struct {
+	Targets []string
+	Modules []GraphModule
+	Issues  []GraphIssue
+	Mermaid string
+}
+
+// GraphIssueKind is the kind of issue found by ValidateDependencyGraph.
+type GraphIssueKind string
+
+const (
+	// GraphIssueUnreachable is a module which is neither targetable nor a dependency of any targetable module,
+	// so it can never be initialised.
+	GraphIssueUnreachable GraphIssueKind = "unreachable"
+
+	// GraphIssueRedundantEdge is a direct dependency which is also a transitive dependency through another
+	// direct dependency.
+	GraphIssueRedundantEdge GraphIssueKind = "redundant-edge"
+)
+
+// GraphIssue is an issue found in the module dependency graph.
+type GraphIssue struct {
+	Kind   GraphIssueKind `json:"kind"`
+	Module string         `json:"module"`
+
+	// Dependency is the redundant dependency, for GraphIssueRedundantEdge.
+	Dependency string `json:"dependency,omitempty"`
+}
+
+func (i GraphIssue) String() string {
+	switch i.Kind {
+	case GraphIssueUnreachable:
+		return fmt.Sprintf("module %s is not targetable, and no targetable module depends on it", i.Module)
+	case GraphIssueRedundantEdge:
+		return fmt.Sprintf("dependency of module %s on %s is redundant, because it's a transitive dependency", i.Module, i.Dependency)
+	default:
+		return fmt.Sprintf("%s: %s", i.Kind, i.Module)
+	}
+}
+
+// ValidateDependencyGraph returns the issues found in the dependency graph of all registered modules, sorted
+// by module. These issues don't prevent modules from being initialised, but usually point to mistakes.
+func (m *Manager) ValidateDependencyGraph() []GraphIssue {
+	reachable := map[string]bool{}
+	for name, mod := range m.modules {
+		if !mod.targetable {
+			continue
+		}
+		reachable[name] = true
+		for _, dep := range m.listDeps(name) {
+			reachable[dep] = true
+		}
+	}
+
+	var issues []GraphIssue
+	for name, mod := range m.modules {
+		if !reachable[name] {
+			issues = append(issues, GraphIssue{Kind: GraphIssueUnreachable, Module: name})
+		}
+
+		// A direct dependency is redundant if it's reachable through another direct dependency.
+		transitive := map[string]bool{}
+		for _, dep := range mod.deps {
+			for _, d := range m.listDeps(dep) {
+				transitive[d] = true
+			}
+		}
+		reported := map[string]bool{}
+		for _, dep := range mod.deps {
+			if transitive[dep] && !reported[dep] {
+				reported[dep] = true
+				issues = append(issues, GraphIssue{Kind: GraphIssueRedundantEdge, Module: name, Dependency: dep})
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Module != issues[j].Module {
+			return issues[i].Module < issues[j].Module
+		}
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Dependency < issues[j].Dependency
+	})
+	return issues
+}
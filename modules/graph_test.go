@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+func newGraphTestManager(t *testing.T) *Manager {
+	m := NewManager(log.NewNopLogger())
+	m.RegisterModule("server", mockInitFunc, UserInvisibleModule)
+	m.RegisterModule("store", mockInitFunc)
+	m.RegisterModule("querier", mockInitFunc)
+	m.RegisterModule("all", nil)
+	m.RegisterModule("unused", nil, UserInvisibleModule)
+	require.NoError(t, m.AddDependency("store", "server"))
+	require.NoError(t, m.AddDependency("querier", "store", "server"))
+	require.NoError(t, m.AddDependency("all", "querier"))
+	return m
+}
+
+func TestManager_DependencyGraph(t *testing.T) {
+	m := newGraphTestManager(t)
+
+	graph, err := m.DependencyGraph(nil)
+	require.NoError(t, err)
+	require.Len(t, graph.Modules, 5)
+
+	graph, err = m.DependencyGraph(nil, "querier")
+	require.NoError(t, err)
+	assert.Equal(t, []GraphModule{
+		{Name: "querier", Dependencies: []string{"server", "store"}, UserVisible: true, Targetable: true},
+		{Name: "server", Dependencies: nil, UserVisible: false, Targetable: false},
+		{Name: "store", Dependencies: []string{"server"}, UserVisible: true, Targetable: true},
+	}, graph.Modules)
+
+	_, err = m.DependencyGraph(nil, "unknown")
+	require.Error(t, err)
+
+	dot, err := graph.Export(GraphFormatDOT)
+	require.NoError(t, err)
+	assert.Equal(t, `digraph modules {
+  "querier" [label="querier"];
+  "server" [label="server", style=dashed];
+  "store" [label="store"];
+  "querier" -> "server";
+  "querier" -> "store";
+  "store" -> "server";
+}
+`, dot)
+
+	mermaid, err := graph.Export(GraphFormatMermaid)
+	require.NoError(t, err)
+	assert.Equal(t, `graph TD
+  m0["querier"]
+  m1["server"]
+  m2["store"]
+  m0 --> m1
+  m0 --> m2
+  m2 --> m1
+`, mermaid)
+
+	encoded, err := graph.Export(GraphFormatJSON)
+	require.NoError(t, err)
+	var decoded DependencyGraph
+	require.NoError(t, json.Unmarshal([]byte(encoded), &decoded))
+	assert.Equal(t, graph, decoded)
+
+	_, err = graph.Export("svg")
+	require.Error(t, err)
+}
+
+func TestManager_ValidateDependencyGraph(t *testing.T) {
+	m := newGraphTestManager(t)
+	m.RegisterModule("hidden", nil, UserInvisibleModule)
+
+	assert.Equal(t, []GraphIssue{
+		{Kind: GraphIssueUnreachable, Module: "hidden"},
+		{Kind: GraphIssueRedundantEdge, Module: "querier", Dependency: "server"},
+		{Kind: GraphIssueUnreachable, Module: "unused"},
+	}, m.ValidateDependencyGraph())
+}
+
+func TestManager_DependencyGraphHandler(t *testing.T) {
+	m := newGraphTestManager(t)
+	servs, err := m.InitModuleServices("querier")
+	require.NoError(t, err)
+
+	manager, err := services.NewManager(servs["server"], servs["store"], servs["querier"])
+	require.NoError(t, err)
+	require.NoError(t, services.StartManagerAndAwaitHealthy(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopManagerAndAwaitStopped(context.Background(), manager))
+	})
+
+	handler := m.DependencyGraphHandler(servs, "querier")
+
+	req := httptest.NewRequest(http.MethodGet, "/modules", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var graph DependencyGraph
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &graph))
+	require.Len(t, graph.Modules, 3)
+	for _, mod := range graph.Modules {
+		assert.Equal(t, services.Running.String(), mod.State)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/modules?format=dot", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"server" [label="server\nRunning", style=dashed];`)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/modules?format=svg", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/modules", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "<td>querier</td>")
+	assert.Contains(t, rec.Body.String(), "dependency of module querier on server is redundant")
+}
@@ -3,6 +3,10 @@ package modules
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -25,6 +29,91 @@ type moduleService struct {
 
 	// startDeps, stopDeps return map of service names to services
 	startDeps, stopDeps func(string) map[string]services.Service
+
+	// shutdown is shared by all module services of the Manager, and may be nil.
+	shutdown    *shutdown
+	stopTimeout time.Duration
+
+	// dynamic is true for module services enabled at runtime, whose stop doesn't start the shutdown.
+	dynamic bool
+}
+
+// shutdown tracks the deadline for all module services to stop, which starts when the first module service
+// initialised by InitModuleServices stops.
+type shutdown struct {
+	cfg ShutdownConfig
+
+	deadlineOnce sync.Once
+	deadline     time.Time
+	// started is closed once the deadline is set.
+	started chan struct{}
+
+	// Goroutines are only dumped once, even if many modules are stuck.
+	dumpOnce sync.Once
+}
+
+func newShutdown(cfg ShutdownConfig) *shutdown {
+	return &shutdown{cfg: cfg, started: make(chan struct{})}
+}
+
+// context returns a context canceled at the shutdown deadline. If start is true, the shutdown is started if not
+// started yet. Otherwise, the context is canceled at the deadline once another module service starts the shutdown.
+func (s *shutdown) context(start bool) (context.Context, context.CancelFunc) {
+	if s == nil || s.cfg.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	if start {
+		s.deadlineOnce.Do(func() {
+			s.deadline = time.Now().Add(s.cfg.Timeout)
+			close(s.started)
+		})
+	}
+
+	select {
+	case <-s.started:
+		return context.WithDeadline(context.Background(), s.deadline)
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.started:
+		}
+
+		timer := time.NewTimer(time.Until(s.deadline))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+func (s *shutdown) policy() StopTimeoutPolicy {
+	if s == nil {
+		return ContinueOnStopTimeout
+	}
+	return s.cfg.OnStopTimeout
+}
+
+// reportStuck logs the modules which didn't stop in time, with a dump of all goroutines the first time.
+func (s *shutdown) reportStuck(logger log.Logger, msg string, module string, stuck []string) {
+	dumped := false
+	if s != nil {
+		s.dumpOnce.Do(func() {
+			dumped = true
+			level.Error(logger).Log("msg", msg, "module", module, "stuck", strings.Join(stuck, ", "), "goroutines", services.GoroutineDump())
+		})
+	}
+	if !dumped {
+		level.Error(logger).Log("msg", msg, "module", module, "stuck", strings.Join(stuck, ", "))
+	}
 }
 
 type delegatedNamedService struct {
@@ -41,12 +130,19 @@ func (n delegatedNamedService) ServiceName() string {
 // If any dependency fails to start, this service fails as well.
 // On stop, errors from failed dependencies are ignored.
 func NewModuleService(name string, logger log.Logger, service services.Service, startDeps, stopDeps func(string) map[string]services.Service) services.Service {
+	return newModuleService(name, logger, service, startDeps, stopDeps, nil, 0, false)
+}
+
+func newModuleService(name string, logger log.Logger, service services.Service, startDeps, stopDeps func(string) map[string]services.Service, shutdown *shutdown, stopTimeout time.Duration, dynamic bool) services.Service {
 	w := &moduleService{
-		name:      name,
-		logger:    logger,
-		service:   service,
-		startDeps: startDeps,
-		stopDeps:  stopDeps,
+		name:        name,
+		logger:      logger,
+		service:     service,
+		startDeps:   startDeps,
+		stopDeps:    stopDeps,
+		shutdown:    shutdown,
+		stopTimeout: stopTimeout,
+		dynamic:     dynamic,
 	}
 
 	w.Service = services.NewBasicService(w.start, w.run, w.stop)
@@ -105,11 +201,12 @@ func (w *moduleService) stop(_ error) error {
 	var err error
 	if w.service.State() == services.Running {
 		// Only wait for other modules, if underlying service is still running.
-		w.waitForModulesToStop()
+		err = w.waitForModulesToStop()
+		if err == nil {
+			level.Debug(w.logger).Log("msg", "stopping", "module", w.name)
 
-		level.Debug(w.logger).Log("msg", "stopping", "module", w.name)
-
-		err = services.StopAndAwaitTerminated(context.Background(), w.service)
+			err = w.stopService()
+		}
 	} else {
 		err = w.service.FailureCase()
 	}
@@ -122,8 +219,13 @@ func (w *moduleService) stop(_ error) error {
 	return err
 }
 
-func (w *moduleService) waitForModulesToStop() {
-	// wait until all stopDeps have stopped
+// waitForModulesToStop waits until all stopDeps have stopped, or the shutdown deadline is reached. With the
+// AbortOnStopTimeout policy, it returns an error if any of them is stuck, or was aborted itself.
+func (w *moduleService) waitForModulesToStop() error {
+	ctx, cancel := w.shutdown.context(!w.dynamic)
+	defer cancel()
+
+	var stuck, aborted []string
 	stopDeps := w.stopDeps(w.name)
 	for n, s := range stopDeps {
 		if s == nil {
@@ -131,8 +233,44 @@ func (w *moduleService) waitForModulesToStop() {
 		}
 
 		level.Debug(w.logger).Log("msg", "module waiting for", "module", w.name, "waiting_for", n)
-		// Passed context isn't canceled, so we can only get error here, if service
-		// fails. But we don't care *how* service stops, as long as it is done.
-		_ = s.AwaitTerminated(context.Background())
+		// Passed context is only canceled at the shutdown deadline, otherwise we can only get error here if
+		// service fails. But we don't care *how* service stops, as long as it is done.
+		_ = s.AwaitTerminated(ctx)
+
+		if state := s.State(); state != services.Terminated && state != services.Failed {
+			stuck = append(stuck, n)
+		} else if errors.Is(s.FailureCase(), services.ErrStopTimeout) {
+			aborted = append(aborted, n)
+		}
 	}
+
+	sort.Strings(stuck)
+	if len(stuck) > 0 {
+		w.shutdown.reportStuck(w.logger, "modules depending on module did not stop before the shutdown deadline", w.name, stuck)
+	}
+
+	if w.shutdown.policy() != AbortOnStopTimeout || len(stuck)+len(aborted) == 0 {
+		return nil
+	}
+
+	sort.Strings(aborted)
+	return fmt.Errorf("%w: not stopping module %s, because modules depending on it did not stop: %s", services.ErrStopTimeout, w.name, strings.Join(append(stuck, aborted...), ", "))
+}
+
+// stopService stops the underlying service, waiting up to the module stop timeout and the shutdown deadline.
+func (w *moduleService) stopService() error {
+	ctx, cancel := w.shutdown.context(!w.dynamic)
+	defer cancel()
+	if w.stopTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, w.stopTimeout)
+		defer cancelTimeout()
+	}
+
+	_ = services.StopAndAwaitTerminated(ctx, w.service)
+	if state := w.service.State(); state != services.Terminated && state != services.Failed {
+		w.shutdown.reportStuck(w.logger, "module did not stop before the deadline", w.name, []string{w.name})
+		return fmt.Errorf("%w: module %s did not stop", services.ErrStopTimeout, w.name)
+	}
+	return w.service.FailureCase()
 }
@@ -1,18 +1,78 @@
 package modules
 
 import (
+	"sync"
+	"time"
+
 	"github.com/go-kit/log"
 
 	"github.com/grafana/dskit/services"
 )
 
+// serviceRegistry holds the module services by module name. Modules can be added and removed at runtime, so
+// module services look up their dependencies through the registry when they start and stop.
+type serviceRegistry struct {
+	mtx      sync.RWMutex
+	services map[string]services.Service
+
+	// dynamic are the modules started at runtime by Manager.EnableModule.
+	dynamic map[string]bool
+}
+
+func newServiceRegistry() *serviceRegistry {
+	return &serviceRegistry{
+		services: map[string]services.Service{},
+		dynamic:  map[string]bool{},
+	}
+}
+
+func (r *serviceRegistry) get(name string) services.Service {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.services[name]
+}
+
+func (r *serviceRegistry) isDynamic(name string) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.dynamic[name]
+}
+
+func (r *serviceRegistry) set(name string, s services.Service, dynamic bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.services[name] = s
+	r.dynamic[name] = dynamic
+}
+
+func (r *serviceRegistry) delete(name string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.services, name)
+	delete(r.dynamic, name)
+}
+
+// snapshot returns a copy of the module services, either the dynamic ones or the other ones.
+func (r *serviceRegistry) snapshot(dynamic bool) map[string]services.Service {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	result := map[string]services.Service{}
+	for name, s := range r.services {
+		if r.dynamic[name] == dynamic {
+			result[name] = s
+		}
+	}
+	return result
+}
+
 // This function wraps module service, and adds waiting for dependencies to start before starting,
 // and dependant modules to stop before stopping this module service.
-func newModuleServiceWrapper(serviceMap map[string]services.Service, mod string, logger log.Logger, modServ services.Service, startDeps []string, stopDeps []string) services.Service {
+func newModuleServiceWrapper(registry *serviceRegistry, mod string, logger log.Logger, modServ services.Service, startDeps []string, stopDeps []string, shutdown *shutdown, stopTimeout time.Duration, dynamic bool) services.Service {
 	getDeps := func(deps []string) map[string]services.Service {
 		r := map[string]services.Service{}
 		for _, m := range deps {
-			s := serviceMap[m]
+			s := registry.get(m)
 			if s != nil {
 				r[m] = s
 			}
@@ -20,12 +80,13 @@ func newModuleServiceWrapper(serviceMap map[string]services.Service, mod string,
 		return r
 	}
 
-	return NewModuleService(mod, logger, modServ,
+	return newModuleService(mod, logger, modServ,
 		func(_ string) map[string]services.Service {
 			return getDeps(startDeps)
 		},
 		func(_ string) map[string]services.Service {
 			return getDeps(stopDeps)
 		},
+		shutdown, stopTimeout, dynamic,
 	)
 }
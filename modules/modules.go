@@ -3,6 +3,8 @@ package modules
 import (
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
@@ -23,13 +25,48 @@ type module struct {
 
 	// is the module allowed to be selected as a target
 	targetable bool
+
+	// maximum time for the module to stop, overriding ShutdownConfig.ModuleStopTimeout if not zero
+	stopTimeout time.Duration
+}
+
+// StopTimeoutPolicy defines how a module stops when the modules depending on it didn't stop before the
+// shutdown deadline.
+type StopTimeoutPolicy int
+
+const (
+	// ContinueOnStopTimeout stops the module anyway, so that the shutdown completes even if some modules are stuck.
+	ContinueOnStopTimeout StopTimeoutPolicy = iota
+
+	// AbortOnStopTimeout doesn't stop the module, because stuck modules may still be using it. The module fails
+	// with an error wrapping services.ErrStopTimeout, and so do the modules it depends on.
+	AbortOnStopTimeout
+)
+
+// ShutdownConfig configures the deadlines for stopping modules.
+type ShutdownConfig struct {
+	// Timeout is the maximum time for all modules to stop, from the moment the first module stops. Once reached,
+	// remaining modules are asked to stop, but not waited for. Zero means no timeout.
+	Timeout time.Duration
+
+	// ModuleStopTimeout is the maximum time for a module to stop, once the modules depending on it have stopped.
+	// It can be overridden per module with ModuleStopTimeout. Zero means no timeout.
+	ModuleStopTimeout time.Duration
+
+	// OnStopTimeout is the policy applied when the modules depending on a module didn't stop in time.
+	OnStopTimeout StopTimeoutPolicy
 }
 
 // Manager is a component that initialises modules of the application
 // in the right order of dependencies.
 type Manager struct {
-	modules map[string]*module
-	logger  log.Logger
+	modules     map[string]*module
+	logger      log.Logger
+	shutdownCfg ShutdownConfig
+
+	// dynamic tracks the modules enabled at runtime, on top of the last InitModuleServices call.
+	dynamicMtx sync.Mutex
+	dynamic    *dynamicModules
 }
 
 // UserInvisibleModule is an option for `RegisterModule` that marks module not visible to user. Modules are user visible by default.
@@ -49,6 +86,14 @@ func UserInvisibleTargetableModule(m *module) {
 	m.targetable = true
 }
 
+// ModuleStopTimeout is an option for `RegisterModule` that sets the maximum time for the module to stop, once the
+// modules depending on it have stopped. It overrides ShutdownConfig.ModuleStopTimeout.
+func ModuleStopTimeout(timeout time.Duration) func(m *module) {
+	return func(m *module) {
+		m.stopTimeout = timeout
+	}
+}
+
 // NewManager creates a new Manager
 func NewManager(logger log.Logger) *Manager {
 	return &Manager{
@@ -72,6 +117,12 @@ func (m *Manager) RegisterModule(name string, initFn func() (services.Service, e
 	}
 }
 
+// SetShutdownConfig sets the deadlines for stopping module services. It applies to module services initialised
+// by subsequent calls to InitModuleServices. By default, modules wait indefinitely for each other to stop.
+func (m *Manager) SetShutdownConfig(cfg ShutdownConfig) {
+	m.shutdownCfg = cfg
+}
+
 // AddDependency adds a dependency from name(source) to dependsOn(targets)
 // An error is returned if the source module name is not found
 func (m *Manager) AddDependency(name string, dependsOn ...string) error {
@@ -101,19 +152,23 @@ func (m *Manager) AddDependency(name string, dependsOn ...string) error {
 // in the right order. Modules are wrapped in such a way that they start after their
 // dependencies have been started and stop before their dependencies are stopped.
 func (m *Manager) InitModuleServices(modules ...string) (map[string]services.Service, error) {
-	servicesMap := map[string]services.Service{}
+	registry := newServiceRegistry()
 	initMap := map[string]bool{}
 
+	// The shutdown deadline is shared by all the module services.
+	shutdown := newShutdown(m.shutdownCfg)
+
 	for _, module := range modules {
-		if err := m.initModule(module, initMap, servicesMap); err != nil {
+		if err := m.initModule(module, initMap, registry, shutdown); err != nil {
 			return nil, err
 		}
 	}
 
-	return servicesMap, nil
+	m.setDynamicModules(newDynamicModules(registry, shutdown))
+	return registry.snapshot(false), nil
 }
 
-func (m *Manager) initModule(name string, initMap map[string]bool, servicesMap map[string]services.Service) error {
+func (m *Manager) initModule(name string, initMap map[string]bool, registry *serviceRegistry, shutdown *shutdown) error {
 	if _, ok := m.modules[name]; !ok {
 		return fmt.Errorf("unrecognised module name: %s", name)
 	}
@@ -128,25 +183,13 @@ func (m *Manager) initModule(name string, initMap map[string]bool, servicesMap m
 			continue
 		}
 
-		mod := m.modules[n]
-
-		var serv services.Service
-
-		if mod.initFn != nil {
-			s, err := mod.initFn()
-			if err != nil {
-				return errors.Wrap(err, fmt.Sprintf("error initialising module: %s", n))
-			}
-
-			if s != nil {
-				// We pass servicesMap, which isn't yet complete. By the time service starts,
-				// it will be fully built, so there is no need for extra synchronization.
-				serv = newModuleServiceWrapper(servicesMap, n, m.logger, s, m.DependenciesForModule(n), m.inverseDependenciesForModule(n))
-			}
+		serv, err := m.initModuleService(n, registry, shutdown, false)
+		if err != nil {
+			return err
 		}
 
 		if serv != nil {
-			servicesMap[n] = serv
+			registry.set(n, serv, false)
 		}
 
 		initMap[n] = true
@@ -155,6 +198,32 @@ func (m *Manager) initModule(name string, initMap map[string]bool, servicesMap m
 	return nil
 }
 
+// initModuleService initialises the service of a single module, wrapped to wait for its dependencies.
+// It returns nil if the module has no service. Services of modules enabled at runtime are dynamic.
+func (m *Manager) initModuleService(name string, registry *serviceRegistry, shutdown *shutdown, dynamic bool) (services.Service, error) {
+	mod := m.modules[name]
+	if mod.initFn == nil {
+		return nil, nil
+	}
+
+	s, err := mod.initFn()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("error initialising module: %s", name))
+	}
+	if s == nil {
+		return nil, nil
+	}
+
+	stopTimeout := mod.stopTimeout
+	if stopTimeout == 0 {
+		stopTimeout = m.shutdownCfg.ModuleStopTimeout
+	}
+
+	// We pass the registry, which isn't yet complete. By the time service starts,
+	// it will be fully built.
+	return newModuleServiceWrapper(registry, name, m.logger, s, m.DependenciesForModule(name), m.inverseDependenciesForModule(name), shutdown, stopTimeout, dynamic), nil
+}
+
 // UserVisibleModuleNames gets list of module names that are
 // user visible. Returned list is sorted in increasing order.
 func (m *Manager) UserVisibleModuleNames() []string {
@@ -436,3 +436,82 @@ func getStopDependenciesForModule(module string, services map[string]services.Se
 	sort.Strings(deps)
 	return deps
 }
+
+func TestModuleService_StopTimeouts(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		cfg                ShutdownConfig
+		moduleStopTimeout  time.Duration
+		expectedDepsStates services.State
+	}{
+		"module stop timeout, continue": {
+			moduleStopTimeout:  100 * time.Millisecond,
+			expectedDepsStates: services.Terminated,
+		},
+		"shutdown timeout, continue": {
+			cfg:                ShutdownConfig{Timeout: 100 * time.Millisecond},
+			expectedDepsStates: services.Terminated,
+		},
+		"module stop timeout, abort": {
+			cfg:                ShutdownConfig{OnStopTimeout: AbortOnStopTimeout},
+			moduleStopTimeout:  100 * time.Millisecond,
+			expectedDepsStates: services.Running,
+		},
+		"shutdown timeout, abort": {
+			cfg:                ShutdownConfig{Timeout: 100 * time.Millisecond, OnStopTimeout: AbortOnStopTimeout},
+			expectedDepsStates: services.Running,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			release := make(chan struct{})
+			underlying := map[string]services.Service{
+				"a": services.NewIdleService(nil, nil),
+				"b": services.NewIdleService(nil, nil),
+				"stuck": services.NewIdleService(nil, func(_ error) error {
+					<-release
+					return nil
+				}),
+			}
+			initFn := func(name string) func() (services.Service, error) {
+				return func() (services.Service, error) { return underlying[name], nil }
+			}
+
+			m := NewManager(log.NewNopLogger())
+			m.SetShutdownConfig(tc.cfg)
+			m.RegisterModule("a", initFn("a"))
+			m.RegisterModule("b", initFn("b"))
+			m.RegisterModule("stuck", initFn("stuck"), ModuleStopTimeout(tc.moduleStopTimeout))
+			require.NoError(t, m.AddDependency("b", "a"))
+			require.NoError(t, m.AddDependency("stuck", "b"))
+
+			servs, err := m.InitModuleServices("stuck")
+			require.NoError(t, err)
+			manager, err := services.NewManager(servs["a"], servs["b"], servs["stuck"])
+			require.NoError(t, err)
+			require.NoError(t, services.StartManagerAndAwaitHealthy(context.Background(), manager))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			require.NoError(t, services.StopManagerAndAwaitStopped(ctx, manager))
+
+			require.ErrorIs(t, servs["stuck"].FailureCase(), services.ErrStopTimeout)
+			assert.Equal(t, services.Stopping, underlying["stuck"].State())
+			// Once the shutdown deadline is reached, modules are asked to stop, but not waited for.
+			require.Eventually(t, func() bool {
+				return underlying["a"].State() == tc.expectedDepsStates && underlying["b"].State() == tc.expectedDepsStates
+			}, time.Second, time.Millisecond)
+			if tc.cfg.OnStopTimeout == AbortOnStopTimeout {
+				require.ErrorIs(t, servs["a"].FailureCase(), services.ErrStopTimeout)
+				require.ErrorIs(t, servs["b"].FailureCase(), services.ErrStopTimeout)
+			}
+
+			close(release)
+			for _, s := range underlying {
+				require.NoError(t, services.StopAndAwaitTerminated(context.Background(), s))
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package modules
+
+import (
+	_ "embed" // Used to embed html template
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/dskit/services"
+)
+
+//go:embed startup_profile.gohtml
+var startupProfilePageContent string
+var startupProfilePageTemplate = template.Must(template.New("webpage").Parse(startupProfilePageContent))
+
+// StartupStep is a module on the startup critical path.
+type StartupStep struct {
+	Module string `json:"module"`
+
+	// StartedAt is when the module started its own startup, once all its dependencies were running.
+	StartedAt time.Time `json:"started_at"`
+
+	// RunningAt is when the module reached the Running state.
+	RunningAt time.Time `json:"running_at"`
+
+	// Duration is how long the module took to start, not including the wait for its dependencies.
+	Duration time.Duration `json:"duration"`
+}
+
+// StartupCriticalPath returns the chain of modules which determined how long it took for all the modules to
+// start, in startup order: the last module to reach Running, the dependency it waited for the longest, and so on.
+// Module services must be watched by the recorder under their module name, for example by calling
+// recorder.WatchService(name, service) for each entry returned by InitModuleServices before starting them.
+func (m *Manager) StartupCriticalPath(recorder *services.TimelineRecorder) []StartupStep {
+	starting := map[string]time.Time{}
+	running := map[string]time.Time{}
+	for name := range m.modules {
+		timeline, ok := recorder.Timeline(name)
+		if !ok {
+			continue
+		}
+		startingAt, ok1 := timeline.TransitionTo(services.Starting)
+		runningAt, ok2 := timeline.TransitionTo(services.Running)
+		if ok1 && ok2 {
+			starting[name] = startingAt
+			running[name] = runningAt
+		}
+	}
+
+	// The critical path ends with the last module reaching Running.
+	names := make([]string, 0, len(running))
+	for name := range running {
+		names = append(names, name)
+	}
+	current := latestRunning(running, names)
+
+	var path []StartupStep
+	for current != "" {
+		// Modules wait for all their transitive dependencies to be running before starting.
+		dep := latestRunning(running, m.DependenciesForModule(current))
+
+		startedAt := starting[current]
+		if dep != "" && running[dep].After(startedAt) {
+			startedAt = running[dep]
+		}
+
+		path = append(path, StartupStep{
+			Module:    current,
+			StartedAt: startedAt,
+			RunningAt: running[current],
+			Duration:  running[current].Sub(startedAt),
+		})
+		current = dep
+	}
+
+	slices.Reverse(path)
+	return path
+}
+
+// latestRunning returns the module reaching Running last among names, or an empty string if none is running.
+func latestRunning(running map[string]time.Time, names []string) string {
+	result := ""
+	for _, name := range names {
+		t, ok := running[name]
+		if !ok {
+			continue
+		}
+		// Ties are broken by name, to get a deterministic result.
+		if result == "" || t.After(running[result]) || (t.Equal(running[result]) && name < result) {
+			result = name
+		}
+	}
+	return result
+}
+
+type startupProfile struct {
+	CriticalPath []StartupStep              `json:"critical_path"`
+	Services     []services.ServiceTimeline `json:"services"`
+}
+
+type startupProfilePageData struct {
+	CriticalPath []startupProfilePageRow
+	Services     []startupProfilePageRow
+}
+
+type startupProfilePageRow struct {
+	Name     string
+	State    string
+	Offset   time.Duration
+	Duration time.Duration
+	Failure  string
+}
+
+// StartupProfileHandler returns an HTTP handler exposing the startup timeline of the services recorded by
+// recorder and the startup critical path of the modules, as an HTML page or as JSON if requested via the
+// Accept header.
+func (m *Manager) StartupProfileHandler(recorder *services.TimelineRecorder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		profile := startupProfile{
+			CriticalPath: m.StartupCriticalPath(recorder),
+			Services:     recorder.Timelines(),
+		}
+
+		if strings.Contains(req.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(profile); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := startupProfilePageTemplate.Execute(w, newStartupProfilePageData(profile)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func newStartupProfilePageData(profile startupProfile) startupProfilePageData {
+	// Offsets are relative to the first service starting.
+	var origin time.Time
+	if len(profile.Services) > 0 {
+		origin, _ = profile.Services[0].TransitionTo(services.Starting)
+	}
+
+	data := startupProfilePageData{}
+	for _, step := range profile.CriticalPath {
+		data.CriticalPath = append(data.CriticalPath, startupProfilePageRow{
+			Name:     step.Module,
+			Offset:   step.StartedAt.Sub(origin),
+			Duration: step.Duration,
+		})
+	}
+
+	for _, timeline := range profile.Services {
+		row := startupProfilePageRow{Name: timeline.Name, State: services.New.String()}
+		if n := len(timeline.Transitions); n > 0 {
+			last := timeline.Transitions[n-1]
+			row.State = last.To.String()
+			row.Failure = last.Failure
+		}
+		if startingAt, ok := timeline.TransitionTo(services.Starting); ok {
+			row.Offset = startingAt.Sub(origin)
+		}
+		row.Duration, _ = timeline.StartingDuration()
+		data.Services = append(data.Services, row)
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+func TestManager_StartupCriticalPath(t *testing.T) {
+	sleepingInitFunc := func(d time.Duration) func() (services.Service, error) {
+		return func() (services.Service, error) {
+			return services.NewIdleService(func(context.Context) error {
+				time.Sleep(d)
+				return nil
+			}, nil), nil
+		}
+	}
+
+	// "slow" is the dependency "target" waits for the longest, and "fast" is not on the critical path.
+	m := NewManager(log.NewNopLogger())
+	m.RegisterModule("base", sleepingInitFunc(20*time.Millisecond))
+	m.RegisterModule("slow", sleepingInitFunc(100*time.Millisecond))
+	m.RegisterModule("fast", sleepingInitFunc(0))
+	m.RegisterModule("target", sleepingInitFunc(20*time.Millisecond))
+	require.NoError(t, m.AddDependency("slow", "base"))
+	require.NoError(t, m.AddDependency("fast", "base"))
+	require.NoError(t, m.AddDependency("target", "slow", "fast"))
+
+	servs, err := m.InitModuleServices("target")
+	require.NoError(t, err)
+
+	recorder := services.NewTimelineRecorder()
+	t.Cleanup(recorder.Close)
+	all := make([]services.Service, 0, len(servs))
+	for name, s := range servs {
+		recorder.WatchService(name, s)
+		all = append(all, s)
+	}
+
+	manager, err := services.NewManager(all...)
+	require.NoError(t, err)
+	require.NoError(t, services.StartManagerAndAwaitHealthy(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopManagerAndAwaitStopped(context.Background(), manager))
+	})
+
+	require.Eventually(t, func() bool {
+		timeline, _ := recorder.Timeline("target")
+		_, running := timeline.TransitionTo(services.Running)
+		return running
+	}, time.Second, time.Millisecond)
+
+	path := m.StartupCriticalPath(recorder)
+	require.Len(t, path, 3)
+	assert.Equal(t, "base", path[0].Module)
+	assert.Equal(t, "slow", path[1].Module)
+	assert.Equal(t, "target", path[2].Module)
+	assert.GreaterOrEqual(t, path[1].Duration, 90*time.Millisecond)
+	assert.Equal(t, path[0].RunningAt, path[1].StartedAt)
+
+	handler := m.StartupProfileHandler(recorder)
+
+	req := httptest.NewRequest(http.MethodGet, "/startup", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var profile struct {
+		CriticalPath []StartupStep `json:"critical_path"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &profile))
+	require.Len(t, profile.CriticalPath, 3)
+	for i, step := range profile.CriticalPath {
+		assert.Equal(t, path[i].Module, step.Module)
+		assert.Equal(t, path[i].Duration, step.Duration)
+	}
+	assert.Contains(t, rec.Body.String(), `"name":"fast"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/startup", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "<td>slow</td>")
+}
+
+func TestManager_StartupCriticalPathNotStarted(t *testing.T) {
+	m := NewManager(log.NewNopLogger())
+	m.RegisterModule("module", mockInitFunc)
+
+	assert.Empty(t, m.StartupCriticalPath(services.NewTimelineRecorder()))
+}
@@ -53,6 +53,9 @@ type BasicLifecyclerConfig struct {
 	HeartbeatTimeout    time.Duration
 	TokensObservePeriod time.Duration
 	NumTokens           int
+	// Weight is the weight of the instance relative to the other instances of the ring. The instance owns
+	// NumTokens multiplied by Weight tokens. 0 is equivalent to 1.
+	Weight int
 	// HideTokensInStatusPage allows tokens to be hidden from management tools e.g. the status page, for use in contexts which do not utilize tokens.
 	HideTokensInStatusPage bool
 
@@ -76,7 +79,9 @@ Rather, it's the delegate's responsibility to call [BasicLifecycler.ChangeState]
   - The lifecycler will update they key/value store with heartbeats and state changes based on the [ring.BasicLifecyclerConfig.HeartbeatPeriod], calling [ring.BasicLifecyclerDelegate.OnRingInstanceHeartbeat] each time.
   - When the BasicLifecycler is stopped, it will call [ring.BasicLifecyclerDelegate.OnRingInstanceStopping].
 
-BasicLifecycler does not support read only instances for now.
+BasicLifecycler doesn't change the read-only state of the instance itself: delegates can set it on heartbeats, for
+example [ReadOnlyOnUnhealthyDelegate]. The read-only state of an instance already in the ring is kept when it registers
+again, for example on restart.
 */
 type BasicLifecycler struct {
 	*services.BasicService
@@ -104,6 +109,16 @@ type BasicLifecycler struct {
 	tokenGenerator TokenGenerator
 }
 
+// weight returns the weight of the instance, which is 1 if unset.
+func (cfg *BasicLifecyclerConfig) weight() uint32 {
+	return uint32(max(1, cfg.Weight))
+}
+
+// tokensCount returns the number of tokens the instance should own, taking its weight into account.
+func (cfg *BasicLifecyclerConfig) tokensCount() int {
+	return cfg.NumTokens * int(cfg.weight())
+}
+
 // NewBasicLifecycler makes a new BasicLifecycler.
 func NewBasicLifecycler(cfg BasicLifecyclerConfig, ringName, ringKey string, store kv.Client, delegate BasicLifecyclerDelegate, logger log.Logger, reg prometheus.Registerer) (*BasicLifecycler, error) {
 	tokenGenerator := cfg.RingTokenGenerator
@@ -124,7 +139,8 @@ func NewBasicLifecycler(cfg BasicLifecyclerConfig, ringName, ringKey string, sto
 		tokenGenerator:                  tokenGenerator,
 	}
 
-	l.metrics.tokensToOwn.Set(float64(cfg.NumTokens))
+	l.metrics.tokensToOwn.Set(float64(cfg.tokensCount()))
+	l.metrics.weight.Set(float64(cfg.weight()))
 	l.BasicService = services.NewBasicService(l.starting, l.running, l.stopping)
 
 	return l, nil
@@ -301,6 +317,9 @@ func (l *BasicLifecycler) registerInstance(ctx context.Context) error {
 			level.Info(l.logger).Log("msg", "instance not found in the ring", "instance", l.cfg.ID, "ring", l.ringName)
 		}
 
+		// The delegate gets the weight the instance is registered with.
+		instanceDesc.Weight = l.cfg.weight()
+
 		// We call the delegate to get the desired state right after the initialization.
 		state, tokens := l.delegate.OnRingInstanceRegister(l, *ringDesc, exists, l.cfg.ID, instanceDesc)
 
@@ -319,8 +338,9 @@ func (l *BasicLifecycler) registerInstance(ctx context.Context) error {
 
 		// Always overwrite the instance in the ring (even if already exists) because some properties
 		// may have changed (stated, tokens, zone, address) and even if they didn't the heartbeat at
-		// least did.
-		instanceDesc = ringDesc.AddIngester(l.cfg.ID, l.cfg.Addr, l.cfg.Zone, tokens, state, registeredAt, false, time.Time{})
+		// least did. The read-only state is kept, since it's not managed by the lifecycler.
+		readOnly, readOnlyUpdated := instanceDesc.GetReadOnlyState()
+		instanceDesc = ringDesc.AddIngester(l.cfg.ID, l.cfg.Addr, l.cfg.Zone, tokens, state, registeredAt, readOnly, readOnlyUpdated, l.cfg.weight())
 		return ringDesc, true, nil
 	})
 
@@ -382,10 +402,10 @@ func (l *BasicLifecycler) verifyTokens(ctx context.Context) bool {
 		}
 
 		// uh, oh... our tokens are not our anymore. Let's try new ones.
-		needTokens := l.cfg.NumTokens - len(actualTokens)
+		needTokens := l.cfg.tokensCount() - len(actualTokens)
 
 		level.Info(l.logger).Log("msg", "generating new tokens", "count", needTokens, "ring", l.ringName)
-		newTokens := l.tokenGenerator.GenerateTokens(needTokens, takenTokens)
+		newTokens := generateTokens(l.tokenGenerator, needTokens, l.cfg.weight(), r, takenTokens)
 
 		actualTokens = append(actualTokens, newTokens...)
 		sort.Sort(actualTokens)
@@ -447,7 +467,10 @@ func (l *BasicLifecycler) updateInstance(ctx context.Context, update func(*Desc,
 			// a resharding of tenants among instances: to guarantee query correctness we need to update the
 			// registration timestamp to current time.
 			registeredAt := time.Now()
-			instanceDesc = ringDesc.AddIngester(l.cfg.ID, l.cfg.Addr, l.cfg.Zone, l.GetTokens(), l.GetState(), registeredAt, false, time.Time{})
+			l.currState.RLock()
+			readOnly, readOnlyUpdated := l.currInstanceDesc.GetReadOnlyState()
+			l.currState.RUnlock()
+			instanceDesc = ringDesc.AddIngester(l.cfg.ID, l.cfg.Addr, l.cfg.Zone, l.GetTokens(), l.GetState(), registeredAt, readOnly, readOnlyUpdated, l.cfg.weight())
 		}
 
 		prevTimestamp := instanceDesc.Timestamp
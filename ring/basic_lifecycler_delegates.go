@@ -3,6 +3,7 @@ package ring
 import (
 	"context"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -152,7 +153,7 @@ func (d *AutoForgetDelegate) OnRingInstanceHeartbeat(lifecycler *BasicLifecycler
 	d.next.OnRingInstanceHeartbeat(lifecycler, ringDesc, instanceDesc)
 }
 
-// InstanceRegisterDelegate generates a new set of tokenCount tokens on instance register, and returns the registerState InstanceState.
+// InstanceRegisterDelegate generates a new set of tokenCount tokens, multiplied by the weight of the instance, on instance register, and returns the registerState InstanceState.
 type InstanceRegisterDelegate struct {
 	registerState InstanceState
 	tokenCount    int
@@ -173,7 +174,7 @@ func (d InstanceRegisterDelegate) OnRingInstanceRegister(l *BasicLifecycler, rin
 	}
 
 	takenTokens := ringDesc.GetTokens()
-	newTokens := l.GetTokenGenerator().GenerateTokens(d.tokenCount-len(tokens), takenTokens)
+	newTokens := generateTokens(l.GetTokenGenerator(), d.tokenCount*int(l.cfg.weight())-len(tokens), l.cfg.weight(), &ringDesc, takenTokens)
 
 	// Tokens sorting will be enforced by the parent caller.
 	tokens = append(tokens, newTokens...)
@@ -186,3 +187,167 @@ func (d InstanceRegisterDelegate) OnRingInstanceTokens(*BasicLifecycler, Tokens)
 func (d InstanceRegisterDelegate) OnRingInstanceStopping(*BasicLifecycler) {}
 
 func (d InstanceRegisterDelegate) OnRingInstanceHeartbeat(*BasicLifecycler, *Desc, *InstanceDesc) {}
+
+// ReadOnlyOnUnhealthyDelegateConfig configures a ReadOnlyOnUnhealthyDelegate.
+type ReadOnlyOnUnhealthyDelegateConfig struct {
+	// Probes evaluated on each heartbeat.
+	Probes []HealthProbe
+
+	// UnhealthyPeriod is how long a probe must keep failing before the instance is switched to read-only.
+	// 0 switches the instance to read-only as soon as a probe fails.
+	UnhealthyPeriod time.Duration
+
+	// RecoveryPeriod is how long all probes must keep succeeding before the instance is switched back to read-write.
+	RecoveryPeriod time.Duration
+
+	// ProbeTimeout is the timeout of each probe evaluation. 0 means no timeout.
+	ProbeTimeout time.Duration
+}
+
+// ReadOnlyOnUnhealthyDelegate evaluates health probes every heartbeat period, switches the instance to read-only in
+// the ring when a probe keeps failing, and switches it back to read-write once all probes keep succeeding. The instance
+// is only switched back to read-write if it has been switched to read-only by this delegate. Since the read-only state
+// is kept when the instance registers again, an instance switched to read-only before a restart stays read-only
+// until it's switched back to read-write by other means, for example with the ring admin API.
+//
+// The probes are evaluated in the background from the moment the instance registers until the lifecycler stops,
+// so that slow probes don't delay the heartbeat. Each heartbeat applies the result of the last evaluation.
+type ReadOnlyOnUnhealthyDelegate struct {
+	next   BasicLifecyclerDelegate
+	logger log.Logger
+	cfg    ReadOnlyOnUnhealthyDelegateConfig
+
+	probesOnce sync.Once
+
+	// Result of the last evaluation of the probes.
+	mtx            sync.Mutex
+	failedProbe    string
+	probeErr       error
+	unhealthySince time.Time
+	healthySince   time.Time
+
+	// Protected by the lifecycler, which calls the delegate from a single goroutine.
+	readOnly bool
+}
+
+func NewReadOnlyOnUnhealthyDelegate(cfg ReadOnlyOnUnhealthyDelegateConfig, next BasicLifecyclerDelegate, logger log.Logger) *ReadOnlyOnUnhealthyDelegate {
+	return &ReadOnlyOnUnhealthyDelegate{
+		next:   next,
+		logger: logger,
+		cfg:    cfg,
+	}
+}
+
+func (d *ReadOnlyOnUnhealthyDelegate) OnRingInstanceRegister(lifecycler *BasicLifecycler, ringDesc Desc, instanceExists bool, instanceID string, instanceDesc InstanceDesc) (InstanceState, Tokens) {
+	d.startProbes(lifecycler)
+	return d.next.OnRingInstanceRegister(lifecycler, ringDesc, instanceExists, instanceID, instanceDesc)
+}
+
+func (d *ReadOnlyOnUnhealthyDelegate) OnRingInstanceTokens(lifecycler *BasicLifecycler, tokens Tokens) {
+	d.next.OnRingInstanceTokens(lifecycler, tokens)
+}
+
+func (d *ReadOnlyOnUnhealthyDelegate) OnRingInstanceStopping(lifecycler *BasicLifecycler) {
+	d.next.OnRingInstanceStopping(lifecycler)
+}
+
+func (d *ReadOnlyOnUnhealthyDelegate) OnRingInstanceHeartbeat(lifecycler *BasicLifecycler, ringDesc *Desc, instanceDesc *InstanceDesc) {
+	d.updateReadOnly(instanceDesc, time.Now())
+	d.next.OnRingInstanceHeartbeat(lifecycler, ringDesc, instanceDesc)
+}
+
+// updateReadOnly switches the instance to read-only or back to read-write according to the result of the last
+// evaluation of the probes.
+func (d *ReadOnlyOnUnhealthyDelegate) updateReadOnly(instanceDesc *InstanceDesc, now time.Time) {
+	d.mtx.Lock()
+	failed, err, unhealthySince, healthySince := d.failedProbe, d.probeErr, d.unhealthySince, d.healthySince
+	d.mtx.Unlock()
+
+	// The hysteresis is based on time rather than on the number of evaluations, so that applying the result
+	// again when the heartbeat CAS is retried doesn't affect it.
+	if err != nil {
+		if !instanceDesc.ReadOnly && now.Sub(unhealthySince) >= d.cfg.UnhealthyPeriod {
+			level.Warn(d.logger).Log("msg", "switching instance to read-only in the ring because a health probe is failing", "probe", failed, "unhealthy_since", unhealthySince.String(), "err", err)
+			instanceDesc.ReadOnly = true
+			instanceDesc.ReadOnlyUpdatedTimestamp = now.Unix()
+			d.readOnly = true
+		}
+	} else if d.readOnly && !healthySince.IsZero() && now.Sub(healthySince) >= d.cfg.RecoveryPeriod {
+		if instanceDesc.ReadOnly {
+			level.Info(d.logger).Log("msg", "switching instance back to read-write in the ring because all health probes recovered", "healthy_since", healthySince.String())
+			instanceDesc.ReadOnly = false
+			instanceDesc.ReadOnlyUpdatedTimestamp = now.Unix()
+		}
+		d.readOnly = false
+	}
+}
+
+// startProbes starts evaluating the probes every heartbeat period until the lifecycler stops.
+func (d *ReadOnlyOnUnhealthyDelegate) startProbes(lifecycler *BasicLifecycler) {
+	if lifecycler == nil || lifecycler.cfg.HeartbeatPeriod <= 0 {
+		return
+	}
+	ctx := lifecycler.ServiceContext()
+	if ctx == nil {
+		return
+	}
+
+	// The instance may register more than once when the CAS is retried.
+	d.probesOnce.Do(func() {
+		go d.runProbes(ctx, lifecycler.cfg.HeartbeatPeriod)
+	})
+}
+
+func (d *ReadOnlyOnUnhealthyDelegate) runProbes(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		d.evaluateProbes(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluateProbes evaluates the probes and records since when they're failing or succeeding.
+func (d *ReadOnlyOnUnhealthyDelegate) evaluateProbes(now time.Time) {
+	failed, err := d.checkProbes()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.failedProbe, d.probeErr = failed, err
+	if err != nil {
+		d.healthySince = time.Time{}
+		if d.unhealthySince.IsZero() {
+			d.unhealthySince = now
+			level.Warn(d.logger).Log("msg", "instance health probe failed", "probe", failed, "err", err)
+		}
+	} else {
+		d.unhealthySince = time.Time{}
+		if d.healthySince.IsZero() {
+			d.healthySince = now
+		}
+	}
+}
+
+// checkProbes returns the name and the error of the first failing probe, if any.
+func (d *ReadOnlyOnUnhealthyDelegate) checkProbes() (string, error) {
+	for _, probe := range d.cfg.Probes {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if d.cfg.ProbeTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, d.cfg.ProbeTimeout)
+		}
+		err := probe.Check(ctx)
+		cancel()
+
+		if err != nil {
+			return probe.Name(), err
+		}
+	}
+	return "", nil
+}
@@ -2,6 +2,7 @@ package ring
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/dskit/concurrency"
 	"github.com/grafana/dskit/services"
@@ -172,7 +174,7 @@ func TestTokensPersistencyDelegate_ShouldHandleTheCaseTheInstanceIsAlreadyInTheR
 			// Add the instance to the ring.
 			require.NoError(t, store.CAS(ctx, testRingKey, func(interface{}) (out interface{}, retry bool, err error) {
 				ringDesc := NewDesc()
-				ringDesc.AddIngester(cfg.ID, cfg.Addr, cfg.Zone, testData.initialTokens, testData.initialState, registeredAt, false, time.Now())
+				ringDesc.AddIngester(cfg.ID, cfg.Addr, cfg.Zone, testData.initialTokens, testData.initialState, registeredAt, false, time.Now(), 0)
 				return ringDesc, true, nil
 			}))
 
@@ -242,13 +244,13 @@ func TestAutoForgetDelegate(t *testing.T) {
 	}{
 		"no unhealthy instance in the ring": {
 			setup: func(ringDesc *Desc) {
-				ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated)
+				ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated, 0)
 			},
 			expectedInstances: []string{testInstanceID, "instance-1"},
 		},
 		"unhealthy instance in the ring that has NOTreached the forget period yet": {
 			setup: func(ringDesc *Desc) {
-				i := ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated)
+				i := ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated, 0)
 				i.Timestamp = time.Now().Add(-forgetPeriod).Add(5 * time.Second).Unix()
 				ringDesc.Ingesters["instance-1"] = i
 			},
@@ -256,7 +258,7 @@ func TestAutoForgetDelegate(t *testing.T) {
 		},
 		"unhealthy instance in the ring that has reached the forget period": {
 			setup: func(ringDesc *Desc) {
-				i := ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated)
+				i := ringDesc.AddIngester("instance-1", "1.1.1.1", "", nil, ACTIVE, registeredAt, false, readOnlyUpdated, 0)
 				i.Timestamp = time.Now().Add(-forgetPeriod).Add(-5 * time.Second).Unix()
 				ringDesc.Ingesters["instance-1"] = i
 			},
@@ -321,7 +323,7 @@ func TestInstanceRegisterDelegate_OnRingInstanceRegister(t *testing.T) {
 		otherIngesterTokens := []uint32{100, 200, 300, 400, 500}
 
 		desc := NewDesc()
-		desc.AddIngester("other-instance", "addr", "zone", otherIngesterTokens, ACTIVE, time.Now(), false, time.Time{})
+		desc.AddIngester("other-instance", "addr", "zone", otherIngesterTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 
 		state, tokens := delegate.OnRingInstanceRegister(lifecycler, *desc, false, "test-instance", InstanceDesc{})
 		require.Equal(t, JOINING, state)
@@ -342,10 +344,10 @@ func TestInstanceRegisterDelegate_OnRingInstanceRegister(t *testing.T) {
 		otherIngesterTokens := []uint32{100, 200, 300, 400, 500}
 
 		desc := NewDesc()
-		desc.AddIngester("other-instance", "addr", "zone", otherIngesterTokens, ACTIVE, time.Now(), false, time.Time{})
+		desc.AddIngester("other-instance", "addr", "zone", otherIngesterTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 
 		prevTokens := []uint32{10, 20, 30}
-		desc.AddIngester("test-instance", "test-addr", "zone", prevTokens, JOINING, time.Now(), false, time.Time{})
+		desc.AddIngester("test-instance", "test-addr", "zone", prevTokens, JOINING, time.Now(), false, time.Time{}, 0)
 
 		state, tokens := delegate.OnRingInstanceRegister(lifecycler, *desc, true, "test-instance", desc.GetIngesters()["test-instance"])
 		require.Equal(t, ACTIVE, state)
@@ -359,3 +361,122 @@ func TestInstanceRegisterDelegate_OnRingInstanceRegister(t *testing.T) {
 		}
 	})
 }
+
+func TestReadOnlyOnUnhealthyDelegate(t *testing.T) {
+	var (
+		probeErr error
+		now      = time.Now()
+	)
+
+	probe := NewFuncHealthProbe("test", func(context.Context) error { return probeErr })
+	delegate := NewReadOnlyOnUnhealthyDelegate(ReadOnlyOnUnhealthyDelegateConfig{
+		Probes:          []HealthProbe{NewFuncHealthProbe("healthy", func(context.Context) error { return nil }), probe},
+		UnhealthyPeriod: 10 * time.Second,
+		RecoveryPeriod:  30 * time.Second,
+	}, &mockDelegate{}, log.NewNopLogger())
+
+	instance := &InstanceDesc{State: ACTIVE}
+	heartbeat := func(elapsed time.Duration) {
+		now = now.Add(elapsed)
+		delegate.evaluateProbes(now)
+		delegate.updateReadOnly(instance, now)
+	}
+
+	heartbeat(0)
+	assert.False(t, instance.ReadOnly)
+
+	// The instance is switched to read-only once the probe keeps failing for the unhealthy period.
+	probeErr = errors.New("disk full")
+	heartbeat(time.Second)
+	heartbeat(5 * time.Second)
+	assert.False(t, instance.ReadOnly)
+	heartbeat(5 * time.Second)
+	assert.True(t, instance.ReadOnly)
+	assert.Equal(t, now.Unix(), instance.ReadOnlyUpdatedTimestamp)
+
+	// A short recovery doesn't switch the instance back to read-write.
+	probeErr = nil
+	heartbeat(20 * time.Second)
+	heartbeat(20 * time.Second)
+	assert.True(t, instance.ReadOnly)
+	probeErr = errors.New("disk full")
+	heartbeat(time.Second)
+	assert.True(t, instance.ReadOnly)
+
+	probeErr = nil
+	heartbeat(time.Second)
+	heartbeat(29 * time.Second)
+	assert.True(t, instance.ReadOnly)
+	heartbeat(time.Second)
+	assert.False(t, instance.ReadOnly)
+	assert.Equal(t, now.Unix(), instance.ReadOnlyUpdatedTimestamp)
+
+	// An instance switched to read-only by someone else is not switched back to read-write.
+	instance.ReadOnly = true
+	heartbeat(time.Minute)
+	assert.True(t, instance.ReadOnly)
+	probeErr = errors.New("disk full")
+	heartbeat(time.Minute)
+	probeErr = nil
+	heartbeat(time.Minute)
+	heartbeat(time.Minute)
+	assert.True(t, instance.ReadOnly)
+}
+
+func TestReadOnlyOnUnhealthyDelegate_UpdatesTheRing(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareBasicLifecyclerConfig()
+	cfg.HeartbeatPeriod = 10 * time.Millisecond
+
+	healthy := atomic.NewBool(true)
+	delegate := NewReadOnlyOnUnhealthyDelegate(ReadOnlyOnUnhealthyDelegateConfig{
+		Probes: []HealthProbe{NewFuncHealthProbe("test", func(context.Context) error {
+			if healthy.Load() {
+				return nil
+			}
+			return errors.New("unhealthy")
+		})},
+		ProbeTimeout: time.Second,
+	}, &mockDelegate{}, log.NewNopLogger())
+
+	lifecycler, store, err := prepareBasicLifecyclerWithDelegate(t, cfg, delegate)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+	defer services.StopAndAwaitTerminated(ctx, lifecycler) //nolint:errcheck
+
+	isReadOnly := func() interface{} {
+		instance, _ := getInstanceFromStore(t, store, testInstanceID)
+		return instance.ReadOnly
+	}
+
+	healthy.Store(false)
+	test.Poll(t, time.Second, true, isReadOnly)
+
+	healthy.Store(true)
+	test.Poll(t, time.Second, false, isReadOnly)
+}
+
+func TestReadOnlyOnUnhealthyDelegate_SlowProbeDoesntDelayHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareBasicLifecyclerConfig()
+	cfg.HeartbeatPeriod = 10 * time.Millisecond
+
+	release := make(chan struct{})
+	defer close(release)
+	delegate := NewReadOnlyOnUnhealthyDelegate(ReadOnlyOnUnhealthyDelegateConfig{
+		Probes: []HealthProbe{NewFuncHealthProbe("slow", func(context.Context) error {
+			<-release
+			return nil
+		})},
+	}, &mockDelegate{}, log.NewNopLogger())
+
+	lifecycler, _, err := prepareBasicLifecyclerWithDelegate(t, cfg, delegate)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+	defer services.StopAndAwaitTerminated(ctx, lifecycler) //nolint:errcheck
+
+	// The probe never completes, but the instance keeps heartbeating.
+	test.Poll(t, time.Second, true, func() interface{} {
+		return testutil.ToFloat64(lifecycler.metrics.heartbeats) >= 3
+	})
+}
@@ -9,6 +9,7 @@ type BasicLifecyclerMetrics struct {
 	heartbeats  prometheus.Counter
 	tokensOwned prometheus.Gauge
 	tokensToOwn prometheus.Gauge
+	weight      prometheus.Gauge
 }
 
 func NewBasicLifecyclerMetrics(ringName string, reg prometheus.Registerer) *BasicLifecyclerMetrics {
@@ -28,5 +29,10 @@ func NewBasicLifecyclerMetrics(ringName string, reg prometheus.Registerer) *Basi
 			Help:        "The number of tokens to own in the ring.",
 			ConstLabels: prometheus.Labels{"name": ringName},
 		}),
+		weight: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "ring_member_weight",
+			Help:        "The weight of the instance in the ring.",
+			ConstLabels: prometheus.Labels{"name": ringName},
+		}),
 	}
 }
@@ -131,7 +131,7 @@ func TestBasicLifecycler_RegisterOnStart(t *testing.T) {
 					desc := testData.initialInstanceDesc
 
 					ringDesc := GetOrCreateRingDesc(in)
-					ringDesc.AddIngester(testData.initialInstanceID, desc.Addr, desc.Zone, desc.Tokens, desc.State, desc.GetRegisteredAt(), desc.ReadOnly, time.Unix(desc.ReadOnlyUpdatedTimestamp, 0))
+					ringDesc.AddIngester(testData.initialInstanceID, desc.Addr, desc.Zone, desc.Tokens, desc.State, desc.GetRegisteredAt(), desc.ReadOnly, time.Unix(desc.ReadOnlyUpdatedTimestamp, 0), 0)
 					return ringDesc, true, nil
 				}))
 			}
@@ -194,6 +194,14 @@ func TestBasicLifecycler_RegisterOnStart(t *testing.T) {
 			} else {
 				assert.InDelta(t, time.Now().Unix(), instanceDesc.RegisteredTimestamp, 2)
 			}
+
+			// The read-only state of an instance already in the ring is kept.
+			if testData.initialInstanceID == testInstanceID {
+				assert.Equal(t, testData.initialInstanceDesc.ReadOnly, instanceDesc.ReadOnly)
+				assert.Equal(t, testData.initialInstanceDesc.ReadOnlyUpdatedTimestamp, instanceDesc.ReadOnlyUpdatedTimestamp)
+			} else {
+				assert.False(t, instanceDesc.ReadOnly)
+			}
 		})
 	}
 }
@@ -476,7 +484,7 @@ func TestBasicLifecycler_TokensObservePeriod(t *testing.T) {
 		// Remove some tokens.
 		return store.CAS(ctx, testRingKey, func(in interface{}) (out interface{}, retry bool, err error) {
 			ringDesc := GetOrCreateRingDesc(in)
-			ringDesc.AddIngester(testInstanceID, desc.Addr, desc.Zone, Tokens{4, 5}, desc.State, time.Now(), false, time.Time{})
+			ringDesc.AddIngester(testInstanceID, desc.Addr, desc.Zone, Tokens{4, 5}, desc.State, time.Now(), false, time.Time{}, 0)
 			return ringDesc, true, nil
 		}) == nil
 	})
@@ -528,6 +536,74 @@ func TestBasicLifecycler_updateInstance_ShouldAddInstanceToTheRingIfDoesNotExist
 	assert.Equal(t, expectedRegisteredAt.Unix(), desc.GetRegisteredAt().Unix())
 }
 
+func TestBasicLifecycler_Weight(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareBasicLifecyclerConfig()
+	cfg.Weight = 2
+	lifecycler, delegate, store, err := prepareBasicLifecycler(t, cfg)
+	require.NoError(t, err)
+
+	delegate.onRegister = func(l *BasicLifecycler, ringDesc Desc, instanceExists bool, instanceID string, instanceDesc InstanceDesc) (InstanceState, Tokens) {
+		return NewInstanceRegisterDelegate(ACTIVE, cfg.NumTokens).OnRingInstanceRegister(l, ringDesc, instanceExists, instanceID, instanceDesc)
+	}
+
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+	defer services.StopAndAwaitTerminated(ctx, lifecycler) //nolint:errcheck
+
+	// The instance registers its weight, and a number of tokens proportional to it.
+	instanceDesc, ok := getInstanceFromStore(t, store, testInstanceID)
+	require.True(t, ok)
+	assert.Equal(t, uint32(2), instanceDesc.GetWeight())
+	assert.Len(t, instanceDesc.GetTokens(), 2*cfg.NumTokens)
+	assert.Equal(t, float64(2*cfg.NumTokens), testutil.ToFloat64(lifecycler.metrics.tokensToOwn))
+	assert.Equal(t, float64(2), testutil.ToFloat64(lifecycler.metrics.weight))
+
+	// The weight is preserved by heartbeats.
+	lifecycler.heartbeat(ctx)
+	instanceDesc, ok = getInstanceFromStore(t, store, testInstanceID)
+	require.True(t, ok)
+	assert.Equal(t, uint32(2), instanceDesc.GetWeight())
+}
+
+func TestBasicLifecycler_WeightedOwnership(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareBasicLifecyclerConfig()
+	cfg.NumTokens = 128
+	cfg.Weight = 3
+	cfg.RingTokenGenerator = NewZoneAwareSpreadMinimizingTokenGenerator(cfg.ID, cfg.Zone, 0, false)
+	lifecycler, delegate, store, err := prepareBasicLifecycler(t, cfg)
+	require.NoError(t, err)
+
+	delegate.onRegister = func(l *BasicLifecycler, ringDesc Desc, instanceExists bool, instanceID string, instanceDesc InstanceDesc) (InstanceState, Tokens) {
+		// The delegate gets the weight of the instance, which isn't in the ring yet.
+		assert.False(t, instanceExists)
+		assert.NotContains(t, ringDesc.Ingesters, instanceID)
+		assert.Equal(t, uint32(3), instanceDesc.GetWeight())
+		return NewInstanceRegisterDelegate(ACTIVE, cfg.NumTokens).OnRingInstanceRegister(l, ringDesc, instanceExists, instanceID, instanceDesc)
+	}
+
+	// Another instance of weight 1 is already in the ring.
+	const otherID = "instance-other"
+	otherTokens := NewZoneAwareSpreadMinimizingTokenGenerator(otherID, cfg.Zone, 0, false).GenerateTokensForRing(cfg.NumTokens, 0, NewDesc())
+	require.NoError(t, store.CAS(ctx, testRingKey, func(interface{}) (interface{}, bool, error) {
+		desc := NewDesc()
+		desc.AddIngester(otherID, "127.0.0.1:1", cfg.Zone, otherTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
+		return desc, true, nil
+	}))
+
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+	defer services.StopAndAwaitTerminated(ctx, lifecycler) //nolint:errcheck
+
+	// The new instance owns a share of the token space proportional to its weight.
+	desc, err := store.Get(ctx, testRingKey)
+	require.NoError(t, err)
+	plan, err := PlanRebalance(desc.(*Desc), 1, 0)
+	require.NoError(t, err)
+	require.Len(t, plan.Instances, 2)
+	assert.InDelta(t, 0.75, plan.Instances[testInstanceID].Before, 0.01)
+	assert.InDelta(t, 0.25, plan.Instances[otherID].Before, 0.01)
+}
+
 func prepareBasicLifecyclerConfig() BasicLifecyclerConfig {
 	return BasicLifecyclerConfig{
 		ID:                  testInstanceID,
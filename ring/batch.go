@@ -4,6 +4,7 @@ package ring
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -66,6 +67,19 @@ type DoBatchRing interface {
 	InstancesCount() int
 }
 
+// DoBatchReplicasRing is optionally implemented by a DoBatchRing which can return all the replicas of a key,
+// including the ones removed from the ReplicationSet returned by Get, for example because they're unhealthy.
+// DoBatchWithOptions uses it to call DoBatchOptions.OnInstanceFailure for these replicas too.
+type DoBatchReplicasRing interface {
+	// GetReplicas returns the instances the input key is sharded to for the input Operation, before they're
+	// filtered by the replication strategy. The input buffers may be referenced in the returned instances.
+	GetReplicas(key uint32, op Operation, bufInstances []InstanceDesc, bufStrings []string) ([]InstanceDesc, error)
+}
+
+// ErrNotInReplicationSet is the error passed to DoBatchOptions.OnInstanceFailure for the replicas of the keys
+// which have been removed from their replication set, and haven't been called.
+var ErrNotInReplicationSet = errors.New("instance not in the replication set")
+
 // DoBatch is a deprecated version of DoBatchWithOptions where grpc errors containing status codes 4xx are treated as client errors.
 // Deprecated. Use DoBatchWithOptions instead.
 func DoBatch(ctx context.Context, op Operation, r DoBatchRing, keys []uint32, callback func(InstanceDesc, []int) error, cleanup func()) error {
@@ -89,6 +103,13 @@ type DoBatchOptions struct {
 
 	// Go will be used to spawn the callback goroutines, and can be used to use a worker pool like concurrency.ReusableGoroutinesPool.
 	Go func(func())
+
+	// OnInstanceFailure, if set, is called with the indexes of the keys sent to an instance whose callback failed
+	// with an error which is not a client error. If the ring implements DoBatchReplicasRing, it's also called with
+	// ErrNotInReplicationSet for the replicas removed from the replication set of the keys, like unhealthy instances,
+	// with the indexes of the keys they would have received. It's called before Cleanup, even if DoBatchWithOptions
+	// already returned, so it can be used to record the failed items with HintedHandoff.
+	OnInstanceFailure func(instance InstanceDesc, indexes []int, err error)
 }
 
 func (o *DoBatchOptions) replaceZeroValuesWithDefaults() {
@@ -126,7 +147,17 @@ func DoBatchWithOptions(ctx context.Context, op Operation, r DoBatchRing, keys [
 		bufDescs [GetBufferSize]InstanceDesc
 		bufHosts [GetBufferSize]string
 		bufZones [GetBufferSize]string
+
+		// Replicas removed from the replication set of the keys, by address.
+		unavailable               map[string]instance
+		bufReplicas               [GetBufferSize]InstanceDesc
+		bufReplicasHosts          [GetBufferSize]string
+		replicasRing, hasReplicas = r.(DoBatchReplicasRing)
 	)
+	trackUnavailable := hasReplicas && o.OnInstanceFailure != nil
+	if trackUnavailable {
+		unavailable = map[string]instance{}
+	}
 	for i, key := range keys {
 		// Get call below takes ~1 microsecond for ~500 instances.
 		// Checking every 10K calls would be every 10ms.
@@ -142,8 +173,9 @@ func DoBatchWithOptions(ctx context.Context, op Operation, r DoBatchRing, keys [
 			o.Cleanup()
 			return err
 		}
-		itemTrackers[i].minSuccess = len(replicationSet.Instances) - replicationSet.MaxErrors
-		itemTrackers[i].maxFailures = replicationSet.MaxErrors
+		maxFailures := replicationSet.maxFailedInstances()
+		itemTrackers[i].minSuccess = len(replicationSet.Instances) - maxFailures
+		itemTrackers[i].maxFailures = maxFailures
 		itemTrackers[i].remaining.Store(int32(len(replicationSet.Instances)))
 
 		for _, desc := range replicationSet.Instances {
@@ -158,6 +190,20 @@ func DoBatchWithOptions(ctx context.Context, op Operation, r DoBatchRing, keys [
 				indexes:      append(curr.indexes, i),
 			}
 		}
+
+		if trackUnavailable {
+			replicas, err := replicasRing.GetReplicas(key, op, bufReplicas[:0], bufReplicasHosts[:0])
+			if err != nil {
+				o.Cleanup()
+				return err
+			}
+			for _, desc := range replicas {
+				if !replicationSet.Includes(desc.Addr) {
+					curr := unavailable[desc.Addr]
+					unavailable[desc.Addr] = instance{desc: desc, indexes: append(curr.indexes, i)}
+				}
+			}
+		}
 	}
 
 	// One last check before calling the callbacks: it doesn't make sense if context is canceled.
@@ -180,12 +226,18 @@ func DoBatchWithOptions(ctx context.Context, op Operation, r DoBatchRing, keys [
 		o.Go(func() {
 			err := callback(i.desc, i.indexes)
 			tracker.record(i.itemTrackers, err, o.IsClientError)
+			if err != nil && o.OnInstanceFailure != nil && !o.IsClientError(err) {
+				o.OnInstanceFailure(i.desc, i.indexes, err)
+			}
 			wg.Done()
 		})
 	}
 
 	// Perform cleanup at the end.
 	o.Go(func() {
+		for _, i := range unavailable {
+			o.OnInstanceFailure(i.desc, i.indexes, ErrNotInReplicationSet)
+		}
 		wg.Wait()
 		o.Cleanup()
 	})
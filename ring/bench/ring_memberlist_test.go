@@ -81,7 +81,7 @@ func BenchmarkMemberlistReceiveWithRingDesc(b *testing.B) {
 	{
 		for i := 0; i < numInstances; i++ {
 			tokens := generateUniqueTokens(i, numTokens)
-			initialDesc.AddIngester(fmt.Sprintf("instance-%d", i), "127.0.0.1", "zone", tokens, ring.ACTIVE, time.Now(), false, time.Time{})
+			initialDesc.AddIngester(fmt.Sprintf("instance-%d", i), "127.0.0.1", "zone", tokens, ring.ACTIVE, time.Now(), false, time.Time{}, 0)
 		}
 		// Send a single update to populate the store.
 		msg := encodeMessage(b, "ring", initialDesc)
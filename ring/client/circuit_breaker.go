@@ -0,0 +1,339 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/dskit/grpcutil"
+	"github.com/grafana/dskit/ring"
+)
+
+// ErrCircuitOpen is returned for requests to an address whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of the circuit breaker of an address.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all requests: the address is ejected.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of requests through, to probe whether the address has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+}
+
+// CircuitBreakerConfig configures the per-address circuit breakers of a Pool.
+type CircuitBreakerConfig struct {
+	Enabled bool
+
+	// FailureThreshold is the number of consecutive failed requests opening the circuit breaker. Defaults to 5.
+	FailureThreshold int
+
+	// OpenDuration is how long the circuit breaker stays open before switching to half-open. Defaults to 10s.
+	OpenDuration time.Duration
+
+	// HalfOpenRequests is the number of requests let through in half-open state, all of which must succeed to
+	// close the circuit breaker. Defaults to 1.
+	HalfOpenRequests int
+
+	// MaxEjectionPercent is the maximum percentage of the addresses tracked by the pool whose circuit breaker can
+	// be open or half-open at the same time. The addresses tracked are the ones returned by the service discovery
+	// of the pool or, without service discovery, the ones with a client. At least one address can always be
+	// ejected. Defaults to 50.
+	MaxEjectionPercent int
+
+	// IsFailure returns whether a request error should count as a failure. Errors not counting as failures are
+	// ignored. Defaults to all errors except cancellations.
+	IsFailure func(err error) bool
+}
+
+func (cfg *CircuitBreakerConfig) applyDefaults() {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 10 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.MaxEjectionPercent <= 0 {
+		cfg.MaxEjectionPercent = 50
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			return !grpcutil.IsCanceled(err)
+		}
+	}
+}
+
+type circuitBreaker struct {
+	state               CircuitState
+	consecutiveFailures int
+	stateChangedAt      time.Time
+
+	// Number of requests let through and succeeded since the last switch to half-open.
+	halfOpenAdmitted  int
+	halfOpenSucceeded int
+}
+
+// circuitBreakers tracks the circuit breaker of each address of a Pool.
+type circuitBreakers struct {
+	cfg    CircuitBreakerConfig
+	logger log.Logger
+
+	mtx      sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(cfg CircuitBreakerConfig, logger log.Logger) *circuitBreakers {
+	cfg.applyDefaults()
+
+	return &circuitBreakers{
+		cfg:      cfg,
+		logger:   logger,
+		breakers: map[string]*circuitBreaker{},
+	}
+}
+
+// get returns the circuit breaker of addr, switching it to half-open if it has been open for long enough.
+// It must be called with the lock held.
+func (c *circuitBreakers) get(addr string, now time.Time) *circuitBreaker {
+	b, ok := c.breakers[addr]
+	if !ok {
+		b = &circuitBreaker{state: CircuitClosed, stateChangedAt: now}
+		c.breakers[addr] = b
+	}
+
+	switch {
+	case b.state == CircuitOpen && now.Sub(b.stateChangedAt) >= c.cfg.OpenDuration:
+		c.setState(addr, b, CircuitHalfOpen, now)
+	case b.state == CircuitHalfOpen && b.halfOpenAdmitted >= c.cfg.HalfOpenRequests && now.Sub(b.stateChangedAt) >= c.cfg.OpenDuration:
+		// The outcome of the probe requests has never been reported: let new ones through.
+		c.setState(addr, b, CircuitHalfOpen, now)
+	}
+	return b
+}
+
+// setState must be called with the lock held.
+func (c *circuitBreakers) setState(addr string, b *circuitBreaker, state CircuitState, now time.Time) {
+	if state != b.state {
+		level.Info(c.logger).Log("msg", "circuit breaker state changed", "addr", addr, "from", b.state, "to", state)
+	}
+
+	b.state = state
+	b.stateChangedAt = now
+	b.consecutiveFailures = 0
+	b.halfOpenAdmitted = 0
+	b.halfOpenSucceeded = 0
+}
+
+// allow returns ErrCircuitOpen if a request to addr should be rejected.
+func (c *circuitBreakers) allow(addr string, now time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	b := c.get(addr, now)
+	switch b.state {
+	case CircuitOpen:
+		return errors.Wrap(ErrCircuitOpen, addr)
+	case CircuitHalfOpen:
+		if b.halfOpenAdmitted >= c.cfg.HalfOpenRequests {
+			return errors.Wrap(ErrCircuitOpen, addr)
+		}
+		b.halfOpenAdmitted++
+	}
+	return nil
+}
+
+// report records the outcome of a request to addr.
+func (c *circuitBreakers) report(addr string, err error, now time.Time) {
+	if errors.Is(err, ErrCircuitOpen) {
+		// The request has not been sent.
+		return
+	}
+	if err != nil && !c.cfg.IsFailure(err) {
+		// The error says nothing about the health of the address.
+		return
+	}
+	failed := err != nil
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	b := c.get(addr, now)
+
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.consecutiveFailures = 0
+			return
+		}
+		b.consecutiveFailures++
+		if b.consecutiveFailures < c.cfg.FailureThreshold {
+			return
+		}
+		if ejected, maxEjected := c.ejectedCount(), c.maxEjectedCount(); ejected >= maxEjected {
+			level.Warn(c.logger).Log("msg", "not opening circuit breaker because the maximum number of ejected addresses has been reached", "addr", addr, "ejected", ejected, "max_ejected", maxEjected)
+			return
+		}
+		c.setState(addr, b, CircuitOpen, now)
+
+	case CircuitHalfOpen:
+		if failed {
+			c.setState(addr, b, CircuitOpen, now)
+			return
+		}
+		b.halfOpenSucceeded++
+		if b.halfOpenSucceeded >= c.cfg.HalfOpenRequests {
+			c.setState(addr, b, CircuitClosed, now)
+		}
+
+	case CircuitOpen:
+		// Outcome of a request started before the circuit breaker opened.
+	}
+}
+
+// ejectedCount must be called with the lock held.
+func (c *circuitBreakers) ejectedCount() int {
+	count := 0
+	for _, b := range c.breakers {
+		if b.state != CircuitClosed {
+			count++
+		}
+	}
+	return count
+}
+
+// maxEjectedCount must be called with the lock held.
+func (c *circuitBreakers) maxEjectedCount() int {
+	return max(1, len(c.breakers)*c.cfg.MaxEjectionPercent/100)
+}
+
+func (c *circuitBreakers) state(addr string, now time.Time) CircuitState {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.breakers[addr]; !ok {
+		return CircuitClosed
+	}
+	return c.get(addr, now).state
+}
+
+// retain removes the circuit breakers of the addresses not in addrs.
+func (c *circuitBreakers) retain(addrs []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for addr := range c.breakers {
+		if !slices.Contains(addrs, addr) {
+			delete(c.breakers, addr)
+		}
+	}
+}
+
+// AllowRequest returns an error wrapping ErrCircuitOpen if the circuit breaker of addr is open, or if it's
+// half-open and enough probe requests have already been let through. The outcome of the requests let
+// through must be reported with ReportResult. It always returns nil if circuit breaking is disabled.
+func (p *Pool) AllowRequest(addr string) error {
+	if p.breakers == nil {
+		return nil
+	}
+	return p.breakers.allow(addr, time.Now())
+}
+
+// ReportResult records the outcome of a request to addr with its circuit breaker. It's a no-op if circuit
+// breaking is disabled.
+func (p *Pool) ReportResult(addr string, err error) {
+	if p.breakers == nil {
+		return
+	}
+	p.breakers.report(addr, err, time.Now())
+}
+
+// CircuitState returns the state of the circuit breaker of addr. It's always CircuitClosed if circuit breaking
+// is disabled.
+func (p *Pool) CircuitState(addr string) CircuitState {
+	if p.breakers == nil {
+		return CircuitClosed
+	}
+	return p.breakers.state(addr, time.Now())
+}
+
+// CircuitBreakerUnaryClientInterceptor returns a gRPC interceptor rejecting requests to ejected addresses, and
+// reporting the outcome of the other requests to their circuit breaker. It's meant to be added to the dial options
+// of the clients created by the PoolFactory: the target of the connection must be the address the client is
+// obtained with from the pool.
+func (p *Pool) CircuitBreakerUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		addr := cc.Target()
+		if err := p.AllowRequest(addr); err != nil {
+			return err
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		p.ReportResult(addr, err)
+		return err
+	}
+}
+
+// CircuitBreakerInstanceScorer returns a ring.InstanceScorer for ring.DoUntilQuorumConfig, reporting the outcome of
+// the requests made by DoUntilQuorum to the circuit breakers of the pool, and deprioritizing the instances whose
+// circuit breaker is open so that they're only requested if the other instances can't reach the quorum. Instances
+// whose circuit breaker is closed or half-open are scored by next, if not nil.
+//
+// The outcomes observed are reported only if AllowRequest lets them through, as DoUntilQuorum doesn't check it
+// before sending the requests: a half-open circuit breaker only counts the outcomes of as many requests as
+// HalfOpenRequests. Note that DoUntilQuorum only uses scores when request minimization is enabled.
+func (p *Pool) CircuitBreakerInstanceScorer(next ring.InstanceScorer) ring.InstanceScorer {
+	return &circuitBreakerInstanceScorer{pool: p, next: next}
+}
+
+type circuitBreakerInstanceScorer struct {
+	pool *Pool
+	next ring.InstanceScorer
+}
+
+func (s *circuitBreakerInstanceScorer) Observe(instance *ring.InstanceDesc, latency time.Duration, err error) {
+	if s.pool.AllowRequest(instance.Addr) == nil {
+		s.pool.ReportResult(instance.Addr, err)
+	}
+	if s.next != nil {
+		s.next.Observe(instance, latency, err)
+	}
+}
+
+func (s *circuitBreakerInstanceScorer) Score(instance *ring.InstanceDesc) float64 {
+	if s.pool.CircuitState(instance.Addr) == CircuitOpen {
+		return math.Inf(1)
+	}
+	if s.next != nil {
+		return s.next.Score(instance)
+	}
+	return 0
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/dskit/ring"
+)
+
+func newTestPoolWithCircuitBreaker(cfg CircuitBreakerConfig, discovery PoolServiceDiscovery) *Pool {
+	cfg.Enabled = true
+	factory := PoolAddrFunc(func(string) (PoolClient, error) {
+		return mockClient{happy: true}, nil
+	})
+
+	return NewPool("test", PoolConfig{CheckInterval: time.Minute, CircuitBreaker: cfg}, discovery, factory, nil, log.NewNopLogger())
+}
+
+func TestCircuitBreaker_StateTransitions(t *testing.T) {
+	breakers := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold:   3,
+		OpenDuration:       10 * time.Second,
+		HalfOpenRequests:   2,
+		MaxEjectionPercent: 100,
+	}, nil).breakers
+	now := time.Now()
+	errFailed := errors.New("failed")
+
+	// Successes reset the consecutive failures.
+	breakers.report("1", errFailed, now)
+	breakers.report("1", errFailed, now)
+	breakers.report("1", nil, now)
+	breakers.report("1", errFailed, now)
+	breakers.report("1", errFailed, now)
+	assert.Equal(t, CircuitClosed, breakers.state("1", now))
+	require.NoError(t, breakers.allow("1", now))
+
+	// Cancellations are not failures.
+	breakers.report("1", context.Canceled, now)
+	breakers.report("1", status.Error(codes.Canceled, "canceled"), now)
+	assert.Equal(t, CircuitClosed, breakers.state("1", now))
+
+	breakers.report("1", errFailed, now)
+	assert.Equal(t, CircuitOpen, breakers.state("1", now))
+	require.ErrorIs(t, breakers.allow("1", now), ErrCircuitOpen)
+
+	// Once the open duration has elapsed, a limited number of probe requests are let through.
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, CircuitHalfOpen, breakers.state("1", now))
+	require.NoError(t, breakers.allow("1", now))
+	require.NoError(t, breakers.allow("1", now))
+	require.ErrorIs(t, breakers.allow("1", now), ErrCircuitOpen)
+
+	// A failed probe opens the circuit breaker again.
+	breakers.report("1", nil, now)
+	breakers.report("1", errFailed, now)
+	assert.Equal(t, CircuitOpen, breakers.state("1", now))
+
+	// All probes must succeed to close the circuit breaker.
+	now = now.Add(10 * time.Second)
+	require.NoError(t, breakers.allow("1", now))
+	require.NoError(t, breakers.allow("1", now))
+	breakers.report("1", nil, now)
+	assert.Equal(t, CircuitHalfOpen, breakers.state("1", now))
+	breakers.report("1", nil, now)
+	assert.Equal(t, CircuitClosed, breakers.state("1", now))
+	require.NoError(t, breakers.allow("1", now))
+}
+
+func TestCircuitBreaker_HalfOpenProbesNeverReported(t *testing.T) {
+	breakers := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: time.Second}, nil).breakers
+	now := time.Now()
+
+	breakers.report("1", errors.New("failed"), now)
+	now = now.Add(time.Second)
+	require.NoError(t, breakers.allow("1", now))
+	require.ErrorIs(t, breakers.allow("1", now), ErrCircuitOpen)
+
+	// New probes are let through if the outcome of the previous ones is never reported.
+	now = now.Add(time.Second)
+	require.NoError(t, breakers.allow("1", now))
+}
+
+func TestCircuitBreaker_MaxEjectionPercent(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, MaxEjectionPercent: 50}, nil)
+
+	for _, addr := range []string{"1", "2", "3", "4"} {
+		pool.ReportResult(addr, nil)
+	}
+
+	pool.ReportResult("1", errors.New("failed"))
+	pool.ReportResult("2", errors.New("failed"))
+	pool.ReportResult("3", errors.New("failed"))
+	assert.Equal(t, CircuitOpen, pool.CircuitState("1"))
+	assert.Equal(t, CircuitOpen, pool.CircuitState("2"))
+	assert.Equal(t, CircuitClosed, pool.CircuitState("3"))
+	require.NoError(t, pool.AllowRequest("3"))
+
+	// At least one address can always be ejected.
+	pool = newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, MaxEjectionPercent: 10}, nil)
+	pool.ReportResult("1", errors.New("failed"))
+	assert.Equal(t, CircuitOpen, pool.CircuitState("1"))
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	pool := NewPool("test", PoolConfig{CheckInterval: time.Minute}, nil, nil, nil, log.NewNopLogger())
+
+	for i := 0; i < 10; i++ {
+		pool.ReportResult("1", errors.New("failed"))
+	}
+	assert.Equal(t, CircuitClosed, pool.CircuitState("1"))
+	require.NoError(t, pool.AllowRequest("1"))
+}
+
+func TestCircuitBreaker_RemovedWithStaleAddresses(t *testing.T) {
+	addrs := []string{"1", "2"}
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1}, func() ([]string, error) {
+		return addrs, nil
+	})
+
+	_, err := pool.GetClientFor("1")
+	require.NoError(t, err)
+	pool.ReportResult("1", errors.New("failed"))
+	require.Equal(t, CircuitOpen, pool.CircuitState("1"))
+
+	// The circuit breaker is kept while the address is known, even if the client is removed.
+	pool.RemoveClientFor("1")
+	require.NoError(t, pool.iteration(context.Background()))
+	assert.Equal(t, CircuitOpen, pool.CircuitState("1"))
+
+	addrs = []string{"2"}
+	require.NoError(t, pool.iteration(context.Background()))
+	assert.Equal(t, CircuitClosed, pool.CircuitState("1"))
+}
+
+func TestCircuitBreaker_RemovedWithClientsWithoutDiscovery(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, MaxEjectionPercent: 50}, nil)
+
+	for _, addr := range []string{"1", "2", "3", "4"} {
+		_, err := pool.GetClientFor(addr)
+		require.NoError(t, err)
+		pool.ReportResult(addr, nil)
+	}
+	for _, addr := range []string{"2", "3", "4"} {
+		pool.RemoveClientFor(addr)
+	}
+	require.NoError(t, pool.iteration(context.Background()))
+
+	// The removed addresses don't count anymore towards the maximum number of ejected addresses.
+	pool.ReportResult("1", errors.New("failed"))
+	assert.Equal(t, CircuitOpen, pool.CircuitState("1"))
+	_, err := pool.GetClientFor("5")
+	require.NoError(t, err)
+	pool.ReportResult("5", errors.New("failed"))
+	assert.Equal(t, CircuitClosed, pool.CircuitState("5"))
+}
+
+func TestCircuitBreaker_UnaryClientInterceptor(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2}, nil)
+	interceptor := pool.CircuitBreakerUnaryClientInterceptor()
+
+	conn, err := grpc.NewClient("localhost:1234", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, conn.Close()) })
+
+	invocations := 0
+	invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		invocations++
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+
+	for i := 0; i < 3; i++ {
+		err := interceptor(context.Background(), "/test", nil, nil, conn, invoker)
+		require.Error(t, err)
+	}
+
+	// The third request is rejected without being sent.
+	assert.Equal(t, 2, invocations)
+	assert.Equal(t, CircuitOpen, pool.CircuitState("localhost:1234"))
+	require.ErrorIs(t, interceptor(context.Background(), "/test", nil, nil, conn, invoker), ErrCircuitOpen)
+}
+
+func TestCircuitBreaker_InstanceScorer(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, MaxEjectionPercent: 100}, nil)
+	scorer := pool.CircuitBreakerInstanceScorer(ring.NewEWMAInstanceScorer(ring.EWMAInstanceScorerConfig{ExplorationProbability: -1}))
+
+	healthy := &ring.InstanceDesc{Addr: "1"}
+	failing := &ring.InstanceDesc{Addr: "2"}
+
+	scorer.Observe(healthy, time.Second, nil)
+	scorer.Observe(failing, time.Millisecond, errors.New("failed"))
+
+	// The ejected instance is deprioritized, even if it's faster.
+	assert.Equal(t, CircuitOpen, pool.CircuitState("2"))
+	assert.Equal(t, math.Inf(1), scorer.Score(failing))
+	assert.InDelta(t, 1, scorer.Score(healthy), 0.01)
+}
+
+func TestCircuitBreaker_InstanceScorerHalfOpen(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: time.Second, HalfOpenRequests: 2}, nil)
+	scorer := pool.CircuitBreakerInstanceScorer(nil)
+	instance := &ring.InstanceDesc{Addr: "1"}
+
+	// The circuit breaker opened long enough ago to switch to half-open.
+	pool.breakers.report("1", errors.New("failed"), time.Now().Add(-time.Second))
+	require.NoError(t, pool.AllowRequest("1"))
+	require.NoError(t, pool.AllowRequest("1"))
+
+	// The outcomes of requests not let through don't close the circuit breaker before the probes complete.
+	scorer.Observe(instance, time.Millisecond, nil)
+	scorer.Observe(instance, time.Millisecond, nil)
+	assert.Equal(t, CircuitHalfOpen, pool.CircuitState("1"))
+
+	pool.ReportResult("1", nil)
+	pool.ReportResult("1", nil)
+	assert.Equal(t, CircuitClosed, pool.CircuitState("1"))
+
+	// Without probes, the observed outcomes are let through as probes.
+	// The circuit breaker opened long enough ago to switch to half-open.
+	pool.breakers.report("1", errors.New("failed"), time.Now().Add(-time.Second))
+	scorer.Observe(instance, time.Millisecond, nil)
+	assert.Equal(t, CircuitHalfOpen, pool.CircuitState("1"))
+	scorer.Observe(instance, time.Millisecond, nil)
+	assert.Equal(t, CircuitClosed, pool.CircuitState("1"))
+}
+
+func TestCircuitBreaker_DoUntilQuorum(t *testing.T) {
+	pool := newTestPoolWithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, MaxEjectionPercent: 100}, nil)
+	cfg := ring.DoUntilQuorumConfig{MinimizeRequests: true, InstanceScorer: pool.CircuitBreakerInstanceScorer(nil)}
+
+	replicationSet := ring.ReplicationSet{
+		Instances: []ring.InstanceDesc{{Addr: "1"}, {Addr: "2"}, {Addr: "3"}},
+		MaxErrors: 1,
+	}
+	pool.ReportResult("2", errors.New("failed"))
+
+	// The ejected instance is only requested if another instance fails.
+	for i := 0; i < 10; i++ {
+		results, err := ring.DoUntilQuorum(context.Background(), replicationSet, cfg, func(_ context.Context, instance *ring.InstanceDesc) (string, error) {
+			return instance.Addr, nil
+		}, func(string) {})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"1", "3"}, results)
+	}
+}
@@ -60,6 +60,10 @@ type PoolConfig struct {
 	HealthCheckEnabled        bool
 	HealthCheckTimeout        time.Duration
 	MaxConcurrentHealthChecks int // defaults to 16
+
+	// CircuitBreaker configures the per-address circuit breakers, driven by the request outcomes reported
+	// with ReportResult, CircuitBreakerUnaryClientInterceptor or CircuitBreakerInstanceScorer.
+	CircuitBreaker CircuitBreakerConfig
 }
 
 // Pool holds a cache of grpc_health_v1 clients.
@@ -75,6 +79,9 @@ type Pool struct {
 	sync.RWMutex
 	clients map[string]PoolClient
 
+	// breakers is nil if circuit breaking is disabled.
+	breakers *circuitBreakers
+
 	clientsMetric prometheus.Gauge
 }
 
@@ -93,6 +100,9 @@ func NewPool(clientName string, cfg PoolConfig, discovery PoolServiceDiscovery,
 		clients:       map[string]PoolClient{},
 		clientsMetric: clientsMetric,
 	}
+	if cfg.CircuitBreaker.Enabled {
+		p.breakers = newCircuitBreakers(cfg.CircuitBreaker, log.With(logger, "client", clientName))
+	}
 
 	p.Service = services.
 		NewTimerService(cfg.CheckInterval, nil, p.iteration, nil).
@@ -218,6 +228,11 @@ func (p *Pool) Count() int {
 func (p *Pool) removeStaleClients() {
 	// Only if service discovery has been configured.
 	if p.discovery == nil {
+		// Without service discovery, the circuit breakers are only kept for the addresses with a client,
+		// so that they don't accumulate and inflate the number of addresses MaxEjectionPercent applies to.
+		if p.breakers != nil {
+			p.breakers.retain(p.RegisteredAddresses())
+		}
 		return
 	}
 
@@ -234,6 +249,12 @@ func (p *Pool) removeStaleClients() {
 		level.Info(p.logger).Log("msg", "removing stale client", "addr", addr)
 		p.RemoveClientFor(addr)
 	}
+
+	// The circuit breakers are kept when clients are removed by health checks, so that ejected addresses
+	// stay ejected, and only removed once the addresses are gone.
+	if p.breakers != nil {
+		p.breakers.retain(serviceAddrs)
+	}
 }
 
 // cleanUnhealthy loops through all servers and deletes any that fail a healthcheck.
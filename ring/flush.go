@@ -18,6 +18,20 @@ type FlushTransferer interface {
 	TransferOut(ctx context.Context) error
 }
 
+// FlushProgressFunc is called to report the progress of a flush: flushed out of total items have been flushed
+// so far. The unit of the items is up to the FlushProgressTransferer, and total may grow while flushing.
+type FlushProgressFunc func(flushed, total int)
+
+// FlushProgressTransferer is a FlushTransferer which can report the progress of a flush, and stop flushing
+// when the context is canceled. It's used by the Lifecycler to drain the instance, see Lifecycler.StartDrain.
+type FlushProgressTransferer interface {
+	FlushTransferer
+
+	// FlushWithProgress flushes like Flush, calling progress as the flush progresses. It returns early
+	// with the context error if ctx is canceled.
+	FlushWithProgress(ctx context.Context, progress FlushProgressFunc) error
+}
+
 // NoopFlushTransferer is a FlushTransferer which does nothing and can
 // be used in cases we don't need one
 type NoopFlushTransferer struct{}
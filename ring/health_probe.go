@@ -0,0 +1,121 @@
+package ring
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HealthProbe checks the local health of an instance. See ReadOnlyOnUnhealthyDelegate.
+type HealthProbe interface {
+	// Name of the probe, used in logs.
+	Name() string
+
+	// Check returns an error if the instance is unhealthy.
+	Check(ctx context.Context) error
+}
+
+type funcHealthProbe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// NewFuncHealthProbe returns a HealthProbe calling check.
+func NewFuncHealthProbe(name string, check func(ctx context.Context) error) HealthProbe {
+	return &funcHealthProbe{name: name, check: check}
+}
+
+func (p *funcHealthProbe) Name() string                    { return p.name }
+func (p *funcHealthProbe) Check(ctx context.Context) error { return p.check(ctx) }
+
+type diskFreeHealthProbe struct {
+	path           string
+	minFreePercent float64
+}
+
+// NewDiskFreeHealthProbe returns a HealthProbe failing when the free space of the filesystem containing path,
+// available to unprivileged users, is below minFreePercent of its size.
+func NewDiskFreeHealthProbe(path string, minFreePercent float64) HealthProbe {
+	return &diskFreeHealthProbe{path: path, minFreePercent: minFreePercent}
+}
+
+func (p *diskFreeHealthProbe) Name() string { return "disk-free" }
+
+func (p *diskFreeHealthProbe) Check(_ context.Context) error {
+	free, total, err := diskUsage(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to get the disk usage of %s: %w", p.path, err)
+	}
+	return p.checkUsage(free, total)
+}
+
+func (p *diskFreeHealthProbe) checkUsage(free, total uint64) error {
+	if total == 0 {
+		return nil
+	}
+
+	if freePercent := float64(free) / float64(total) * 100; freePercent < p.minFreePercent {
+		return fmt.Errorf("free disk space of %s is %.2f%%, below the minimum of %.2f%%", p.path, freePercent, p.minFreePercent)
+	}
+	return nil
+}
+
+type memoryPressureHealthProbe struct {
+	path               string
+	maxPressurePercent float64
+}
+
+// NewMemoryPressureHealthProbe returns a HealthProbe failing when the memory pressure, as the share of the last
+// 10 seconds during which some tasks were stalled on memory, is above maxPressurePercent. It relies on the Linux
+// pressure stall information, and fails on systems which don't provide it.
+func NewMemoryPressureHealthProbe(maxPressurePercent float64) HealthProbe {
+	return newMemoryPressureHealthProbe("/proc/pressure/memory", maxPressurePercent)
+}
+
+func newMemoryPressureHealthProbe(path string, maxPressurePercent float64) *memoryPressureHealthProbe {
+	return &memoryPressureHealthProbe{path: path, maxPressurePercent: maxPressurePercent}
+}
+
+func (p *memoryPressureHealthProbe) Name() string { return "memory-pressure" }
+
+func (p *memoryPressureHealthProbe) Check(_ context.Context) error {
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read the memory pressure: %w", err)
+	}
+
+	pressure, err := parseSomeAvg10Pressure(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse the memory pressure from %s: %w", p.path, err)
+	}
+
+	if pressure > p.maxPressurePercent {
+		return fmt.Errorf("memory pressure is %.2f%%, above the maximum of %.2f%%", pressure, p.maxPressurePercent)
+	}
+	return nil
+}
+
+// parseSomeAvg10Pressure parses the "some avg10" value out of a pressure stall information file, like:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parseSomeAvg10Pressure(content []byte) (float64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			if value, ok := strings.CutPrefix(field, "avg10="); ok {
+				return strconv.ParseFloat(value, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("some avg10 value not found")
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package ring
+
+import (
+	"errors"
+	"runtime"
+)
+
+// diskUsage is not supported on this platform.
+func diskUsage(string) (free, total uint64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on " + runtime.GOOS)
+}
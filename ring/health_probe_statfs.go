@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package ring
+
+import "syscall"
+
+// diskUsage returns the space available to unprivileged users and the size of the filesystem containing path.
+func diskUsage(path string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	// The types of the fields differ between platforms.
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,47 @@
+package ring
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskFreeHealthProbe(t *testing.T) {
+	probe := NewDiskFreeHealthProbe("/data", 10).(*diskFreeHealthProbe)
+	assert.NoError(t, probe.checkUsage(20, 100))
+	assert.EqualError(t, probe.checkUsage(5, 100), "free disk space of /data is 5.00%, below the minimum of 10.00%")
+
+	// The path doesn't exist.
+	missing := NewDiskFreeHealthProbe(filepath.Join(t.TempDir(), "missing"), 10)
+	assert.Error(t, missing.Check(context.Background()))
+}
+
+func TestDiskFreeHealthProbe_ActualDisk(t *testing.T) {
+	free, total, err := diskUsage(t.TempDir())
+	if err != nil {
+		t.Skip("disk usage not supported:", err)
+	}
+	assert.NotZero(t, total)
+	assert.LessOrEqual(t, free, total)
+}
+
+func TestMemoryPressureHealthProbe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory")
+	probe := newMemoryPressureHealthProbe(path, 20)
+
+	// The file doesn't exist.
+	assert.Error(t, probe.Check(context.Background()))
+
+	require.NoError(t, os.WriteFile(path, []byte("some avg10=12.50 avg60=30.00 avg300=1.00 total=100\nfull avg10=50.00 avg60=0.00 avg300=0.00 total=10\n"), 0o600))
+	assert.NoError(t, probe.Check(context.Background()))
+
+	require.NoError(t, os.WriteFile(path, []byte("some avg10=25.00 avg60=0.00 avg300=0.00 total=100\n"), 0o600))
+	assert.EqualError(t, probe.Check(context.Background()), "memory pressure is 25.00%, above the maximum of 20.00%")
+
+	require.NoError(t, os.WriteFile(path, []byte("full avg10=25.00\n"), 0o600))
+	assert.Error(t, probe.Check(context.Background()))
+}
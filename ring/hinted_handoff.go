@@ -0,0 +1,630 @@
+package ring
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/services"
+)
+
+const (
+	hintFileExtension = ".hints"
+
+	// hintFileHeaderSize is the size of the header of a spool file: the offset of the first hint not discarded.
+	hintFileHeaderSize = 8
+
+	// hintHeaderSize is the size of the header of each hint in a spool file: the hint timestamp in
+	// nanoseconds and the payload size.
+	hintHeaderSize = 8 + 4
+
+	hintDroppedReasonFull    = "full"
+	hintDroppedReasonExpired = "expired"
+)
+
+// ErrHintedHandoffFull is returned by HintedHandoff.Record when the spool has no room for a new hint.
+var ErrHintedHandoffFull = errors.New("hinted handoff spool is full")
+
+// HintReplayFunc sends the payload of a hint to the instance which missed it.
+type HintReplayFunc func(ctx context.Context, instance InstanceDesc, payload []byte) error
+
+// HintedHandoffConfig configures HintedHandoff.
+type HintedHandoffConfig struct {
+	Directory         string        `yaml:"directory"`
+	MaxSizeBytes      int64         `yaml:"max_size_bytes"`
+	MaxHintAge        time.Duration `yaml:"max_hint_age"`
+	ReplayInterval    time.Duration `yaml:"replay_interval" category:"advanced"`
+	ReplayConcurrency int           `yaml:"replay_concurrency" category:"advanced"`
+}
+
+// RegisterFlagsWithPrefix registers flags with the given prefix.
+func (cfg *HintedHandoffConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.Directory, prefix+"hinted-handoff.directory", "", "Directory where hints for unavailable instances are spooled. If empty, hints are kept in memory and lost on restart.")
+	f.Int64Var(&cfg.MaxSizeBytes, prefix+"hinted-handoff.max-size-bytes", 64*1024*1024, "Maximum size of the payloads of all the spooled hints. New hints are dropped once the limit is reached.")
+	f.DurationVar(&cfg.MaxHintAge, prefix+"hinted-handoff.max-hint-age", 3*time.Hour, "Hints older than this are dropped instead of being replayed. 0 to never drop hints because of their age.")
+	f.DurationVar(&cfg.ReplayInterval, prefix+"hinted-handoff.replay-interval", 10*time.Second, "How frequently hints are replayed to the instances which are healthy again.")
+	f.IntVar(&cfg.ReplayConcurrency, prefix+"hinted-handoff.replay-concurrency", 4, "Maximum number of instances to replay hints to concurrently.")
+}
+
+// Validate the config.
+func (cfg *HintedHandoffConfig) Validate() error {
+	if cfg.MaxSizeBytes <= 0 {
+		return errors.New("the hinted handoff max size must be greater than 0")
+	}
+	if cfg.ReplayInterval <= 0 {
+		return errors.New("the hinted handoff replay interval must be greater than 0")
+	}
+	if cfg.ReplayConcurrency <= 0 {
+		return errors.New("the hinted handoff replay concurrency must be greater than 0")
+	}
+	return nil
+}
+
+// HintedHandoff records the items which couldn't be written to an unavailable instance as hints in a bounded
+// local spool, and replays them once the instance is healthy again in the ring. It's typically fed by the
+// DoBatchOptions.OnInstanceFailure hook of DoBatchWithOptions.
+//
+// Hints are opaque payloads, replayed in the order they have been recorded. A hint is removed from the spool
+// once replayed successfully, so it may be replayed more than once if the HintReplayFunc fails after
+// the instance received it.
+type HintedHandoff struct {
+	services.Service
+
+	cfg    HintedHandoffConfig
+	ring   ReadRing
+	replay HintReplayFunc
+	logger log.Logger
+
+	mtx   sync.Mutex
+	spool hintSpool
+	// backlog tracks the hints in the spool for each instance, in the order they have been recorded.
+	backlog map[string][]hintMeta
+	size    int64
+
+	recorded       prometheus.Counter
+	replayed       prometheus.Counter
+	replayFailures prometheus.Counter
+	dropped        *prometheus.CounterVec
+	backlogHints   prometheus.Gauge
+	backlogBytes   prometheus.Gauge
+	replayDelay    prometheus.Histogram
+}
+
+type hintMeta struct {
+	timestamp time.Time
+	size      int64
+}
+
+// NewHintedHandoff creates a HintedHandoff replaying hints with replay to the instances of the ring.
+// The name is used to distinguish the metrics of multiple HintedHandoff.
+func NewHintedHandoff(cfg HintedHandoffConfig, name string, ring ReadRing, replay HintReplayFunc, logger log.Logger, reg prometheus.Registerer) (*HintedHandoff, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var spool hintSpool = newMemoryHintSpool()
+	if cfg.Directory != "" {
+		if err := os.MkdirAll(cfg.Directory, 0o750); err != nil {
+			return nil, fmt.Errorf("creating hinted handoff directory: %w", err)
+		}
+		spool = &diskHintSpool{dir: cfg.Directory}
+	}
+
+	h := &HintedHandoff{
+		cfg:     cfg,
+		ring:    ring,
+		replay:  replay,
+		logger:  log.With(logger, "component", "hinted-handoff", "name", name),
+		spool:   spool,
+		backlog: map[string][]hintMeta{},
+
+		recorded: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "hinted_handoff_hints_recorded_total",
+			Help:        "Total number of hints recorded for unavailable instances.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		replayed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "hinted_handoff_hints_replayed_total",
+			Help:        "Total number of hints successfully replayed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		replayFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "hinted_handoff_replay_failures_total",
+			Help:        "Total number of failed hint replays.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		dropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "hinted_handoff_hints_dropped_total",
+			Help:        "Total number of hints dropped without being replayed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}, []string{"reason"}),
+		backlogHints: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "hinted_handoff_backlog_hints",
+			Help:        "Number of hints waiting to be replayed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		backlogBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "hinted_handoff_backlog_bytes",
+			Help:        "Size of the payloads of the hints waiting to be replayed.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		replayDelay: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:                            "hinted_handoff_replay_delay_seconds",
+			Help:                            "Time between recording a hint and successfully replaying it.",
+			ConstLabels:                     prometheus.Labels{"name": name},
+			Buckets:                         prometheus.ExponentialBuckets(1, 4, 8),
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: time.Hour,
+		}),
+	}
+
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "hinted_handoff_replay_lag_seconds",
+		Help:        "Age of the oldest hint waiting to be replayed.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, h.replayLag)
+	h.dropped.WithLabelValues(hintDroppedReasonFull)
+	h.dropped.WithLabelValues(hintDroppedReasonExpired)
+
+	h.Service = services.NewTimerService(cfg.ReplayInterval, h.starting, h.iteration, nil).WithName(fmt.Sprintf("%s hinted handoff", name))
+	return h, nil
+}
+
+// starting loads the hints left in the spool by a previous process.
+func (h *HintedHandoff) starting(_ context.Context) error {
+	instanceIDs, err := h.spool.instances()
+	if err != nil {
+		return fmt.Errorf("listing spooled hints: %w", err)
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, instanceID := range instanceIDs {
+		hints, err := h.spool.read(instanceID)
+		if err != nil {
+			return fmt.Errorf("reading spooled hints for instance %s: %w", instanceID, err)
+		}
+		for _, hint := range hints {
+			h.addToBacklog(instanceID, hintMeta{timestamp: hint.timestamp, size: int64(len(hint.payload))})
+		}
+	}
+	if len(instanceIDs) > 0 {
+		level.Info(h.logger).Log("msg", "loaded spooled hints", "instances", len(instanceIDs), "bytes", h.size)
+	}
+	return nil
+}
+
+// Record spools a hint with the payload which couldn't be written to the instance, to be replayed once the
+// instance is healthy again. It returns ErrHintedHandoffFull if the spool has no room for the hint.
+func (h *HintedHandoff) Record(instance InstanceDesc, payload []byte) error {
+	if instance.Id == "" {
+		return errors.New("cannot record a hint for an instance without ID")
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	size := int64(len(payload))
+	if h.size+size > h.cfg.MaxSizeBytes {
+		h.dropped.WithLabelValues(hintDroppedReasonFull).Inc()
+		return ErrHintedHandoffFull
+	}
+
+	hint := spooledHint{timestamp: time.Now(), payload: payload}
+	if err := h.spool.append(instance.Id, hint); err != nil {
+		return fmt.Errorf("spooling hint: %w", err)
+	}
+
+	h.addToBacklog(instance.Id, hintMeta{timestamp: hint.timestamp, size: size})
+	h.recorded.Inc()
+	return nil
+}
+
+// Backlog returns the number of hints waiting to be replayed to the instance.
+func (h *HintedHandoff) Backlog(instanceID string) int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return len(h.backlog[instanceID])
+}
+
+func (h *HintedHandoff) iteration(ctx context.Context) error {
+	h.expireHints(time.Now())
+
+	healthy, err := h.ring.GetAllHealthy(Write)
+	if err != nil {
+		// An empty ring is not an error: there's just no instance to replay hints to.
+		if !errors.Is(err, ErrEmptyRing) {
+			level.Warn(h.logger).Log("msg", "failed to get healthy instances from the ring", "err", err)
+		}
+		return nil
+	}
+
+	h.mtx.Lock()
+	var instances []InstanceDesc
+	for _, instance := range healthy.Instances {
+		if len(h.backlog[instance.Id]) > 0 {
+			instances = append(instances, instance)
+		}
+	}
+	h.mtx.Unlock()
+
+	// Failures are logged and retried at the next iteration, so they never stop the service.
+	_ = concurrency.ForEachJob(ctx, len(instances), h.cfg.ReplayConcurrency, func(ctx context.Context, idx int) error {
+		h.replayInstance(ctx, instances[idx])
+		return nil
+	})
+	return nil
+}
+
+// replayInstance replays the hints of the instance in order, until the first failure.
+func (h *HintedHandoff) replayInstance(ctx context.Context, instance InstanceDesc) {
+	h.mtx.Lock()
+	hints, err := h.spool.read(instance.Id)
+	h.mtx.Unlock()
+	if err != nil {
+		level.Warn(h.logger).Log("msg", "failed to read spooled hints", "instance", instance.Id, "err", err)
+		return
+	}
+
+	// Hints recorded while replaying are appended after the ones read, so it's safe to discard
+	// the replayed hints from the head of the spool.
+	replayed := 0
+	for _, hint := range hints {
+		if err := h.replay(ctx, instance, hint.payload); err != nil {
+			h.replayFailures.Inc()
+			level.Warn(h.logger).Log("msg", "failed to replay hint", "instance", instance.Id, "addr", instance.Addr, "err", err)
+			break
+		}
+		replayed++
+		h.replayed.Inc()
+		h.replayDelay.Observe(time.Since(hint.timestamp).Seconds())
+	}
+
+	if replayed == 0 {
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if err := h.discard(instance.Id, replayed); err != nil {
+		level.Warn(h.logger).Log("msg", "failed to discard replayed hints", "instance", instance.Id, "err", err)
+	}
+}
+
+// expireHints drops the hints older than the max hint age.
+func (h *HintedHandoff) expireHints(now time.Time) {
+	if h.cfg.MaxHintAge <= 0 {
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for instanceID, hints := range h.backlog {
+		expired := 0
+		for expired < len(hints) && now.Sub(hints[expired].timestamp) > h.cfg.MaxHintAge {
+			expired++
+		}
+		if expired == 0 {
+			continue
+		}
+		if err := h.discard(instanceID, expired); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to discard expired hints", "instance", instanceID, "err", err)
+			continue
+		}
+		h.dropped.WithLabelValues(hintDroppedReasonExpired).Add(float64(expired))
+	}
+}
+
+// discard removes the first n hints of the instance. It must be called with the lock held.
+func (h *HintedHandoff) discard(instanceID string, n int) error {
+	if err := h.spool.discard(instanceID, n); err != nil {
+		return err
+	}
+
+	for _, hint := range h.backlog[instanceID][:n] {
+		h.size -= hint.size
+	}
+	h.backlog[instanceID] = h.backlog[instanceID][n:]
+	if len(h.backlog[instanceID]) == 0 {
+		delete(h.backlog, instanceID)
+	}
+
+	h.backlogHints.Sub(float64(n))
+	h.backlogBytes.Set(float64(h.size))
+	return nil
+}
+
+// addToBacklog must be called with the lock held.
+func (h *HintedHandoff) addToBacklog(instanceID string, hint hintMeta) {
+	h.backlog[instanceID] = append(h.backlog[instanceID], hint)
+	h.size += hint.size
+	h.backlogHints.Inc()
+	h.backlogBytes.Set(float64(h.size))
+}
+
+func (h *HintedHandoff) replayLag() float64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var oldest time.Time
+	for _, hints := range h.backlog {
+		if len(hints) > 0 && (oldest.IsZero() || hints[0].timestamp.Before(oldest)) {
+			oldest = hints[0].timestamp
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest).Seconds()
+}
+
+type spooledHint struct {
+	timestamp time.Time
+	payload   []byte
+}
+
+// hintSpool stores the hints of each instance in the order they have been appended.
+// Implementations don't need to be safe for concurrent use.
+type hintSpool interface {
+	append(instanceID string, hint spooledHint) error
+	read(instanceID string) ([]spooledHint, error)
+	// discard removes the first n hints of the instance.
+	discard(instanceID string, n int) error
+	instances() ([]string, error)
+}
+
+type memoryHintSpool struct {
+	hints map[string][]spooledHint
+}
+
+func newMemoryHintSpool() *memoryHintSpool {
+	return &memoryHintSpool{hints: map[string][]spooledHint{}}
+}
+
+func (s *memoryHintSpool) append(instanceID string, hint spooledHint) error {
+	// The payload is copied because the caller may reuse its buffer.
+	hint.payload = append([]byte(nil), hint.payload...)
+	s.hints[instanceID] = append(s.hints[instanceID], hint)
+	return nil
+}
+
+func (s *memoryHintSpool) read(instanceID string) ([]spooledHint, error) {
+	return s.hints[instanceID][:len(s.hints[instanceID]):len(s.hints[instanceID])], nil
+}
+
+func (s *memoryHintSpool) discard(instanceID string, n int) error {
+	remaining := s.hints[instanceID][n:]
+	if len(remaining) == 0 {
+		delete(s.hints, instanceID)
+		return nil
+	}
+	s.hints[instanceID] = remaining
+	return nil
+}
+
+func (s *memoryHintSpool) instances() ([]string, error) {
+	// Hints kept in memory don't survive restarts.
+	return nil, nil
+}
+
+// diskHintSpool stores the hints of each instance in a file of the directory. The file starts with the offset
+// of the first hint not discarded yet, followed by the hints, each with a header made of the timestamp and the
+// payload size preceding the payload. Discarded hints are skipped by moving the offset, and the file is only
+// rewritten once the discarded hints take more room than the remaining ones.
+type diskHintSpool struct {
+	dir string
+}
+
+func (s *diskHintSpool) path(instanceID string) string {
+	return filepath.Join(s.dir, url.PathEscape(instanceID)+hintFileExtension)
+}
+
+func (s *diskHintSpool) append(instanceID string, hint spooledHint) error {
+	f, err := os.OpenFile(s.path(instanceID), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	size := info.Size()
+	if size < hintFileHeaderSize {
+		// The file is new, or its creation was interrupted by a crash.
+		if err := writeHintFileOffset(f, hintFileHeaderSize); err != nil {
+			_ = f.Close()
+			return err
+		}
+		size = hintFileHeaderSize
+	}
+
+	if err := writeHint(io.NewOffsetWriter(f, size), hint); err != nil {
+		// The partially written hint is removed, so that the next ones can be read.
+		_ = f.Truncate(size)
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// read returns the hints of the instance which have not been discarded. A truncated hint at the end of the file,
+// the result of a crash while appending it, is removed from the file.
+func (s *diskHintSpool) read(instanceID string) ([]spooledHint, error) {
+	f, err := os.OpenFile(s.path(instanceID), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offset, err := readHintFileOffset(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		hints  []spooledHint
+		reader = bufio.NewReader(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+		header [hintHeaderSize]byte
+		end    = offset
+	)
+	for {
+		if _, err := io.ReadFull(reader, header[:]); errors.Is(err, io.EOF) {
+			return hints, nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			return hints, f.Truncate(end)
+		} else if err != nil {
+			return nil, err
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(header[8:]))
+		if _, err := io.ReadFull(reader, payload); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return hints, f.Truncate(end)
+		} else if err != nil {
+			return nil, err
+		}
+
+		hints = append(hints, spooledHint{
+			timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(header[:8]))),
+			payload:   payload,
+		})
+		end += hintHeaderSize + int64(len(payload))
+	}
+}
+
+func (s *diskHintSpool) discard(instanceID string, n int) error {
+	path := s.path(instanceID)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := readHintFileOffset(f)
+	if err != nil {
+		return err
+	}
+
+	// Only the headers of the discarded hints are read, to find the offset of the next hint.
+	reader := bufio.NewReader(io.NewSectionReader(f, offset, info.Size()-offset))
+	var header [hintHeaderSize]byte
+	for i := 0; i < n && offset < info.Size(); i++ {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return err
+		}
+		size := int(binary.BigEndian.Uint32(header[8:]))
+		if _, err := reader.Discard(size); err != nil {
+			return err
+		}
+		offset += hintHeaderSize + int64(size)
+	}
+
+	remaining := info.Size() - offset
+	switch {
+	case remaining <= 0:
+		return os.Remove(path)
+	case offset-hintFileHeaderSize <= remaining:
+		return writeHintFileOffset(f, offset)
+	}
+
+	// The remaining hints are written to a temporary file which atomically replaces the spool file.
+	tmp, err := os.CreateTemp(s.dir, "discard-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeHintFileOffset(tmp, hintFileHeaderSize); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(io.NewOffsetWriter(tmp, hintFileHeaderSize), io.NewSectionReader(f, offset, remaining)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *diskHintSpool) instances() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceIDs []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), hintFileExtension)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		instanceID, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	return instanceIDs, nil
+}
+
+// readHintFileOffset returns the offset of the first hint not discarded yet. A file too short to hold the offset
+// has been created by an interrupted append, and has no hints.
+func readHintFileOffset(f *os.File) (int64, error) {
+	var buf [hintFileHeaderSize]byte
+	if _, err := f.ReadAt(buf[:], 0); errors.Is(err, io.EOF) {
+		return hintFileHeaderSize, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf[:])), nil
+}
+
+func writeHintFileOffset(f *os.File, offset int64) error {
+	var buf [hintFileHeaderSize]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(offset))
+	_, err := f.WriteAt(buf[:], 0)
+	return err
+}
+
+func writeHint(w io.Writer, hint spooledHint) error {
+	var header [hintHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(hint.timestamp.UnixNano()))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(hint.payload)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(hint.payload)
+	return err
+}
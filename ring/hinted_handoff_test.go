@@ -0,0 +1,366 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+func newHintedHandoffTestRing(t *testing.T, instances int) *Ring {
+	gen := initTokenGenerator(t)
+
+	desc := NewDesc()
+	for i := 0; i < instances; i++ {
+		instanceID := fmt.Sprintf("instance-%d", i)
+		desc.AddIngester(instanceID, instanceID, "", gen.GenerateTokens(128, nil), ACTIVE, time.Now(), false, time.Time{}, 0)
+	}
+
+	ring, err := NewWithStoreClientAndStrategy(Config{HeartbeatTimeout: time.Minute, ReplicationFactor: 3}, "ingester", ringKey, nil, NewDefaultReplicationStrategy(), nil, log.NewNopLogger())
+	require.NoError(t, err)
+	ring.updateRingState(desc)
+	return ring
+}
+
+func setInstanceHeartbeat(ring *Ring, instanceID string, heartbeat time.Time) {
+	desc := ring.ringDesc.Clone().(*Desc)
+	instance := desc.Ingesters[instanceID]
+	instance.Timestamp = heartbeat.Unix()
+	desc.Ingesters[instanceID] = instance
+	ring.updateRingState(desc)
+}
+
+type hintReplayRecorder struct {
+	mtx      sync.Mutex
+	err      error
+	replayed map[string][]string
+}
+
+func (r *hintReplayRecorder) replay(_ context.Context, instance InstanceDesc, payload []byte) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.replayed == nil {
+		r.replayed = map[string][]string{}
+	}
+	r.replayed[instance.Id] = append(r.replayed[instance.Id], string(payload))
+	return nil
+}
+
+func (r *hintReplayRecorder) setError(err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.err = err
+}
+
+func (r *hintReplayRecorder) get(instanceID string) []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.replayed[instanceID]
+}
+
+func newHintedHandoffForTesting(t *testing.T, cfg HintedHandoffConfig, ring ReadRing, replay HintReplayFunc, reg prometheus.Registerer) *HintedHandoff {
+	if cfg.MaxSizeBytes == 0 {
+		cfg.MaxSizeBytes = 1024
+	}
+	if cfg.ReplayInterval == 0 {
+		cfg.ReplayInterval = time.Hour
+	}
+	if cfg.ReplayConcurrency == 0 {
+		cfg.ReplayConcurrency = 2
+	}
+
+	h, err := NewHintedHandoff(cfg, "test", ring, replay, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), h))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), h))
+	})
+	return h
+}
+
+func TestHintedHandoff_DoBatchFailuresAreReplayed(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 3)
+	replayer := &hintReplayRecorder{}
+	reg := prometheus.NewPedanticRegistry()
+	h := newHintedHandoffForTesting(t, HintedHandoffConfig{}, ring, replayer.replay, reg)
+
+	keys := []uint32{1, 10, 100}
+	items := []string{"a", "b", "c"}
+	serverErr := errors.New("unavailable")
+	clientErr := mockError{isClientErr: true}
+
+	doBatch := func(failures map[string]error) {
+		done := make(chan struct{})
+		err := DoBatchWithOptions(context.Background(), Write, ring, keys, func(instance InstanceDesc, _ []int) error {
+			return failures[instance.Id]
+		}, DoBatchOptions{
+			Cleanup: func() { close(done) },
+			IsClientError: func(err error) bool {
+				return errors.Is(err, clientErr)
+			},
+			OnInstanceFailure: func(instance InstanceDesc, indexes []int, _ error) {
+				var payload []string
+				for _, idx := range indexes {
+					payload = append(payload, items[idx])
+				}
+				require.NoError(t, h.Record(instance, []byte(strings.Join(payload, ","))))
+			},
+		})
+		require.NoError(t, err)
+		<-done
+	}
+
+	// Client errors are not recorded: the items would be rejected again.
+	doBatch(map[string]error{"instance-2": clientErr})
+	assert.Zero(t, h.Backlog("instance-2"))
+
+	doBatch(map[string]error{"instance-2": serverErr})
+	doBatch(map[string]error{"instance-2": serverErr})
+	assert.Equal(t, 2, h.Backlog("instance-2"))
+
+	// Hints aren't replayed while the instance is unhealthy.
+	setInstanceHeartbeat(ring, "instance-2", time.Now().Add(-time.Hour))
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Empty(t, replayer.get("instance-2"))
+	assert.Equal(t, 2, h.Backlog("instance-2"))
+
+	// Hints are replayed in order once the instance is healthy again.
+	setInstanceHeartbeat(ring, "instance-2", time.Now())
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Equal(t, []string{"a,b,c", "a,b,c"}, replayer.get("instance-2"))
+	assert.Zero(t, h.Backlog("instance-2"))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP hinted_handoff_backlog_hints Number of hints waiting to be replayed.
+		# TYPE hinted_handoff_backlog_hints gauge
+		hinted_handoff_backlog_hints{name="test"} 0
+		# HELP hinted_handoff_hints_recorded_total Total number of hints recorded for unavailable instances.
+		# TYPE hinted_handoff_hints_recorded_total counter
+		hinted_handoff_hints_recorded_total{name="test"} 2
+		# HELP hinted_handoff_hints_replayed_total Total number of hints successfully replayed.
+		# TYPE hinted_handoff_hints_replayed_total counter
+		hinted_handoff_hints_replayed_total{name="test"} 2
+		# HELP hinted_handoff_replay_lag_seconds Age of the oldest hint waiting to be replayed.
+		# TYPE hinted_handoff_replay_lag_seconds gauge
+		hinted_handoff_replay_lag_seconds{name="test"} 0
+	`), "hinted_handoff_backlog_hints", "hinted_handoff_hints_recorded_total", "hinted_handoff_hints_replayed_total", "hinted_handoff_replay_lag_seconds"))
+}
+
+func TestHintedHandoff_DoBatchUnhealthyReplicasAreHinted(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 3)
+	replayer := &hintReplayRecorder{}
+	h := newHintedHandoffForTesting(t, HintedHandoffConfig{}, ring, replayer.replay, nil)
+
+	keys := []uint32{1, 10, 100}
+	items := []string{"a", "b", "c"}
+
+	// instance-2 is removed from the replication sets, because its heartbeat is stale.
+	setInstanceHeartbeat(ring, "instance-2", time.Now().Add(-time.Hour))
+
+	var called sync.Map
+	done := make(chan struct{})
+	err := DoBatchWithOptions(context.Background(), Write, ring, keys, func(instance InstanceDesc, _ []int) error {
+		called.Store(instance.Id, true)
+		return nil
+	}, DoBatchOptions{
+		Cleanup: func() { close(done) },
+		OnInstanceFailure: func(instance InstanceDesc, indexes []int, err error) {
+			assert.ErrorIs(t, err, ErrNotInReplicationSet)
+			var payload []string
+			for _, idx := range indexes {
+				payload = append(payload, items[idx])
+			}
+			require.NoError(t, h.Record(instance, []byte(strings.Join(payload, ","))))
+		},
+	})
+	require.NoError(t, err)
+	<-done
+
+	_, ok := called.Load("instance-2")
+	assert.False(t, ok)
+	assert.Equal(t, 1, h.Backlog("instance-2"))
+	assert.Zero(t, h.Backlog("instance-0"))
+	assert.Zero(t, h.Backlog("instance-1"))
+
+	setInstanceHeartbeat(ring, "instance-2", time.Now())
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Equal(t, []string{"a,b,c"}, replayer.get("instance-2"))
+}
+
+func TestHintedHandoff_ReplayStopsAtFirstFailure(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 3)
+	replayer := &hintReplayRecorder{}
+	h := newHintedHandoffForTesting(t, HintedHandoffConfig{}, ring, replayer.replay, nil)
+
+	instance := ring.ringDesc.Ingesters["instance-0"]
+	for _, payload := range []string{"1", "2"} {
+		require.NoError(t, h.Record(instance, []byte(payload)))
+	}
+
+	replayer.setError(errors.New("still failing"))
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Equal(t, 2, h.Backlog("instance-0"))
+
+	// Hints recorded in the meantime are replayed after the previous ones.
+	require.NoError(t, h.Record(instance, []byte("3")))
+	replayer.setError(nil)
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3"}, replayer.get("instance-0"))
+	assert.Zero(t, h.Backlog("instance-0"))
+}
+
+func TestHintedHandoff_BoundedSpool(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 1)
+	reg := prometheus.NewPedanticRegistry()
+	h := newHintedHandoffForTesting(t, HintedHandoffConfig{MaxSizeBytes: 10}, ring, (&hintReplayRecorder{}).replay, reg)
+
+	instance := ring.ringDesc.Ingesters["instance-0"]
+	require.NoError(t, h.Record(instance, []byte("12345")))
+	require.NoError(t, h.Record(instance, []byte("12345")))
+	require.ErrorIs(t, h.Record(instance, []byte("1")), ErrHintedHandoffFull)
+	require.Error(t, h.Record(InstanceDesc{Addr: "no-id"}, []byte("1")))
+	assert.Equal(t, 2, h.Backlog("instance-0"))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP hinted_handoff_backlog_bytes Size of the payloads of the hints waiting to be replayed.
+		# TYPE hinted_handoff_backlog_bytes gauge
+		hinted_handoff_backlog_bytes{name="test"} 10
+		# HELP hinted_handoff_hints_dropped_total Total number of hints dropped without being replayed.
+		# TYPE hinted_handoff_hints_dropped_total counter
+		hinted_handoff_hints_dropped_total{name="test",reason="expired"} 0
+		hinted_handoff_hints_dropped_total{name="test",reason="full"} 1
+	`), "hinted_handoff_backlog_bytes", "hinted_handoff_hints_dropped_total"))
+}
+
+func TestHintedHandoff_ExpiredHintsAreDropped(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 1)
+	replayer := &hintReplayRecorder{}
+	h := newHintedHandoffForTesting(t, HintedHandoffConfig{MaxHintAge: time.Minute}, ring, replayer.replay, nil)
+
+	instance := ring.ringDesc.Ingesters["instance-0"]
+	require.NoError(t, h.Record(instance, []byte("old")))
+	require.NoError(t, h.Record(instance, []byte("new")))
+
+	h.expireHints(time.Now().Add(30 * time.Second))
+	assert.Equal(t, 2, h.Backlog("instance-0"))
+
+	h.expireHints(time.Now().Add(2 * time.Minute))
+	assert.Zero(t, h.Backlog("instance-0"))
+
+	require.NoError(t, h.iteration(context.Background()))
+	assert.Empty(t, replayer.get("instance-0"))
+}
+
+func TestHintedHandoff_DiskSpoolSurvivesRestart(t *testing.T) {
+	ring := newHintedHandoffTestRing(t, 1)
+	instance := ring.ringDesc.Ingesters["instance-0"]
+	instance.Id = "instance/with:special chars"
+	cfg := HintedHandoffConfig{Directory: t.TempDir(), MaxSizeBytes: 1024, ReplayInterval: time.Hour, ReplayConcurrency: 1}
+
+	first, err := NewHintedHandoff(cfg, "test", ring, (&hintReplayRecorder{}).replay, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), first))
+	for _, payload := range []string{"1", "2", "3"} {
+		require.NoError(t, first.Record(instance, []byte(payload)))
+	}
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), first))
+
+	second, err := NewHintedHandoff(cfg, "test", ring, (&hintReplayRecorder{}).replay, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), second))
+	defer func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), second))
+	}()
+	assert.Equal(t, 3, second.Backlog(instance.Id))
+
+	second.mtx.Lock()
+	require.NoError(t, second.discard(instance.Id, 1))
+	hints, err := second.spool.read(instance.Id)
+	second.mtx.Unlock()
+	require.NoError(t, err)
+	require.Len(t, hints, 2)
+	assert.Equal(t, "2", string(hints[0].payload))
+	assert.Equal(t, "3", string(hints[1].payload))
+}
+
+func TestDiskHintSpool(t *testing.T) {
+	spool := &diskHintSpool{dir: t.TempDir()}
+	const instanceID = "instance-0"
+	fileSize := func() int64 {
+		info, err := os.Stat(spool.path(instanceID))
+		require.NoError(t, err)
+		return info.Size()
+	}
+	payloads := func() []string {
+		hints, err := spool.read(instanceID)
+		require.NoError(t, err)
+		var result []string
+		for _, hint := range hints {
+			result = append(result, string(hint.payload))
+		}
+		return result
+	}
+
+	for _, payload := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, spool.append(instanceID, spooledHint{timestamp: time.Now(), payload: []byte(payload)}))
+	}
+	size := fileSize()
+
+	// Discarding a few hints only moves the offset of the first hint.
+	require.NoError(t, spool.discard(instanceID, 1))
+	assert.Equal(t, []string{"2", "3", "4"}, payloads())
+	assert.Equal(t, size, fileSize())
+
+	// A hint truncated by a crash is removed, so that new hints can be appended after the last complete one.
+	f, err := os.OpenFile(spool.path(instanceID), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, []string{"2", "3", "4"}, payloads())
+	assert.Equal(t, size, fileSize())
+	require.NoError(t, spool.append(instanceID, spooledHint{timestamp: time.Now(), payload: []byte("5")}))
+	assert.Equal(t, []string{"2", "3", "4", "5"}, payloads())
+
+	// The file is rewritten once the discarded hints take more room than the remaining ones.
+	require.NoError(t, spool.discard(instanceID, 2))
+	assert.Equal(t, []string{"4", "5"}, payloads())
+	assert.Equal(t, int64(hintFileHeaderSize+2*(hintHeaderSize+1)), fileSize())
+
+	require.NoError(t, spool.discard(instanceID, 2))
+	assert.NoFileExists(t, spool.path(instanceID))
+	assert.Empty(t, payloads())
+}
+
+func TestHintedHandoffConfig_Validate(t *testing.T) {
+	cfg := HintedHandoffConfig{MaxSizeBytes: 1, ReplayInterval: time.Second, ReplayConcurrency: 1}
+	require.NoError(t, cfg.Validate())
+
+	invalid := cfg
+	invalid.MaxSizeBytes = 0
+	require.Error(t, invalid.Validate())
+
+	invalid = cfg
+	invalid.ReplayInterval = 0
+	require.Error(t, invalid.Validate())
+
+	invalid = cfg
+	invalid.ReplayConcurrency = 0
+	require.Error(t, invalid.Validate())
+}
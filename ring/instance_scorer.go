@@ -0,0 +1,175 @@
+package ring
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// InstanceScorer learns the performance of instances from the requests made by DoUntilQuorum, so that
+// DoUntilQuorum can prefer the best instances and zones when request minimization is enabled.
+//
+// Implementations must be safe for concurrent use.
+type InstanceScorer interface {
+	// Observe records the outcome of a request to the instance.
+	Observe(instance *InstanceDesc, latency time.Duration, err error)
+
+	// Score returns the score of the instance: instances with a lower score are preferred. Scores may be
+	// randomized, for example to explore instances which would otherwise never be preferred.
+	Score(instance *InstanceDesc) float64
+}
+
+// EWMAInstanceScorerConfig configures an EWMAInstanceScorer.
+type EWMAInstanceScorerConfig struct {
+	// DecayPeriod is the time constant of the moving averages: the weight of an observation is divided by e
+	// every DecayPeriod. The latency and error rate of an instance which is not requested decay with the same time
+	// constant, so that it's eventually scored like an instance never observed. Defaults to 30s.
+	DecayPeriod time.Duration
+
+	// ErrorPenalty is added to the average latency of an instance, proportionally to its error rate.
+	ErrorPenalty time.Duration
+
+	// ExplorationProbability is the probability for an instance to be scored as if it was the best one
+	// regardless of its history, so that slow or recovering instances still get some requests. Defaults to 0.01,
+	// negative to disable.
+	ExplorationProbability float64
+}
+
+// EWMAInstanceScorer is an InstanceScorer scoring instances by their exponentially weighted moving average
+// latency, penalized by their exponentially weighted moving average error rate. Instances never observed get
+// the best score, so that they're tried first.
+type EWMAInstanceScorer struct {
+	cfg EWMAInstanceScorerConfig
+
+	mtx       sync.Mutex
+	stats     map[string]*instanceStats
+	lastPrune time.Time
+}
+
+type instanceStats struct {
+	latency    float64 // Seconds.
+	errorRate  float64
+	lastUpdate time.Time
+}
+
+// NewEWMAInstanceScorer creates an EWMAInstanceScorer.
+func NewEWMAInstanceScorer(cfg EWMAInstanceScorerConfig) *EWMAInstanceScorer {
+	if cfg.DecayPeriod <= 0 {
+		cfg.DecayPeriod = 30 * time.Second
+	}
+	if cfg.ExplorationProbability == 0 {
+		cfg.ExplorationProbability = 0.01
+	}
+
+	return &EWMAInstanceScorer{
+		cfg:   cfg,
+		stats: map[string]*instanceStats{},
+	}
+}
+
+// Observe implements InstanceScorer.
+func (s *EWMAInstanceScorer) Observe(instance *InstanceDesc, latency time.Duration, err error) {
+	s.observe(instance, latency, err, time.Now())
+}
+
+func (s *EWMAInstanceScorer) observe(instance *InstanceDesc, latency time.Duration, err error, now time.Time) {
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.pruneStale(now)
+
+	stats, ok := s.stats[instance.Addr]
+	if !ok {
+		s.stats[instance.Addr] = &instanceStats{latency: latency.Seconds(), errorRate: failed, lastUpdate: now}
+		return
+	}
+
+	// The weight of the previous average depends on the time elapsed since the last observation,
+	// so that the averages don't depend on the request rate.
+	weight := s.decay(now.Sub(stats.lastUpdate))
+	stats.latency = weight*stats.latency + (1-weight)*latency.Seconds()
+	stats.errorRate = weight*stats.errorRate + (1-weight)*failed
+	stats.lastUpdate = now
+}
+
+// Score implements InstanceScorer.
+func (s *EWMAInstanceScorer) Score(instance *InstanceDesc) float64 {
+	return s.score(instance, time.Now(), rand.Float64())
+}
+
+// score returns the score of the instance at now, random being a random number in [0, 1).
+func (s *EWMAInstanceScorer) score(instance *InstanceDesc, now time.Time, random float64) float64 {
+	if s.cfg.ExplorationProbability > 0 && random < s.cfg.ExplorationProbability {
+		return 0
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stats, ok := s.stats[instance.Addr]
+	if !ok {
+		return 0
+	}
+
+	// The stats decay towards the score of an instance never observed while the instance is not requested.
+	return (stats.latency + stats.errorRate*s.cfg.ErrorPenalty.Seconds()) * s.decay(now.Sub(stats.lastUpdate))
+}
+
+// decay returns the weight of an observation after elapsed.
+func (s *EWMAInstanceScorer) decay(elapsed time.Duration) float64 {
+	return math.Exp(-float64(elapsed) / float64(s.cfg.DecayPeriod))
+}
+
+// pruneStale removes the instances not observed for a while, whose stats are mostly decayed.
+// It must be called with the lock held.
+func (s *EWMAInstanceScorer) pruneStale(now time.Time) {
+	staleAfter := 10 * s.cfg.DecayPeriod
+	if now.Sub(s.lastPrune) < staleAfter {
+		return
+	}
+
+	for addr, stats := range s.stats {
+		if now.Sub(stats.lastUpdate) > staleAfter {
+			delete(s.stats, addr)
+		}
+	}
+	s.lastPrune = now
+}
+
+// sortInstancesByScore sorts the instances by increasing score. Instances with the same score are kept
+// in their original order.
+func sortInstancesByScore(instances []*InstanceDesc, scorer InstanceScorer) {
+	scores := make(map[*InstanceDesc]float64, len(instances))
+	for _, instance := range instances {
+		scores[instance] = scorer.Score(instance)
+	}
+
+	slices.SortStableFunc(instances, func(a, b *InstanceDesc) int {
+		return cmp.Compare(scores[a], scores[b])
+	})
+}
+
+// newScoringZoneSorter returns a ZoneSorter sorting zones by the highest score of their instances, because all
+// the instances of a zone must succeed for the zone to succeed. Zones with the same score are shuffled.
+func newScoringZoneSorter(instances []InstanceDesc, scorer InstanceScorer) ZoneSorter {
+	return func(zones []string) []string {
+		scores := make(map[string]float64, len(zones))
+		for i := range instances {
+			scores[instances[i].Zone] = max(scores[instances[i].Zone], scorer.Score(&instances[i]))
+		}
+
+		zones = defaultZoneSorter(zones)
+		slices.SortStableFunc(zones, func(a, b string) int {
+			return cmp.Compare(scores[a], scores[b])
+		})
+		return zones
+	}
+}
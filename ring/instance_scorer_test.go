@@ -0,0 +1,89 @@
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWMAInstanceScorer(t *testing.T) {
+	now := time.Now()
+	scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{DecayPeriod: time.Minute, ErrorPenalty: 10 * time.Second, ExplorationProbability: -1})
+
+	fast := &InstanceDesc{Addr: "fast"}
+	slow := &InstanceDesc{Addr: "slow"}
+	failing := &InstanceDesc{Addr: "failing"}
+
+	// Instances never observed are preferred.
+	assert.Zero(t, scorer.score(fast, now, 1))
+
+	scorer.observe(fast, 10*time.Millisecond, nil, now)
+	scorer.observe(slow, time.Second, nil, now)
+	scorer.observe(failing, time.Millisecond, errors.New("failed"), now)
+	assert.InDelta(t, 0.01, scorer.score(fast, now, 1), 1e-9)
+	assert.InDelta(t, 1, scorer.score(slow, now, 1), 1e-9)
+	assert.InDelta(t, 10.001, scorer.score(failing, now, 1), 1e-9)
+
+	// After one decay period, a new observation weighs 1-1/e.
+	now = now.Add(time.Minute)
+	scorer.observe(slow, 10*time.Millisecond, nil, now)
+	assert.InDelta(t, 1/math.E+0.01*(1-1/math.E), scorer.score(slow, now, 1), 1e-9)
+
+	// The latency and the error rate decay while the instance is not requested, so that it gets traffic again.
+	assert.InDelta(t, 0.01/math.E, scorer.score(fast, now, 1), 1e-9)
+	assert.InDelta(t, 10.001/math.E, scorer.score(failing, now, 1), 1e-9)
+	now = now.Add(10 * time.Minute)
+	scorer.observe(fast, 10*time.Millisecond, nil, now)
+	assert.Less(t, scorer.score(failing, now, 1), scorer.score(fast, now, 1))
+
+	// Instances not observed for a while are forgotten.
+	now = now.Add(10 * time.Minute)
+	scorer.observe(fast, 10*time.Millisecond, nil, now)
+	assert.Zero(t, scorer.score(slow, now, 1))
+	assert.Zero(t, scorer.score(failing, now, 1))
+	assert.NotZero(t, scorer.score(fast, now, 1))
+}
+
+func TestEWMAInstanceScorer_Exploration(t *testing.T) {
+	scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{ExplorationProbability: 0.1})
+	slow := &InstanceDesc{Addr: "slow"}
+	scorer.Observe(slow, time.Second, nil)
+
+	assert.InDelta(t, 1, scorer.score(slow, time.Now(), 0.5), 0.01)
+	assert.Zero(t, scorer.score(slow, time.Now(), 0.05))
+}
+
+func TestEWMAInstanceScorer_DefaultExploration(t *testing.T) {
+	scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{})
+	slow := &InstanceDesc{Addr: "slow"}
+	scorer.Observe(slow, time.Second, nil)
+
+	assert.Zero(t, scorer.score(slow, time.Now(), 0.005))
+
+	scorer = NewEWMAInstanceScorer(EWMAInstanceScorerConfig{ExplorationProbability: -1})
+	scorer.Observe(slow, time.Second, nil)
+	assert.NotZero(t, scorer.score(slow, time.Now(), 0))
+}
+
+func TestSortInstancesByScore(t *testing.T) {
+	scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{ExplorationProbability: -1})
+	var instances []*InstanceDesc
+	for i := 0; i < 5; i++ {
+		instance := &InstanceDesc{Addr: fmt.Sprintf("instance-%d", i)}
+		scorer.Observe(instance, time.Duration(5-i)*time.Millisecond, nil)
+		instances = append(instances, instance)
+	}
+	unknown := &InstanceDesc{Addr: "unknown"}
+	instances = append(instances, unknown)
+
+	sortInstancesByScore(instances, scorer)
+	require.Len(t, instances, 6)
+	assert.Equal(t, []string{"unknown", "instance-4", "instance-3", "instance-2", "instance-1", "instance-0"}, []string{
+		instances[0].Addr, instances[1].Addr, instances[2].Addr, instances[3].Addr, instances[4].Addr, instances[5].Addr,
+	})
+}
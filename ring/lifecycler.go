@@ -32,6 +32,7 @@ type LifecyclerConfig struct {
 
 	// Config for the ingester lifecycle control
 	NumTokens        int           `yaml:"num_tokens" category:"advanced"`
+	Weight           int           `yaml:"weight" category:"experimental"`
 	HeartbeatPeriod  time.Duration `yaml:"heartbeat_period" category:"advanced"`
 	HeartbeatTimeout time.Duration `yaml:"heartbeat_timeout" category:"advanced"`
 	ObservePeriod    time.Duration `yaml:"observe_period" category:"advanced"`
@@ -81,6 +82,7 @@ func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.Flag
 	}
 
 	f.IntVar(&cfg.NumTokens, prefix+"num-tokens", 128, "Number of tokens for each ingester.")
+	f.IntVar(&cfg.Weight, prefix+"weight", 1, "Weight of this instance relative to the other instances of the ring. The instance registers num-tokens multiplied by the weight tokens, and token generators aware of weights target a proportional ownership.")
 	f.DurationVar(&cfg.HeartbeatPeriod, prefix+"heartbeat-period", 5*time.Second, "Period at which to heartbeat to consul. 0 = disabled.")
 	f.DurationVar(&cfg.HeartbeatTimeout, prefix+"heartbeat-timeout", 1*time.Minute, "Heartbeat timeout after which instance is assumed to be unhealthy. 0 = disabled.")
 	f.DurationVar(&cfg.JoinAfter, prefix+"join-after", 0*time.Second, "Period to wait for a claim from another member; will join automatically after this.")
@@ -107,6 +109,9 @@ func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.Flag
 
 // Validate checks the consistency of LifecyclerConfig, and fails if this cannot be achieved.
 func (cfg *LifecyclerConfig) Validate() error {
+	if cfg.Weight < 0 {
+		return errors.New("the instance weight can't be negative")
+	}
 	_, ok := cfg.RingTokenGenerator.(*SpreadMinimizingTokenGenerator)
 	if ok {
 		// If cfg.RingTokenGenerator is a SpreadMinimizingTokenGenerator, we must ensure that
@@ -114,10 +119,26 @@ func (cfg *LifecyclerConfig) Validate() error {
 		if cfg.TokensFilePath != "" {
 			return errors.New("you can't configure the tokens file path when using the spread minimizing token strategy. Please set the tokens file path to an empty string")
 		}
+		// SpreadMinimizingTokenGenerator computes the tokens of each instance from its ID only, assuming all the
+		// instances own the same number of tokens, so it doesn't support weights. Weighted instances must use
+		// ZoneAwareSpreadMinimizingTokenGenerator instead.
+		if cfg.Weight > 1 {
+			return errors.New("you can't configure an instance weight greater than 1 when using the spread minimizing token strategy, use the zone-aware spread minimizing token generator instead")
+		}
 	}
 	return nil
 }
 
+// weight returns the weight of the instance, which is 1 if unset.
+func (cfg *LifecyclerConfig) weight() uint32 {
+	return uint32(max(1, cfg.Weight))
+}
+
+// tokensCount returns the number of tokens the instance should own, taking its weight into account.
+func (cfg *LifecyclerConfig) tokensCount() int {
+	return cfg.NumTokens * int(cfg.weight())
+}
+
 /*
 Lifecycler is a Service that is responsible for publishing changes to a ring for a single instance.
 
@@ -170,6 +191,15 @@ type Lifecycler struct {
 	instancesInZoneCount        int
 	zonesCount                  int
 
+	// Keeps track of the drain of the instance, see StartDrain.
+	drainMtx    sync.Mutex
+	drainStatus DrainStatus
+	drainCancel context.CancelFunc
+	drainDone   chan struct{}
+	drainMarked bool // Whether the drain changed the instance state or read-only mode.
+	// drainCanceling is true while CancelDrain reverts the changes of the drain, which is still in progress until then.
+	drainCanceling bool
+
 	tokenGenerator TokenGenerator
 	// The maximum time allowed to wait on the CanJoin() condition.
 	// Configurable for testing purposes only.
@@ -235,6 +265,8 @@ func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer, ringNa
 		logger:                logger,
 	}
 
+	l.lifecyclerMetrics.weight.Set(float64(cfg.weight()))
+
 	l.BasicService = services.
 		NewBasicService(nil, l.loop, l.stopping).
 		WithName(fmt.Sprintf("%s ring lifecycler", ringName))
@@ -613,17 +645,22 @@ func (i *Lifecycler) stopping(runningError error) error {
 	heartbeatTickerStop, heartbeatTickerChan := newDisableableTicker(i.cfg.HeartbeatPeriod)
 	defer heartbeatTickerStop()
 
+	// An in-progress drain is superseded by the shutdown.
+	drained := i.stopDrain()
+
 	// Mark ourselved as Leaving so no more samples are send to us.
-	err := i.changeState(context.Background(), LEAVING)
-	if err != nil {
-		level.Error(i.logger).Log("msg", "failed to set state to LEAVING", "ring", i.RingName, "err", err)
+	if i.GetState() != LEAVING {
+		err := i.changeState(context.Background(), LEAVING)
+		if err != nil {
+			level.Error(i.logger).Log("msg", "failed to set state to LEAVING", "ring", i.RingName, "err", err)
+		}
 	}
 
 	// Do the transferring / flushing on a background goroutine so we can continue
 	// to heartbeat to consul.
 	done := make(chan struct{})
 	go func() {
-		i.processShutdown(context.Background())
+		i.processShutdown(context.Background(), drained)
 		close(done)
 	}()
 
@@ -691,11 +728,11 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 			// We use the tokens from the file only if it does not exist in the ring yet.
 			if len(tokensFromFile) > 0 {
 				level.Info(i.logger).Log("msg", "adding tokens from file", "num_tokens", len(tokensFromFile))
-				if len(tokensFromFile) >= i.cfg.NumTokens {
+				if len(tokensFromFile) >= i.cfg.tokensCount() {
 					i.setState(ACTIVE)
 				}
 				ro, rots := i.GetReadOnlyState()
-				ringDesc.AddIngester(i.ID, i.Addr, i.Zone, tokensFromFile, i.GetState(), i.getRegisteredAt(), ro, rots)
+				ringDesc.AddIngester(i.ID, i.Addr, i.Zone, tokensFromFile, i.GetState(), i.getRegisteredAt(), ro, rots, i.cfg.weight())
 				i.setTokens(tokensFromFile)
 				return ringDesc, true, nil
 			}
@@ -703,7 +740,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 			// Either we are a new ingester, or consul must have restarted
 			level.Info(i.logger).Log("msg", "instance not found in ring, adding with no tokens", "ring", i.RingName)
 			ro, rots := i.GetReadOnlyState()
-			ringDesc.AddIngester(i.ID, i.Addr, i.Zone, []uint32{}, i.GetState(), i.getRegisteredAt(), ro, rots)
+			ringDesc.AddIngester(i.ID, i.Addr, i.Zone, []uint32{}, i.GetState(), i.getRegisteredAt(), ro, rots, i.cfg.weight())
 			return ringDesc, true, nil
 		}
 
@@ -732,21 +769,21 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 		// If the ingester fails to clean its ring entry up or unregister_on_shutdown=false, it can leave behind its
 		// ring state as LEAVING. Make sure to switch to the ACTIVE state.
 		if instanceDesc.State == LEAVING {
-			delta := i.cfg.NumTokens - len(tokens)
+			delta := i.cfg.tokensCount() - len(tokens)
 			if delta > 0 {
 				// We need more tokens
 				level.Info(i.logger).Log("msg", "existing instance has too few tokens, adding difference",
-					"current_tokens", len(tokens), "desired_tokens", i.cfg.NumTokens)
-				newTokens := i.tokenGenerator.GenerateTokens(delta, ringDesc.GetTokens())
+					"current_tokens", len(tokens), "desired_tokens", i.cfg.tokensCount())
+				newTokens := generateTokens(i.tokenGenerator, delta, i.cfg.weight(), ringDesc, ringDesc.GetTokens())
 				tokens = append(tokens, newTokens...)
 				sort.Sort(tokens)
 			} else if delta < 0 {
 				// We have too many tokens
 				level.Info(i.logger).Log("msg", "existing instance has too many tokens, removing difference",
-					"current_tokens", len(tokens), "desired_tokens", i.cfg.NumTokens)
+					"current_tokens", len(tokens), "desired_tokens", i.cfg.tokensCount())
 				// Make sure we don't pick the N smallest tokens, since that would increase the chance of the instance receiving only smaller hashes.
 				rand.Shuffle(len(tokens), tokens.Swap)
-				tokens = tokens[0:i.cfg.NumTokens]
+				tokens = tokens[0:i.cfg.tokensCount()]
 				sort.Sort(tokens)
 			}
 
@@ -762,6 +799,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 		instanceDesc.Id = i.ID
 		instanceDesc.Addr = i.Addr
 		instanceDesc.Zone = i.Zone
+		instanceDesc.Weight = i.cfg.weight()
 
 		// Update the ring if the instance has been changed. We don't want to rely on heartbeat update, as heartbeat
 		// can be configured to long time, and until then lifecycler would not report this instance as ready in CheckReady.
@@ -798,16 +836,16 @@ func (i *Lifecycler) verifyTokens(ctx context.Context) bool {
 
 		if !i.compareTokens(ringTokens) {
 			// uh, oh... our tokens are not ours anymore. Let's try new ones.
-			needTokens := i.cfg.NumTokens - len(ringTokens)
+			needTokens := i.cfg.tokensCount() - len(ringTokens)
 
 			level.Info(i.logger).Log("msg", "generating new tokens", "count", needTokens, "ring", i.RingName)
-			newTokens := i.tokenGenerator.GenerateTokens(needTokens, takenTokens)
+			newTokens := generateTokens(i.tokenGenerator, needTokens, i.cfg.weight(), ringDesc, takenTokens)
 
 			ringTokens = append(ringTokens, newTokens...)
 			sort.Sort(ringTokens)
 
 			ro, rots := i.GetReadOnlyState()
-			ringDesc.AddIngester(i.ID, i.Addr, i.Zone, ringTokens, i.GetState(), i.getRegisteredAt(), ro, rots)
+			ringDesc.AddIngester(i.ID, i.Addr, i.Zone, ringTokens, i.GetState(), i.getRegisteredAt(), ro, rots, i.cfg.weight())
 
 			i.setTokens(ringTokens)
 
@@ -908,7 +946,7 @@ func (i *Lifecycler) autoJoin(ctx context.Context, targetState InstanceState) er
 			level.Error(i.logger).Log("msg", "tokens already exist for this instance - wasn't expecting any!", "num_tokens", len(myTokens), "ring", i.RingName)
 		}
 
-		newTokens := i.tokenGenerator.GenerateTokens(i.cfg.NumTokens-len(myTokens), takenTokens)
+		newTokens := generateTokens(i.tokenGenerator, i.cfg.tokensCount()-len(myTokens), i.cfg.weight(), ringDesc, takenTokens)
 		i.setState(targetState)
 
 		myTokens = append(myTokens, newTokens...)
@@ -916,7 +954,7 @@ func (i *Lifecycler) autoJoin(ctx context.Context, targetState InstanceState) er
 		i.setTokens(myTokens)
 
 		ro, rots := i.GetReadOnlyState()
-		ringDesc.AddIngester(i.ID, i.Addr, i.Zone, i.getTokens(), i.GetState(), i.getRegisteredAt(), ro, rots)
+		ringDesc.AddIngester(i.ID, i.Addr, i.Zone, i.getTokens(), i.GetState(), i.getRegisteredAt(), ro, rots, i.cfg.weight())
 		return ringDesc, true, nil
 	})
 
@@ -951,7 +989,7 @@ func (i *Lifecycler) updateConsul(ctx context.Context) error {
 		}
 
 		ro, rots := i.GetReadOnlyState()
-		ringDesc.AddIngester(i.ID, i.Addr, i.Zone, tokens, i.GetState(), i.getRegisteredAt(), ro, rots)
+		ringDesc.AddIngester(i.ID, i.Addr, i.Zone, tokens, i.GetState(), i.getRegisteredAt(), ro, rots, i.cfg.weight())
 		return ringDesc, true, nil
 	})
 
@@ -973,7 +1011,8 @@ func (i *Lifecycler) changeState(ctx context.Context, state InstanceState) error
 		(currState == JOINING && state == PENDING) || // triggered by TransferChunks on failure
 		(currState == JOINING && state == ACTIVE) || // triggered by TransferChunks on success
 		(currState == PENDING && state == ACTIVE) || // triggered by autoJoin
-		(currState == ACTIVE && state == LEAVING)) { // triggered by shutdown
+		(currState == ACTIVE && state == LEAVING) || // triggered by shutdown or drain
+		(currState == LEAVING && state == ACTIVE)) { // triggered by drain cancellation
 		return fmt.Errorf("changing instance state from %v -> %v is disallowed", currState, state)
 	}
 
@@ -1051,7 +1090,19 @@ func (i *Lifecycler) SetClearTokensOnShutdown(enabled bool) {
 	i.clearTokensOnShutdown.Store(enabled)
 }
 
-func (i *Lifecycler) processShutdown(ctx context.Context) {
+func (i *Lifecycler) processShutdown(ctx context.Context, drained bool) {
+	if drained {
+		level.Info(i.logger).Log("msg", "instance has been drained in LEAVING state, skipping transfer and flush", "ring", i.RingName)
+	} else {
+		i.transferOrFlush(ctx)
+	}
+
+	// Sleep so the shutdownDuration metric can be collected.
+	level.Info(i.logger).Log("msg", "lifecycler entering final sleep before shutdown", "final_sleep", i.cfg.FinalSleep)
+	time.Sleep(i.cfg.FinalSleep)
+}
+
+func (i *Lifecycler) transferOrFlush(ctx context.Context) {
 	flushRequired := i.FlushOnShutdown()
 	transferStart := time.Now()
 	if err := i.flushTransferer.TransferOut(ctx); err != nil {
@@ -1071,10 +1122,6 @@ func (i *Lifecycler) processShutdown(ctx context.Context) {
 		i.flushTransferer.Flush()
 		i.lifecyclerMetrics.shutdownDuration.WithLabelValues("flush", "success").Observe(time.Since(flushStart).Seconds())
 	}
-
-	// Sleep so the shutdownDuration metric can be collected.
-	level.Info(i.logger).Log("msg", "lifecycler entering final sleep before shutdown", "final_sleep", i.cfg.FinalSleep)
-	time.Sleep(i.cfg.FinalSleep)
 }
 
 func (i *Lifecycler) casRing(ctx context.Context, f func(in interface{}) (out interface{}, retry bool, err error)) error {
@@ -0,0 +1,361 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrDrainInProgress is returned by Lifecycler.StartDrain when the instance is already draining or drained.
+	ErrDrainInProgress = errors.New("drain already in progress")
+
+	// ErrNotDraining is returned by Lifecycler.CancelDrain when the instance is not draining.
+	ErrNotDraining = errors.New("instance is not draining")
+)
+
+// DrainMode is how clients are stopped from routing writes to a draining instance.
+type DrainMode string
+
+const (
+	// DrainModeLeaving switches the instance to the LEAVING state.
+	DrainModeLeaving DrainMode = "leaving"
+
+	// DrainModeReadOnly switches the instance to read-only, keeping it ACTIVE. Only clients selecting instances
+	// with shuffle sharding exclude read-only instances: Ring.Get() keeps returning them for writes, so this mode
+	// only stops writes routed through a shuffle shard.
+	DrainModeReadOnly DrainMode = "read_only"
+)
+
+// defaultDrainPropagationDelay is the minimum default DrainOptions.PropagationDelay.
+const defaultDrainPropagationDelay = 15 * time.Second
+
+// DrainPhase is the phase of the drain of an instance.
+type DrainPhase string
+
+const (
+	DrainIdle              DrainPhase = "idle"
+	DrainMarking           DrainPhase = "marking"
+	DrainWaitingForClients DrainPhase = "waiting_for_clients"
+	DrainFlushing          DrainPhase = "flushing"
+	DrainDrained           DrainPhase = "drained"
+	DrainFailed            DrainPhase = "failed"
+	DrainCanceled          DrainPhase = "canceled"
+)
+
+// DrainOptions configures the drain of an instance.
+type DrainOptions struct {
+	// Mode is how clients are stopped from routing writes to the instance. Defaults to DrainModeLeaving.
+	Mode DrainMode
+
+	// PropagationDelay is how long to wait after the change of the instance is stored in the ring in the KV store,
+	// before flushing. It should cover the time it takes for the clients to observe the ring change.
+	// Defaults to the lifecycler heartbeat period, and at least 15s. A negative value disables the delay.
+	PropagationDelay time.Duration
+
+	// PollInterval is how often the ring is checked while waiting for clients. Defaults to 1s.
+	PollInterval time.Duration
+}
+
+// DrainStatus reports the progress of the drain of an instance.
+type DrainStatus struct {
+	Phase     DrainPhase `json:"phase"`
+	Mode      DrainMode  `json:"mode,omitempty"`
+	StartedAt time.Time  `json:"started_at,omitempty"`
+
+	// Flushed and Total are the progress of the flush, as reported by the FlushProgressTransferer.
+	Flushed int `json:"flushed"`
+	Total   int `json:"total"`
+
+	// Error is the reason why the drain failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// StartDrain starts draining the instance in the background, without stopping the lifecycler:
+//
+//   - The instance is switched to LEAVING or read-only, depending on the mode, so that clients stop routing
+//     writes to it.
+//   - The drain waits until the change is stored in the ring in the KV store, plus the propagation delay for the
+//     clients to observe it. Whether the clients actually stopped routing writes to the instance is not checked.
+//   - The instance is flushed. If the FlushTransferer is a FlushProgressTransferer, the flush progress is
+//     reported in the DrainStatus and the flush is interrupted when the drain is canceled.
+//
+// Once drained, the instance keeps running. If drained with DrainModeLeaving, it doesn't flush again on shutdown.
+// With DrainModeReadOnly, it's flushed again on shutdown, because Ring.Get() keeps routing writes to it. Use
+// DrainStatus to follow the progress of the drain, and CancelDrain to cancel it. A failed drain must be canceled
+// before starting a new one.
+func (i *Lifecycler) StartDrain(opts DrainOptions) error {
+	if opts.Mode == "" {
+		opts.Mode = DrainModeLeaving
+	}
+	if opts.Mode != DrainModeLeaving && opts.Mode != DrainModeReadOnly {
+		return fmt.Errorf("unsupported drain mode %q", opts.Mode)
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.PropagationDelay == 0 {
+		// The ring in the KV store is updated by the drain itself, so the clients need time to observe it.
+		opts.PropagationDelay = max(i.cfg.HeartbeatPeriod, defaultDrainPropagationDelay)
+	}
+	if i.ServiceContext() == nil {
+		return errors.New("lifecycler not running")
+	}
+
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+
+	if i.drainCancel != nil {
+		return ErrDrainInProgress
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.drainCancel = cancel
+	i.drainDone = make(chan struct{})
+	i.drainMarked = false
+	i.drainStatus = DrainStatus{Phase: DrainMarking, Mode: opts.Mode, StartedAt: time.Now()}
+
+	level.Info(i.logger).Log("msg", "starting to drain the instance", "mode", opts.Mode, "ring", i.RingName)
+	go i.drain(ctx, opts, i.drainDone)
+	return nil
+}
+
+// CancelDrain cancels the drain of the instance, and reverts the change to the instance state or read-only
+// mode made by the drain. It waits until the drain has stopped, which may take until the end of the flush
+// if the FlushTransferer can't be interrupted. A new drain can't be started until the changes are reverted.
+func (i *Lifecycler) CancelDrain(ctx context.Context) error {
+	i.drainMtx.Lock()
+	cancel, done := i.drainCancel, i.drainDone
+	if cancel == nil || i.drainCanceling {
+		i.drainMtx.Unlock()
+		return ErrNotDraining
+	}
+	i.drainCanceling = true
+	i.drainMtx.Unlock()
+
+	cancel()
+	<-done
+
+	i.drainMtx.Lock()
+	marked, mode := i.drainMarked, i.drainStatus.Mode
+	i.drainMtx.Unlock()
+
+	var err error
+	if marked {
+		err = i.revertDrainMark(ctx, mode)
+	}
+
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+
+	i.drainCancel = nil
+	i.drainCanceling = false
+	i.drainMarked = false
+	i.drainStatus.Phase = DrainCanceled
+	if err != nil {
+		i.drainStatus.Error = err.Error()
+	}
+
+	level.Info(i.logger).Log("msg", "drain of the instance canceled", "ring", i.RingName, "err", err)
+	return err
+}
+
+// DrainStatus returns the status of the drain of the instance.
+func (i *Lifecycler) DrainStatus() DrainStatus {
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+
+	if i.drainStatus.Phase == "" {
+		return DrainStatus{Phase: DrainIdle}
+	}
+	return i.drainStatus
+}
+
+// stopDrain interrupts an in-progress drain when the lifecycler is stopping, without reverting its changes.
+// It returns whether the instance has been fully drained with DrainModeLeaving: a read-only instance may have
+// received writes since the flush of the drain.
+func (i *Lifecycler) stopDrain() bool {
+	i.drainMtx.Lock()
+	cancel, done := i.drainCancel, i.drainDone
+	i.drainMtx.Unlock()
+
+	if cancel == nil {
+		return false
+	}
+
+	cancel()
+	<-done
+
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+	return i.drainStatus.Phase == DrainDrained && i.drainStatus.Mode == DrainModeLeaving
+}
+
+func (i *Lifecycler) drain(ctx context.Context, opts DrainOptions, done chan struct{}) {
+	defer close(done)
+
+	err := i.runDrain(ctx, opts)
+
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+
+	switch {
+	case ctx.Err() != nil:
+		// The drain has been canceled: the phase is updated by the canceller.
+	case err != nil:
+		i.drainStatus.Phase = DrainFailed
+		i.drainStatus.Error = err.Error()
+		level.Error(i.logger).Log("msg", "failed to drain the instance", "ring", i.RingName, "err", err)
+	default:
+		i.drainStatus.Phase = DrainDrained
+		level.Info(i.logger).Log("msg", "instance drained", "ring", i.RingName, "duration", time.Since(i.drainStatus.StartedAt))
+	}
+}
+
+func (i *Lifecycler) runDrain(ctx context.Context, opts DrainOptions) error {
+	// Stop clients from routing writes to this instance.
+	switch opts.Mode {
+	case DrainModeLeaving:
+		if i.GetState() != LEAVING {
+			if err := i.ChangeState(ctx, LEAVING); err != nil {
+				return errors.Wrap(err, "failed to set state to LEAVING")
+			}
+			i.setDrainMarked()
+		}
+	case DrainModeReadOnly:
+		if readOnly, _ := i.GetReadOnlyState(); !readOnly {
+			if err := i.ChangeReadOnlyState(ctx, true); err != nil {
+				return errors.Wrap(err, "failed to switch to read-only")
+			}
+			i.setDrainMarked()
+		}
+	}
+
+	i.setDrainPhase(DrainWaitingForClients)
+	if err := i.waitUntilMarkedInRing(ctx, opts.PollInterval); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(max(opts.PropagationDelay, 0)):
+	}
+
+	i.setDrainPhase(DrainFlushing)
+	if flusher, ok := i.flushTransferer.(FlushProgressTransferer); ok {
+		return flusher.FlushWithProgress(ctx, func(flushed, total int) {
+			i.drainMtx.Lock()
+			defer i.drainMtx.Unlock()
+			i.drainStatus.Flushed = flushed
+			i.drainStatus.Total = total
+		})
+	}
+
+	// The flush can't be interrupted nor report its progress.
+	i.flushTransferer.Flush()
+	return nil
+}
+
+// waitUntilMarkedInRing waits until the ring stored in the KV store has this instance LEAVING or read-only.
+// It's usually satisfied right away by the change made by the drain. It doesn't check whether the clients
+// observed the change: that's covered by the propagation delay.
+func (i *Lifecycler) waitUntilMarkedInRing(ctx context.Context, pollInterval time.Duration) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		ringDesc, err := i.getRing(ctx)
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "failed to read the ring while draining", "ring", i.RingName, "err", err)
+		} else if instance, ok := ringDesc.Ingesters[i.ID]; !ok || instance.State != ACTIVE || instance.ReadOnly {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// revertDrainMark reverts the change made to the instance to stop clients from routing writes to it.
+func (i *Lifecycler) revertDrainMark(ctx context.Context, mode DrainMode) error {
+	errCh := make(chan error)
+	fn := func() {
+		switch mode {
+		case DrainModeLeaving:
+			if i.GetState() != LEAVING {
+				errCh <- nil
+				return
+			}
+			errCh <- i.changeState(ctx, ACTIVE)
+			return
+		case DrainModeReadOnly:
+			level.Info(i.logger).Log("msg", "changing read-only state of instance in the ring", "readOnly", false, "ring", i.RingName)
+			i.setReadOnlyState(false, time.Now())
+		}
+		errCh <- i.updateConsul(ctx)
+	}
+
+	if err := i.sendToLifecyclerLoop(fn); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+func (i *Lifecycler) setDrainPhase(phase DrainPhase) {
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+	i.drainStatus.Phase = phase
+}
+
+func (i *Lifecycler) setDrainMarked() {
+	i.drainMtx.Lock()
+	defer i.drainMtx.Unlock()
+	i.drainMarked = true
+}
+
+// DrainHandler returns an HTTP handler to drain the instance. GET returns the DrainStatus as JSON, POST starts
+// the drain (with optional "mode" and "propagation_delay" parameters), and DELETE cancels it.
+func (i *Lifecycler) DrainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			opts := DrainOptions{Mode: DrainMode(req.FormValue("mode"))}
+			if delay := req.FormValue("propagation_delay"); delay != "" {
+				var err error
+				if opts.PropagationDelay, err = time.ParseDuration(delay); err != nil {
+					http.Error(w, fmt.Sprintf("invalid propagation delay: %s", err.Error()), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if err := i.StartDrain(opts); errors.Is(err, ErrDrainInProgress) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if err := i.CancelDrain(req.Context()); errors.Is(err, ErrNotDraining) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSONResponse(w, i.DrainStatus())
+	})
+}
@@ -0,0 +1,291 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+)
+
+// progressFlushTransferer flushes 10 items, one every time an item is released.
+type progressFlushTransferer struct {
+	release  chan struct{}
+	canceled atomic.Bool
+	flushes  atomic.Int32
+}
+
+func newProgressFlushTransferer() *progressFlushTransferer {
+	return &progressFlushTransferer{release: make(chan struct{})}
+}
+
+func (f *progressFlushTransferer) Flush() {
+	f.flushes.Inc()
+}
+
+func (f *progressFlushTransferer) TransferOut(_ context.Context) error {
+	return ErrTransferDisabled
+}
+
+func (f *progressFlushTransferer) FlushWithProgress(ctx context.Context, progress FlushProgressFunc) error {
+	f.flushes.Inc()
+
+	const total = 10
+	for flushed := 0; flushed < total; flushed++ {
+		progress(flushed, total)
+
+		select {
+		case <-ctx.Done():
+			f.canceled.Store(true)
+			return ctx.Err()
+		case <-f.release:
+		}
+	}
+	progress(total, total)
+	return nil
+}
+
+func startLifecyclerForDrain(t *testing.T, flushTransferer FlushTransferer) (*Lifecycler, kv.Client) {
+	ctx := context.Background()
+
+	ringStore, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.KVStore.Mock = ringStore
+
+	cfg := testLifecyclerConfig(ringConfig, "ing1")
+	lifecycler, err := NewLifecycler(cfg, flushTransferer, "ingester", ringKey, true, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+
+	test.Poll(t, time.Second, ACTIVE, func() interface{} {
+		return lifecycler.GetState()
+	})
+	return lifecycler, ringStore
+}
+
+func getLifecyclerInstance(t *testing.T, store kv.Client, id string) InstanceDesc {
+	in, err := store.Get(context.Background(), ringKey)
+	require.NoError(t, err)
+	return GetOrCreateRingDesc(in).Ingesters[id]
+}
+
+func TestLifecycler_Drain(t *testing.T) {
+	ctx := context.Background()
+	flusher := newProgressFlushTransferer()
+	lifecycler, store := startLifecyclerForDrain(t, flusher)
+
+	assert.Equal(t, DrainIdle, lifecycler.DrainStatus().Phase)
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{PollInterval: 10 * time.Millisecond, PropagationDelay: -1}))
+	require.ErrorIs(t, lifecycler.StartDrain(DrainOptions{}), ErrDrainInProgress)
+
+	// The instance leaves before flushing.
+	test.Poll(t, time.Second, DrainFlushing, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+	assert.Equal(t, LEAVING, getLifecyclerInstance(t, store, "ing1").State)
+
+	flusher.release <- struct{}{}
+	flusher.release <- struct{}{}
+	test.Poll(t, time.Second, 2, func() interface{} {
+		return lifecycler.DrainStatus().Flushed
+	})
+	assert.Equal(t, 10, lifecycler.DrainStatus().Total)
+
+	for n := 2; n < 10; n++ {
+		flusher.release <- struct{}{}
+	}
+	test.Poll(t, time.Second, DrainDrained, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+	assert.Equal(t, 10, lifecycler.DrainStatus().Flushed)
+
+	// The instance keeps running, and isn't flushed again on shutdown.
+	assert.Equal(t, services.Running, lifecycler.State())
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+	assert.Equal(t, int32(1), flusher.flushes.Load())
+}
+
+func TestLifecycler_CancelDrain(t *testing.T) {
+	ctx := context.Background()
+	flusher := newProgressFlushTransferer()
+	lifecycler, store := startLifecyclerForDrain(t, flusher)
+	t.Cleanup(func() {
+		assert.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+	})
+
+	require.ErrorIs(t, lifecycler.CancelDrain(ctx), ErrNotDraining)
+
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{PollInterval: 10 * time.Millisecond, PropagationDelay: -1}))
+	test.Poll(t, time.Second, DrainFlushing, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+
+	// The flush is interrupted and the instance is back to ACTIVE.
+	require.NoError(t, lifecycler.CancelDrain(ctx))
+	assert.True(t, flusher.canceled.Load())
+	assert.Equal(t, DrainCanceled, lifecycler.DrainStatus().Phase)
+	assert.Equal(t, ACTIVE, lifecycler.GetState())
+	assert.Equal(t, ACTIVE, getLifecyclerInstance(t, store, "ing1").State)
+	require.ErrorIs(t, lifecycler.CancelDrain(ctx), ErrNotDraining)
+
+	// The drain can be started again.
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{PollInterval: 10 * time.Millisecond, PropagationDelay: -1}))
+	test.Poll(t, time.Second, DrainFlushing, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+}
+
+// blockingFlushTransferer is a FlushTransferer whose flush can't be interrupted, and blocks until released.
+type blockingFlushTransferer struct {
+	flushing chan struct{}
+	release  chan struct{}
+}
+
+func (f *blockingFlushTransferer) Flush() {
+	select {
+	case f.flushing <- struct{}{}:
+	default:
+	}
+	<-f.release
+}
+
+func (f *blockingFlushTransferer) TransferOut(_ context.Context) error {
+	return ErrTransferDisabled
+}
+
+func TestLifecycler_CancelDrainPreventsNewDrainUntilReverted(t *testing.T) {
+	ctx := context.Background()
+	flusher := &blockingFlushTransferer{flushing: make(chan struct{}), release: make(chan struct{})}
+	lifecycler, _ := startLifecyclerForDrain(t, flusher)
+
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{PollInterval: 10 * time.Millisecond, PropagationDelay: -1}))
+	<-flusher.flushing
+
+	// The cancellation waits for the flush, and a new drain can't start before the instance is reverted.
+	canceled := make(chan error)
+	go func() { canceled <- lifecycler.CancelDrain(ctx) }()
+	test.Poll(t, time.Second, true, func() interface{} {
+		lifecycler.drainMtx.Lock()
+		defer lifecycler.drainMtx.Unlock()
+		return lifecycler.drainCanceling
+	})
+	require.ErrorIs(t, lifecycler.StartDrain(DrainOptions{}), ErrDrainInProgress)
+	require.ErrorIs(t, lifecycler.CancelDrain(ctx), ErrNotDraining)
+
+	close(flusher.release)
+	require.NoError(t, <-canceled)
+	assert.Equal(t, ACTIVE, lifecycler.GetState())
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+}
+
+func TestLifecycler_DrainReadOnlyFlushesOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	flusher := newProgressFlushTransferer()
+	lifecycler, store := startLifecyclerForDrain(t, flusher)
+
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{Mode: DrainModeReadOnly, PollInterval: 10 * time.Millisecond, PropagationDelay: -1}))
+	test.Poll(t, time.Second, DrainFlushing, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+	assert.True(t, getLifecyclerInstance(t, store, "ing1").ReadOnly)
+	for n := 0; n < 10; n++ {
+		flusher.release <- struct{}{}
+	}
+	test.Poll(t, time.Second, DrainDrained, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+
+	// Writes may still be routed to a read-only instance, so it's flushed again on shutdown.
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+	assert.Equal(t, int32(2), flusher.flushes.Load())
+}
+
+func TestLifecycler_DrainDefaultPropagationDelay(t *testing.T) {
+	ctx := context.Background()
+	flusher := newProgressFlushTransferer()
+	lifecycler, _ := startLifecyclerForDrain(t, flusher)
+	t.Cleanup(func() {
+		assert.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+	})
+
+	// The drain doesn't flush right after the ring in the KV store has been updated.
+	require.NoError(t, lifecycler.StartDrain(DrainOptions{PollInterval: 10 * time.Millisecond}))
+	test.Poll(t, time.Second, DrainWaitingForClients, func() interface{} {
+		return lifecycler.DrainStatus().Phase
+	})
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, DrainWaitingForClients, lifecycler.DrainStatus().Phase)
+	assert.Equal(t, int32(0), flusher.flushes.Load())
+
+	require.NoError(t, lifecycler.CancelDrain(ctx))
+}
+
+func TestLifecycler_DrainHandler(t *testing.T) {
+	ctx := context.Background()
+	lifecycler, store := startLifecyclerForDrain(t, &nopFlushTransferer{})
+	t.Cleanup(func() {
+		assert.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+	})
+	handler := lifecycler.DrainHandler()
+
+	doRequest := func(method string, form url.Values) (*httptest.ResponseRecorder, DrainStatus) {
+		req := httptest.NewRequest(method, "/drain", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		var status DrainStatus
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		}
+		return recorder, status
+	}
+
+	recorder, _ := doRequest(http.MethodPost, url.Values{"mode": {"unknown"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder, _ = doRequest(http.MethodPost, url.Values{"propagation_delay": {"xxx"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder, status := doRequest(http.MethodPost, url.Values{"mode": {"read_only"}, "propagation_delay": {"10ms"}})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, DrainModeReadOnly, status.Mode)
+
+	recorder, _ = doRequest(http.MethodPost, url.Values{"mode": {"read_only"}})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	test.Poll(t, 5*time.Second, DrainDrained, func() interface{} {
+		_, status := doRequest(http.MethodGet, nil)
+		return status.Phase
+	})
+
+	// In read-only mode the instance stays ACTIVE.
+	instance := getLifecyclerInstance(t, store, "ing1")
+	assert.Equal(t, ACTIVE, instance.State)
+	assert.True(t, instance.ReadOnly)
+
+	recorder, status = doRequest(http.MethodDelete, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, DrainCanceled, status.Phase)
+	assert.False(t, getLifecyclerInstance(t, store, "ing1").ReadOnly)
+
+	recorder, _ = doRequest(http.MethodDelete, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
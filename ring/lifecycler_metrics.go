@@ -9,6 +9,7 @@ type LifecyclerMetrics struct {
 	consulHeartbeats prometheus.Counter
 	shutdownDuration *prometheus.HistogramVec
 	readonly         prometheus.Gauge
+	weight           prometheus.Gauge
 }
 
 func NewLifecyclerMetrics(ringName string, reg prometheus.Registerer) *LifecyclerMetrics {
@@ -29,6 +30,11 @@ func NewLifecyclerMetrics(ringName string, reg prometheus.Registerer) *Lifecycle
 			Help:        "Set to 1 if this lifecycler's instance entry is in read-only state.",
 			ConstLabels: prometheus.Labels{"name": ringName},
 		}),
+		weight: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "lifecycler_weight",
+			Help:        "Weight of this lifecycler's instance in the ring.",
+			ConstLabels: prometheus.Labels{"name": ringName},
+		}),
 	}
 
 }
@@ -79,6 +79,51 @@ func TestLifecyclerConfig_Validate(t *testing.T) {
 	cfg.RingTokenGenerator = spreadMinimizingTokenGenerator
 	err = cfg.Validate()
 	require.Error(t, err)
+
+	// Instances can't have a weight greater than 1 with the spread minimizing token generator.
+	cfg.TokensFilePath = ""
+	cfg.Weight = 2
+	require.Error(t, cfg.Validate())
+
+	cfg.RingTokenGenerator = nil
+	require.NoError(t, cfg.Validate())
+
+	cfg.Weight = -1
+	require.Error(t, cfg.Validate())
+}
+
+func TestLifecycler_Weight(t *testing.T) {
+	ringStore, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.KVStore.Mock = ringStore
+
+	ctx := context.Background()
+
+	cfg := testLifecyclerConfig(ringConfig, "ing1")
+	cfg.NumTokens = 4
+	cfg.Weight = 3
+
+	reg := prometheus.NewPedanticRegistry()
+	lifecycler, err := NewLifecycler(cfg, &nopFlushTransferer{}, "ingester", ringKey, true, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+	defer services.StopAndAwaitTerminated(ctx, lifecycler) // nolint:errcheck
+
+	// The instance registers its weight, and a number of tokens proportional to it.
+	test.Poll(t, time.Second, true, func() interface{} {
+		d, err := ringStore.Get(ctx, ringKey)
+		require.NoError(t, err)
+		desc, ok := d.(*Desc)
+		if !ok {
+			return false
+		}
+		instance := desc.Ingesters["ing1"]
+		return instance.State == ACTIVE && instance.Weight == 3 && len(instance.Tokens) == 12
+	})
+	assert.Equal(t, 3.0, testutil.ToFloat64(lifecycler.lifecyclerMetrics.weight))
 }
 
 func TestLifecycler_TokenGenerator(t *testing.T) {
@@ -656,7 +701,7 @@ func TestLifecycler_IncreasingTokensLeavingInstanceInTheRing(t *testing.T) {
 			return nil, false, err
 		}
 
-		ringDesc.AddIngester("ing1", addr, lifecyclerConfig.Zone, origTokens, LEAVING, time.Now(), false, time.Time{})
+		ringDesc.AddIngester("ing1", addr, lifecyclerConfig.Zone, origTokens, LEAVING, time.Now(), false, time.Time{}, 0)
 		return ringDesc, false, nil
 	})
 	require.NoError(t, err)
@@ -834,7 +879,7 @@ func TestLifecycler_DecreasingTokensLeavingInstanceInTheRing(t *testing.T) {
 			return nil, false, err
 		}
 
-		ringDesc.AddIngester("ing1", addr, lifecyclerConfig.Zone, origTokens, LEAVING, time.Now(), false, time.Time{})
+		ringDesc.AddIngester("ing1", addr, lifecyclerConfig.Zone, origTokens, LEAVING, time.Now(), false, time.Time{}, 0)
 		return ringDesc, false, nil
 	})
 	require.NoError(t, err)
@@ -1232,7 +1277,7 @@ func TestRestartIngester_NoUnregister_LongHeartbeat(t *testing.T) {
 	err := ringStore.CAS(context.Background(), ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
 		// Create ring with LEAVING entry with some tokens
 		r := GetOrCreateRingDesc(in)
-		r.AddIngester(id, "3.3.3.3:333", "old", origTokens, LEAVING, registeredAt, false, time.Time{})
+		r.AddIngester(id, "3.3.3.3:333", "old", origTokens, LEAVING, registeredAt, false, time.Time{}, 0)
 		return r, true, err
 	})
 	require.NoError(t, err)
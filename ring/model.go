@@ -53,8 +53,8 @@ func timeToUnixSecons(t time.Time) int64 {
 }
 
 // AddIngester adds the given ingester to the ring. Ingester will only use supplied tokens,
-// any other tokens are removed.
-func (d *Desc) AddIngester(id, addr, zone string, tokens []uint32, state InstanceState, registeredAt time.Time, readOnly bool, readOnlyUpdated time.Time) InstanceDesc {
+// any other tokens are removed. A weight of 0 is the default weight of 1.
+func (d *Desc) AddIngester(id, addr, zone string, tokens []uint32, state InstanceState, registeredAt time.Time, readOnly bool, readOnlyUpdated time.Time, weight uint32) InstanceDesc {
 	if d.Ingesters == nil {
 		d.Ingesters = map[string]InstanceDesc{}
 	}
@@ -69,6 +69,7 @@ func (d *Desc) AddIngester(id, addr, zone string, tokens []uint32, state Instanc
 		RegisteredTimestamp:      timeToUnixSecons(registeredAt),
 		ReadOnly:                 readOnly,
 		ReadOnlyUpdatedTimestamp: timeToUnixSecons(readOnlyUpdated),
+		Weight:                   weight,
 	}
 
 	d.Ingesters[id] = ingester
@@ -170,6 +171,14 @@ func (i *InstanceDesc) GetReadOnlyState() (bool, time.Time) {
 	return i.ReadOnly, ts
 }
 
+// GetEffectiveWeight returns the weight of the instance, which is 1 if the weight is unset.
+func (i *InstanceDesc) GetEffectiveWeight() uint32 {
+	if i == nil || i.Weight == 0 {
+		return 1
+	}
+	return i.Weight
+}
+
 func (i *InstanceDesc) IsHealthy(op Operation, heartbeatTimeout time.Duration, now time.Time) bool {
 	healthy := op.IsInstanceInStateHealthy(i.State)
 
@@ -683,6 +692,10 @@ func (d *Desc) RingCompare(o *Desc) CompareResult {
 			return Different
 		}
 
+		if ing.GetEffectiveWeight() != oing.GetEffectiveWeight() {
+			return Different
+		}
+
 		if len(ing.Tokens) != len(oing.Tokens) {
 			return Different
 		}
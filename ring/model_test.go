@@ -63,6 +63,24 @@ func TestInstanceDesc_IsHealthy_ForIngesterOperations(t *testing.T) {
 	}
 }
 
+func TestInstanceDesc_GetEffectiveWeight(t *testing.T) {
+	assert.Equal(t, uint32(1), (*InstanceDesc)(nil).GetEffectiveWeight())
+	assert.Equal(t, uint32(1), (&InstanceDesc{}).GetEffectiveWeight())
+	assert.Equal(t, uint32(3), (&InstanceDesc{Weight: 3}).GetEffectiveWeight())
+}
+
+func TestDesc_AddIngester_Weight(t *testing.T) {
+	desc := NewDesc()
+	desc.AddIngester("ing1", "addr1", "", []uint32{1}, ACTIVE, time.Now(), false, time.Time{}, 2)
+	assert.Equal(t, uint32(2), desc.Ingesters["ing1"].Weight)
+
+	// The weight isn't inherited from the instance already in the ring.
+	instance := desc.AddIngester("ing1", "addr2", "", []uint32{2}, LEAVING, time.Now(), false, time.Time{}, 0)
+	assert.Equal(t, uint32(0), instance.Weight)
+	assert.Equal(t, uint32(0), desc.Ingesters["ing1"].Weight)
+	assert.Equal(t, "addr2", desc.Ingesters["ing1"].Addr)
+}
+
 func TestInstanceDesc_GetRegisteredAt(t *testing.T) {
 	tests := map[string]struct {
 		desc     *InstanceDesc
@@ -330,6 +348,16 @@ func TestDesc_RingsCompare(t *testing.T) {
 			r2:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", ReadOnlyUpdatedTimestamp: time.Now().Unix()}}},
 			expected: Different,
 		},
+		"same single instance, different weight": {
+			r1:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", Weight: 2}}},
+			r2:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", Weight: 3}}},
+			expected: Different,
+		},
+		"same single instance, unset weight and weight 1": {
+			r1:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1"}}},
+			r2:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", Weight: 1}}},
+			expected: Equal,
+		},
 		"instance in different zone": {
 			r1:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", Zone: "one"}}},
 			r2:       &Desc{Ingesters: map[string]InstanceDesc{"ing1": {Addr: "addr1", Zone: "two"}}},
@@ -0,0 +1,434 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/services"
+)
+
+const (
+	partitionLifecycleActionCreate     = "create"
+	partitionLifecycleActionActivate   = "activate"
+	partitionLifecycleActionDeactivate = "deactivate"
+	partitionLifecycleActionDelete     = "delete"
+
+	// partitionLifecycleTargetDeleted is the target state of the partitions to remove from the ring.
+	partitionLifecycleTargetDeleted = "deleted"
+)
+
+type PartitionLifecycleControllerConfig struct {
+	// DesiredPartitions is the desired number of partitions: partitions 0 to DesiredPartitions-1 should be
+	// active, while the other ones should be removed from the ring. It can be changed at runtime with
+	// PartitionLifecycleController.SetDesiredPartitions.
+	DesiredPartitions int
+
+	// Zones are the zones which should own each partition. If empty, owners are counted regardless of their zone.
+	Zones []string
+
+	// OwnerZone returns the zone of a partition owner. It's required when Zones is set.
+	OwnerZone func(ownerID string) string
+
+	// MinOwnersPerZone is the minimum number of owners in each zone to switch a partition to ACTIVE. Defaults to 1,
+	// so that partitions are never switched to ACTIVE without owners.
+	MinOwnersPerZone int
+
+	// PendingGracePeriod is how long each owner should have been added to a PENDING or INACTIVE partition
+	// before it's considered eligible for the MinOwnersPerZone count.
+	PendingGracePeriod time.Duration
+
+	// InactiveGracePeriod is how long a partition should be INACTIVE before it's removed from the ring.
+	// Partitions are removed only once they have no owners left.
+	InactiveGracePeriod time.Duration
+
+	// ReconcileInterval is how often the partition ring is reconciled. Defaults to 10s.
+	ReconcileInterval time.Duration
+}
+
+func (cfg *PartitionLifecycleControllerConfig) Validate() error {
+	if cfg.DesiredPartitions < 0 {
+		return errors.New("the desired number of partitions can't be negative")
+	}
+	if cfg.MinOwnersPerZone < 0 {
+		return errors.New("the minimum number of owners per zone can't be negative")
+	}
+	if len(cfg.Zones) > 0 && cfg.OwnerZone == nil {
+		return errors.New("the owner zone function is required when zones are configured")
+	}
+	return nil
+}
+
+// PartitionLifecyclePlanEntry is the plan of the controller for a single partition.
+type PartitionLifecyclePlanEntry struct {
+	PartitionID int32 `json:"partition_id"`
+
+	// State is the state of the partition in the ring after the last reconciliation, or PartitionUnknown
+	// if it doesn't exist.
+	State string `json:"state"`
+
+	// TargetState is either PartitionActive or "deleted".
+	TargetState string `json:"target_state"`
+
+	// Action applied by the last reconciliation, if any.
+	Action string `json:"action,omitempty"`
+
+	// Waiting is why the partition can't progress towards its target state yet, if it can't.
+	Waiting string `json:"waiting,omitempty"`
+
+	// OwnersPerZone is the number of owners of the partition in each zone.
+	OwnersPerZone map[string]int `json:"owners_per_zone"`
+}
+
+// PartitionLifecycleControllerStatus is the plan and progress of a PartitionLifecycleController.
+type PartitionLifecycleControllerStatus struct {
+	DesiredPartitions int `json:"desired_partitions"`
+
+	// Converged is true if all the partitions have reached their target state.
+	Converged bool `json:"converged"`
+
+	LastReconcile time.Time                     `json:"last_reconcile"`
+	LastError     string                        `json:"last_error,omitempty"`
+	Partitions    []PartitionLifecyclePlanEntry `json:"partitions"`
+}
+
+// PartitionLifecycleController is a service scaling the number of partitions of a partition ring. It periodically
+// walks partitions towards the desired number of partitions:
+//
+//   - Missing partitions are created in PENDING state, and switched to ACTIVE once they have enough owners in each
+//     zone since at least the pending grace period.
+//   - Partitions in excess are switched to INACTIVE, and removed from the ring once they have been INACTIVE for
+//     the inactive grace period and their owners have been removed.
+//
+// Each reconciliation is applied with a single CAS.
+type PartitionLifecycleController struct {
+	services.Service
+
+	cfg      PartitionLifecycleControllerConfig
+	ringName string
+	ringKey  string
+	store    kv.Client
+	logger   log.Logger
+
+	mtx     sync.Mutex
+	desired int
+	status  PartitionLifecycleControllerStatus
+
+	// Metrics.
+	desiredPartitions      prometheus.Gauge
+	transitionsTotal       *prometheus.CounterVec
+	reconcilesFailedTotal  prometheus.Counter
+	partitionsNotConverged prometheus.Gauge
+}
+
+func NewPartitionLifecycleController(cfg PartitionLifecycleControllerConfig, ringName, ringKey string, store kv.Client, logger log.Logger, reg prometheus.Registerer) (*PartitionLifecycleController, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.MinOwnersPerZone == 0 {
+		cfg.MinOwnersPerZone = 1
+	}
+	if cfg.ReconcileInterval <= 0 {
+		cfg.ReconcileInterval = 10 * time.Second
+	}
+
+	c := &PartitionLifecycleController{
+		cfg:      cfg,
+		ringName: ringName,
+		ringKey:  ringKey,
+		store:    store,
+		logger:   log.With(logger, "ring", ringName),
+		desired:  cfg.DesiredPartitions,
+		desiredPartitions: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "partition_lifecycle_controller_desired_partitions",
+			Help:        "Desired number of partitions.",
+			ConstLabels: map[string]string{"name": ringName},
+		}),
+		transitionsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "partition_lifecycle_controller_transitions_total",
+			Help:        "Total number of partition transitions applied.",
+			ConstLabels: map[string]string{"name": ringName},
+		}, []string{"action"}),
+		reconcilesFailedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "partition_lifecycle_controller_reconciles_failed_total",
+			Help:        "Total number of reconciliations failed.",
+			ConstLabels: map[string]string{"name": ringName},
+		}),
+		partitionsNotConverged: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "partition_lifecycle_controller_partitions_not_converged",
+			Help:        "Number of partitions which haven't reached their target state yet.",
+			ConstLabels: map[string]string{"name": ringName},
+		}),
+	}
+	c.desiredPartitions.Set(float64(cfg.DesiredPartitions))
+
+	c.Service = services.NewTimerService(cfg.ReconcileInterval, nil, c.iteration, nil).WithName(fmt.Sprintf("%s partition lifecycle controller", ringName))
+	return c, nil
+}
+
+// SetDesiredPartitions changes the desired number of partitions. The change is applied at the next reconciliation.
+func (c *PartitionLifecycleController) SetDesiredPartitions(desired int) error {
+	if desired < 0 {
+		return errors.New("the desired number of partitions can't be negative")
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if desired != c.desired {
+		level.Info(c.logger).Log("msg", "changing the desired number of partitions", "from", c.desired, "to", desired)
+	}
+	c.desired = desired
+	c.desiredPartitions.Set(float64(desired))
+	return nil
+}
+
+// Status returns the plan and progress of the controller, as of the last reconciliation.
+func (c *PartitionLifecycleController) Status() PartitionLifecycleControllerStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	status := c.status
+	status.DesiredPartitions = c.desired
+	return status
+}
+
+func (c *PartitionLifecycleController) iteration(ctx context.Context) error {
+	// Failures are tracked in the status and retried at the next iteration.
+	c.reconcile(ctx, time.Now())
+	return nil
+}
+
+func (c *PartitionLifecycleController) reconcile(ctx context.Context, now time.Time) {
+	c.mtx.Lock()
+	desired := c.desired
+	c.mtx.Unlock()
+
+	var plan []PartitionLifecyclePlanEntry
+	err := c.store.CAS(ctx, c.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		ringDesc := GetOrCreatePartitionRingDesc(in)
+
+		// The plan is computed again if the CAS is retried.
+		plan = c.plan(ringDesc, desired, now)
+		if !c.apply(ringDesc, plan, now) {
+			return nil, false, nil
+		}
+		return ringDesc, true, nil
+	})
+
+	if err != nil {
+		c.reconcilesFailedTotal.Inc()
+		level.Warn(c.logger).Log("msg", "failed to reconcile the partition ring", "err", err)
+	} else {
+		for _, entry := range plan {
+			if entry.Action != "" {
+				c.transitionsTotal.WithLabelValues(entry.Action).Inc()
+				level.Info(c.logger).Log("msg", "partition lifecycle transition applied", "partition", entry.PartitionID, "action", entry.Action, "state", entry.State, "target_state", entry.TargetState)
+			}
+		}
+	}
+
+	converged, notConverged := true, 0
+	for _, entry := range plan {
+		if !entry.converged() {
+			converged = false
+			notConverged++
+		}
+	}
+	c.partitionsNotConverged.Set(float64(notConverged))
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.status.LastReconcile = now
+	c.status.LastError = ""
+	if err != nil {
+		c.status.LastError = err.Error()
+		return
+	}
+	c.status.Partitions = plan
+	c.status.Converged = converged
+}
+
+func (e PartitionLifecyclePlanEntry) converged() bool {
+	return e.Action == "" && e.Waiting == "" && (e.State == e.TargetState || (e.State == PartitionUnknown.String() && e.TargetState == partitionLifecycleTargetDeleted))
+}
+
+// plan computes the next action of each partition, without changing the ring.
+func (c *PartitionLifecycleController) plan(ringDesc *PartitionRingDesc, desired int, now time.Time) []PartitionLifecyclePlanEntry {
+	ids := make([]int32, 0, max(desired, len(ringDesc.Partitions)))
+	for id := int32(0); id < int32(desired); id++ {
+		ids = append(ids, id)
+	}
+	for id := range ringDesc.Partitions {
+		if id >= int32(desired) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	plan := make([]PartitionLifecyclePlanEntry, 0, len(ids))
+	for _, id := range ids {
+		partition, exists := ringDesc.Partitions[id]
+
+		entry := PartitionLifecyclePlanEntry{
+			PartitionID:   id,
+			State:         PartitionUnknown.String(),
+			TargetState:   PartitionActive.String(),
+			OwnersPerZone: c.ownersPerZone(ringDesc, id, time.Time{}),
+		}
+		if exists {
+			entry.State = partition.State.String()
+		}
+		if id >= int32(desired) {
+			entry.TargetState = partitionLifecycleTargetDeleted
+		}
+
+		switch {
+		case !exists:
+			if entry.TargetState == PartitionActive.String() {
+				entry.Action = partitionLifecycleActionCreate
+			}
+
+		case entry.TargetState == PartitionActive.String() && (partition.IsPending() || partition.IsInactive()):
+			if missing := c.missingOwners(c.ownersPerZone(ringDesc, id, now.Add(-c.cfg.PendingGracePeriod))); missing != "" {
+				entry.Waiting = "waiting for owners: " + missing
+			} else {
+				entry.Action = partitionLifecycleActionActivate
+			}
+
+		case entry.TargetState == partitionLifecycleTargetDeleted && (partition.IsActive() || partition.IsPending()):
+			entry.Action = partitionLifecycleActionDeactivate
+
+		case entry.TargetState == partitionLifecycleTargetDeleted && partition.IsInactive():
+			if deleteAt := partition.GetStateTime().Add(c.cfg.InactiveGracePeriod); now.Before(deleteAt) {
+				entry.Waiting = fmt.Sprintf("waiting for the inactive grace period until %s", deleteAt.UTC().Format(time.RFC3339))
+			} else if owners := ringDesc.PartitionOwnersCount(id); owners > 0 {
+				entry.Waiting = fmt.Sprintf("waiting for %d owners to be removed", owners)
+			} else {
+				entry.Action = partitionLifecycleActionDelete
+			}
+		}
+
+		plan = append(plan, entry)
+	}
+
+	return plan
+}
+
+// apply applies the actions of the plan to the ring, and updates the state of the plan entries accordingly.
+// It returns whether the ring has been changed.
+func (c *PartitionLifecycleController) apply(ringDesc *PartitionRingDesc, plan []PartitionLifecyclePlanEntry, now time.Time) bool {
+	changed := false
+
+	for i, entry := range plan {
+		switch entry.Action {
+		case partitionLifecycleActionCreate:
+			ringDesc.AddPartition(entry.PartitionID, PartitionPending, now)
+			plan[i].State = PartitionPending.String()
+			changed = true
+		case partitionLifecycleActionActivate:
+			changed = ringDesc.UpdatePartitionState(entry.PartitionID, PartitionActive, now) || changed
+			plan[i].State = PartitionActive.String()
+		case partitionLifecycleActionDeactivate:
+			changed = ringDesc.UpdatePartitionState(entry.PartitionID, PartitionInactive, now) || changed
+			plan[i].State = PartitionInactive.String()
+		case partitionLifecycleActionDelete:
+			ringDesc.RemovePartition(entry.PartitionID)
+			plan[i].State = PartitionUnknown.String()
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// ownersPerZone returns the number of owners of the partition in each zone. If updatedBefore is not zero,
+// only the owners updated before it are counted.
+func (c *PartitionLifecycleController) ownersPerZone(ringDesc *PartitionRingDesc, partitionID int32, updatedBefore time.Time) map[string]int {
+	owners := map[string]int{}
+	for _, zone := range c.cfg.Zones {
+		owners[zone] = 0
+	}
+
+	for ownerID, owner := range ringDesc.Owners {
+		if owner.OwnedPartition != partitionID || owner.State != OwnerActive {
+			continue
+		}
+		if !updatedBefore.IsZero() && owner.GetUpdatedTimestamp() >= updatedBefore.Unix() {
+			continue
+		}
+
+		zone := ""
+		if c.cfg.OwnerZone != nil {
+			zone = c.cfg.OwnerZone(ownerID)
+		}
+		owners[zone]++
+	}
+
+	return owners
+}
+
+// missingOwners returns a description of the zones which don't have enough owners, or an empty string if
+// all zones have enough owners.
+func (c *PartitionLifecycleController) missingOwners(ownersPerZone map[string]int) string {
+	zones := c.cfg.Zones
+	if len(zones) == 0 {
+		// Owners are counted regardless of their zone.
+		total := 0
+		for _, count := range ownersPerZone {
+			total += count
+		}
+		ownersPerZone = map[string]int{"": total}
+		zones = []string{""}
+	}
+
+	var missing []string
+	for _, zone := range zones {
+		if count := ownersPerZone[zone]; count < c.cfg.MinOwnersPerZone {
+			if zone == "" {
+				missing = append(missing, fmt.Sprintf("%d/%d", count, c.cfg.MinOwnersPerZone))
+			} else {
+				missing = append(missing, fmt.Sprintf("%s %d/%d", zone, count, c.cfg.MinOwnersPerZone))
+			}
+		}
+	}
+	sort.Strings(missing)
+	return strings.Join(missing, ", ")
+}
+
+// ServeHTTP returns the plan and progress of the controller as JSON. A POST request with the
+// "desired_partitions" parameter changes the desired number of partitions.
+func (c *PartitionLifecycleController) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		desired, err := strconv.Atoi(req.FormValue("desired_partitions"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid desired number of partitions: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetDesiredPartitions(desired); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Unsupported HTTP method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSONResponse(w, c.Status())
+}
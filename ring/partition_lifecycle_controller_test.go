@@ -0,0 +1,251 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+)
+
+func TestPartitionLifecycleController_ScaleUpAndDown(t *testing.T) {
+	const ringKey = "test"
+
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(GetPartitionRingCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	cfg := PartitionLifecycleControllerConfig{
+		DesiredPartitions:   2,
+		Zones:               []string{"zone-a", "zone-b"},
+		OwnerZone:           func(ownerID string) string { return ownerID[:strings.LastIndex(ownerID, "-")] },
+		MinOwnersPerZone:    1,
+		PendingGracePeriod:  time.Minute,
+		InactiveGracePeriod: 10 * time.Minute,
+	}
+	controller, err := NewPartitionLifecycleController(cfg, "test", ringKey, store, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	addOwners := func(partitionID int32, now time.Time, ownerIDs ...string) {
+		require.NoError(t, store.CAS(ctx, ringKey, func(in interface{}) (interface{}, bool, error) {
+			ringDesc := GetOrCreatePartitionRingDesc(in)
+			for _, id := range ownerIDs {
+				ringDesc.AddOrUpdateOwner(id, OwnerActive, partitionID, now)
+			}
+			return ringDesc, true, nil
+		}))
+	}
+
+	removeOwners := func(ownerIDs ...string) {
+		require.NoError(t, store.CAS(ctx, ringKey, func(in interface{}) (interface{}, bool, error) {
+			ringDesc := GetOrCreatePartitionRingDesc(in)
+			for _, id := range ownerIDs {
+				ringDesc.RemoveOwner(id)
+			}
+			return ringDesc, true, nil
+		}))
+	}
+
+	now := time.Now()
+
+	// The missing partitions are created in PENDING state.
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionPending, getPartitionStateFromStore(t, store, ringKey, 0))
+	assert.Equal(t, PartitionPending, getPartitionStateFromStore(t, store, ringKey, 1))
+
+	status := controller.Status()
+	require.Len(t, status.Partitions, 2)
+	assert.False(t, status.Converged)
+	assert.Equal(t, partitionLifecycleActionCreate, status.Partitions[0].Action)
+
+	// Partitions are not switched to ACTIVE until they have enough owners in each zone.
+	addOwners(0, now, "zone-a-0", "zone-b-0")
+	addOwners(1, now, "zone-a-1")
+
+	now = now.Add(2 * time.Minute)
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionActive, getPartitionStateFromStore(t, store, ringKey, 0))
+	assert.Equal(t, PartitionPending, getPartitionStateFromStore(t, store, ringKey, 1))
+
+	status = controller.Status()
+	assert.Equal(t, partitionLifecycleActionActivate, status.Partitions[0].Action)
+	assert.Equal(t, "waiting for owners: zone-b 0/1", status.Partitions[1].Waiting)
+	assert.Equal(t, map[string]int{"zone-a": 1, "zone-b": 0}, status.Partitions[1].OwnersPerZone)
+
+	// Owners are not counted until the pending grace period has elapsed.
+	addOwners(1, now, "zone-b-1")
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionPending, getPartitionStateFromStore(t, store, ringKey, 1))
+
+	now = now.Add(2 * time.Minute)
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionActive, getPartitionStateFromStore(t, store, ringKey, 1))
+
+	controller.reconcile(ctx, now)
+	assert.True(t, controller.Status().Converged)
+
+	// Scale down: the partition in excess is switched to INACTIVE.
+	require.NoError(t, controller.SetDesiredPartitions(1))
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionActive, getPartitionStateFromStore(t, store, ringKey, 0))
+	assert.Equal(t, PartitionInactive, getPartitionStateFromStore(t, store, ringKey, 1))
+
+	// The partition isn't removed before the inactive grace period.
+	now = now.Add(5 * time.Minute)
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionInactive, getPartitionStateFromStore(t, store, ringKey, 1))
+	assert.Contains(t, controller.Status().Partitions[1].Waiting, "waiting for the inactive grace period")
+
+	// Nor while it still has owners.
+	now = now.Add(10 * time.Minute)
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionInactive, getPartitionStateFromStore(t, store, ringKey, 1))
+	assert.Equal(t, "waiting for 2 owners to be removed", controller.Status().Partitions[1].Waiting)
+
+	removeOwners("zone-a-1", "zone-b-1")
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionUnknown, getPartitionStateFromStore(t, store, ringKey, 1))
+	assert.Equal(t, partitionLifecycleActionDelete, controller.Status().Partitions[1].Action)
+
+	controller.reconcile(ctx, now)
+	status = controller.Status()
+	assert.True(t, status.Converged)
+	require.Len(t, status.Partitions, 1)
+	assert.Equal(t, PartitionActive.String(), status.Partitions[0].State)
+}
+
+func TestPartitionLifecycleController_ReactivateInactivePartition(t *testing.T) {
+	const ringKey = "test"
+
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(GetPartitionRingCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	now := time.Now()
+	require.NoError(t, store.CAS(ctx, ringKey, func(in interface{}) (interface{}, bool, error) {
+		ringDesc := GetOrCreatePartitionRingDesc(in)
+		ringDesc.AddPartition(0, PartitionInactive, now.Add(-time.Hour))
+		ringDesc.AddOrUpdateOwner("owner-0", OwnerActive, 0, now.Add(-time.Hour))
+		return ringDesc, true, nil
+	}))
+
+	cfg := PartitionLifecycleControllerConfig{DesiredPartitions: 1, MinOwnersPerZone: 1}
+	controller, err := NewPartitionLifecycleController(cfg, "test", ringKey, store, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	// Scaling up again reactivates the INACTIVE partition instead of deleting it.
+	controller.reconcile(ctx, now)
+	assert.Equal(t, PartitionActive, getPartitionStateFromStore(t, store, ringKey, 0))
+}
+
+func TestPartitionLifecycleController_Config(t *testing.T) {
+	_, err := NewPartitionLifecycleController(PartitionLifecycleControllerConfig{DesiredPartitions: -1}, "test", "test", nil, log.NewNopLogger(), nil)
+	require.Error(t, err)
+
+	_, err = NewPartitionLifecycleController(PartitionLifecycleControllerConfig{MinOwnersPerZone: -1}, "test", "test", nil, log.NewNopLogger(), nil)
+	require.Error(t, err)
+
+	_, err = NewPartitionLifecycleController(PartitionLifecycleControllerConfig{Zones: []string{"zone-a"}}, "test", "test", nil, log.NewNopLogger(), nil)
+	require.Error(t, err)
+}
+
+func TestPartitionLifecycleController_Service(t *testing.T) {
+	const ringKey = "test"
+
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(GetPartitionRingCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	cfg := PartitionLifecycleControllerConfig{DesiredPartitions: 3, ReconcileInterval: 10 * time.Millisecond}
+	controller, err := NewPartitionLifecycleController(cfg, "test", ringKey, store, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, controller))
+	t.Cleanup(func() {
+		assert.NoError(t, services.StopAndAwaitTerminated(ctx, controller))
+	})
+
+	// Partitions are created, but not switched to ACTIVE until they have at least one owner.
+	test.Poll(t, time.Second, 3, func() interface{} {
+		return len(getPartitionRingFromStore(t, store, ringKey).Partitions)
+	})
+	assert.Equal(t, 0, getPartitionRingFromStore(t, store, ringKey).activePartitionsCount())
+
+	require.NoError(t, store.CAS(ctx, ringKey, func(in interface{}) (interface{}, bool, error) {
+		ringDesc := GetOrCreatePartitionRingDesc(in)
+		for partitionID := int32(0); partitionID < 3; partitionID++ {
+			ringDesc.AddOrUpdateOwner(fmt.Sprintf("owner-%d", partitionID), OwnerActive, partitionID, time.Now())
+		}
+		return ringDesc, true, nil
+	}))
+	test.Poll(t, time.Second, 3, func() interface{} {
+		return getPartitionRingFromStore(t, store, ringKey).activePartitionsCount()
+	})
+	test.Poll(t, time.Second, true, func() interface{} {
+		return controller.Status().Converged
+	})
+}
+
+func TestPartitionLifecycleController_ServeHTTP(t *testing.T) {
+	const ringKey = "test"
+
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(GetPartitionRingCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	controller, err := NewPartitionLifecycleController(PartitionLifecycleControllerConfig{DesiredPartitions: 1, MinOwnersPerZone: 1}, "test", ringKey, store, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	controller.reconcile(ctx, time.Now())
+	controller.reconcile(ctx, time.Now())
+
+	doRequest := func(method string, form url.Values) (*httptest.ResponseRecorder, PartitionLifecycleControllerStatus) {
+		req := httptest.NewRequest(method, "/partition-lifecycle", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+		controller.ServeHTTP(recorder, req)
+
+		var status PartitionLifecycleControllerStatus
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		}
+		return recorder, status
+	}
+
+	recorder, status := doRequest(http.MethodGet, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 1, status.DesiredPartitions)
+	require.Len(t, status.Partitions, 1)
+	assert.Equal(t, PartitionPending.String(), status.Partitions[0].State)
+	assert.Equal(t, PartitionActive.String(), status.Partitions[0].TargetState)
+	assert.Equal(t, "waiting for owners: 0/1", status.Partitions[0].Waiting)
+
+	recorder, _ = doRequest(http.MethodPost, url.Values{"desired_partitions": {"-1"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder, _ = doRequest(http.MethodPost, url.Values{"desired_partitions": {"xxx"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder, _ = doRequest(http.MethodDelete, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	recorder, status = doRequest(http.MethodPost, url.Values{"desired_partitions": {"0"}})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 0, status.DesiredPartitions)
+
+	controller.reconcile(ctx, time.Now())
+	_, status = doRequest(http.MethodGet, nil)
+	require.Len(t, status.Partitions, 1)
+	assert.Equal(t, partitionLifecycleTargetDeleted, status.Partitions[0].TargetState)
+	assert.Equal(t, partitionLifecycleActionDeactivate, status.Partitions[0].Action)
+}
@@ -0,0 +1,184 @@
+package ring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/grafana/dskit/kv"
+)
+
+// PartitionRingAdminHandler serves a JSON admin API to inspect and edit a partition ring stored in the KV store.
+//
+// GET requests list the partitions with their ownership and owners. POST requests apply an action to the ring,
+// described by a JSON body with an "action" field:
+//
+//   - add_owner: adds "owner" as an owner of the partition "partition". The partition must exist and the
+//     owner must not own another partition.
+//   - remove_owner: removes "owner" from the owners of the partition "partition". The owner must own it.
+//   - change_state: changes the state of the partition "partition" to "to_state", if the state change is allowed.
+//
+// Every action is applied with a single CAS, so it's either fully applied or not at all, and is audit logged.
+type PartitionRingAdminHandler struct {
+	editor *PartitionRingEditor
+	logger log.Logger
+}
+
+// NewPartitionRingAdminHandler creates a PartitionRingAdminHandler for the partition ring stored at ringKey.
+func NewPartitionRingAdminHandler(ringKey string, store kv.Client, logger log.Logger) *PartitionRingAdminHandler {
+	return &PartitionRingAdminHandler{
+		editor: NewPartitionRingEditor(ringKey, store),
+		logger: logger,
+	}
+}
+
+type partitionRingAdminPartition struct {
+	ID             int32     `json:"id"`
+	State          string    `json:"state"`
+	StateTimestamp time.Time `json:"state_timestamp"`
+	OwnerIDs       []string  `json:"owner_ids"`
+	NumTokens      int       `json:"num_tokens"`
+	Ownership      float64   `json:"ownership"`
+}
+
+type partitionRingAdminPartitionsResponse struct {
+	Partitions []partitionRingAdminPartition `json:"partitions"`
+}
+
+type partitionRingAdminRequest struct {
+	Action    string `json:"action"`
+	Owner     string `json:"owner"`
+	Partition *int32 `json:"partition"`
+	ToState   string `json:"to_state"`
+}
+
+func (h *PartitionRingAdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.listPartitions(w, req)
+	case http.MethodPost:
+		h.handleAction(w, req)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("unsupported HTTP method"))
+	}
+}
+
+func (h *PartitionRingAdminHandler) listPartitions(w http.ResponseWriter, req *http.Request) {
+	in, err := h.editor.store.Get(req.Context(), h.editor.ringKey)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ringDesc := GetOrCreatePartitionRingDesc(in)
+	ownedTokens := ringDesc.countTokens()
+	owners := ringDesc.ownersByPartition()
+
+	partitions := make([]partitionRingAdminPartition, 0, len(ringDesc.Partitions))
+	for id, partition := range ringDesc.Partitions {
+		partitions = append(partitions, partitionRingAdminPartition{
+			ID:             id,
+			State:          partition.State.String(),
+			StateTimestamp: partition.GetStateTime().UTC(),
+			OwnerIDs:       owners[id],
+			NumTokens:      len(partition.Tokens),
+			Ownership:      distancePercentage(ownedTokens[id]),
+		})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].ID < partitions[j].ID
+	})
+
+	writeJSONResponse(w, partitionRingAdminPartitionsResponse{Partitions: partitions})
+}
+
+func (h *PartitionRingAdminHandler) handleAction(w http.ResponseWriter, req *http.Request) {
+	var action partitionRingAdminRequest
+	if err := json.NewDecoder(req.Body).Decode(&action); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if action.Partition == nil {
+		writeAdminError(w, http.StatusBadRequest, errors.New("no partition specified"))
+		return
+	}
+	partitionID := *action.Partition
+
+	var (
+		update  func(*PartitionRingDesc) (bool, error)
+		logArgs = []any{"partition", partitionID}
+	)
+
+	switch action.Action {
+	case "add_owner", "remove_owner":
+		if action.Owner == "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("no owner specified"))
+			return
+		}
+		if action.Action == "add_owner" {
+			update = func(desc *PartitionRingDesc) (bool, error) {
+				return addPartitionOwner(desc, action.Owner, partitionID, time.Now())
+			}
+		} else {
+			update = func(desc *PartitionRingDesc) (bool, error) {
+				return removePartitionOwner(desc, action.Owner, partitionID)
+			}
+		}
+		logArgs = append(logArgs, "owner", action.Owner)
+
+	case "change_state":
+		toState, ok := PartitionState_value[action.ToState]
+		if !ok {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid to_state %q", action.ToState))
+			return
+		}
+		update = func(desc *PartitionRingDesc) (bool, error) {
+			return changePartitionState(desc, partitionID, PartitionState(toState))
+		}
+		logArgs = append(logArgs, "to_state", action.ToState)
+
+	default:
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("unknown action %q", action.Action))
+		return
+	}
+
+	// The update may be retried on CAS conflicts, so we only keep track of the last attempt.
+	changed := false
+	err := h.editor.updateRing(req.Context(), func(desc *PartitionRingDesc) (bool, error) {
+		var err error
+		changed, err = update(desc)
+		return changed, err
+	})
+
+	logAdminAction(h.logger, req, "partition ring admin action", action.Action, changed, err, logArgs...)
+	writeAdminActionResponse(w, changed, err)
+}
+
+func addPartitionOwner(desc *PartitionRingDesc, ownerID string, partitionID int32, now time.Time) (bool, error) {
+	if !desc.HasPartition(partitionID) {
+		return false, fmt.Errorf("partition %d: %w", partitionID, errAdminNotFound)
+	}
+	if owner, ok := desc.Owners[ownerID]; ok && owner.OwnedPartition != partitionID {
+		return false, fmt.Errorf("owner %s already owns partition %d: %w", ownerID, owner.OwnedPartition, errAdminPreconditionFailed)
+	}
+
+	return desc.AddOrUpdateOwner(ownerID, OwnerActive, partitionID, now), nil
+}
+
+func removePartitionOwner(desc *PartitionRingDesc, ownerID string, partitionID int32) (bool, error) {
+	owner, ok := desc.Owners[ownerID]
+	if !ok {
+		return false, fmt.Errorf("owner %s: %w", ownerID, errAdminNotFound)
+	}
+	if owner.OwnedPartition != partitionID {
+		return false, fmt.Errorf("owner %s owns partition %d, expected %d: %w", ownerID, owner.OwnedPartition, partitionID, errAdminPreconditionFailed)
+	}
+
+	return desc.RemoveOwner(ownerID), nil
+}
@@ -0,0 +1,124 @@
+package ring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/kv/consul"
+)
+
+func newPartitionRingAdminHandlerForTesting(t *testing.T) (*PartitionRingAdminHandler, kv.Client, *bytes.Buffer) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store, closer := consul.NewInMemoryClient(GetPartitionRingCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	require.NoError(t, store.CAS(ctx, ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		desc := GetOrCreatePartitionRingDesc(in)
+		desc.AddPartition(1, PartitionActive, now)
+		desc.AddPartition(2, PartitionPending, now)
+		desc.AddOrUpdateOwner("owner-1a", OwnerActive, 1, now)
+		desc.AddOrUpdateOwner("owner-1b", OwnerActive, 1, now)
+		return desc, true, nil
+	}))
+
+	logs := &bytes.Buffer{}
+	return NewPartitionRingAdminHandler(ringKey, store, log.NewLogfmtLogger(logs)), store, logs
+}
+
+func getPartitionRingDesc(t *testing.T, store kv.Client) *PartitionRingDesc {
+	in, err := store.Get(context.Background(), ringKey)
+	require.NoError(t, err)
+	return GetOrCreatePartitionRingDesc(in)
+}
+
+func TestPartitionRingAdminHandler_ListPartitions(t *testing.T) {
+	handler, _, _ := newPartitionRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res partitionRingAdminPartitionsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Len(t, res.Partitions, 2)
+
+	assert.Equal(t, int32(1), res.Partitions[0].ID)
+	assert.Equal(t, PartitionActive.String(), res.Partitions[0].State)
+	assert.Equal(t, []string{"owner-1a", "owner-1b"}, res.Partitions[0].OwnerIDs)
+	assert.InDelta(t, 100, res.Partitions[0].Ownership+res.Partitions[1].Ownership, 0.001)
+
+	assert.Equal(t, int32(2), res.Partitions[1].ID)
+	assert.Equal(t, PartitionPending.String(), res.Partitions[1].State)
+	assert.Empty(t, res.Partitions[1].OwnerIDs)
+}
+
+func TestPartitionRingAdminHandler_AddOwner(t *testing.T) {
+	handler, store, logs := newPartitionRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "add_owner", "owner": "owner-2a", "partition": 2}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"status": "success", "changed": true}`, recorder.Body.String())
+	assert.Equal(t, 1, getPartitionRingDesc(t, store).PartitionOwnersCount(2))
+	assert.Contains(t, logs.String(), `msg="partition ring admin action" action=add_owner`)
+	assert.Contains(t, logs.String(), "partition=2 owner=owner-2a")
+
+	// Adding the same owner again is a no-op.
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "add_owner", "owner": "owner-2a", "partition": 2}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"status": "success", "changed": false}`, recorder.Body.String())
+
+	// An owner can't own two partitions.
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "add_owner", "owner": "owner-1a", "partition": 2}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "owner owner-1a already owns partition 1")
+	assert.Equal(t, int32(1), getPartitionRingDesc(t, store).Owners["owner-1a"].OwnedPartition)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "add_owner", "owner": "owner-3a", "partition": 3}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.False(t, getPartitionRingDesc(t, store).HasOwner("owner-3a"))
+}
+
+func TestPartitionRingAdminHandler_RemoveOwner(t *testing.T) {
+	handler, store, logs := newPartitionRingAdminHandlerForTesting(t)
+
+	// The owner doesn't own the given partition.
+	recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "remove_owner", "owner": "owner-1a", "partition": 2}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.True(t, getPartitionRingDesc(t, store).HasOwner("owner-1a"))
+	assert.Contains(t, logs.String(), "level=warn")
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "remove_owner", "owner": "owner-1a", "partition": 1}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.False(t, getPartitionRingDesc(t, store).HasOwner("owner-1a"))
+	assert.Equal(t, 1, getPartitionRingDesc(t, store).PartitionOwnersCount(1))
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "remove_owner", "owner": "owner-1a", "partition": 1}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestPartitionRingAdminHandler_ChangeState(t *testing.T) {
+	handler, store, _ := newPartitionRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "partition": 2, "to_state": "PartitionActive"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, PartitionActive, getPartitionRingDesc(t, store).Partitions[2].State)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "partition": 2, "to_state": "PartitionPending"}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "partition": 3, "to_state": "PartitionActive"}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "to_state": "PartitionActive"}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -26,6 +26,8 @@ type PartitionRingWatcher struct {
 	ringMx sync.Mutex
 	ring   *PartitionRing
 
+	subscriptions subscriptions[PartitionRingDiff]
+
 	// Metrics.
 	numPartitionsGaugeVec *prometheus.GaugeVec
 }
@@ -101,6 +103,7 @@ func (w *PartitionRingWatcher) updatePartitionRing(desc *PartitionRingDesc) {
 	if w.delegate != nil {
 		w.delegate.OnPartitionRingChanged(&oldRing.desc, desc)
 	}
+	w.subscriptions.publish(&oldRing.desc, desc)
 
 	// Update metrics.
 	for state, count := range desc.countPartitionsByState() {
@@ -108,6 +111,13 @@ func (w *PartitionRingWatcher) updatePartitionRing(desc *PartitionRingDesc) {
 	}
 }
 
+// Subscribe returns a Subscription delivering the changes applied to the partition ring from now on, such as
+// partitions and owners added, removed or changed. Up to bufferSize changes are buffered before being coalesced,
+// so a slow subscriber never blocks the watcher. The Subscription must be closed once not needed anymore.
+func (w *PartitionRingWatcher) Subscribe(bufferSize int) *Subscription[PartitionRingDiff] {
+	return w.subscriptions.subscribe(bufferSize, diffPartitionRingDescs)
+}
+
 // PartitionRing returns the most updated snapshot of the PartitionRing. The returned instance
 // is immutable and will not be updated if new changes are done to the ring.
 func (w *PartitionRingWatcher) PartitionRing() *PartitionRing {
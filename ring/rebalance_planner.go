@@ -0,0 +1,342 @@
+package ring
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// TokenMove describes the reassignment of a token of the ring from an instance to another one of the same zone.
+type TokenMove struct {
+	Token uint32 `json:"token"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Zone  string `json:"zone"`
+
+	// Ranges are the token ranges whose keys move from the instance From to the instance To.
+	Ranges TokenRanges `json:"ranges"`
+
+	// Ownership is the fraction of the token space of the zone owned by Token.
+	Ownership float64 `json:"ownership"`
+}
+
+// InstanceOwnership is the fraction of the token space of its zone owned by an instance, before and after a RebalancePlan.
+type InstanceOwnership struct {
+	Zone   string  `json:"zone"`
+	Weight uint32  `json:"weight"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// ZoneOwnership describes the ownership spread of the instances of a zone, before and after a RebalancePlan.
+// The ownership spread of a zone is the difference between the highest and the lowest ownership per unit of
+// weight of its instances, divided by the highest one. MinAfter and MaxAfter are ownerships per unit of weight.
+type ZoneOwnership struct {
+	Instances    int     `json:"instances"`
+	SpreadBefore float64 `json:"spread_before"`
+	SpreadAfter  float64 `json:"spread_after"`
+	MinAfter     float64 `json:"min_after"`
+	MaxAfter     float64 `json:"max_after"`
+}
+
+// RebalancePlan is a sequence of token moves, to be applied in order, and the ownership predicted after all of them have been applied.
+type RebalancePlan struct {
+	Moves     []TokenMove                  `json:"moves"`
+	Instances map[string]InstanceOwnership `json:"instances"`
+	Zones     map[string]ZoneOwnership     `json:"zones"`
+}
+
+// TargetReached returns true if the spread of all the zones after the plan is at most targetSpread.
+func (p *RebalancePlan) TargetReached(targetSpread float64) bool {
+	for _, zone := range p.Zones {
+		if zone.SpreadAfter > targetSpread {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply applies the moves of the plan to the given ring. It fails if a moved token is not owned by the expected instance.
+func (p *RebalancePlan) Apply(desc *Desc) error {
+	for _, move := range p.Moves {
+		from, ok := desc.Ingesters[move.From]
+		if !ok {
+			return fmt.Errorf("instance %q not found", move.From)
+		}
+		to, ok := desc.Ingesters[move.To]
+		if !ok {
+			return fmt.Errorf("instance %q not found", move.To)
+		}
+		idx := slices.Index(from.Tokens, move.Token)
+		if idx < 0 {
+			return fmt.Errorf("token %d is not owned by instance %q", move.Token, move.From)
+		}
+
+		from.Tokens = slices.Delete(slices.Clone(from.Tokens), idx, idx+1)
+		to.Tokens = append(slices.Clone(to.Tokens), move.Token)
+		sort.Sort(Tokens(to.Tokens))
+		desc.Ingesters[move.From] = from
+		desc.Ingesters[move.To] = to
+	}
+	return nil
+}
+
+// PlanRebalance computes a sequence of token moves bringing the ownership spread of each zone of the given ring
+// at or below targetSpread (between 0 and 1), with at most maxMoves moves (0 means no limit). Tokens only move
+// between instances of the same zone, so that the replicas of each key stay in distinct zones.
+//
+// Instances are expected to own a fraction of the token space of their zone proportional to their weight.
+// Instances without tokens, like instances just added to the ring, take tokens from the other instances of their
+// zone. Zones without any token are ignored.
+// Moves are chosen greedily: at each step the planner picks the zone with the highest spread and moves a token
+// of its instance with the highest ownership per unit of weight to its instance with the lowest one, choosing
+// the token that balances the two instances the most. Each move strictly reduces the imbalance, so the plan only contains moves
+// that are needed, but it's not guaranteed to be the shortest possible one. If the target can't be reached, the
+// returned plan gets as close as possible to it, and TargetReached returns false.
+//
+// The ring itself is not modified.
+func PlanRebalance(desc *Desc, targetSpread float64, maxMoves int) (*RebalancePlan, error) {
+	if targetSpread < 0 || targetSpread > 1 {
+		return nil, fmt.Errorf("target spread %v must be between 0 and 1", targetSpread)
+	}
+	if maxMoves < 0 {
+		return nil, fmt.Errorf("max moves %d must not be negative", maxMoves)
+	}
+	if desc == nil || len(desc.Ingesters) == 0 {
+		return nil, errors.New("the ring is empty")
+	}
+
+	zones := newRebalanceZones(desc)
+	plan := &RebalancePlan{
+		Instances: map[string]InstanceOwnership{},
+		Zones:     make(map[string]ZoneOwnership, len(zones)),
+	}
+	spreadsBefore := make(map[string]float64, len(zones))
+	for _, zone := range zones {
+		spreadsBefore[zone.name] = zone.spread()
+		for id, instanceID := range zone.instanceIDs {
+			plan.Instances[instanceID] = InstanceOwnership{Zone: zone.name, Weight: uint32(zone.weights[id]), Before: zone.ownership(id)}
+		}
+	}
+
+	for maxMoves == 0 || len(plan.Moves) < maxMoves {
+		// Pick the zone with the highest spread, among the ones that can still be improved.
+		var worst *rebalanceZone
+		for _, zone := range zones {
+			if zone.done || zone.spread() <= targetSpread {
+				continue
+			}
+			if worst == nil || zone.spread() > worst.spread() {
+				worst = zone
+			}
+		}
+		if worst == nil {
+			break
+		}
+
+		move, ok := worst.moveToken()
+		if !ok {
+			worst.done = true
+			continue
+		}
+		plan.Moves = append(plan.Moves, move)
+	}
+
+	for _, zone := range zones {
+		minOwnership, maxOwnership := zone.minMax()
+		plan.Zones[zone.name] = ZoneOwnership{
+			Instances:    len(zone.instanceIDs),
+			SpreadBefore: spreadsBefore[zone.name],
+			SpreadAfter:  zone.spread(),
+			MinAfter:     minOwnership / totalTokensCount,
+			MaxAfter:     maxOwnership / totalTokensCount,
+		}
+		for id, instanceID := range zone.instanceIDs {
+			ownership := plan.Instances[instanceID]
+			ownership.After = zone.ownership(id)
+			plan.Instances[instanceID] = ownership
+		}
+	}
+
+	return plan, nil
+}
+
+// rebalanceZone tracks the token ownership of the instances of a zone while a RebalancePlan is computed.
+type rebalanceZone struct {
+	name string
+	done bool
+
+	// instanceIDs are the sorted ids of the instances of the zone, including the ones without tokens.
+	// Instances are identified by their position in instanceIDs.
+	instanceIDs []string
+	// weights are the weights of each instance.
+	weights []float64
+	// tokens are the tokens of each instance, with their ownership.
+	tokens [][]ownershipInfo[ringToken]
+	// instanceQueue is a priority queue of instances such that instances with higher ownership per
+	// unit of weight have a higher priority.
+	instanceQueue ownershipPriorityQueue[ringInstance]
+}
+
+func newRebalanceZones(desc *Desc) []*rebalanceZone {
+	tokensInfo := desc.getTokensInfo()
+	tokensByZone := desc.getTokensByZone()
+
+	zoneNames := make([]string, 0, len(tokensByZone))
+	for name, tokens := range tokensByZone {
+		if len(tokens) > 0 {
+			zoneNames = append(zoneNames, name)
+		}
+	}
+	slices.Sort(zoneNames)
+
+	zones := make([]*rebalanceZone, 0, len(zoneNames))
+	for _, name := range zoneNames {
+		zone := &rebalanceZone{name: name}
+		for instanceID, instance := range desc.Ingesters {
+			if instance.Zone == name {
+				zone.instanceIDs = append(zone.instanceIDs, instanceID)
+			}
+		}
+		slices.Sort(zone.instanceIDs)
+
+		ids := make(map[string]int, len(zone.instanceIDs))
+		zone.weights = make([]float64, len(zone.instanceIDs))
+		for id, instanceID := range zone.instanceIDs {
+			ids[instanceID] = id
+			instance := desc.Ingesters[instanceID]
+			zone.weights[id] = float64(instance.GetEffectiveWeight())
+		}
+
+		zone.tokens = make([][]ownershipInfo[ringToken], len(zone.instanceIDs))
+		ownerships := make([]float64, len(zone.instanceIDs))
+		tokens := tokensByZone[name]
+		prev := tokens[len(tokens)-1]
+		for _, token := range tokens {
+			id := ids[tokensInfo[token].InstanceID]
+			info := newRingTokenOwnershipInfo(token, prev)
+			zone.tokens[id] = append(zone.tokens[id], info)
+			ownerships[id] += info.ownership
+			prev = token
+		}
+
+		zone.instanceQueue = newPriorityQueue[ringInstance](len(zone.instanceIDs))
+		for id, ownership := range ownerships {
+			heap.Push(&zone.instanceQueue, newRingInstanceOwnershipInfo(id, ownership/zone.weights[id]))
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// moveToken moves a token from the instance with the highest ownership per unit of weight to the instance with
+// the lowest one. The moved token is the one whose ownership is the closest to the ownership that would equalize
+// the ownership per unit of weight of the two instances. It returns false if there is no token whose move reduces
+// the imbalance.
+func (z *rebalanceZone) moveToken() (TokenMove, bool) {
+	if len(z.instanceQueue.items) < 2 {
+		return TokenMove{}, false
+	}
+
+	highest := z.instanceQueue.Peek()
+	lowestIdx := z.lowestOwnershipIndex()
+	lowest := z.instanceQueue.items[lowestIdx]
+
+	fromID, toID := highest.item.instanceID, lowest.item.instanceID
+	fromWeight, toWeight := z.weights[fromID], z.weights[toID]
+	// balancing is the ownership that, moved from the highest to the lowest instance, equalizes their ownership
+	// per unit of weight. Moving a token reduces the imbalance, i.e., the sum of the squared ownership of each
+	// instance divided by its weight, only if its ownership is lower than twice balancing.
+	balancing := (highest.ownership - lowest.ownership) * fromWeight * toWeight / (fromWeight + toWeight)
+	best := -1
+	for i, token := range z.tokens[fromID] {
+		if token.ownership >= 2*balancing {
+			continue
+		}
+		if best < 0 || math.Abs(balancing-token.ownership) < math.Abs(balancing-z.tokens[fromID][best].ownership) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return TokenMove{}, false
+	}
+
+	token := z.tokens[fromID][best]
+	z.tokens[fromID] = slices.Delete(z.tokens[fromID], best, best+1)
+	z.tokens[toID] = append(z.tokens[toID], token)
+
+	z.instanceQueue.items[lowestIdx].ownership += token.ownership / toWeight
+	heap.Fix(&z.instanceQueue, lowestIdx)
+	for i := range z.instanceQueue.items {
+		if z.instanceQueue.items[i].item.instanceID == fromID {
+			z.instanceQueue.items[i].ownership -= token.ownership / fromWeight
+			heap.Fix(&z.instanceQueue, i)
+			break
+		}
+	}
+
+	return TokenMove{
+		Token:     token.item.token,
+		From:      z.instanceIDs[fromID],
+		To:        z.instanceIDs[toID],
+		Zone:      z.name,
+		Ranges:    tokenRanges(token.item.prevToken, token.item.token),
+		Ownership: token.ownership / totalTokensCount,
+	}, true
+}
+
+// lowestOwnershipIndex returns the index in the instance queue of the instance with the lowest ownership.
+func (z *rebalanceZone) lowestOwnershipIndex() int {
+	lowest := 0
+	for i := 1; i < len(z.instanceQueue.items); i++ {
+		// Reuse the priority queue ordering, so that ties are broken consistently.
+		if z.instanceQueue.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+func (z *rebalanceZone) minMax() (float64, float64) {
+	if len(z.instanceQueue.items) == 0 {
+		return 0, 0
+	}
+	return z.instanceQueue.items[z.lowestOwnershipIndex()].ownership, z.instanceQueue.Peek().ownership
+}
+
+func (z *rebalanceZone) spread() float64 {
+	minOwnership, maxOwnership := z.minMax()
+	if maxOwnership == 0 {
+		return 0
+	}
+	return (maxOwnership - minOwnership) / maxOwnership
+}
+
+// ownership returns the fraction of the token space of the zone owned by the instance with the given id.
+func (z *rebalanceZone) ownership(id int) float64 {
+	for _, instance := range z.instanceQueue.items {
+		if instance.item.instanceID == id {
+			return instance.ownership * z.weights[id] / totalTokensCount
+		}
+	}
+	return 0
+}
+
+// tokenRanges returns the TokenRanges owned by token, whose previous token in the ring is prevToken.
+// The keys owned by token are [prevToken, token-1], possibly wrapping around the end of the token space.
+func tokenRanges(prevToken, token uint32) TokenRanges {
+	switch {
+	case prevToken == token:
+		return TokenRanges{0, math.MaxUint32}
+	case token == 0:
+		return TokenRanges{prevToken, math.MaxUint32}
+	case prevToken < token:
+		return TokenRanges{prevToken, token - 1}
+	default:
+		return TokenRanges{0, token - 1, prevToken, math.MaxUint32}
+	}
+}
@@ -0,0 +1,192 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	const quarter = 1 << 30
+
+	// zone-a: instance-1 owns 3/4 of the token space, instance-2 owns 1/4.
+	// zone-b: instances are already balanced.
+	desc := NewDesc()
+	desc.AddIngester("instance-1", "", "zone-a", []uint32{quarter, 2 * quarter, 3 * quarter}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-2", "", "zone-a", []uint32{0}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-3", "", "zone-b", []uint32{1, 2*quarter + 1}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-4", "", "zone-b", []uint32{quarter + 1, 3*quarter + 1}, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	plan, err := PlanRebalance(desc, 0.1, 0)
+	require.NoError(t, err)
+	require.True(t, plan.TargetReached(0.1))
+
+	require.Len(t, plan.Moves, 1)
+	move := plan.Moves[0]
+	assert.Equal(t, "instance-1", move.From)
+	assert.Equal(t, "instance-2", move.To)
+	assert.Equal(t, "zone-a", move.Zone)
+	assert.Equal(t, 0.25, move.Ownership)
+	assert.Len(t, move.Ranges, 2)
+	assert.Equal(t, move.Token-1, move.Ranges[1])
+
+	assert.Equal(t, InstanceOwnership{Zone: "zone-a", Weight: 1, Before: 0.75, After: 0.5}, plan.Instances["instance-1"])
+	assert.Equal(t, InstanceOwnership{Zone: "zone-a", Weight: 1, Before: 0.25, After: 0.5}, plan.Instances["instance-2"])
+	assert.Equal(t, InstanceOwnership{Zone: "zone-b", Weight: 1, Before: 0.5, After: 0.5}, plan.Instances["instance-3"])
+	assert.Equal(t, ZoneOwnership{Instances: 2, SpreadBefore: 2.0 / 3, SpreadAfter: 0, MinAfter: 0.5, MaxAfter: 0.5}, plan.Zones["zone-a"])
+	assert.Equal(t, ZoneOwnership{Instances: 2, SpreadBefore: 0, SpreadAfter: 0, MinAfter: 0.5, MaxAfter: 0.5}, plan.Zones["zone-b"])
+
+	// The ring is not modified by the planner, but the plan can be applied to it.
+	assert.Len(t, desc.Ingesters["instance-1"].Tokens, 3)
+	require.NoError(t, plan.Apply(desc))
+	assert.Len(t, desc.Ingesters["instance-1"].Tokens, 2)
+	assert.Equal(t, 0.0, ownershipSpreadByZone(desc)["zone-a"])
+
+	// Applying the plan again fails, because the tokens have already moved.
+	require.Error(t, plan.Apply(desc))
+}
+
+func TestPlanRebalance_InstanceWithoutTokens(t *testing.T) {
+	const quarter = 1 << 30
+
+	desc := NewDesc()
+	desc.AddIngester("instance-1", "", "zone-a", []uint32{0, quarter, 2 * quarter, 3 * quarter}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-2", "", "zone-a", nil, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	plan, err := PlanRebalance(desc, 0, 0)
+	require.NoError(t, err)
+	require.True(t, plan.TargetReached(0))
+
+	require.Len(t, plan.Moves, 2)
+	for _, move := range plan.Moves {
+		assert.Equal(t, "instance-1", move.From)
+		assert.Equal(t, "instance-2", move.To)
+	}
+	assert.Equal(t, InstanceOwnership{Zone: "zone-a", Weight: 1, Before: 0, After: 0.5}, plan.Instances["instance-2"])
+	assert.Equal(t, ZoneOwnership{Instances: 2, SpreadBefore: 1, SpreadAfter: 0, MinAfter: 0.5, MaxAfter: 0.5}, plan.Zones["zone-a"])
+
+	require.NoError(t, plan.Apply(desc))
+	assert.Len(t, desc.Ingesters["instance-2"].Tokens, 2)
+}
+
+func TestPlanRebalance_RandomTokens(t *testing.T) {
+	desc := NewDesc()
+	gen := NewRandomTokenGeneratorWithSeed(1)
+	for i := 0; i < 30; i++ {
+		for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+			desc.AddIngester(fmt.Sprintf("instance-%d-%s", i, zone), "", zone, gen.GenerateTokens(128, desc.GetTokens()), ACTIVE, time.Now(), false, time.Time{}, 0)
+		}
+	}
+
+	t.Run("unlimited moves", func(t *testing.T) {
+		plan, err := PlanRebalance(desc, 0.05, 0)
+		require.NoError(t, err)
+		require.True(t, plan.TargetReached(0.05))
+
+		for _, zone := range plan.Zones {
+			assert.Greater(t, zone.SpreadBefore, 0.05)
+			assert.LessOrEqual(t, zone.SpreadAfter, 0.05)
+		}
+
+		// Predicted ownership matches the ownership of the ring after the plan has been applied.
+		rebalanced := desc.Clone().(*Desc)
+		require.NoError(t, plan.Apply(rebalanced))
+		for zone, spread := range ownershipSpreadByZone(rebalanced) {
+			assert.InDelta(t, plan.Zones[zone].SpreadAfter, spread, 1e-9)
+		}
+		totalOwnership := 0.0
+		for _, instance := range plan.Instances {
+			totalOwnership += instance.After
+		}
+		assert.InDelta(t, 3, totalOwnership, 1e-9)
+
+		// Tokens never move across zones.
+		for _, move := range plan.Moves {
+			assert.Equal(t, desc.Ingesters[move.From].Zone, desc.Ingesters[move.To].Zone)
+		}
+	})
+
+	t.Run("limited moves", func(t *testing.T) {
+		plan, err := PlanRebalance(desc, 0.05, 10)
+		require.NoError(t, err)
+		require.Len(t, plan.Moves, 10)
+		require.False(t, plan.TargetReached(0.05))
+
+		for _, zone := range plan.Zones {
+			assert.Less(t, zone.SpreadAfter, zone.SpreadBefore)
+		}
+	})
+
+	t.Run("target already reached", func(t *testing.T) {
+		plan, err := PlanRebalance(desc, 1, 0)
+		require.NoError(t, err)
+		require.Empty(t, plan.Moves)
+	})
+}
+
+func TestPlanRebalance_InvalidInput(t *testing.T) {
+	desc := NewDesc()
+	desc.AddIngester("instance-1", "", "", []uint32{1}, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	_, err := PlanRebalance(desc, -0.1, 0)
+	require.Error(t, err)
+	_, err = PlanRebalance(desc, 0.1, -1)
+	require.Error(t, err)
+	_, err = PlanRebalance(NewDesc(), 0.1, 0)
+	require.Error(t, err)
+}
+
+func TestTokenRanges_ForToken(t *testing.T) {
+	tests := map[string]struct {
+		prevToken, token uint32
+		expected         TokenRanges
+	}{
+		"single token":  {prevToken: 10, token: 10, expected: TokenRanges{0, math.MaxUint32}},
+		"no wrapping":   {prevToken: 10, token: 20, expected: TokenRanges{10, 19}},
+		"token is zero": {prevToken: 10, token: 0, expected: TokenRanges{10, math.MaxUint32}},
+		"wrapping":      {prevToken: 20, token: 10, expected: TokenRanges{0, 9, 20, math.MaxUint32}},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			ranges := tokenRanges(testData.prevToken, testData.token)
+			require.Equal(t, testData.expected, ranges)
+
+			// Keys owned by the token according to the ring lookup are included in the ranges.
+			tokens := []uint32{testData.prevToken, testData.token}
+			if testData.prevToken > testData.token {
+				tokens = []uint32{testData.token, testData.prevToken}
+			}
+			for _, key := range []uint32{testData.prevToken, testData.token - 1, testData.token, testData.token + 1} {
+				owned := tokens[searchToken(tokens, key)] == testData.token
+				assert.Equal(t, owned, ranges.IncludesKey(key), "key %d", key)
+			}
+		})
+	}
+}
+
+func TestPlanRebalance_Weights(t *testing.T) {
+	// Both instances own half of the token space, but instance-2 has a weight of 3.
+	desc := NewDesc()
+	tokens := make([][]uint32, 2)
+	for i := uint32(0); i < 16; i++ {
+		tokens[i%2] = append(tokens[i%2], i<<28)
+	}
+	desc.AddIngester("instance-1", "", "", tokens[0], ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("instance-2", "", "", tokens[1], ACTIVE, time.Now(), false, time.Time{}, 3)
+
+	plan, err := PlanRebalance(desc, 0, 0)
+	require.NoError(t, err)
+	require.True(t, plan.TargetReached(0))
+	require.Len(t, plan.Moves, 4)
+
+	assert.Equal(t, InstanceOwnership{Zone: "", Weight: 1, Before: 0.5, After: 0.25}, plan.Instances["instance-1"])
+	assert.Equal(t, InstanceOwnership{Zone: "", Weight: 3, Before: 0.5, After: 0.75}, plan.Instances["instance-2"])
+	assert.InDelta(t, 2.0/3, plan.Zones[""].SpreadBefore, 1e-9)
+	assert.Equal(t, 0.0, plan.Zones[""].SpreadAfter)
+	assert.Equal(t, 0.25, plan.Zones[""].MinAfter)
+}
@@ -0,0 +1,824 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/dskit/kv"
+	shardUtil "github.com/grafana/dskit/ring/shard"
+	"github.com/grafana/dskit/services"
+)
+
+var errTokenRangesNotSupported = errors.New("token ranges are not supported by the rendezvous ring, because keys owned by an instance are not contiguous")
+
+// RendezvousRing is a ReadRing placing keys on instances by highest random weight (rendezvous) hashing,
+// instead of walking the tokens of the ring: for each key, instances are ranked by a score computed from
+// the hash of the key and the instance ID, weighted by the instance weight, and the replication set is
+// made of the instances with the highest score. Tokens registered by the instances are ignored, so that
+// the RendezvousRing can be used by components registering in the ring without meaningful tokens.
+//
+// When an instance joins or leaves the ring, only the keys for which it has or had the highest score move,
+// hence the key to instance mapping is stable under membership churn.
+//
+// Zones, replication factor, operation health and shuffle sharding follow the same rules of the Ring.
+// Since placement doesn't depend on tokens, every instance is counted as if it owned tokens.
+type RendezvousRing struct {
+	services.Service
+
+	key      string
+	cfg      Config
+	KVClient kv.Client
+	strategy ReplicationStrategy
+	logger   log.Logger
+
+	mtx      sync.RWMutex
+	ringDesc *Desc
+	// instances of the ring sorted by ID, with their precomputed hash.
+	instances                     []rendezvousInstance
+	instancesPerZone              map[string][]rendezvousInstance
+	weighted                      bool
+	ringZones                     []string
+	instancesCountPerZone         map[string]int
+	writableInstancesCount        int
+	writableInstancesCountPerZone map[string]int
+	oldestRegisteredTimestamp     int64
+	readOnlyInstances             int
+	oldestReadOnlyUpdatedTime     int64
+	lastTopologyChange            time.Time
+
+	// Cache of shuffle-sharded subrings per identifier. Invalidated when the topology changes.
+	// If set to nil, no caching is done (used by tests, and subrings).
+	shuffledSubringCache             map[subringCacheKey]*RendezvousRing
+	shuffledSubringWithLookbackCache map[subringCacheKey]cachedSubringWithLookback[*RendezvousRing]
+}
+
+type rendezvousInstance struct {
+	id     string
+	zone   string
+	hash   uint64
+	weight uint32
+}
+
+type scoredRendezvousInstance struct {
+	rendezvousInstance
+	score float64
+}
+
+// NewRendezvousRing creates a new RendezvousRing. Being a service, RendezvousRing needs to be started to do anything.
+func NewRendezvousRing(cfg Config, name, key string, logger log.Logger, reg prometheus.Registerer) (*RendezvousRing, error) {
+	// Suffix all client names with "-ring" to denote this kv client is used by the ring
+	store, err := kv.NewClient(
+		cfg.KVStore,
+		GetCodec(),
+		kv.RegistererWithKVName(reg, name+"-ring"),
+		logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRendezvousRingWithStoreClientAndStrategy(cfg, name, key, store, NewDefaultReplicationStrategy(), logger)
+}
+
+func NewRendezvousRingWithStoreClientAndStrategy(cfg Config, name, key string, store kv.Client, strategy ReplicationStrategy, logger log.Logger) (*RendezvousRing, error) {
+	if cfg.ReplicationFactor <= 0 {
+		return nil, fmt.Errorf("ReplicationFactor must be greater than zero: %d", cfg.ReplicationFactor)
+	}
+
+	r := newRendezvousRing(cfg, strategy, &Desc{})
+	r.key = key
+	r.KVClient = store
+	r.logger = logger
+	r.shuffledSubringCache = map[subringCacheKey]*RendezvousRing{}
+	r.shuffledSubringWithLookbackCache = map[subringCacheKey]cachedSubringWithLookback[*RendezvousRing]{}
+	r.Service = services.NewBasicService(r.starting, r.loop, nil).WithName(fmt.Sprintf("%s rendezvous ring client", name))
+	return r, nil
+}
+
+// newRendezvousRing returns a RendezvousRing for the given ring, which is not updated in the future.
+func newRendezvousRing(cfg Config, strategy ReplicationStrategy, ringDesc *Desc) *RendezvousRing {
+	r := &RendezvousRing{
+		cfg:      cfg,
+		strategy: strategy,
+		logger:   log.NewNopLogger(),
+	}
+	r.setRingStateFromDesc(ringDesc)
+	return r
+}
+
+func (r *RendezvousRing) starting(ctx context.Context) error {
+	value, err := r.KVClient.Get(ctx, r.key)
+	if err != nil {
+		return errors.Wrap(err, "unable to initialise ring state")
+	}
+	if value != nil {
+		r.updateRingState(value.(*Desc))
+	} else {
+		level.Info(r.logger).Log("msg", "ring doesn't exist in KV store yet")
+	}
+	return nil
+}
+
+func (r *RendezvousRing) loop(ctx context.Context) error {
+	r.KVClient.WatchKey(ctx, r.key, func(value interface{}) bool {
+		if value == nil {
+			level.Info(r.logger).Log("msg", "ring doesn't exist in KV store yet")
+			return true
+		}
+
+		r.updateRingState(value.(*Desc))
+		return true
+	})
+	return nil
+}
+
+func (r *RendezvousRing) updateRingState(ringDesc *Desc) {
+	r.mtx.RLock()
+	prevRing := r.ringDesc
+	r.mtx.RUnlock()
+
+	// Filter out all instances belonging to excluded zones.
+	if len(r.cfg.ExcludedZones) > 0 {
+		for instanceID, instance := range ringDesc.Ingesters {
+			if slices.Contains(r.cfg.ExcludedZones, instance.Zone) {
+				delete(ringDesc.Ingesters, instanceID)
+			}
+		}
+	}
+	ringDesc.setInstanceIDs()
+
+	rc := prevRing.RingCompare(ringDesc)
+	if rc == Equal || rc == EqualButStatesAndTimestamps {
+		// The placement of keys only depends on the instance IDs, zones and weights, which didn't change.
+		r.mtx.Lock()
+		r.ringDesc = ringDesc
+		r.mtx.Unlock()
+		return
+	}
+
+	r.setRingStateFromDesc(ringDesc)
+}
+
+func (r *RendezvousRing) setRingStateFromDesc(ringDesc *Desc) {
+	instances := make([]rendezvousInstance, 0, len(ringDesc.Ingesters))
+	instancesCountPerZone := map[string]int{}
+	writableInstancesCountPerZone := map[string]int{}
+	writableInstancesCount := 0
+	weighted := false
+	for id, instance := range ringDesc.Ingesters {
+		weight := instance.GetEffectiveWeight()
+		instances = append(instances, rendezvousInstance{id: id, zone: instance.Zone, hash: xxhash.Sum64String(id), weight: weight})
+		weighted = weighted || weight != 1
+
+		instancesCountPerZone[instance.Zone]++
+		if !instance.ReadOnly {
+			writableInstancesCount++
+			writableInstancesCountPerZone[instance.Zone]++
+		}
+	}
+	slices.SortFunc(instances, func(a, b rendezvousInstance) int {
+		return strings.Compare(a.id, b.id)
+	})
+	ringZones := make([]string, 0, len(instancesCountPerZone))
+	for zone := range instancesCountPerZone {
+		ringZones = append(ringZones, zone)
+	}
+	slices.Sort(ringZones)
+	instancesPerZone := make(map[string][]rendezvousInstance, len(ringZones))
+	for _, instance := range instances {
+		if instancesPerZone[instance.zone] == nil {
+			instancesPerZone[instance.zone] = make([]rendezvousInstance, 0, instancesCountPerZone[instance.zone])
+		}
+		instancesPerZone[instance.zone] = append(instancesPerZone[instance.zone], instance)
+	}
+	oldestRegisteredTimestamp := ringDesc.getOldestRegisteredTimestamp()
+	readOnlyInstances, oldestReadOnlyUpdatedTime := ringDesc.readOnlyInstancesAndOldestReadOnlyUpdatedTimestamp()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.ringDesc = ringDesc
+	r.instances = instances
+	r.instancesPerZone = instancesPerZone
+	r.weighted = weighted
+	r.ringZones = ringZones
+	r.instancesCountPerZone = instancesCountPerZone
+	r.writableInstancesCount = writableInstancesCount
+	r.writableInstancesCountPerZone = writableInstancesCountPerZone
+	r.oldestRegisteredTimestamp = oldestRegisteredTimestamp
+	r.readOnlyInstances = readOnlyInstances
+	r.oldestReadOnlyUpdatedTime = oldestReadOnlyUpdatedTime
+	r.lastTopologyChange = time.Now()
+
+	// Invalidate all cached subrings.
+	if r.shuffledSubringCache != nil {
+		r.shuffledSubringCache = make(map[subringCacheKey]*RendezvousRing)
+	}
+	if r.shuffledSubringWithLookbackCache != nil {
+		r.shuffledSubringWithLookbackCache = make(map[subringCacheKey]cachedSubringWithLookback[*RendezvousRing])
+	}
+}
+
+// Get implements ReadRing. bufHosts and bufZones are unused.
+func (r *RendezvousRing) Get(key uint32, op Operation, bufDescs []InstanceDesc, _, _ []string) (ReplicationSet, error) {
+	return r.getReplicationSetForKey(key, op, bufDescs, r.cfg.ReplicationFactor, ConsistencyLevelDefault)
+}
+
+// GetReplicas implements DoBatchReplicasRing. bufHosts is unused.
+func (r *RendezvousRing) GetReplicas(key uint32, op Operation, bufDescs []InstanceDesc, _ []string) ([]InstanceDesc, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if len(r.instances) == 0 {
+		return nil, ErrEmptyRing
+	}
+	return r.findInstancesForKey(key, op, bufDescs, r.cfg.ReplicationFactor), nil
+}
+
+// GetWithOptions implements ReadRing.
+func (r *RendezvousRing) GetWithOptions(key uint32, op Operation, opts ...Option) (ReplicationSet, error) {
+	options := collectOptions(opts...)
+	return r.getReplicationSetForKey(key, op, options.BufDescs, options.ReplicationFactor, options.ConsistencyLevel)
+}
+
+func (r *RendezvousRing) getReplicationSetForKey(key uint32, op Operation, bufDescs []InstanceDesc, replicationFactor int, level ConsistencyLevel) (ReplicationSet, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if len(r.instances) == 0 {
+		return ReplicationSet{}, ErrEmptyRing
+	}
+
+	if replicationFactor <= 0 || replicationFactor < r.cfg.ReplicationFactor {
+		replicationFactor = r.cfg.ReplicationFactor
+	}
+	if replicationFactor > r.cfg.ReplicationFactor && !r.strategy.SupportsExpandedReplication() {
+		return ReplicationSet{}, fmt.Errorf("per-call replication factor %d cannot exceed the configured replication factor %d with this replication strategy", replicationFactor, r.cfg.ReplicationFactor)
+	}
+
+	instances := r.findInstancesForKey(key, op, bufDescs, replicationFactor)
+	return filterInstances(r.strategy, instances, op, replicationFactor, r.cfg.HeartbeatTimeout, r.cfg.ZoneAwarenessEnabled, level)
+}
+
+// findInstancesForKey returns the instances for the given key and operation, selected with the same rules
+// of Ring.findInstancesForKey, but iterating the instances by decreasing score instead of walking the tokens.
+// This function needs to be called with read lock on the ring.
+func (r *RendezvousRing) findInstancesForKey(key uint32, op Operation, bufDescs []InstanceDesc, replicationFactor int) []InstanceDesc {
+	var (
+		n                    = replicationFactor
+		instances            = bufDescs[:0]
+		found                = 0
+		examinedHostsPerZone = make(map[string]int)
+		foundHostsPerZone    = make(map[string]int)
+		targetHostsPerZone   = max(1, replicationFactor/r.cfg.ReplicationFactor)
+	)
+
+	ranking := rankInstances(r.instances, uint64(key), r.weighted)
+	defer ranking.release()
+
+	for candidate, ok := ranking.next(); ok; candidate, ok = ranking.next() {
+		if found >= n {
+			break
+		}
+		if r.cfg.ZoneAwarenessEnabled && r.canStopLooking(foundHostsPerZone, examinedHostsPerZone, targetHostsPerZone) {
+			break
+		}
+
+		if r.cfg.ZoneAwarenessEnabled && candidate.zone != "" {
+			// If we already have the required number of instances for this zone, skip.
+			if foundHostsPerZone[candidate.zone] >= targetHostsPerZone {
+				continue
+			}
+			examinedHostsPerZone[candidate.zone]++
+		}
+
+		found++
+		instance := r.ringDesc.Ingesters[candidate.id]
+
+		// Check whether the replica set should be extended given we're including this instance.
+		if op.ShouldExtendReplicaSetOnState(instance.State) {
+			n++
+		} else if r.cfg.ZoneAwarenessEnabled && candidate.zone != "" {
+			foundHostsPerZone[candidate.zone]++
+		}
+
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// canStopLooking returns true if we have enough hosts for the replication factor
+// or if we have looked at all hosts, for all zones. This method assumes that the
+// lock for ring state is held.
+func (r *RendezvousRing) canStopLooking(foundPerZone map[string]int, examinedPerZone map[string]int, targetPerZone int) bool {
+	for zone, total := range r.instancesCountPerZone {
+		if foundPerZone[zone] < targetPerZone && examinedPerZone[zone] < total {
+			return false
+		}
+	}
+	return true
+}
+
+// rendezvousRanking returns instances by decreasing score, using a heap so that only the instances actually
+// examined are sorted. Rankings are pooled to avoid allocating on every lookup.
+type rendezvousRanking struct {
+	scored []scoredRendezvousInstance
+}
+
+var rendezvousRankingPool = sync.Pool{
+	New: func() any {
+		return &rendezvousRanking{}
+	},
+}
+
+// rankInstances returns a ranking of the given instances for the given key. The ranking must be released once done.
+func rankInstances(instances []rendezvousInstance, key uint64, weighted bool) *rendezvousRanking {
+	ranking := rendezvousRankingPool.Get().(*rendezvousRanking)
+	for _, instance := range instances {
+		ranking.scored = append(ranking.scored, scoredRendezvousInstance{rendezvousInstance: instance, score: rendezvousScore(instance.hash, key, instance.weight, weighted)})
+	}
+	for i := len(ranking.scored)/2 - 1; i >= 0; i-- {
+		ranking.down(i)
+	}
+	return ranking
+}
+
+// next returns the instance with the highest score among the ones not returned yet, if any.
+func (r *rendezvousRanking) next() (rendezvousInstance, bool) {
+	n := len(r.scored)
+	if n == 0 {
+		return rendezvousInstance{}, false
+	}
+
+	top := r.scored[0]
+	r.scored[0] = r.scored[n-1]
+	r.scored = r.scored[:n-1]
+	r.down(0)
+	return top.rendezvousInstance, true
+}
+
+func (r *rendezvousRanking) release() {
+	r.scored = r.scored[:0]
+	rendezvousRankingPool.Put(r)
+}
+
+// down moves the instance at index i down the heap until both its children rank after it.
+func (r *rendezvousRanking) down(i int) {
+	for {
+		first := i
+		if left := 2*i + 1; left < len(r.scored) && r.before(left, first) {
+			first = left
+		}
+		if right := 2*i + 2; right < len(r.scored) && r.before(right, first) {
+			first = right
+		}
+		if first == i {
+			return
+		}
+		r.scored[i], r.scored[first] = r.scored[first], r.scored[i]
+		i = first
+	}
+}
+
+// before returns whether the instance at index i ranks before the one at index j: by decreasing score, then by ID.
+func (r *rendezvousRanking) before(i, j int) bool {
+	a, b := &r.scored[i], &r.scored[j]
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.id < b.id
+}
+
+// rendezvousScore returns the score of an instance for a key. For weighted rings the score is
+// weight / -ln(h), where h is the hash of the instance and the key mapped to (0, 1), so that the
+// probability for an instance to get the highest score is proportional to its weight. Since the
+// score is monotonic in h, unweighted rings compare the hashes directly.
+func rendezvousScore(instanceHash, key uint64, weight uint32, weighted bool) float64 {
+	h := mixHash(instanceHash^key) >> 11
+	if !weighted {
+		return float64(h)
+	}
+	u := (float64(h) + 0.5) / (1 << 53)
+	return float64(weight) / -math.Log(u)
+}
+
+// mixHash is the 64-bit finalizer of MurmurHash3.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// GetAllHealthy implements ReadRing.
+func (r *RendezvousRing) GetAllHealthy(op Operation) (ReplicationSet, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if len(r.instances) == 0 {
+		return ReplicationSet{}, ErrEmptyRing
+	}
+
+	now := time.Now()
+	instances := make([]InstanceDesc, 0, len(r.ringDesc.Ingesters))
+	for _, instance := range r.ringDesc.Ingesters {
+		if instance.IsHealthy(op, r.cfg.HeartbeatTimeout, now) {
+			instances = append(instances, instance)
+		}
+	}
+
+	return ReplicationSet{
+		Instances: instances,
+		MaxErrors: 0,
+	}, nil
+}
+
+// GetReplicationSetForOperation implements ReadRing.
+func (r *RendezvousRing) GetReplicationSetForOperation(op Operation) (ReplicationSet, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if len(r.instances) == 0 {
+		return ReplicationSet{}, ErrEmptyRing
+	}
+
+	return getReplicationSetForOperation(r.ringDesc.Ingesters, len(r.ringZones), op, r.cfg)
+}
+
+// ReplicationFactor implements ReadRing.
+func (r *RendezvousRing) ReplicationFactor() int {
+	return r.cfg.ReplicationFactor
+}
+
+// ShuffleShard implements ReadRing. Instances of each zone are selected by decreasing score for a key
+// derived from the identifier and the zone, hence adding or removing 1 instance from the ring generates
+// a resulting subring with no more than 1 difference.
+//
+// Subring returned by this method does not contain instances that have read-only field set.
+func (r *RendezvousRing) ShuffleShard(identifier string, size int) ReadRing {
+	if cached := r.getCachedShuffledSubring(identifier, size); cached != nil {
+		return cached
+	}
+
+	var result *RendezvousRing
+	if size <= 0 || r.shardContainsAllInstances(size) {
+		result = r.filterOutReadOnlyInstances(0, time.Now())
+	} else {
+		result = r.shuffleShard(identifier, size, 0, time.Now())
+	}
+	if result != r {
+		r.setCachedShuffledSubring(identifier, size, result)
+	}
+	return result
+}
+
+// ShuffleShardWithLookback implements ReadRing, with the same semantics of Ring.ShuffleShardWithLookback.
+func (r *RendezvousRing) ShuffleShardWithLookback(identifier string, size int, lookbackPeriod time.Duration, now time.Time) ReadRing {
+	if cached := r.getCachedShuffledSubringWithLookback(identifier, size, lookbackPeriod, now); cached != nil {
+		return cached
+	}
+
+	var result *RendezvousRing
+	if size <= 0 || r.shardContainsAllInstances(size) {
+		result = r.filterOutReadOnlyInstances(lookbackPeriod, now)
+	} else {
+		result = r.shuffleShard(identifier, size, lookbackPeriod, now)
+	}
+	if result != r {
+		r.setCachedShuffledSubringWithLookback(identifier, size, lookbackPeriod, now, result)
+	}
+	return result
+}
+
+// shardContainsAllInstances returns whether a shard of the given size selects all the instances of the ring, so
+// that it only needs to filter out read-only instances.
+func (r *RendezvousRing) shardContainsAllInstances(size int) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if size < len(r.instances) {
+		return false
+	}
+	if !r.cfg.ZoneAwarenessEnabled {
+		return true
+	}
+
+	// Zones are not necessarily balanced, so each zone must fit in its share of the shard.
+	numInstancesPerZone := shardUtil.ShuffleShardExpectedInstancesPerZone(size, len(r.ringZones))
+	for _, count := range r.instancesCountPerZone {
+		if count > numInstancesPerZone {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *RendezvousRing) shuffleShard(identifier string, size int, lookbackPeriod time.Duration, now time.Time) *RendezvousRing {
+	lookbackUntil := now.Add(-lookbackPeriod).Unix()
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	// If all instances have been registered within the lookback period, they're all part of the subring.
+	if lookbackPeriod > 0 && r.oldestRegisteredTimestamp > 0 && r.oldestRegisteredTimestamp >= lookbackUntil {
+		return r
+	}
+
+	var numInstancesPerZone int
+	var actualZones []string
+	if r.cfg.ZoneAwarenessEnabled {
+		numInstancesPerZone = shardUtil.ShuffleShardExpectedInstancesPerZone(size, len(r.ringZones))
+		actualZones = r.ringZones
+	} else {
+		numInstancesPerZone = size
+		actualZones = []string{""}
+	}
+
+	shard := make(map[string]InstanceDesc, min(len(r.ringDesc.Ingesters), size))
+	for _, zone := range actualZones {
+		candidates := r.instances
+		if r.cfg.ZoneAwarenessEnabled {
+			candidates = r.instancesPerZone[zone]
+		}
+
+		selected := 0
+		ranking := rankInstances(candidates, uint64(shardUtil.ShuffleShardSeed(identifier, zone)), r.weighted)
+		for candidate, ok := ranking.next(); ok; candidate, ok = ranking.next() {
+			if selected >= numInstancesPerZone {
+				break
+			}
+
+			instance := r.ringDesc.Ingesters[candidate.id]
+			if !shouldIncludeReadonlyInstanceInTheShard(instance, lookbackPeriod, lookbackUntil) {
+				continue
+			}
+			shard[candidate.id] = instance
+
+			// Instances registered, or that switched their read-only state, within the lookback period are
+			// included in the subring, but don't count towards its size: see Ring.shuffleShard().
+			if lookbackPeriod > 0 && instance.RegisteredTimestamp >= lookbackUntil {
+				continue
+			}
+			if lookbackPeriod > 0 && (instance.ReadOnly || instance.ReadOnlyUpdatedTimestamp >= lookbackUntil) {
+				continue
+			}
+			selected++
+		}
+		ranking.release()
+	}
+
+	return r.buildRingForTheShard(shard)
+}
+
+// filterOutReadOnlyInstances removes all read-only instances from the ring, and returns the resulting ring.
+func (r *RendezvousRing) filterOutReadOnlyInstances(lookbackPeriod time.Duration, now time.Time) *RendezvousRing {
+	lookbackUntil := now.Add(-lookbackPeriod).Unix()
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.readOnlyInstances == 0 {
+		return r
+	}
+	if lookbackPeriod > 0 && r.oldestReadOnlyUpdatedTime >= lookbackUntil {
+		return r
+	}
+
+	shard := make(map[string]InstanceDesc, len(r.ringDesc.Ingesters))
+	for id, instance := range r.ringDesc.Ingesters {
+		if shouldIncludeReadonlyInstanceInTheShard(instance, lookbackPeriod, lookbackUntil) {
+			shard[id] = instance
+		}
+	}
+	return r.buildRingForTheShard(shard)
+}
+
+// buildRingForTheShard builds read-only ring for the shard (this ring won't be updated in the future).
+func (r *RendezvousRing) buildRingForTheShard(shard map[string]InstanceDesc) *RendezvousRing {
+	subring := newRendezvousRing(r.cfg, r.strategy, &Desc{Ingesters: shard})
+	// For caching to work, remember the topology of the parent ring.
+	subring.lastTopologyChange = r.lastTopologyChange
+	return subring
+}
+
+func (r *RendezvousRing) getCachedShuffledSubring(identifier string, size int) *RendezvousRing {
+	if r.cfg.SubringCacheDisabled {
+		return nil
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	cached := r.shuffledSubringCache[subringCacheKey{identifier: identifier, shardSize: size}]
+	if cached == nil {
+		return nil
+	}
+	r.refreshCachedSubring(cached)
+	return cached
+}
+
+func (r *RendezvousRing) setCachedShuffledSubring(identifier string, size int, subring *RendezvousRing) {
+	if subring == nil || r.cfg.SubringCacheDisabled {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// Only cache if *this* ring hasn't changed since computing result.
+	if r.shuffledSubringCache != nil && r.lastTopologyChange.Equal(subring.lastTopologyChange) {
+		r.shuffledSubringCache[subringCacheKey{identifier: identifier, shardSize: size}] = subring
+	}
+}
+
+func (r *RendezvousRing) getCachedShuffledSubringWithLookback(identifier string, size int, lookbackPeriod time.Duration, now time.Time) *RendezvousRing {
+	if r.cfg.SubringCacheDisabled {
+		return nil
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	cached, ok := r.shuffledSubringWithLookbackCache[subringCacheKey{identifier: identifier, shardSize: size, lookbackPeriod: lookbackPeriod}]
+	if !ok {
+		return nil
+	}
+
+	lookbackWindowStart := now.Add(-lookbackPeriod).Unix()
+	if lookbackWindowStart < cached.validForLookbackWindowsStartingAfter || lookbackWindowStart > cached.validForLookbackWindowsStartingBefore {
+		return nil
+	}
+	r.refreshCachedSubring(cached.subring)
+	return cached.subring
+}
+
+func (r *RendezvousRing) setCachedShuffledSubringWithLookback(identifier string, size int, lookbackPeriod time.Duration, now time.Time, subring *RendezvousRing) {
+	if subring == nil || r.cfg.SubringCacheDisabled {
+		return
+	}
+
+	lookbackWindowStart := now.Add(-lookbackPeriod).Unix()
+	validForLookbackWindowsStartingBefore := int64(math.MaxInt64)
+	for _, instance := range subring.ringDesc.Ingesters {
+		if instance.RegisteredTimestamp >= lookbackWindowStart && instance.RegisteredTimestamp < validForLookbackWindowsStartingBefore {
+			validForLookbackWindowsStartingBefore = instance.RegisteredTimestamp
+		}
+		if instance.ReadOnlyUpdatedTimestamp >= lookbackWindowStart && instance.ReadOnlyUpdatedTimestamp < validForLookbackWindowsStartingBefore {
+			validForLookbackWindowsStartingBefore = instance.ReadOnlyUpdatedTimestamp
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.shuffledSubringWithLookbackCache == nil || !r.lastTopologyChange.Equal(subring.lastTopologyChange) {
+		return
+	}
+
+	key := subringCacheKey{identifier: identifier, shardSize: size, lookbackPeriod: lookbackPeriod}
+	if existingEntry, haveCached := r.shuffledSubringWithLookbackCache[key]; !haveCached || existingEntry.validForLookbackWindowsStartingAfter < lookbackWindowStart {
+		r.shuffledSubringWithLookbackCache[key] = cachedSubringWithLookback[*RendezvousRing]{
+			subring:                               subring,
+			validForLookbackWindowsStartingAfter:  lookbackWindowStart,
+			validForLookbackWindowsStartingBefore: validForLookbackWindowsStartingBefore,
+		}
+	}
+}
+
+// refreshCachedSubring updates the states and timestamps of the instances of the given cached subring.
+// The topology is the same, so the placement of keys didn't change. This method assumes that the read
+// lock for ring state is held.
+func (r *RendezvousRing) refreshCachedSubring(cached *RendezvousRing) {
+	if cached == r {
+		return
+	}
+
+	cached.mtx.Lock()
+	defer cached.mtx.Unlock()
+
+	for id, cachedInstance := range cached.ringDesc.Ingesters {
+		instance := r.ringDesc.Ingesters[id]
+		cachedInstance.State = instance.State
+		cachedInstance.Timestamp = instance.Timestamp
+		cached.ringDesc.Ingesters[id] = cachedInstance
+	}
+}
+
+// CleanupShuffleShardCache implements ReadRing.
+func (r *RendezvousRing) CleanupShuffleShardCache(identifier string) {
+	if r.cfg.SubringCacheDisabled {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for k := range r.shuffledSubringCache {
+		if k.identifier == identifier {
+			delete(r.shuffledSubringCache, k)
+		}
+	}
+	for k := range r.shuffledSubringWithLookbackCache {
+		if k.identifier == identifier {
+			delete(r.shuffledSubringWithLookbackCache, k)
+		}
+	}
+}
+
+// GetInstance return the InstanceDesc for the given instanceID or an error
+// if the instance doesn't exist in the ring. The returned InstanceDesc is NOT a
+// deep copy, so the caller should never modify it.
+func (r *RendezvousRing) GetInstance(instanceID string) (doNotModify InstanceDesc, _ error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	instance, ok := r.ringDesc.GetIngesters()[instanceID]
+	if !ok {
+		return InstanceDesc{}, ErrInstanceNotFound
+	}
+	return instance, nil
+}
+
+// GetInstanceState implements ReadRing.
+func (r *RendezvousRing) GetInstanceState(instanceID string) (InstanceState, error) {
+	instance, err := r.GetInstance(instanceID)
+	if err != nil {
+		return PENDING, err
+	}
+	return instance.GetState(), nil
+}
+
+// HasInstance implements ReadRing.
+func (r *RendezvousRing) HasInstance(instanceID string) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	_, ok := r.ringDesc.GetIngesters()[instanceID]
+	return ok
+}
+
+// GetTokenRangesForInstance implements ReadRing. It always returns an error, because keys owned by an
+// instance of a RendezvousRing can't be expressed as token ranges.
+func (r *RendezvousRing) GetTokenRangesForInstance(_ string) (TokenRanges, error) {
+	return nil, errTokenRangesNotSupported
+}
+
+// InstancesCount implements ReadRing.
+func (r *RendezvousRing) InstancesCount() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return len(r.instances)
+}
+
+// InstancesWithTokensCount implements ReadRing. All the instances are counted, regardless of their tokens.
+func (r *RendezvousRing) InstancesWithTokensCount() int {
+	return r.InstancesCount()
+}
+
+// InstancesInZoneCount implements ReadRing.
+func (r *RendezvousRing) InstancesInZoneCount(zone string) int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.instancesCountPerZone[zone]
+}
+
+// InstancesWithTokensInZoneCount implements ReadRing. All the instances are counted, regardless of their tokens.
+func (r *RendezvousRing) InstancesWithTokensInZoneCount(zone string) int {
+	return r.InstancesInZoneCount(zone)
+}
+
+// WritableInstancesWithTokensCount implements ReadRing. All the writable instances are counted, regardless of their tokens.
+func (r *RendezvousRing) WritableInstancesWithTokensCount() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.writableInstancesCount
+}
+
+// WritableInstancesWithTokensInZoneCount implements ReadRing. All the writable instances are counted, regardless of their tokens.
+func (r *RendezvousRing) WritableInstancesWithTokensInZoneCount(zone string) int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.writableInstancesCountPerZone[zone]
+}
+
+// ZonesCount implements ReadRing.
+func (r *RendezvousRing) ZonesCount() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return len(r.ringZones)
+}
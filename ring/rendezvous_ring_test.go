@@ -0,0 +1,373 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+)
+
+var _ ReadRing = (*RendezvousRing)(nil)
+
+func newRendezvousRingForTesting(cfg Config, desc *Desc) *RendezvousRing {
+	r := newRendezvousRing(cfg, NewDefaultReplicationStrategy(), desc)
+	r.shuffledSubringCache = map[subringCacheKey]*RendezvousRing{}
+	r.shuffledSubringWithLookbackCache = map[subringCacheKey]cachedSubringWithLookback[*RendezvousRing]{}
+	return r
+}
+
+// generateTokenlessRing returns a ring with the given number of instances per zone, registered without tokens.
+func generateTokenlessRing(zones []string, instancesPerZone int, registeredAt time.Time) *Desc {
+	desc := NewDesc()
+	for _, zone := range zones {
+		for i := 0; i < instancesPerZone; i++ {
+			id := fmt.Sprintf("instance-%d-%s", i, zone)
+			desc.AddIngester(id, id, zone, nil, ACTIVE, registeredAt, false, time.Time{}, 0)
+		}
+	}
+	return desc
+}
+
+func TestRendezvousRing_Get_ZoneAwareness(t *testing.T) {
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+	r := newRendezvousRingForTesting(Config{ReplicationFactor: 3, ZoneAwarenessEnabled: true, HeartbeatTimeout: time.Minute}, generateTokenlessRing(zones, 5, time.Now()))
+
+	bufDescs, bufHosts, bufZones := MakeBuffersForGet()
+	keysPerInstance := map[string]int{}
+	for key := uint32(0); key < 10000; key++ {
+		set, err := r.Get(key*7919, Write, bufDescs, bufHosts, bufZones)
+		require.NoError(t, err)
+		require.Len(t, set.Instances, 3)
+		require.Equal(t, 1, set.MaxErrors)
+		var setZones []string
+		for _, instance := range set.Instances {
+			setZones = append(setZones, instance.Zone)
+		}
+		require.ElementsMatch(t, zones, setZones)
+
+		for _, instance := range set.Instances {
+			keysPerInstance[instance.Id]++
+		}
+
+		// The placement is deterministic.
+		again, err := r.Get(key*7919, Write, nil, nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, set.GetIDs(), again.GetIDs())
+	}
+
+	// Keys are evenly spread across the instances of each zone.
+	require.Len(t, keysPerInstance, 15)
+	for id, keys := range keysPerInstance {
+		assert.InDelta(t, 2000, keys, 200, id)
+	}
+}
+
+func TestRendezvousRing_Get_StableUnderChurn(t *testing.T) {
+	const (
+		numKeys      = 10000
+		numInstances = 10
+	)
+	cfg := Config{ReplicationFactor: 1}
+	desc := generateTokenlessRing([]string{""}, numInstances, time.Now())
+
+	lookup := func(r *RendezvousRing) []string {
+		owners := make([]string, numKeys)
+		for key := range owners {
+			set, err := r.Get(uint32(key)*65537, Write, nil, nil, nil)
+			require.NoError(t, err)
+			owners[key] = set.Instances[0].Id
+		}
+		return owners
+	}
+	before := lookup(newRendezvousRingForTesting(cfg, desc))
+
+	// Only the keys moving to the new instance change owner.
+	joined := desc.Clone().(*Desc)
+	joined.AddIngester("new", "new", "", nil, ACTIVE, time.Now(), false, time.Time{}, 0)
+	after := lookup(newRendezvousRingForTesting(cfg, joined))
+	moved := 0
+	for key := range before {
+		if before[key] != after[key] {
+			require.Equal(t, "new", after[key])
+			moved++
+		}
+	}
+	assert.InDelta(t, numKeys/(numInstances+1), moved, numKeys/(numInstances+1)/5)
+
+	// Only the keys owned by the leaving instance change owner.
+	left := desc.Clone().(*Desc)
+	left.RemoveIngester("instance-3-")
+	after = lookup(newRendezvousRingForTesting(cfg, left))
+	for key := range before {
+		if before[key] != "instance-3-" {
+			require.Equal(t, before[key], after[key])
+		}
+	}
+}
+
+func TestRendezvousRing_Get_Weights(t *testing.T) {
+	desc := generateTokenlessRing([]string{""}, 4, time.Now())
+	desc.AddIngester("instance-0-", "instance-0-", "", nil, ACTIVE, time.Now(), false, time.Time{}, 3)
+	r := newRendezvousRingForTesting(Config{ReplicationFactor: 1}, desc)
+
+	keysPerInstance := map[string]int{}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 60000; i++ {
+		set, err := r.Get(random.Uint32(), Write, nil, nil, nil)
+		require.NoError(t, err)
+		keysPerInstance[set.Instances[0].Id]++
+	}
+
+	// The instance with weight 3 owns half of the keys.
+	assert.InDelta(t, 30000, keysPerInstance["instance-0-"], 1000)
+	for _, id := range []string{"instance-1-", "instance-2-", "instance-3-"} {
+		assert.InDelta(t, 10000, keysPerInstance[id], 1000, id)
+	}
+}
+
+func TestRendezvousRing_Get_OperationHealth(t *testing.T) {
+	now := time.Now()
+	desc := generateTokenlessRing([]string{""}, 5, now)
+	r := newRendezvousRingForTesting(Config{ReplicationFactor: 3, HeartbeatTimeout: time.Minute}, desc)
+
+	// Find a key replicated to instance-0.
+	var key uint32
+	for ; ; key++ {
+		set, err := r.Get(key, Write, nil, nil, nil)
+		require.NoError(t, err)
+		if set.Includes("instance-0-") {
+			break
+		}
+	}
+
+	t.Run("replica set is extended on JOINING instances", func(t *testing.T) {
+		joining := desc.Clone().(*Desc)
+		instance := joining.Ingesters["instance-0-"]
+		instance.State = JOINING
+		joining.Ingesters["instance-0-"] = instance
+
+		set, err := newRendezvousRingForTesting(r.cfg, joining).Get(key, Write, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, set.Instances, 3)
+		require.False(t, set.Includes("instance-0-"))
+		require.Equal(t, 0, set.MaxErrors)
+
+		// Without extension, the JOINING instance is filtered out of the replica set.
+		set, err = newRendezvousRingForTesting(r.cfg, joining).Get(key, WriteNoExtend, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, set.Instances, 2)
+		require.Equal(t, 0, set.MaxErrors)
+	})
+
+	t.Run("unhealthy instances are filtered out", func(t *testing.T) {
+		unhealthy := desc.Clone().(*Desc)
+		instance := unhealthy.Ingesters["instance-0-"]
+		instance.Timestamp = now.Add(-time.Hour).Unix()
+		unhealthy.Ingesters["instance-0-"] = instance
+
+		set, err := newRendezvousRingForTesting(r.cfg, unhealthy).Get(key, Write, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, set.Instances, 2)
+		require.False(t, set.Includes("instance-0-"))
+	})
+
+	t.Run("empty ring", func(t *testing.T) {
+		_, err := newRendezvousRingForTesting(r.cfg, NewDesc()).Get(key, Write, nil, nil, nil)
+		require.ErrorIs(t, err, ErrEmptyRing)
+	})
+}
+
+func TestRendezvousRing_ShuffleShard(t *testing.T) {
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+	registeredAt := time.Now().Add(-2 * time.Hour)
+	desc := generateTokenlessRing(zones, 10, registeredAt)
+	cfg := Config{ReplicationFactor: 3, ZoneAwarenessEnabled: true}
+	r := newRendezvousRingForTesting(cfg, desc)
+
+	shardIDs := func(subring ReadRing) []string {
+		var ids []string
+		for id := range desc.Ingesters {
+			if subring.HasInstance(id) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	subring := r.ShuffleShard("tenant", 6)
+	require.Equal(t, 6, subring.InstancesCount())
+	for _, zone := range zones {
+		require.Equal(t, 2, subring.InstancesInZoneCount(zone))
+	}
+	before := shardIDs(subring)
+
+	// Subrings are cached, and the same identifier always gets the same instances.
+	require.Same(t, subring, r.ShuffleShard("tenant", 6))
+	require.Equal(t, before, shardIDs(newRendezvousRingForTesting(cfg, desc.Clone().(*Desc)).ShuffleShard("tenant", 6)))
+	require.NotEqual(t, before, shardIDs(r.ShuffleShard("other-tenant", 6)))
+
+	// Keys of the subring are placed on the instances of the shard.
+	set, err := subring.Get(12345, Write, nil, nil, nil)
+	require.NoError(t, err)
+	require.Subset(t, before, set.GetIDs())
+
+	// Adding an instance changes at most 1 instance of the shard.
+	joined := desc.Clone().(*Desc)
+	joined.AddIngester("new", "new", "zone-a", nil, ACTIVE, registeredAt, false, time.Time{}, 0)
+	after := shardIDs(newRendezvousRingForTesting(cfg, joined).ShuffleShard("tenant", 6))
+	require.Len(t, after, 6)
+	diff := 0
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			diff++
+		}
+	}
+	require.LessOrEqual(t, diff, 1)
+
+	t.Run("read-only instances are excluded", func(t *testing.T) {
+		readOnly := desc.Clone().(*Desc)
+		instance := readOnly.Ingesters[before[0]]
+		instance.ReadOnly = true
+		instance.ReadOnlyUpdatedTimestamp = time.Now().Add(-30 * time.Minute).Unix()
+		readOnly.Ingesters[before[0]] = instance
+
+		ro := newRendezvousRingForTesting(cfg, readOnly)
+		subring := ro.ShuffleShard("tenant", 6)
+		require.Equal(t, 6, subring.InstancesCount())
+		require.False(t, subring.HasInstance(before[0]))
+		require.Equal(t, 29, ro.ShuffleShard("tenant", 0).InstancesCount())
+		require.Equal(t, 29, ro.WritableInstancesWithTokensCount())
+
+		// Instances which switched to read-only within the lookback period are kept.
+		subring = ro.ShuffleShardWithLookback("tenant", 6, time.Hour, time.Now())
+		require.True(t, subring.HasInstance(before[0]))
+		require.Equal(t, 7, subring.InstancesCount())
+	})
+
+	t.Run("shard as large as the ring", func(t *testing.T) {
+		require.Same(t, r, r.ShuffleShard("tenant", 30))
+		require.Same(t, r, r.ShuffleShardWithLookback("tenant", 100, time.Hour, time.Now()))
+
+		// A shard can't contain all the instances of a zone larger than its share of the shard.
+		unbalanced := desc.Clone().(*Desc)
+		unbalanced.AddIngester("new-1", "new-1", "zone-a", nil, ACTIVE, registeredAt, false, time.Time{}, 0)
+		unbalanced.AddIngester("new-2", "new-2", "zone-a", nil, ACTIVE, registeredAt, false, time.Time{}, 0)
+		subring := newRendezvousRingForTesting(cfg, unbalanced).ShuffleShard("tenant", 32)
+		require.Equal(t, 11, subring.InstancesInZoneCount("zone-a"))
+	})
+
+	t.Run("lookback includes recently registered instances", func(t *testing.T) {
+		recent := desc.Clone().(*Desc)
+		recent.AddIngester("recent", "recent", "zone-a", nil, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+		withLookback := newRendezvousRingForTesting(cfg, recent).ShuffleShardWithLookback("tenant", 6, time.Hour, time.Now())
+		withoutLookback := newRendezvousRingForTesting(cfg, recent).ShuffleShard("tenant", 6)
+		if withoutLookback.HasInstance("recent") {
+			// The recent instance replaced an instance of the shard, which is kept with the lookback.
+			require.Equal(t, 7, withLookback.InstancesCount())
+		} else {
+			require.Equal(t, 6, withLookback.InstancesCount())
+		}
+		for _, id := range before {
+			require.True(t, withLookback.HasInstance(id))
+		}
+	})
+}
+
+func TestRankInstances(t *testing.T) {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, weighted := range []bool{false, true} {
+		instances := make([]rendezvousInstance, 50)
+		for i := range instances {
+			id := fmt.Sprintf("instance-%d", i)
+			instances[i] = rendezvousInstance{id: id, hash: rnd.Uint64(), weight: uint32(1 + rnd.Intn(3))}
+		}
+		key := rnd.Uint64()
+
+		// The ranking returns the instances sorted by decreasing score, then by ID.
+		expected := slices.Clone(instances)
+		slices.SortStableFunc(expected, func(a, b rendezvousInstance) int {
+			scoreA, scoreB := rendezvousScore(a.hash, key, a.weight, weighted), rendezvousScore(b.hash, key, b.weight, weighted)
+			switch {
+			case scoreA > scoreB:
+				return -1
+			case scoreA < scoreB:
+				return 1
+			}
+			return strings.Compare(a.id, b.id)
+		})
+
+		ranking := rankInstances(instances, key, weighted)
+		var actual []rendezvousInstance
+		for instance, ok := ranking.next(); ok; instance, ok = ranking.next() {
+			actual = append(actual, instance)
+		}
+		ranking.release()
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestRendezvousRing_Counts(t *testing.T) {
+	r := newRendezvousRingForTesting(Config{ReplicationFactor: 3, ZoneAwarenessEnabled: true}, generateTokenlessRing([]string{"zone-a", "zone-b"}, 3, time.Now()))
+
+	assert.Equal(t, 6, r.InstancesCount())
+	assert.Equal(t, 6, r.InstancesWithTokensCount())
+	assert.Equal(t, 3, r.InstancesInZoneCount("zone-a"))
+	assert.Equal(t, 3, r.InstancesWithTokensInZoneCount("zone-b"))
+	assert.Equal(t, 3, r.WritableInstancesWithTokensInZoneCount("zone-b"))
+	assert.Equal(t, 2, r.ZonesCount())
+	assert.Equal(t, 3, r.ReplicationFactor())
+
+	state, err := r.GetInstanceState("instance-0-zone-a")
+	require.NoError(t, err)
+	assert.Equal(t, ACTIVE, state)
+	_, err = r.GetInstanceState("unknown")
+	assert.ErrorIs(t, err, ErrInstanceNotFound)
+
+	_, err = r.GetTokenRangesForInstance("instance-0-zone-a")
+	assert.Error(t, err)
+
+	set, err := r.GetReplicationSetForOperation(Read)
+	require.NoError(t, err)
+	assert.Len(t, set.Instances, 6)
+	set, err = r.GetAllHealthy(Read)
+	require.NoError(t, err)
+	assert.Len(t, set.Instances, 6)
+}
+
+func TestRendezvousRing_WatchesKVStore(t *testing.T) {
+	ctx := context.Background()
+	store, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	r, err := NewRendezvousRingWithStoreClientAndStrategy(Config{ReplicationFactor: 1, HeartbeatTimeout: time.Minute}, "test", ringKey, store, NewDefaultReplicationStrategy(), log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, r))
+	t.Cleanup(func() { require.NoError(t, services.StopAndAwaitTerminated(ctx, r)) })
+
+	_, err = r.Get(1, Write, nil, nil, nil)
+	require.ErrorIs(t, err, ErrEmptyRing)
+
+	require.NoError(t, store.CAS(ctx, ringKey, func(interface{}) (interface{}, bool, error) {
+		return generateTokenlessRing([]string{""}, 3, time.Now()), true, nil
+	}))
+	test.Poll(t, time.Second, 3, func() interface{} {
+		return r.InstancesCount()
+	})
+
+	set, err := r.Get(1, Write, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, set.Instances, 1)
+}
@@ -15,6 +15,9 @@ import (
 	"github.com/grafana/dskit/spanlogger"
 )
 
+// errResultNotRequired is the cause of the cancellation of requests whose result is not needed to reach the quorum.
+var errResultNotRequired = errors.New("quorum reached, result not required from this instance")
+
 // ReplicationSet describes the instances to talk to for a given key, and how
 // many errors to tolerate.
 type ReplicationSet struct {
@@ -136,6 +139,13 @@ type DoUntilQuorumConfig struct {
 	// This can be used to prioritise zones that are more likely to succeed, or are expected to complete
 	// faster, for example.
 	ZoneSorter ZoneSorter
+
+	// InstanceScorer, if set, learns the latency and errors of instances from the requests made by DoUntilQuorum.
+	// When MinimizeRequests is true, DoUntilQuorum initiates requests to the instances or zones with the lowest
+	// score first, unless ZoneSorter is set and DoUntilQuorum is operating in zone-aware mode.
+	//
+	// The same InstanceScorer should be shared by the calls to DoUntilQuorum for the same ring.
+	InstanceScorer InstanceScorer
 }
 
 func (c DoUntilQuorumConfig) Validate() error {
@@ -184,9 +194,11 @@ func (c DoUntilQuorumConfig) Validate() error {
 // If cfg.ZoneSorter is non-nil and DoUntilQuorum is operating in zone-aware mode, DoUntilQuorum will initiate requests
 // to zones in the order returned by the sorter.
 //
-// If cfg.ZoneSorter is nil, or DoUntilQuorum is operating in non-zone-aware mode, DoUntilQuorum will randomly select
-// available zones / instances such that calling DoUntilQuorum multiple times with the same ReplicationSet should evenly
-// distribute requests across all zones / instances.
+// Otherwise, if cfg.InstanceScorer is non-nil, DoUntilQuorum will initiate requests to the zones / instances with the
+// lowest score first. A zone is scored as its instance with the highest score.
+//
+// Otherwise, DoUntilQuorum will randomly select available zones / instances such that calling DoUntilQuorum multiple
+// times with the same ReplicationSet should evenly distribute requests across all zones / instances.
 //
 // If cfg.HedgingDelay is non-zero, DoUntilQuorum will call f for an additional zone's instances (if zone-aware) / an
 // additional instance (if not zone-aware) every cfg.HedgingDelay until one of the termination conditions above is
@@ -266,10 +278,16 @@ func DoUntilQuorumWithoutSuccessfulContextCancellation[T any](ctx context.Contex
 	var resultTracker replicationSetResultTracker
 	var contextTracker replicationSetContextTracker
 	if r.MaxUnavailableZones > 0 || r.ZoneAwarenessEnabled {
-		resultTracker = newZoneAwareResultTracker(r.Instances, r.MaxUnavailableZones, cfg.ZoneSorter, logger)
+		zoneSorter := cfg.ZoneSorter
+		if zoneSorter == nil && cfg.InstanceScorer != nil {
+			zoneSorter = newScoringZoneSorter(r.Instances, cfg.InstanceScorer)
+		}
+		resultTracker = newZoneAwareResultTracker(r.Instances, r.MaxUnavailableZones, zoneSorter, logger)
 		contextTracker = newZoneAwareContextTracker(ctx, r.Instances)
 	} else {
-		resultTracker = newDefaultResultTracker(r.Instances, r.MaxErrors, logger)
+		tracker := newDefaultResultTracker(r.Instances, r.MaxErrors, logger)
+		tracker.scorer = cfg.InstanceScorer
+		resultTracker = tracker
 		contextTracker = newDefaultContextTracker(ctx, r.Instances)
 	}
 
@@ -294,7 +312,11 @@ func DoUntilQuorumWithoutSuccessfulContextCancellation[T any](ctx context.Contex
 				return
 			}
 
+			start := time.Now()
 			result, err := f(ctx, desc, ctxCancel)
+			if cfg.InstanceScorer != nil {
+				observeInstance(ctx, cfg, desc, time.Since(start), err)
+			}
 			resultsChan <- instanceResult[T]{
 				result:   result,
 				err:      err,
@@ -376,18 +398,35 @@ func DoUntilQuorumWithoutSuccessfulContextCancellation[T any](ctx context.Contex
 			if resultTracker.shouldIncludeResultFrom(instance) {
 				results = append(results, result)
 			} else {
-				contextTracker.cancelContextFor(instance, cancellation.NewErrorf("quorum reached, result not required from this instance"))
+				contextTracker.cancelContextFor(instance, cancellation.NewError(errResultNotRequired))
 				cleanupFunc(result)
 			}
 		} else {
 			// Nothing to clean up (yet) - this will be handled by deferred call above.
-			contextTracker.cancelContextFor(instance, cancellation.NewErrorf("quorum reached, result not required from this instance"))
+			contextTracker.cancelContextFor(instance, cancellation.NewError(errResultNotRequired))
 		}
 	}
 
 	return results, nil
 }
 
+// observeInstance records the outcome of a request with cfg.InstanceScorer. Requests cancelled because the quorum
+// was reached without them are recorded with their latency so far, which they took at least, so that slow
+// instances are not preferred. Other cancelled requests and terminal errors say nothing about the performance
+// of the instance, so they're not recorded.
+func observeInstance(ctx context.Context, cfg DoUntilQuorumConfig, instance *InstanceDesc, latency time.Duration, err error) {
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(context.Cause(ctx), errResultNotRequired) {
+			cfg.InstanceScorer.Observe(instance, latency, nil)
+		}
+		return
+	}
+	if err != nil && cfg.IsTerminalError != nil && cfg.IsTerminalError(err) {
+		return
+	}
+	cfg.InstanceScorer.Observe(instance, latency, err)
+}
+
 // DoMultiUntilQuorumWithoutSuccessfulContextCancellation behaves similar to DoUntilQuorumWithoutSuccessfulContextCancellation
 // with the following exceptions:
 //
@@ -499,6 +538,15 @@ type instanceResult[T any] struct {
 	instance *InstanceDesc
 }
 
+// maxFailedInstances returns the number of instances of the replication set which can fail. A zone-aware replication
+// set tolerates MaxUnavailableZones failed instances, since they can't be in more than MaxUnavailableZones zones.
+func (r ReplicationSet) maxFailedInstances() int {
+	if r.ZoneAwarenessEnabled {
+		return r.MaxUnavailableZones
+	}
+	return r.MaxErrors
+}
+
 // Includes returns whether the replication set includes the replica with the provided addr.
 func (r ReplicationSet) Includes(addr string) bool {
 	for _, instance := range r.Instances {
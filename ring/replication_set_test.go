@@ -678,6 +678,193 @@ func TestDoUntilQuorumWithoutSuccessfulContextCancellation_ZoneSorting(t *testin
 	cleanupTracker.assertCorrectCleanup(calledInstances, nil)
 }
 
+func TestDoUntilQuorumWithoutSuccessfulContextCancellation_InstanceScorer(t *testing.T) {
+	testCases := map[string]struct {
+		replicationSet  ReplicationSet
+		slowInstances   []string
+		expectedResults []string
+	}{
+		"non-zone-aware": {
+			replicationSet: ReplicationSet{
+				Instances: []InstanceDesc{
+					{Addr: "replica-1"},
+					{Addr: "replica-2"},
+					{Addr: "replica-3"},
+				},
+				MaxErrors: 1,
+			},
+			slowInstances:   []string{"replica-2"},
+			expectedResults: []string{"replica-1", "replica-3"},
+		},
+		"zone-aware": {
+			replicationSet: ReplicationSet{
+				Instances: []InstanceDesc{
+					{Addr: "zone-a-replica-1", Zone: "zone-a"},
+					{Addr: "zone-a-replica-2", Zone: "zone-a"},
+					{Addr: "zone-b-replica-1", Zone: "zone-b"},
+					{Addr: "zone-b-replica-2", Zone: "zone-b"},
+					{Addr: "zone-c-replica-1", Zone: "zone-c"},
+					{Addr: "zone-c-replica-2", Zone: "zone-c"},
+				},
+				MaxUnavailableZones: 1,
+			},
+			// A single slow instance is enough to make its zone slow.
+			slowInstances:   []string{"zone-c-replica-2"},
+			expectedResults: []string{"zone-a-replica-1", "zone-a-replica-2", "zone-b-replica-1", "zone-b-replica-2"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+
+			scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{DecayPeriod: time.Hour, ExplorationProbability: -1})
+			for _, instance := range testCase.replicationSet.Instances {
+				latency := time.Millisecond
+				if slices.Contains(testCase.slowInstances, instance.Addr) {
+					latency = time.Second
+				}
+				scorer.Observe(&instance, latency, nil)
+			}
+
+			ctx := context.Background()
+			cfg := DoUntilQuorumConfig{MinimizeRequests: true, InstanceScorer: scorer}
+
+			// Run it multiple times to make sure the order doesn't depend on randomness.
+			for i := 0; i < 10; i++ {
+				cleanupTracker := newCleanupTracker(t, 0)
+				mtx := &sync.Mutex{}
+				calledInstances := []string{}
+
+				f := func(ctx context.Context, desc *InstanceDesc, cancel context.CancelCauseFunc) (string, error) {
+					cleanupTracker.trackCall(ctx, desc, cancel)
+
+					mtx.Lock()
+					defer mtx.Unlock()
+					calledInstances = append(calledInstances, desc.Addr)
+
+					return desc.Addr, nil
+				}
+
+				actualResults, err := DoUntilQuorumWithoutSuccessfulContextCancellation(ctx, testCase.replicationSet, cfg, f, cleanupTracker.cleanup)
+				require.NoError(t, err)
+				require.ElementsMatch(t, testCase.expectedResults, actualResults)
+				require.ElementsMatch(t, actualResults, calledInstances)
+
+				cleanupTracker.collectCleanedUpInstances()
+				cleanupTracker.assertCorrectCleanup(calledInstances, nil)
+			}
+		})
+	}
+}
+
+func TestDoUntilQuorum_InstanceScorerObservesRequests(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	replicationSet := ReplicationSet{
+		Instances: []InstanceDesc{
+			{Addr: "replica-1"},
+			{Addr: "replica-2"},
+			{Addr: "replica-3"},
+		},
+		// The failure is observed before DoUntilQuorum returns, because it's the reason why it fails.
+		MaxErrors: 0,
+	}
+
+	scorer := NewEWMAInstanceScorer(EWMAInstanceScorerConfig{DecayPeriod: time.Hour, ErrorPenalty: time.Minute, ExplorationProbability: -1})
+	cfg := DoUntilQuorumConfig{InstanceScorer: scorer}
+	failure := errors.New("failed")
+
+	_, err := DoUntilQuorum(context.Background(), replicationSet, cfg, func(_ context.Context, desc *InstanceDesc) (string, error) {
+		if desc.Addr == "replica-2" {
+			return "", failure
+		}
+		return desc.Addr, nil
+	}, func(string) {})
+	require.ErrorIs(t, err, failure)
+
+	assert.Less(t, scorer.Score(&replicationSet.Instances[0]), time.Second.Seconds())
+	assert.Greater(t, scorer.Score(&replicationSet.Instances[1]), time.Second.Seconds())
+	assert.Less(t, scorer.Score(&replicationSet.Instances[2]), time.Second.Seconds())
+}
+
+// observationsScorer sends the observed requests to a channel.
+type observationsScorer struct {
+	observations chan instanceObservation
+}
+
+type instanceObservation struct {
+	addr    string
+	latency time.Duration
+	err     error
+}
+
+func (s *observationsScorer) Observe(instance *InstanceDesc, latency time.Duration, err error) {
+	s.observations <- instanceObservation{addr: instance.Addr, latency: latency, err: err}
+}
+
+func (s *observationsScorer) Score(*InstanceDesc) float64 {
+	return 0
+}
+
+func TestDoUntilQuorum_InstanceScorerObservesRequestsCancelledAtQuorum(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	replicationSet := ReplicationSet{
+		Instances: []InstanceDesc{
+			{Addr: "replica-1"},
+			{Addr: "replica-2"},
+			{Addr: "replica-3"},
+		},
+		MaxErrors: 1,
+	}
+
+	scorer := &observationsScorer{observations: make(chan instanceObservation, len(replicationSet.Instances))}
+	cfg := DoUntilQuorumConfig{InstanceScorer: scorer}
+
+	const slowLatency = 50 * time.Millisecond
+	_, err := DoUntilQuorum(context.Background(), replicationSet, cfg, func(ctx context.Context, desc *InstanceDesc) (string, error) {
+		if desc.Addr == "replica-3" {
+			time.Sleep(slowLatency)
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return desc.Addr, nil
+	}, func(string) {})
+	require.NoError(t, err)
+
+	observations := map[string]instanceObservation{}
+	for range replicationSet.Instances {
+		observation := <-scorer.observations
+		observations[observation.addr] = observation
+	}
+
+	// The slow request is recorded with its latency until it was cancelled, as a success.
+	require.Contains(t, observations, "replica-3")
+	assert.NoError(t, observations["replica-3"].err)
+	assert.GreaterOrEqual(t, observations["replica-3"].latency, slowLatency)
+}
+
+func TestDoUntilQuorum_InstanceScorerDoesntObserveRequestsCancelledByCaller(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	replicationSet := ReplicationSet{
+		Instances: []InstanceDesc{{Addr: "replica-1"}},
+	}
+
+	scorer := &observationsScorer{observations: make(chan instanceObservation, len(replicationSet.Instances))}
+	cfg := DoUntilQuorumConfig{InstanceScorer: scorer}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := DoUntilQuorum(ctx, replicationSet, cfg, func(ctx context.Context, _ *InstanceDesc) (string, error) {
+		cancel()
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, func(string) {})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, scorer.observations)
+}
+
 func TestDoUntilQuorumWithoutSuccessfulContextCancellation_CancelsEntireZoneImmediatelyOnSingleFailure(t *testing.T) {
 	defer goleak.VerifyNone(t)
 
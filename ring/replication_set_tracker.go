@@ -85,6 +85,7 @@ type defaultResultTracker struct {
 	instances        []InstanceDesc
 	instanceRelease  map[*InstanceDesc]chan struct{}
 	pendingInstances []*InstanceDesc
+	scorer           InstanceScorer
 	logger           log.Logger
 }
 
@@ -148,12 +149,22 @@ func (t *defaultResultTracker) startMinimumRequests() {
 		t.instanceRelease[instance] = make(chan struct{}, 1)
 	}
 
-	releaseOrder := rand.Perm(len(t.instances))
-	t.pendingInstances = make([]*InstanceDesc, 0, t.maxErrors)
+	releaseOrder := make([]*InstanceDesc, 0, len(t.instances))
+	for _, instanceIdx := range rand.Perm(len(t.instances)) {
+		releaseOrder = append(releaseOrder, &t.instances[instanceIdx])
+	}
 
-	for _, instanceIdx := range releaseOrder {
-		instance := &t.instances[instanceIdx]
+	if t.scorer != nil {
+		// The first maxErrors instances are kept pending, so the best instances are moved at the end
+		// to be started first. Pending instances are still sorted from the best one.
+		sortInstancesByScore(releaseOrder, t.scorer)
+		started := max(len(releaseOrder)-t.maxErrors, 0)
+		releaseOrder = append(releaseOrder[started:], releaseOrder[:started]...)
+	}
+
+	t.pendingInstances = make([]*InstanceDesc, 0, t.maxErrors)
 
+	for _, instance := range releaseOrder {
 		if len(t.pendingInstances) < t.maxErrors {
 			t.pendingInstances = append(t.pendingInstances, instance)
 		} else {
@@ -2,6 +2,7 @@ package ring
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
@@ -118,6 +119,250 @@ func (r *ignoreUnhealthyInstancesReplicationStrategy) SupportsExpandedReplicatio
 	return true
 }
 
+// ConsistencyLevel is the number of replicas of a key which must succeed for an operation to succeed.
+type ConsistencyLevel int
+
+const (
+	// ConsistencyLevelDefault is the default consistency level of the replication strategy.
+	ConsistencyLevelDefault ConsistencyLevel = iota
+	// ConsistencyLevelOne requires a single replica to succeed.
+	ConsistencyLevelOne
+	// ConsistencyLevelQuorum requires a quorum of the replicas to succeed.
+	ConsistencyLevelQuorum
+	// ConsistencyLevelAll requires all the replicas to succeed.
+	ConsistencyLevelAll
+	// ConsistencyLevelLocalZoneQuorum requires a quorum of the replicas in the local zone to succeed.
+	// Replicas in other zones are not included in the replication set.
+	ConsistencyLevelLocalZoneQuorum
+	// ConsistencyLevelEachZoneQuorum requires a quorum of the replicas in each zone to succeed.
+	ConsistencyLevelEachZoneQuorum
+)
+
+var consistencyLevelNames = map[ConsistencyLevel]string{
+	ConsistencyLevelDefault:         "DEFAULT",
+	ConsistencyLevelOne:             "ONE",
+	ConsistencyLevelQuorum:          "QUORUM",
+	ConsistencyLevelAll:             "ALL",
+	ConsistencyLevelLocalZoneQuorum: "LOCAL_ZONE_QUORUM",
+	ConsistencyLevelEachZoneQuorum:  "EACH_ZONE_QUORUM",
+}
+
+func (l ConsistencyLevel) String() string {
+	if name, ok := consistencyLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("ConsistencyLevel(%d)", int(l))
+}
+
+// ParseConsistencyLevel returns the ConsistencyLevel with the given name, e.g. "LOCAL_ZONE_QUORUM".
+func ParseConsistencyLevel(name string) (ConsistencyLevel, error) {
+	for level, levelName := range consistencyLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return ConsistencyLevelDefault, fmt.Errorf("unknown consistency level %q", name)
+}
+
+// ConsistencyLevelReplicationStrategy is a ReplicationStrategy supporting per-call consistency levels,
+// requested through the WithConsistencyLevel() option.
+type ConsistencyLevelReplicationStrategy interface {
+	ReplicationStrategy
+
+	// FilterWithConsistencyLevel filters out unhealthy instances and checks if there are enough instances
+	// for an operation to succeed with the given consistency level. Returns an error if there are not enough
+	// instances. The instances argument may be overwritten.
+	FilterWithConsistencyLevel(instances []InstanceDesc, op Operation, replicationFactor int, heartbeatTimeout time.Duration, zoneAwarenessEnabled bool, level ConsistencyLevel) (ReplicationSet, error)
+}
+
+type consistencyLevelReplicationStrategy struct {
+	defaultLevel ConsistencyLevel
+	localZone    string
+}
+
+// NewConsistencyLevelReplicationStrategy returns a ConsistencyLevelReplicationStrategy using defaultLevel
+// unless another level is requested for a call. The localZone is the zone of the caller, which is required
+// by ConsistencyLevelLocalZoneQuorum.
+//
+// When zone-awareness is enabled, ConsistencyLevelOne, ConsistencyLevelQuorum and ConsistencyLevelAll apply to
+// zones, and the returned replication sets tolerate MaxUnavailableZones failed zones. When zone-awareness is
+// disabled, they apply to replicas like the default replication strategy, while ConsistencyLevelLocalZoneQuorum
+// and ConsistencyLevelEachZoneQuorum fall back to ConsistencyLevelQuorum.
+func NewConsistencyLevelReplicationStrategy(defaultLevel ConsistencyLevel, localZone string) ConsistencyLevelReplicationStrategy {
+	if defaultLevel == ConsistencyLevelDefault {
+		defaultLevel = ConsistencyLevelQuorum
+	}
+	return &consistencyLevelReplicationStrategy{
+		defaultLevel: defaultLevel,
+		localZone:    localZone,
+	}
+}
+
+// Filter implements ReplicationStrategy using the default consistency level. The unavailable zones tolerated by
+// zone-aware replication sets are returned as max failures, since that many failed instances can't be in more zones.
+func (s *consistencyLevelReplicationStrategy) Filter(instances []InstanceDesc, op Operation, replicationFactor int, heartbeatTimeout time.Duration, zoneAwarenessEnabled bool) ([]InstanceDesc, int, error) {
+	set, err := s.FilterWithConsistencyLevel(instances, op, replicationFactor, heartbeatTimeout, zoneAwarenessEnabled, s.defaultLevel)
+	if err != nil {
+		return nil, 0, err
+	}
+	return set.Instances, set.maxFailedInstances(), nil
+}
+
+func (s *consistencyLevelReplicationStrategy) FilterWithConsistencyLevel(instances []InstanceDesc, op Operation, replicationFactor int, heartbeatTimeout time.Duration, zoneAwarenessEnabled bool, level ConsistencyLevel) (ReplicationSet, error) {
+	if level == ConsistencyLevelDefault {
+		level = s.defaultLevel
+	}
+	if !zoneAwarenessEnabled && (level == ConsistencyLevelLocalZoneQuorum || level == ConsistencyLevelEachZoneQuorum) {
+		level = ConsistencyLevelQuorum
+	}
+
+	if level == ConsistencyLevelLocalZoneQuorum {
+		if s.localZone == "" {
+			return ReplicationSet{}, fmt.Errorf("consistency level %s requires the local zone to be configured", level)
+		}
+		instances = slices.DeleteFunc(instances, func(instance InstanceDesc) bool {
+			return instance.Zone != s.localZone
+		})
+		if len(instances) == 0 {
+			return ReplicationSet{}, fmt.Errorf("no replicas found in the local zone %q", s.localZone)
+		}
+	}
+
+	// The number of replicas and zones are computed before filtering out unhealthy instances.
+	replicas := len(instances)
+	replicasByZone := map[string]int{}
+	for _, instance := range instances {
+		replicasByZone[instance.Zone]++
+	}
+
+	now := time.Now()
+	var unhealthy []string
+	instances = slices.DeleteFunc(instances, func(instance InstanceDesc) bool {
+		if instance.IsHealthy(op, heartbeatTimeout, now) {
+			return false
+		}
+		unhealthy = append(unhealthy, instance.Addr)
+		return true
+	})
+
+	switch level {
+	case ConsistencyLevelOne, ConsistencyLevelQuorum, ConsistencyLevelAll:
+		if zoneAwarenessEnabled {
+			return filterZonesWithConsistencyLevel(instances, len(replicasByZone), level, unhealthy)
+		}
+		// In the case of a node joining/leaving, the actual replica set might be bigger than the
+		// replication factor, so use the bigger of the two.
+		replicas = max(replicationFactor, replicas)
+		return filterReplicasWithConsistencyLevel(instances, minSuccessForConsistencyLevel(level, replicas), level, unhealthy)
+
+	case ConsistencyLevelLocalZoneQuorum:
+		return filterReplicasWithConsistencyLevel(instances, (replicasByZone[s.localZone]/2)+1, level, unhealthy)
+
+	case ConsistencyLevelEachZoneQuorum:
+		// The result trackers can't require a quorum in each zone, so the replication set only includes
+		// a quorum of the healthy replicas of each zone, and doesn't tolerate any error.
+		quorumByZone := make(map[string]int, len(replicasByZone))
+		healthyByZone := make(map[string]int, len(replicasByZone))
+		for _, instance := range instances {
+			healthyByZone[instance.Zone]++
+		}
+		for zone, replicas := range replicasByZone {
+			quorumByZone[zone] = (replicas / 2) + 1
+			if healthyByZone[zone] < quorumByZone[zone] {
+				return ReplicationSet{}, fmt.Errorf("at least %d live replicas required in zone %s, could only find %d%s", quorumByZone[zone], zone, healthyByZone[zone], unhealthyInstancesMessage(unhealthy))
+			}
+		}
+		instances = slices.DeleteFunc(instances, func(instance InstanceDesc) bool {
+			if quorumByZone[instance.Zone] == 0 {
+				return true
+			}
+			quorumByZone[instance.Zone]--
+			return false
+		})
+		return ReplicationSet{Instances: instances}, nil
+
+	default:
+		return ReplicationSet{}, fmt.Errorf("unsupported consistency level %s", level)
+	}
+}
+
+// minSuccessForConsistencyLevel returns the number of successful calls out of replicas required by
+// the ONE, QUORUM and ALL consistency levels.
+func minSuccessForConsistencyLevel(level ConsistencyLevel, replicas int) int {
+	switch level {
+	case ConsistencyLevelOne:
+		return 1
+	case ConsistencyLevelAll:
+		return replicas
+	default:
+		return (replicas / 2) + 1
+	}
+}
+
+func filterReplicasWithConsistencyLevel(healthy []InstanceDesc, minSuccess int, level ConsistencyLevel, unhealthy []string) (ReplicationSet, error) {
+	if len(healthy) < minSuccess {
+		return ReplicationSet{}, fmt.Errorf("at least %d live replicas required with consistency level %s, could only find %d%s", minSuccess, level, len(healthy), unhealthyInstancesMessage(unhealthy))
+	}
+
+	return ReplicationSet{
+		Instances: healthy,
+		MaxErrors: len(healthy) - minSuccess,
+	}, nil
+}
+
+// filterZonesWithConsistencyLevel applies the ONE, QUORUM and ALL consistency levels to zones instead of
+// replicas, because the zone-aware result tracker counts failures by zone.
+func filterZonesWithConsistencyLevel(healthy []InstanceDesc, zones int, level ConsistencyLevel, unhealthy []string) (ReplicationSet, error) {
+	healthyZones := map[string]struct{}{}
+	for _, instance := range healthy {
+		healthyZones[instance.Zone] = struct{}{}
+	}
+
+	minSuccessZones := minSuccessForConsistencyLevel(level, zones)
+	if len(healthyZones) < minSuccessZones {
+		return ReplicationSet{}, fmt.Errorf("at least %d live zones required with consistency level %s, could only find %d%s", minSuccessZones, level, len(healthyZones), unhealthyInstancesMessage(unhealthy))
+	}
+
+	return ReplicationSet{
+		Instances:            healthy,
+		MaxUnavailableZones:  len(healthyZones) - minSuccessZones,
+		ZoneAwarenessEnabled: true,
+	}, nil
+}
+
+func (s *consistencyLevelReplicationStrategy) SupportsExpandedReplication() bool {
+	// Zone-level consistency levels are meaningful only with multiple replicas per zone.
+	return true
+}
+
+func unhealthyInstancesMessage(unhealthy []string) string {
+	if len(unhealthy) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" - unhealthy instances: %s", strings.Join(unhealthy, ","))
+}
+
+// filterInstances filters the instances found for a key through the given strategy, honoring the requested
+// consistency level, and returns the resulting replication set.
+func filterInstances(strategy ReplicationStrategy, instances []InstanceDesc, op Operation, replicationFactor int, heartbeatTimeout time.Duration, zoneAwarenessEnabled bool, level ConsistencyLevel) (ReplicationSet, error) {
+	if consistencyLevelStrategy, ok := strategy.(ConsistencyLevelReplicationStrategy); ok {
+		return consistencyLevelStrategy.FilterWithConsistencyLevel(instances, op, replicationFactor, heartbeatTimeout, zoneAwarenessEnabled, level)
+	}
+	if level != ConsistencyLevelDefault {
+		return ReplicationSet{}, fmt.Errorf("consistency level %s is not supported by the replication strategy", level)
+	}
+
+	healthyInstances, maxFailure, err := strategy.Filter(instances, op, replicationFactor, heartbeatTimeout, zoneAwarenessEnabled)
+	if err != nil {
+		return ReplicationSet{}, err
+	}
+
+	return ReplicationSet{
+		Instances: healthyInstances,
+		MaxErrors: maxFailure,
+	}, nil
+}
+
 func (r *Ring) IsHealthy(instance *InstanceDesc, op Operation, now time.Time) bool {
 	return instance.IsHealthy(op, r.cfg.HeartbeatTimeout, now)
 }
@@ -2,10 +2,12 @@ package ring
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRingReplicationStrategy(t *testing.T) {
@@ -163,3 +165,173 @@ func TestIgnoreUnhealthyInstancesReplicationStrategy(t *testing.T) {
 		})
 	}
 }
+
+func TestConsistencyLevelReplicationStrategy(t *testing.T) {
+	now := time.Now()
+	instance := func(addr, zone string, healthy bool) InstanceDesc {
+		desc := InstanceDesc{Addr: addr, Zone: zone, State: ACTIVE, Timestamp: now.Unix()}
+		if !healthy {
+			desc.Timestamp = now.Add(-time.Hour).Unix()
+		}
+		return desc
+	}
+
+	for name, tc := range map[string]struct {
+		instances            []InstanceDesc
+		replicationFactor    int
+		zoneAwarenessEnabled bool
+		level                ConsistencyLevel
+		expectedInstances    []string
+		expectedSet          ReplicationSet
+		expectedError        string
+	}{
+		"default level is quorum": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", true), instance("c", "", true)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelDefault,
+			expectedInstances: []string{"a", "b", "c"},
+			expectedSet:       ReplicationSet{MaxErrors: 1},
+		},
+		"ONE tolerates all but one failure": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", false), instance("c", "", true)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelOne,
+			expectedInstances: []string{"a", "c"},
+			expectedSet:       ReplicationSet{MaxErrors: 1},
+		},
+		"ONE fails without healthy replicas": {
+			instances:         []InstanceDesc{instance("a", "", false), instance("b", "", false)},
+			replicationFactor: 2,
+			level:             ConsistencyLevelOne,
+			expectedError:     "at least 1 live replicas required with consistency level ONE, could only find 0 - unhealthy instances: a,b",
+		},
+		"QUORUM with an extended replica set": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", true), instance("c", "", true), instance("d", "", true)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelQuorum,
+			expectedInstances: []string{"a", "b", "c", "d"},
+			expectedSet:       ReplicationSet{MaxErrors: 1},
+		},
+		"QUORUM fails with a single healthy replica": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", false), instance("c", "", false)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelQuorum,
+			expectedError:     "at least 2 live replicas required with consistency level QUORUM, could only find 1 - unhealthy instances: b,c",
+		},
+		"ALL doesn't tolerate failures": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", true), instance("c", "", true)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelAll,
+			expectedInstances: []string{"a", "b", "c"},
+			expectedSet:       ReplicationSet{MaxErrors: 0},
+		},
+		"ALL fails with an unhealthy replica": {
+			instances:         []InstanceDesc{instance("a", "", true), instance("b", "", true), instance("c", "", false)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelAll,
+			expectedError:     "at least 3 live replicas required with consistency level ALL, could only find 2 - unhealthy instances: c",
+		},
+		"LOCAL_ZONE_QUORUM falls back to QUORUM without zone-awareness": {
+			instances:         []InstanceDesc{instance("a", "zone-a", true), instance("b", "zone-b", true), instance("c", "zone-c", true)},
+			replicationFactor: 3,
+			level:             ConsistencyLevelLocalZoneQuorum,
+			expectedInstances: []string{"a", "b", "c"},
+			expectedSet:       ReplicationSet{MaxErrors: 1},
+		},
+		"zone-aware ONE tolerates all but one failed zone": {
+			instances:            []InstanceDesc{instance("a", "zone-a", true), instance("b", "zone-b", true), instance("c", "zone-c", true)},
+			replicationFactor:    3,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelOne,
+			expectedInstances:    []string{"a", "b", "c"},
+			expectedSet:          ReplicationSet{MaxUnavailableZones: 2, ZoneAwarenessEnabled: true},
+		},
+		"zone-aware QUORUM with an unhealthy zone": {
+			instances:            []InstanceDesc{instance("a", "zone-a", true), instance("b", "zone-b", true), instance("c", "zone-c", false)},
+			replicationFactor:    3,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelQuorum,
+			expectedInstances:    []string{"a", "b"},
+			expectedSet:          ReplicationSet{MaxUnavailableZones: 0, ZoneAwarenessEnabled: true},
+		},
+		"zone-aware ALL fails with an unhealthy zone": {
+			instances:            []InstanceDesc{instance("a", "zone-a", true), instance("b", "zone-b", true), instance("c", "zone-c", false)},
+			replicationFactor:    3,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelAll,
+			expectedError:        "at least 3 live zones required with consistency level ALL, could only find 2 - unhealthy instances: c",
+		},
+		"LOCAL_ZONE_QUORUM only includes local replicas": {
+			instances: []InstanceDesc{
+				instance("a1", "zone-a", true), instance("a2", "zone-a", true), instance("a3", "zone-a", false),
+				instance("b1", "zone-b", true), instance("b2", "zone-b", true), instance("b3", "zone-b", true),
+			},
+			replicationFactor:    6,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelLocalZoneQuorum,
+			expectedInstances:    []string{"a1", "a2"},
+			expectedSet:          ReplicationSet{MaxErrors: 0},
+		},
+		"LOCAL_ZONE_QUORUM fails without local replicas": {
+			instances:            []InstanceDesc{instance("b", "zone-b", true), instance("c", "zone-c", true)},
+			replicationFactor:    2,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelLocalZoneQuorum,
+			expectedError:        `no replicas found in the local zone "zone-a"`,
+		},
+		"EACH_ZONE_QUORUM includes a quorum of each zone": {
+			instances: []InstanceDesc{
+				instance("a1", "zone-a", true), instance("a2", "zone-a", true), instance("a3", "zone-a", true),
+				instance("b1", "zone-b", false), instance("b2", "zone-b", true), instance("b3", "zone-b", true),
+			},
+			replicationFactor:    6,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelEachZoneQuorum,
+			expectedInstances:    []string{"a1", "a2", "b2", "b3"},
+			expectedSet:          ReplicationSet{MaxErrors: 0},
+		},
+		"EACH_ZONE_QUORUM fails without a quorum in a zone": {
+			instances: []InstanceDesc{
+				instance("a1", "zone-a", true), instance("a2", "zone-a", true), instance("a3", "zone-a", true),
+				instance("b1", "zone-b", false), instance("b2", "zone-b", false), instance("b3", "zone-b", true),
+			},
+			replicationFactor:    6,
+			zoneAwarenessEnabled: true,
+			level:                ConsistencyLevelEachZoneQuorum,
+			expectedError:        "at least 2 live replicas required in zone zone-b, could only find 1 - unhealthy instances: b1,b2",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			strategy := NewConsistencyLevelReplicationStrategy(ConsistencyLevelQuorum, "zone-a")
+			set, err := strategy.FilterWithConsistencyLevel(tc.instances, Read, tc.replicationFactor, time.Minute, tc.zoneAwarenessEnabled, tc.level)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedInstances, set.GetAddresses())
+			set.Instances = nil
+			assert.Equal(t, tc.expectedSet, set)
+		})
+	}
+}
+
+func TestConsistencyLevelReplicationStrategy_LocalZoneNotConfigured(t *testing.T) {
+	strategy := NewConsistencyLevelReplicationStrategy(ConsistencyLevelLocalZoneQuorum, "")
+	instances := []InstanceDesc{{Addr: "a", Zone: "zone-a", Timestamp: time.Now().Unix()}}
+
+	_, _, err := strategy.Filter(instances, Read, 1, time.Minute, true)
+	assert.EqualError(t, err, "consistency level LOCAL_ZONE_QUORUM requires the local zone to be configured")
+}
+
+func TestParseConsistencyLevel(t *testing.T) {
+	for _, level := range []ConsistencyLevel{ConsistencyLevelOne, ConsistencyLevelQuorum, ConsistencyLevelAll, ConsistencyLevelLocalZoneQuorum, ConsistencyLevelEachZoneQuorum} {
+		parsed, err := ParseConsistencyLevel(strings.ToLower(level.String()))
+		require.NoError(t, err)
+		assert.Equal(t, level, parsed)
+	}
+
+	_, err := ParseConsistencyLevel("TWO")
+	assert.EqualError(t, err, `unknown consistency level "TWO"`)
+}
@@ -40,6 +40,7 @@ type Options struct {
 	BufDescs          []InstanceDesc
 	BufHosts          []string
 	BufZones          []string
+	ConsistencyLevel  ConsistencyLevel
 }
 
 // Option can be used to modify Ring behavior when calling Ring.GetWithOptions
@@ -64,6 +65,14 @@ func WithReplicationFactor(replication int) Option {
 	}
 }
 
+// WithConsistencyLevel creates an Option that overrides the consistency level of the replication strategy
+// for a single call. The replication strategy of the ring must implement ConsistencyLevelReplicationStrategy.
+func WithConsistencyLevel(level ConsistencyLevel) Option {
+	return func(opts *Options) {
+		opts.ConsistencyLevel = level
+	}
+}
+
 func collectOptions(opts ...Option) Options {
 	final := Options{}
 	for _, opt := range opts {
@@ -275,9 +284,13 @@ type Ring struct {
 	shuffledSubringWithLookbackCache map[subringCacheKey]cachedSubringWithLookback[*Ring]
 
 	numMembersGaugeVec      *prometheus.GaugeVec
+	membersWeightGaugeVec   *prometheus.GaugeVec
 	totalTokensGauge        prometheus.Gauge
 	oldestTimestampGaugeVec *prometheus.GaugeVec
 
+	// Subscriptions to the changes applied by updateRingState.
+	subscriptions subscriptions[RingDiff]
+
 	logger log.Logger
 }
 
@@ -334,6 +347,12 @@ func NewWithStoreClientAndStrategy(cfg Config, name, key string, store kv.Client
 			Help:        "Number of tokens in the ring",
 			ConstLabels: map[string]string{"name": name},
 		}),
+		membersWeightGaugeVec: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "ring_members_weight",
+			Help:        "Sum of the weights of the members in the ring",
+			ConstLabels: map[string]string{"name": name},
+		},
+			[]string{"state"}),
 		oldestTimestampGaugeVec: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name:        "ring_oldest_member_timestamp",
 			Help:        "Timestamp of the oldest member in the ring.",
@@ -411,10 +430,23 @@ func (r *Ring) updateRingState(ringDesc *Desc) {
 			r.updateRingMetrics()
 		}
 		r.mtx.Unlock()
+
+		if rc != Equal {
+			r.subscriptions.publish(prevRing, ringDesc)
+		}
 		return
 	}
 
 	r.setRingStateFromDesc(ringDesc, true, true, true)
+	r.subscriptions.publish(prevRing, ringDesc)
+}
+
+// Subscribe returns a Subscription delivering the changes applied to the ring from now on, such as instances
+// added or removed, state changes, token changes and read-only changes. Up to bufferSize changes are buffered
+// before being coalesced, so a slow subscriber never blocks the ring. The Subscription must be closed once
+// not needed anymore.
+func (r *Ring) Subscribe(bufferSize int) *Subscription[RingDiff] {
+	return r.subscriptions.subscribe(bufferSize, diffRingDescs)
 }
 
 func (r *Ring) setRingStateFromDesc(ringDesc *Desc, updateMetrics, updateRegisteredTimestampCache, updateReadOnlyInstances bool) {
@@ -470,17 +502,27 @@ func (r *Ring) Get(key uint32, op Operation, bufDescs []InstanceDesc, bufHosts,
 	// Note that we purposefully aren't calling GetWithOptions here since the closures it
 	// uses result in heap allocations which we specifically avoid in this method since it's
 	// called in hot loops.
-	return r.getReplicationSetForKey(key, op, bufDescs, bufHosts, r.cfg.ReplicationFactor)
+	return r.getReplicationSetForKey(key, op, bufDescs, bufHosts, r.cfg.ReplicationFactor, ConsistencyLevelDefault)
+}
+
+// GetReplicas implements DoBatchReplicasRing.
+func (r *Ring) GetReplicas(key uint32, op Operation, bufDescs []InstanceDesc, bufHosts []string) ([]InstanceDesc, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.ringDesc == nil || len(r.ringTokens) == 0 {
+		return nil, ErrEmptyRing
+	}
+	return r.findInstancesForKey(key, op, bufDescs, bufHosts, r.cfg.ReplicationFactor, nil)
 }
 
 // GetWithOptions returns n (or more) instances which form the replicas for the given key
 // with 0 or more options to change the behavior of the method call.
 func (r *Ring) GetWithOptions(key uint32, op Operation, opts ...Option) (ReplicationSet, error) {
 	options := collectOptions(opts...)
-	return r.getReplicationSetForKey(key, op, options.BufDescs, options.BufHosts, options.ReplicationFactor)
+	return r.getReplicationSetForKey(key, op, options.BufDescs, options.BufHosts, options.ReplicationFactor, options.ConsistencyLevel)
 }
 
-func (r *Ring) getReplicationSetForKey(key uint32, op Operation, bufDescs []InstanceDesc, bufHosts []string, replicationFactor int) (ReplicationSet, error) {
+func (r *Ring) getReplicationSetForKey(key uint32, op Operation, bufDescs []InstanceDesc, bufHosts []string, replicationFactor int, level ConsistencyLevel) (ReplicationSet, error) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 	if r.ringDesc == nil || len(r.ringTokens) == 0 {
@@ -503,15 +545,7 @@ func (r *Ring) getReplicationSetForKey(key uint32, op Operation, bufDescs []Inst
 		return ReplicationSet{}, err
 	}
 
-	healthyInstances, maxFailure, err := r.strategy.Filter(instances, op, replicationFactor, r.cfg.HeartbeatTimeout, r.cfg.ZoneAwarenessEnabled)
-	if err != nil {
-		return ReplicationSet{}, err
-	}
-
-	return ReplicationSet{
-		Instances: healthyInstances,
-		MaxErrors: maxFailure,
-	}, nil
+	return filterInstances(r.strategy, instances, op, replicationFactor, r.cfg.HeartbeatTimeout, r.cfg.ZoneAwarenessEnabled, level)
 }
 
 // Returns instances for given key and operation. Instances are not filtered through ReplicationStrategy.
@@ -647,13 +681,19 @@ func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, erro
 		return ReplicationSet{}, ErrEmptyRing
 	}
 
+	return getReplicationSetForOperation(r.ringDesc.Ingesters, len(r.ringZones), op, r.cfg)
+}
+
+// getReplicationSetForOperation returns the instances where the input operation should be executed,
+// among the given instances spread across numZones zones.
+func getReplicationSetForOperation(instances map[string]InstanceDesc, numZones int, op Operation, cfg Config) (ReplicationSet, error) {
 	// Build the initial replication set, excluding unhealthy instances.
-	healthyInstances := make([]InstanceDesc, 0, len(r.ringDesc.Ingesters))
+	healthyInstances := make([]InstanceDesc, 0, len(instances))
 	zoneFailures := make(map[string]struct{})
 	now := time.Now()
 
-	for _, instance := range r.ringDesc.Ingesters {
-		if r.IsHealthy(&instance, op, now) {
+	for _, instance := range instances {
+		if instance.IsHealthy(op, cfg.HeartbeatTimeout, now) {
 			healthyInstances = append(healthyInstances, instance)
 		} else {
 			zoneFailures[instance.Zone] = struct{}{}
@@ -665,11 +705,11 @@ func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, erro
 	maxErrors := 0
 	maxUnavailableZones := 0
 
-	if r.cfg.ZoneAwarenessEnabled {
+	if cfg.ZoneAwarenessEnabled {
 		// Given data is replicated to RF different zones, we can tolerate a number of
 		// RF/2 failing zones. However, we need to protect from the case the ring currently
 		// contains instances in a number of zones < RF.
-		numReplicatedZones := min(len(r.ringZones), r.cfg.ReplicationFactor)
+		numReplicatedZones := min(numZones, cfg.ReplicationFactor)
 		minSuccessZones := (numReplicatedZones / 2) + 1
 		maxUnavailableZones = minSuccessZones - 1
 
@@ -683,7 +723,7 @@ func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, erro
 			// enabled (data is replicated to RF different zones), there's no benefit in
 			// querying healthy instances from "failing zones". A zone is considered
 			// failed if there is single error.
-			filteredInstances := make([]InstanceDesc, 0, len(r.ringDesc.Ingesters))
+			filteredInstances := make([]InstanceDesc, 0, len(instances))
 			for _, instance := range healthyInstances {
 				if _, ok := zoneFailures[instance.Zone]; !ok {
 					filteredInstances = append(filteredInstances, instance)
@@ -699,12 +739,12 @@ func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, erro
 	} else {
 		// Calculate the number of required instances;
 		// ensure we always require at least RF-1 when RF=3.
-		numRequired := len(r.ringDesc.Ingesters)
-		if numRequired < r.cfg.ReplicationFactor {
-			numRequired = r.cfg.ReplicationFactor
+		numRequired := len(instances)
+		if numRequired < cfg.ReplicationFactor {
+			numRequired = cfg.ReplicationFactor
 		}
 		// We can tolerate this many failures
-		numRequired -= r.cfg.ReplicationFactor / 2
+		numRequired -= cfg.ReplicationFactor / 2
 
 		if len(healthyInstances) < numRequired {
 			return ReplicationSet{}, ErrTooManyUnhealthyInstances
@@ -717,7 +757,7 @@ func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, erro
 		Instances:            healthyInstances,
 		MaxErrors:            maxErrors,
 		MaxUnavailableZones:  maxUnavailableZones,
-		ZoneAwarenessEnabled: r.cfg.ZoneAwarenessEnabled,
+		ZoneAwarenessEnabled: cfg.ZoneAwarenessEnabled,
 	}, nil
 }
 
@@ -762,11 +802,13 @@ func (r *Desc) CountTokens() map[string]int64 {
 // updateRingMetrics updates ring metrics. Caller must be holding the Write lock!
 func (r *Ring) updateRingMetrics() {
 	numByState := map[string]int{}
+	weightByState := map[string]uint32{}
 	oldestTimestampByState := map[string]int64{}
 
 	// Initialized to zero so we emit zero-metrics (instead of not emitting anything)
 	for _, s := range []string{unhealthy, ACTIVE.String(), LEAVING.String(), PENDING.String(), JOINING.String()} {
 		numByState[s] = 0
+		weightByState[s] = 0
 		oldestTimestampByState[s] = 0
 	}
 
@@ -776,6 +818,7 @@ func (r *Ring) updateRingMetrics() {
 			s = unhealthy
 		}
 		numByState[s]++
+		weightByState[s] += instance.GetEffectiveWeight()
 		if oldestTimestampByState[s] == 0 || instance.Timestamp < oldestTimestampByState[s] {
 			oldestTimestampByState[s] = instance.Timestamp
 		}
@@ -784,6 +827,9 @@ func (r *Ring) updateRingMetrics() {
 	for state, count := range numByState {
 		r.numMembersGaugeVec.WithLabelValues(state).Set(float64(count))
 	}
+	for state, weight := range weightByState {
+		r.membersWeightGaugeVec.WithLabelValues(state).Set(float64(weight))
+	}
 	for state, timestamp := range oldestTimestampByState {
 		r.oldestTimestampGaugeVec.WithLabelValues(state).Set(float64(timestamp))
 	}
@@ -137,6 +137,11 @@ type InstanceDesc struct {
 	// Read-only instances go through standard state changes, and special handling is applied to them
 	// during shuffle shards.
 	ReadOnly bool `protobuf:"varint,11,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	// Weight of the instance relative to the other instances of the ring. Lifecyclers generate a
+	// number of tokens proportional to the weight, and token generators aware of weights target
+	// a proportional ownership. 0 means unset, and it's equivalent to 1, so that readers not aware
+	// of this field treat all instances equally.
+	Weight uint32 `protobuf:"varint,12,opt,name=weight,proto3" json:"weight,omitempty"`
 }
 
 func (m *InstanceDesc) Reset()      { *m = InstanceDesc{} }
@@ -234,6 +239,13 @@ func (m *InstanceDesc) GetReadOnly() bool {
 	return false
 }
 
+func (m *InstanceDesc) GetWeight() uint32 {
+	if m != nil {
+		return m.Weight
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("ring.InstanceState", InstanceState_name, InstanceState_value)
 	proto.RegisterType((*Desc)(nil), "ring.Desc")
@@ -244,37 +256,38 @@ func init() {
 func init() { proto.RegisterFile("ring.proto", fileDescriptor_26381ed67e202a6e) }
 
 var fileDescriptor_26381ed67e202a6e = []byte{
-	// 478 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x92, 0x31, 0x6f, 0xd3, 0x40,
-	0x1c, 0xc5, 0x7d, 0xf6, 0xc5, 0xb5, 0xff, 0xa1, 0x91, 0x75, 0x45, 0xc8, 0xb4, 0xe8, 0xb0, 0x3a,
-	0x19, 0x24, 0x52, 0x11, 0x18, 0x10, 0x52, 0x87, 0x96, 0x1a, 0xe4, 0x28, 0x4a, 0x2b, 0x13, 0xba,
-	0x46, 0x4e, 0x7c, 0x18, 0xab, 0x89, 0x1d, 0xd9, 0x17, 0xa4, 0x30, 0xf1, 0x11, 0xf8, 0x02, 0xec,
-	0x7c, 0x0e, 0xa6, 0x8e, 0x19, 0x3b, 0x21, 0xe2, 0x2c, 0x8c, 0xfd, 0x08, 0xe8, 0xce, 0x6d, 0xdd,
-	0x6c, 0xef, 0xe5, 0xbd, 0xff, 0xef, 0xe5, 0x24, 0x03, 0xe4, 0x49, 0x1a, 0xb7, 0x67, 0x79, 0xc6,
-	0x33, 0x82, 0x85, 0xde, 0x7d, 0x11, 0x27, 0xfc, 0xcb, 0x7c, 0xd4, 0x1e, 0x67, 0xd3, 0x83, 0x38,
-	0x8b, 0xb3, 0x03, 0x19, 0x8e, 0xe6, 0x9f, 0xa5, 0x93, 0x46, 0xaa, 0xea, 0x68, 0xff, 0x27, 0x02,
-	0x7c, 0xc2, 0x8a, 0x31, 0x39, 0x04, 0x33, 0x49, 0x63, 0x56, 0x70, 0x96, 0x17, 0x36, 0x72, 0x34,
-	0xb7, 0xd9, 0x79, 0xdc, 0x96, 0x74, 0x11, 0xb7, 0xfd, 0xdb, 0xcc, 0x4b, 0x79, 0xbe, 0x38, 0xc6,
-	0x97, 0x7f, 0x9e, 0x2a, 0x41, 0x7d, 0xb1, 0x7b, 0x06, 0xad, 0xcd, 0x0a, 0xb1, 0x40, 0xbb, 0x60,
-	0x0b, 0x1b, 0x39, 0xc8, 0x35, 0x03, 0x21, 0x89, 0x0b, 0x8d, 0xaf, 0xe1, 0x64, 0xce, 0x6c, 0xd5,
-	0x41, 0x6e, 0xb3, 0x43, 0x2a, 0xbc, 0x9f, 0x16, 0x3c, 0x4c, 0xc7, 0x4c, 0xcc, 0x04, 0x55, 0xe1,
-	0xad, 0xfa, 0x06, 0x75, 0xb1, 0xa1, 0x5a, 0xda, 0xfe, 0x6f, 0x15, 0x1e, 0xdc, 0x6f, 0x10, 0x02,
-	0x38, 0x8c, 0xa2, 0xfc, 0x86, 0x2b, 0x35, 0x79, 0x02, 0x26, 0x4f, 0xa6, 0xac, 0xe0, 0xe1, 0x74,
-	0x26, 0xe1, 0x5a, 0x50, 0xff, 0x40, 0x9e, 0x41, 0xa3, 0xe0, 0x21, 0x67, 0xb6, 0xe6, 0x20, 0xb7,
-	0xd5, 0xd9, 0xd9, 0x9c, 0xfd, 0x28, 0xa2, 0xa0, 0x6a, 0x90, 0x47, 0xa0, 0xf3, 0xec, 0x82, 0xa5,
-	0x85, 0xad, 0x3b, 0x9a, 0xbb, 0x1d, 0xdc, 0x38, 0x31, 0xfa, 0x2d, 0x4b, 0x99, 0xbd, 0x55, 0x8d,
-	0x0a, 0x4d, 0x5e, 0xc2, 0xc3, 0x9c, 0xc5, 0x89, 0x78, 0x31, 0x8b, 0x86, 0xf5, 0xbe, 0x21, 0xf7,
-	0x77, 0xea, 0x6c, 0x70, 0xf7, 0x4f, 0x5a, 0xa0, 0x26, 0x91, 0x6d, 0x4a, 0x88, 0x9a, 0x44, 0xe4,
-	0x10, 0xf6, 0x72, 0x16, 0x46, 0xc3, 0x2c, 0x9d, 0x2c, 0x86, 0xf3, 0x59, 0x14, 0xf2, 0x0d, 0x12,
-	0x48, 0x92, 0x2d, 0x2a, 0xa7, 0xe9, 0x64, 0xf1, 0xa9, 0x2a, 0xd4, 0xb8, 0x3d, 0x30, 0xef, 0xce,
-	0xed, 0xa6, 0x83, 0x5c, 0x23, 0x30, 0x6e, 0xcb, 0x5d, 0x6c, 0x60, 0xab, 0xd1, 0xc5, 0x46, 0xc3,
-	0xd2, 0x9f, 0xf7, 0x60, 0x7b, 0xe3, 0xb9, 0x04, 0x40, 0x3f, 0x7a, 0x37, 0xf0, 0xcf, 0x3d, 0x4b,
-	0x21, 0x4d, 0xd8, 0xea, 0x79, 0x47, 0xe7, 0x7e, 0xff, 0x83, 0x85, 0x84, 0x39, 0xf3, 0xfa, 0x27,
-	0xc2, 0xa8, 0xc2, 0x74, 0x4f, 0xfd, 0xbe, 0x30, 0x1a, 0x31, 0x00, 0xf7, 0xbc, 0xf7, 0x03, 0x0b,
-	0x1f, 0xbf, 0x5e, 0xae, 0xa8, 0x72, 0xb5, 0xa2, 0xca, 0xf5, 0x8a, 0xa2, 0xef, 0x25, 0x45, 0xbf,
-	0x4a, 0x8a, 0x2e, 0x4b, 0x8a, 0x96, 0x25, 0x45, 0x7f, 0x4b, 0x8a, 0xfe, 0x95, 0x54, 0xb9, 0x2e,
-	0x29, 0xfa, 0xb1, 0xa6, 0xca, 0x72, 0x4d, 0x95, 0xab, 0x35, 0x55, 0x46, 0xba, 0xfc, 0xde, 0x5e,
-	0xfd, 0x0f, 0x00, 0x00, 0xff, 0xff, 0x6a, 0x5b, 0x75, 0x81, 0xb2, 0x02, 0x00, 0x00,
+	// 488 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x52, 0x41, 0x6f, 0xd3, 0x30,
+	0x18, 0x8d, 0x13, 0xb7, 0x4b, 0xbf, 0x6e, 0x53, 0xe4, 0x21, 0x64, 0x36, 0x64, 0xa2, 0x9d, 0x02,
+	0x12, 0x9d, 0x28, 0x1c, 0x10, 0xd2, 0x0e, 0x1b, 0x0b, 0x28, 0x55, 0xd5, 0x4d, 0xa1, 0xec, 0x5a,
+	0xa5, 0x8d, 0xc9, 0xa2, 0xb5, 0x49, 0x95, 0xb8, 0xa0, 0x72, 0xe2, 0x27, 0xf0, 0x07, 0xb8, 0xf3,
+	0x53, 0x76, 0xec, 0x71, 0xe2, 0x80, 0x68, 0x7a, 0xe1, 0xb8, 0x9f, 0x80, 0xec, 0x6c, 0x0b, 0xbd,
+	0xbd, 0xe7, 0xf7, 0xbe, 0xf7, 0xfc, 0x59, 0x06, 0xc8, 0xe2, 0x24, 0x6a, 0x4d, 0xb3, 0x54, 0xa4,
+	0x04, 0x4b, 0xbc, 0xfb, 0x3c, 0x8a, 0xc5, 0xc5, 0x6c, 0xd8, 0x1a, 0xa5, 0x93, 0x83, 0x28, 0x8d,
+	0xd2, 0x03, 0x25, 0x0e, 0x67, 0x9f, 0x14, 0x53, 0x44, 0xa1, 0x72, 0x68, 0xff, 0x07, 0x02, 0x7c,
+	0xc2, 0xf3, 0x11, 0x39, 0x84, 0x46, 0x9c, 0x44, 0x3c, 0x17, 0x3c, 0xcb, 0x29, 0xb2, 0x0d, 0xa7,
+	0xd9, 0x7e, 0xd4, 0x52, 0xe9, 0x52, 0x6e, 0x79, 0x77, 0x9a, 0x9b, 0x88, 0x6c, 0x7e, 0x8c, 0xaf,
+	0x7e, 0x3f, 0xd1, 0xfc, 0x6a, 0x62, 0xf7, 0x0c, 0xb6, 0xd7, 0x2d, 0xc4, 0x02, 0xe3, 0x92, 0xcf,
+	0x29, 0xb2, 0x91, 0xd3, 0xf0, 0x25, 0x24, 0x0e, 0xd4, 0x3e, 0x07, 0xe3, 0x19, 0xa7, 0xba, 0x8d,
+	0x9c, 0x66, 0x9b, 0x94, 0xf1, 0x5e, 0x92, 0x8b, 0x20, 0x19, 0x71, 0x59, 0xe3, 0x97, 0x86, 0x37,
+	0xfa, 0x6b, 0xd4, 0xc1, 0xa6, 0x6e, 0x19, 0xfb, 0xbf, 0x74, 0xd8, 0xfc, 0xdf, 0x41, 0x08, 0xe0,
+	0x20, 0x0c, 0xb3, 0xdb, 0x5c, 0x85, 0xc9, 0x63, 0x68, 0x88, 0x78, 0xc2, 0x73, 0x11, 0x4c, 0xa6,
+	0x2a, 0xdc, 0xf0, 0xab, 0x03, 0xf2, 0x14, 0x6a, 0xb9, 0x08, 0x04, 0xa7, 0x86, 0x8d, 0x9c, 0xed,
+	0xf6, 0xce, 0x7a, 0xed, 0x07, 0x29, 0xf9, 0xa5, 0x83, 0x3c, 0x84, 0xba, 0x48, 0x2f, 0x79, 0x92,
+	0xd3, 0xba, 0x6d, 0x38, 0x5b, 0xfe, 0x2d, 0x93, 0xa5, 0x5f, 0xd3, 0x84, 0xd3, 0x8d, 0xb2, 0x54,
+	0x62, 0xf2, 0x02, 0x1e, 0x64, 0x3c, 0x8a, 0xe5, 0xc6, 0x3c, 0x1c, 0x54, 0xfd, 0xa6, 0xea, 0xdf,
+	0xa9, 0xb4, 0xfe, 0xfd, 0x4d, 0xb6, 0x41, 0x8f, 0x43, 0xda, 0x50, 0x21, 0x7a, 0x1c, 0x92, 0x43,
+	0xd8, 0xcb, 0x78, 0x10, 0x0e, 0xd2, 0x64, 0x3c, 0x1f, 0xcc, 0xa6, 0x61, 0x20, 0xd6, 0x92, 0x40,
+	0x25, 0x51, 0x69, 0x39, 0x4d, 0xc6, 0xf3, 0x8f, 0xa5, 0xa1, 0x8a, 0xdb, 0x83, 0xc6, 0xfd, 0x38,
+	0x6d, 0xda, 0xc8, 0x31, 0x7d, 0xf3, 0xce, 0x2c, 0x57, 0xf9, 0xc2, 0xe3, 0xe8, 0x42, 0xd0, 0x4d,
+	0x1b, 0xc9, 0x55, 0x4a, 0xd6, 0xc1, 0x26, 0xb6, 0x6a, 0x1d, 0x6c, 0xd6, 0xac, 0xfa, 0xb3, 0x2e,
+	0x6c, 0xad, 0x3d, 0x03, 0x01, 0xa8, 0x1f, 0xbd, 0xed, 0x7b, 0xe7, 0xae, 0xa5, 0x91, 0x26, 0x6c,
+	0x74, 0xdd, 0xa3, 0x73, 0xaf, 0xf7, 0xde, 0x42, 0x92, 0x9c, 0xb9, 0xbd, 0x13, 0x49, 0x74, 0x49,
+	0x3a, 0xa7, 0x5e, 0x4f, 0x12, 0x83, 0x98, 0x80, 0xbb, 0xee, 0xbb, 0xbe, 0x85, 0x8f, 0x5f, 0x2d,
+	0x96, 0x4c, 0xbb, 0x5e, 0x32, 0xed, 0x66, 0xc9, 0xd0, 0xb7, 0x82, 0xa1, 0x9f, 0x05, 0x43, 0x57,
+	0x05, 0x43, 0x8b, 0x82, 0xa1, 0x3f, 0x05, 0x43, 0x7f, 0x0b, 0xa6, 0xdd, 0x14, 0x0c, 0x7d, 0x5f,
+	0x31, 0x6d, 0xb1, 0x62, 0xda, 0xf5, 0x8a, 0x69, 0xc3, 0xba, 0xfa, 0x87, 0x2f, 0xff, 0x0d, 0x00,
+	0xcc, 0x0f, 0x43, 0xca, 0xca, 0x02, 0x00, 0x00,
 }
 
 func (x InstanceState) String() string {
@@ -366,6 +379,9 @@ func (this *InstanceDesc) Equal(that interface{}) bool {
 	if this.ReadOnly != that1.ReadOnly {
 		return false
 	}
+	if this.Weight != that1.Weight {
+		return false
+	}
 	return true
 }
 func (this *Desc) GoString() string {
@@ -394,7 +410,7 @@ func (this *InstanceDesc) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 13)
+	s := make([]string, 0, 14)
 	s = append(s, "&ring.InstanceDesc{")
 	s = append(s, "Addr: "+fmt.Sprintf("%#v", this.Addr)+",\n")
 	s = append(s, "Timestamp: "+fmt.Sprintf("%#v", this.Timestamp)+",\n")
@@ -405,6 +421,7 @@ func (this *InstanceDesc) GoString() string {
 	s = append(s, "Id: "+fmt.Sprintf("%#v", this.Id)+",\n")
 	s = append(s, "ReadOnlyUpdatedTimestamp: "+fmt.Sprintf("%#v", this.ReadOnlyUpdatedTimestamp)+",\n")
 	s = append(s, "ReadOnly: "+fmt.Sprintf("%#v", this.ReadOnly)+",\n")
+	s = append(s, "Weight: "+fmt.Sprintf("%#v", this.Weight)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -483,6 +500,11 @@ func (m *InstanceDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Weight != 0 {
+		i = encodeVarintRing(dAtA, i, uint64(m.Weight))
+		i--
+		dAtA[i] = 0x60
+	}
 	if m.ReadOnly {
 		i--
 		if m.ReadOnly {
@@ -624,6 +646,9 @@ func (m *InstanceDesc) Size() (n int) {
 	if m.ReadOnly {
 		n += 2
 	}
+	if m.Weight != 0 {
+		n += 1 + sovRing(uint64(m.Weight))
+	}
 	return n
 }
 
@@ -667,6 +692,7 @@ func (this *InstanceDesc) String() string {
 		`Id:` + fmt.Sprintf("%v", this.Id) + `,`,
 		`ReadOnlyUpdatedTimestamp:` + fmt.Sprintf("%v", this.ReadOnlyUpdatedTimestamp) + `,`,
 		`ReadOnly:` + fmt.Sprintf("%v", this.ReadOnly) + `,`,
+		`Weight:` + fmt.Sprintf("%v", this.Weight) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1158,6 +1184,25 @@ func (m *InstanceDesc) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.ReadOnly = bool(v != 0)
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Weight", wireType)
+			}
+			m.Weight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRing
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Weight |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRing(dAtA[iNdEx:])
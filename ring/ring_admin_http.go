@@ -0,0 +1,289 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/grafana/dskit/kv"
+)
+
+var (
+	// errAdminNotFound is returned when an admin action targets an instance, partition or owner which doesn't exist.
+	errAdminNotFound = errors.New("not found")
+
+	// errAdminPreconditionFailed is returned when the ring doesn't match the precondition of an admin action.
+	errAdminPreconditionFailed = errors.New("precondition failed")
+)
+
+// RingAdminHandler serves a JSON admin API to inspect and edit a ring stored in the KV store.
+//
+// GET requests list the instances with their ownership. POST requests apply an action to the ring, described by
+// a JSON body with an "action" field:
+//
+//   - forget: removes the instances listed in "instances". All of them must be registered.
+//   - set_read_only: switches the instance "instance" to read-only or back to read-write, depending on "read_only".
+//   - change_state: changes the state of the instance "instance" from "from_state" to "to_state". The request
+//     fails if the instance isn't in "from_state" anymore.
+//
+// Every action is applied with a single CAS, so it's either fully applied or not at all, and is audit logged.
+// Note that the lifecycler of a running instance may overwrite the changes made to it at its next heartbeat.
+type RingAdminHandler struct {
+	ringKey          string
+	store            kv.Client
+	heartbeatTimeout time.Duration
+	logger           log.Logger
+}
+
+// NewRingAdminHandler creates a RingAdminHandler for the ring stored at ringKey.
+func NewRingAdminHandler(ringKey string, store kv.Client, heartbeatTimeout time.Duration, logger log.Logger) *RingAdminHandler {
+	return &RingAdminHandler{
+		ringKey:          ringKey,
+		store:            store,
+		heartbeatTimeout: heartbeatTimeout,
+		logger:           logger,
+	}
+}
+
+type ringAdminInstance struct {
+	ID                       string    `json:"id"`
+	State                    string    `json:"state"`
+	Healthy                  bool      `json:"healthy"`
+	Address                  string    `json:"address"`
+	Zone                     string    `json:"zone"`
+	HeartbeatTimestamp       time.Time `json:"timestamp"`
+	RegisteredTimestamp      time.Time `json:"registered_timestamp"`
+	ReadOnly                 bool      `json:"read_only"`
+	ReadOnlyUpdatedTimestamp time.Time `json:"read_only_updated_timestamp"`
+	NumTokens                int       `json:"num_tokens"`
+	Ownership                float64   `json:"ownership"` // Percentage of the tokens of the instance zone.
+}
+
+type ringAdminInstancesResponse struct {
+	Instances []ringAdminInstance `json:"instances"`
+}
+
+type ringAdminRequest struct {
+	Action    string   `json:"action"`
+	Instances []string `json:"instances"`
+	Instance  string   `json:"instance"`
+	ReadOnly  bool     `json:"read_only"`
+	FromState string   `json:"from_state"`
+	ToState   string   `json:"to_state"`
+}
+
+type adminActionResponse struct {
+	Status  string `json:"status"`
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (h *RingAdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		h.listInstances(w, req)
+	case http.MethodPost:
+		h.handleAction(w, req)
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("unsupported HTTP method"))
+	}
+}
+
+func (h *RingAdminHandler) listInstances(w http.ResponseWriter, req *http.Request) {
+	in, err := h.store.Get(req.Context(), h.ringKey)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ringDesc := GetOrCreateRingDesc(in)
+	ownedTokens := ringDesc.CountTokens()
+	now := time.Now()
+
+	instances := make([]ringAdminInstance, 0, len(ringDesc.Ingesters))
+	for id, instance := range ringDesc.Ingesters {
+		readOnly, readOnlyUpdated := instance.GetReadOnlyState()
+
+		instances = append(instances, ringAdminInstance{
+			ID:                       id,
+			State:                    instance.State.String(),
+			Healthy:                  instance.IsHeartbeatHealthy(h.heartbeatTimeout, now),
+			Address:                  instance.Addr,
+			Zone:                     instance.Zone,
+			HeartbeatTimestamp:       time.Unix(instance.Timestamp, 0).UTC(),
+			RegisteredTimestamp:      instance.GetRegisteredAt().UTC(),
+			ReadOnly:                 readOnly,
+			ReadOnlyUpdatedTimestamp: readOnlyUpdated.UTC(),
+			NumTokens:                len(instance.Tokens),
+			Ownership:                distancePercentage(ownedTokens[id]),
+		})
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+
+	writeJSONResponse(w, ringAdminInstancesResponse{Instances: instances})
+}
+
+func (h *RingAdminHandler) handleAction(w http.ResponseWriter, req *http.Request) {
+	var action ringAdminRequest
+	if err := json.NewDecoder(req.Body).Decode(&action); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	var (
+		update  func(*Desc) (bool, error)
+		logArgs []any
+	)
+
+	switch action.Action {
+	case "forget":
+		if len(action.Instances) == 0 {
+			writeAdminError(w, http.StatusBadRequest, errors.New("no instances to forget"))
+			return
+		}
+		update = func(desc *Desc) (bool, error) {
+			return forgetInstances(desc, action.Instances)
+		}
+		logArgs = []any{"instances", fmt.Sprintf("%v", action.Instances)}
+
+	case "set_read_only":
+		if action.Instance == "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("no instance specified"))
+			return
+		}
+		update = func(desc *Desc) (bool, error) {
+			return setInstanceReadOnly(desc, action.Instance, action.ReadOnly, time.Now())
+		}
+		logArgs = []any{"instance", action.Instance, "read_only", action.ReadOnly}
+
+	case "change_state":
+		if action.Instance == "" {
+			writeAdminError(w, http.StatusBadRequest, errors.New("no instance specified"))
+			return
+		}
+		fromState, ok := InstanceState_value[action.FromState]
+		if !ok {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid from_state %q", action.FromState))
+			return
+		}
+		toState, ok := InstanceState_value[action.ToState]
+		if !ok {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid to_state %q", action.ToState))
+			return
+		}
+		update = func(desc *Desc) (bool, error) {
+			return changeInstanceState(desc, action.Instance, InstanceState(fromState), InstanceState(toState))
+		}
+		logArgs = []any{"instance", action.Instance, "from_state", action.FromState, "to_state", action.ToState}
+
+	default:
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("unknown action %q", action.Action))
+		return
+	}
+
+	changed, err := h.updateRing(req.Context(), update)
+	logAdminAction(h.logger, req, "ring admin action", action.Action, changed, err, logArgs...)
+	writeAdminActionResponse(w, changed, err)
+}
+
+// updateRing applies update to the ring with a single CAS.
+func (h *RingAdminHandler) updateRing(ctx context.Context, update func(*Desc) (bool, error)) (bool, error) {
+	changed := false
+	err := h.store.CAS(ctx, h.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		ringDesc := GetOrCreateRingDesc(in)
+
+		// The update may be retried on CAS conflicts, so we only keep track of the last attempt.
+		changed, err = update(ringDesc)
+		if err != nil || !changed {
+			return nil, false, err
+		}
+		return ringDesc, true, nil
+	})
+	return changed, err
+}
+
+func forgetInstances(desc *Desc, ids []string) (bool, error) {
+	for _, id := range ids {
+		if _, ok := desc.Ingesters[id]; !ok {
+			return false, fmt.Errorf("instance %s: %w", id, errAdminNotFound)
+		}
+	}
+
+	for _, id := range ids {
+		desc.RemoveIngester(id)
+	}
+	return true, nil
+}
+
+func setInstanceReadOnly(desc *Desc, id string, readOnly bool, now time.Time) (bool, error) {
+	instance, ok := desc.Ingesters[id]
+	if !ok {
+		return false, fmt.Errorf("instance %s: %w", id, errAdminNotFound)
+	}
+	if instance.ReadOnly == readOnly {
+		return false, nil
+	}
+
+	instance.ReadOnly = readOnly
+	instance.ReadOnlyUpdatedTimestamp = now.Unix()
+	desc.Ingesters[id] = instance
+	return true, nil
+}
+
+func changeInstanceState(desc *Desc, id string, fromState, toState InstanceState) (bool, error) {
+	instance, ok := desc.Ingesters[id]
+	if !ok {
+		return false, fmt.Errorf("instance %s: %w", id, errAdminNotFound)
+	}
+	if instance.State != fromState {
+		return false, fmt.Errorf("instance %s is in state %s, expected %s: %w", id, instance.State, fromState, errAdminPreconditionFailed)
+	}
+	if fromState == toState {
+		return false, nil
+	}
+
+	instance.State = toState
+	desc.Ingesters[id] = instance
+	return true, nil
+}
+
+// logAdminAction writes the audit log line of an admin action.
+func logAdminAction(logger log.Logger, req *http.Request, msg, action string, changed bool, err error, args ...any) {
+	args = append([]any{"msg", msg, "action", action, "remote_addr", req.RemoteAddr, "changed", changed}, args...)
+	if err != nil {
+		level.Warn(logger).Log(append(args, "err", err)...)
+		return
+	}
+	level.Info(logger).Log(args...)
+}
+
+func writeAdminActionResponse(w http.ResponseWriter, changed bool, err error) {
+	switch {
+	case err == nil:
+		writeJSONResponse(w, adminActionResponse{Status: "success", Changed: changed})
+	case errors.Is(err, errAdminNotFound):
+		writeAdminError(w, http.StatusNotFound, err)
+	case errors.Is(err, errAdminPreconditionFailed), errors.Is(err, ErrPartitionStateChangeNotAllowed):
+		writeAdminError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrPartitionDoesNotExist):
+		writeAdminError(w, http.StatusNotFound, err)
+	default:
+		writeAdminError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(adminActionResponse{Status: "error", Error: err.Error()})
+}
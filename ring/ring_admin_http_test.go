@@ -0,0 +1,168 @@
+package ring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/kv/consul"
+)
+
+func newRingAdminHandlerForTesting(t *testing.T) (*RingAdminHandler, kv.Client, *bytes.Buffer) {
+	ctx := context.Background()
+	now := time.Now()
+
+	store, closer := consul.NewInMemoryClient(GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	require.NoError(t, store.CAS(ctx, ringKey, func(interface{}) (out interface{}, retry bool, err error) {
+		desc := NewDesc()
+		desc.AddIngester("instance-1", "addr-1", "zone-a", []uint32{1000000, 3000000}, ACTIVE, now, false, time.Time{}, 0)
+		desc.AddIngester("instance-2", "addr-2", "zone-a", []uint32{2000000}, ACTIVE, now, false, time.Time{}, 0)
+		desc.AddIngester("instance-3", "addr-3", "zone-a", []uint32{4000000}, LEAVING, now, false, time.Time{}, 0)
+		return desc, true, nil
+	}))
+
+	logs := &bytes.Buffer{}
+	return NewRingAdminHandler(ringKey, store, time.Minute, log.NewLogfmtLogger(logs)), store, logs
+}
+
+func doAdminRequest(t *testing.T, handler http.Handler, method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/admin", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	return recorder
+}
+
+func getRingDesc(t *testing.T, store kv.Client) *Desc {
+	in, err := store.Get(context.Background(), ringKey)
+	require.NoError(t, err)
+	return GetOrCreateRingDesc(in)
+}
+
+func TestRingAdminHandler_ListInstances(t *testing.T) {
+	handler, _, _ := newRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res ringAdminInstancesResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Len(t, res.Instances, 3)
+
+	assert.Equal(t, "instance-1", res.Instances[0].ID)
+	assert.Equal(t, "ACTIVE", res.Instances[0].State)
+	assert.True(t, res.Instances[0].Healthy)
+	assert.Equal(t, 2, res.Instances[0].NumTokens)
+	assert.Equal(t, "instance-3", res.Instances[2].ID)
+	assert.Equal(t, "LEAVING", res.Instances[2].State)
+
+	totalOwnership := 0.0
+	for _, instance := range res.Instances {
+		totalOwnership += instance.Ownership
+	}
+	assert.InDelta(t, 100, totalOwnership, 0.001)
+}
+
+func TestRingAdminHandler_Forget(t *testing.T) {
+	t.Run("should forget all the instances", func(t *testing.T) {
+		handler, store, logs := newRingAdminHandlerForTesting(t)
+
+		recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "forget", "instances": ["instance-1", "instance-3"]}`)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.JSONEq(t, `{"status": "success", "changed": true}`, recorder.Body.String())
+
+		instances := getRingDesc(t, store).Ingesters
+		assert.Len(t, instances, 1)
+		assert.Contains(t, instances, "instance-2")
+		assert.Contains(t, logs.String(), `msg="ring admin action" action=forget`)
+		assert.Contains(t, logs.String(), `instances="[instance-1 instance-3]"`)
+	})
+
+	t.Run("should forget no instance if any of them doesn't exist", func(t *testing.T) {
+		handler, store, logs := newRingAdminHandlerForTesting(t)
+
+		recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "forget", "instances": ["instance-1", "unknown"]}`)
+		require.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "instance unknown: not found")
+
+		assert.Len(t, getRingDesc(t, store).Ingesters, 3)
+		assert.Contains(t, logs.String(), "level=warn")
+	})
+
+	t.Run("should fail if no instance is given", func(t *testing.T) {
+		handler, _, _ := newRingAdminHandlerForTesting(t)
+
+		recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "forget"}`)
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+func TestRingAdminHandler_SetReadOnly(t *testing.T) {
+	handler, store, logs := newRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "set_read_only", "instance": "instance-2", "read_only": true}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"status": "success", "changed": true}`, recorder.Body.String())
+
+	instance := getRingDesc(t, store).Ingesters["instance-2"]
+	readOnly, readOnlyUpdated := instance.GetReadOnlyState()
+	assert.True(t, readOnly)
+	assert.False(t, readOnlyUpdated.IsZero())
+	assert.Contains(t, logs.String(), "action=set_read_only")
+
+	// Setting the same state again is a no-op.
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "set_read_only", "instance": "instance-2", "read_only": true}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"status": "success", "changed": false}`, recorder.Body.String())
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "set_read_only", "instance": "instance-2", "read_only": false}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.False(t, getRingDesc(t, store).Ingesters["instance-2"].ReadOnly)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "set_read_only", "instance": "unknown", "read_only": true}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRingAdminHandler_ChangeState(t *testing.T) {
+	handler, store, logs := newRingAdminHandlerForTesting(t)
+
+	recorder := doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "instance": "instance-1", "from_state": "ACTIVE", "to_state": "LEAVING"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, LEAVING, getRingDesc(t, store).Ingesters["instance-1"].State)
+	assert.Contains(t, logs.String(), "action=change_state")
+	assert.Contains(t, logs.String(), "from_state=ACTIVE to_state=LEAVING")
+
+	// The precondition doesn't hold anymore.
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "instance": "instance-1", "from_state": "ACTIVE", "to_state": "PENDING"}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "instance instance-1 is in state LEAVING, expected ACTIVE")
+	assert.Equal(t, LEAVING, getRingDesc(t, store).Ingesters["instance-1"].State)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "instance": "instance-1", "from_state": "LEAVING", "to_state": "xxx"}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = doAdminRequest(t, handler, http.MethodPost, `{"action": "change_state", "instance": "unknown", "from_state": "ACTIVE", "to_state": "LEAVING"}`)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRingAdminHandler_InvalidRequests(t *testing.T) {
+	handler, _, _ := newRingAdminHandlerForTesting(t)
+
+	assert.Equal(t, http.StatusBadRequest, doAdminRequest(t, handler, http.MethodPost, `{`).Code)
+	assert.Equal(t, http.StatusBadRequest, doAdminRequest(t, handler, http.MethodPost, `{"action": "unknown"}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, doAdminRequest(t, handler, http.MethodDelete, "").Code)
+}
@@ -0,0 +1,204 @@
+package ring
+
+import (
+	"slices"
+	"strings"
+)
+
+// RingDiff describes the changes between two versions of a ring. Heartbeats are not considered changes.
+// Instances are sorted by ID.
+type RingDiff struct {
+	// Added instances, as registered in the new ring.
+	Added []InstanceDesc
+
+	// Removed instances, as registered in the old ring.
+	Removed []InstanceDesc
+
+	// StateChanged are the instances whose state changed.
+	StateChanged []InstanceStateChange
+
+	// TokensChanged are the instances whose tokens changed, as registered in the new ring.
+	TokensChanged []InstanceDesc
+
+	// ReadOnlyChanged are the instances switched to read-only or back to read-write, as registered in the new ring.
+	ReadOnlyChanged []InstanceDesc
+}
+
+// InstanceStateChange describes the state change of an instance.
+type InstanceStateChange struct {
+	// Instance as registered in the new ring.
+	Instance InstanceDesc
+
+	// PreviousState of the instance in the old ring.
+	PreviousState InstanceState
+}
+
+// IsEmpty returns true if the diff has no changes.
+func (d RingDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.StateChanged) == 0 && len(d.TokensChanged) == 0 && len(d.ReadOnlyChanged) == 0
+}
+
+// DiffRingDescs returns the changes from the old to the new ring. Any of them can be nil, meaning an empty ring.
+func DiffRingDescs(oldDesc, newDesc *Desc) RingDiff {
+	var (
+		diff         RingDiff
+		oldInstances = oldDesc.GetIngesters()
+		newInstances = newDesc.GetIngesters()
+	)
+
+	for id, newInstance := range newInstances {
+		newInstance.Id = id
+
+		oldInstance, ok := oldInstances[id]
+		if !ok {
+			diff.Added = append(diff.Added, newInstance)
+			continue
+		}
+
+		if oldInstance.State != newInstance.State {
+			diff.StateChanged = append(diff.StateChanged, InstanceStateChange{Instance: newInstance, PreviousState: oldInstance.State})
+		}
+		if !slices.Equal(oldInstance.Tokens, newInstance.Tokens) {
+			diff.TokensChanged = append(diff.TokensChanged, newInstance)
+		}
+		if oldInstance.ReadOnly != newInstance.ReadOnly {
+			diff.ReadOnlyChanged = append(diff.ReadOnlyChanged, newInstance)
+		}
+	}
+
+	for id, oldInstance := range oldInstances {
+		if _, ok := newInstances[id]; !ok {
+			oldInstance.Id = id
+			diff.Removed = append(diff.Removed, oldInstance)
+		}
+	}
+
+	compareIDs := func(a, b InstanceDesc) int { return strings.Compare(a.Id, b.Id) }
+	slices.SortFunc(diff.Added, compareIDs)
+	slices.SortFunc(diff.Removed, compareIDs)
+	slices.SortFunc(diff.TokensChanged, compareIDs)
+	slices.SortFunc(diff.ReadOnlyChanged, compareIDs)
+	slices.SortFunc(diff.StateChanged, func(a, b InstanceStateChange) int { return strings.Compare(a.Instance.Id, b.Instance.Id) })
+
+	return diff
+}
+
+func diffRingDescs(from, to any) (RingDiff, bool) {
+	diff := DiffRingDescs(from.(*Desc), to.(*Desc))
+	return diff, !diff.IsEmpty()
+}
+
+// PartitionRingDiff describes the changes between two versions of a partition ring. Timestamp updates are not
+// considered changes. Partitions are sorted by ID, and owners by owner ID.
+type PartitionRingDiff struct {
+	// PartitionsAdded as registered in the new ring.
+	PartitionsAdded []PartitionDesc
+
+	// PartitionsRemoved as registered in the old ring.
+	PartitionsRemoved []PartitionDesc
+
+	// PartitionsStateChanged are the partitions whose state changed.
+	PartitionsStateChanged []PartitionStateChange
+
+	// PartitionsTokensChanged are the partitions whose tokens changed, as registered in the new ring.
+	PartitionsTokensChanged []PartitionDesc
+
+	// OwnersAdded as registered in the new ring.
+	OwnersAdded []PartitionOwner
+
+	// OwnersRemoved as registered in the old ring.
+	OwnersRemoved []PartitionOwner
+
+	// OwnersChanged are the owners whose owned partition or state changed, as registered in the new ring.
+	OwnersChanged []PartitionOwner
+}
+
+// PartitionStateChange describes the state change of a partition.
+type PartitionStateChange struct {
+	// Partition as registered in the new ring.
+	Partition PartitionDesc
+
+	// PreviousState of the partition in the old ring.
+	PreviousState PartitionState
+}
+
+// PartitionOwner is an owner of the partition ring.
+type PartitionOwner struct {
+	ID    string
+	Owner OwnerDesc
+}
+
+// IsEmpty returns true if the diff has no changes.
+func (d PartitionRingDiff) IsEmpty() bool {
+	return len(d.PartitionsAdded) == 0 && len(d.PartitionsRemoved) == 0 && len(d.PartitionsStateChanged) == 0 &&
+		len(d.PartitionsTokensChanged) == 0 && len(d.OwnersAdded) == 0 && len(d.OwnersRemoved) == 0 && len(d.OwnersChanged) == 0
+}
+
+// DiffPartitionRingDescs returns the changes from the old to the new partition ring. Any of them can be nil,
+// meaning an empty ring.
+func DiffPartitionRingDescs(oldDesc, newDesc *PartitionRingDesc) PartitionRingDiff {
+	var (
+		diff          PartitionRingDiff
+		oldPartitions = oldDesc.GetPartitions()
+		newPartitions = newDesc.GetPartitions()
+		oldOwners     = oldDesc.GetOwners()
+		newOwners     = newDesc.GetOwners()
+	)
+
+	for id, newPartition := range newPartitions {
+		newPartition.Id = id
+
+		oldPartition, ok := oldPartitions[id]
+		if !ok {
+			diff.PartitionsAdded = append(diff.PartitionsAdded, newPartition)
+			continue
+		}
+
+		if oldPartition.State != newPartition.State {
+			diff.PartitionsStateChanged = append(diff.PartitionsStateChanged, PartitionStateChange{Partition: newPartition, PreviousState: oldPartition.State})
+		}
+		if !slices.Equal(oldPartition.Tokens, newPartition.Tokens) {
+			diff.PartitionsTokensChanged = append(diff.PartitionsTokensChanged, newPartition)
+		}
+	}
+
+	for id, oldPartition := range oldPartitions {
+		if _, ok := newPartitions[id]; !ok {
+			oldPartition.Id = id
+			diff.PartitionsRemoved = append(diff.PartitionsRemoved, oldPartition)
+		}
+	}
+
+	for id, newOwner := range newOwners {
+		oldOwner, ok := oldOwners[id]
+		switch {
+		case !ok:
+			diff.OwnersAdded = append(diff.OwnersAdded, PartitionOwner{ID: id, Owner: newOwner})
+		case oldOwner.OwnedPartition != newOwner.OwnedPartition || oldOwner.State != newOwner.State:
+			diff.OwnersChanged = append(diff.OwnersChanged, PartitionOwner{ID: id, Owner: newOwner})
+		}
+	}
+
+	for id, oldOwner := range oldOwners {
+		if _, ok := newOwners[id]; !ok {
+			diff.OwnersRemoved = append(diff.OwnersRemoved, PartitionOwner{ID: id, Owner: oldOwner})
+		}
+	}
+
+	comparePartitions := func(a, b PartitionDesc) int { return int(a.Id) - int(b.Id) }
+	compareOwners := func(a, b PartitionOwner) int { return strings.Compare(a.ID, b.ID) }
+	slices.SortFunc(diff.PartitionsAdded, comparePartitions)
+	slices.SortFunc(diff.PartitionsRemoved, comparePartitions)
+	slices.SortFunc(diff.PartitionsTokensChanged, comparePartitions)
+	slices.SortFunc(diff.PartitionsStateChanged, func(a, b PartitionStateChange) int { return int(a.Partition.Id) - int(b.Partition.Id) })
+	slices.SortFunc(diff.OwnersAdded, compareOwners)
+	slices.SortFunc(diff.OwnersRemoved, compareOwners)
+	slices.SortFunc(diff.OwnersChanged, compareOwners)
+
+	return diff
+}
+
+func diffPartitionRingDescs(from, to any) (PartitionRingDiff, bool) {
+	diff := DiffPartitionRingDescs(from.(*PartitionRingDesc), to.(*PartitionRingDesc))
+	return diff, !diff.IsEmpty()
+}
@@ -0,0 +1,72 @@
+package ring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRingDescs(t *testing.T) {
+	now := time.Now()
+
+	oldDesc := NewDesc()
+	oldDesc.AddIngester("unchanged", "127.0.0.1", "zone-a", []uint32{1}, ACTIVE, now, false, time.Time{}, 0)
+	oldDesc.AddIngester("removed", "127.0.0.2", "zone-a", []uint32{2}, ACTIVE, now, false, time.Time{}, 0)
+	oldDesc.AddIngester("leaving", "127.0.0.3", "zone-b", []uint32{3}, ACTIVE, now, false, time.Time{}, 0)
+	oldDesc.AddIngester("retokenized", "127.0.0.4", "zone-b", []uint32{4}, ACTIVE, now, false, time.Time{}, 0)
+	oldDesc.AddIngester("read-only", "127.0.0.5", "zone-c", []uint32{5}, ACTIVE, now, false, time.Time{}, 0)
+
+	newDesc := oldDesc.Clone().(*Desc)
+	newDesc.RemoveIngester("removed")
+	newDesc.AddIngester("added", "127.0.0.6", "zone-c", []uint32{6}, JOINING, now, false, time.Time{}, 0)
+	newDesc.AddIngester("leaving", "127.0.0.3", "zone-b", []uint32{3}, LEAVING, now, false, time.Time{}, 0)
+	newDesc.AddIngester("retokenized", "127.0.0.4", "zone-b", []uint32{4, 40}, ACTIVE, now, false, time.Time{}, 0)
+	newDesc.AddIngester("read-only", "127.0.0.5", "zone-c", []uint32{5}, ACTIVE, now, true, now, 0)
+	// Heartbeats are not changes.
+	unchanged := newDesc.Ingesters["unchanged"]
+	unchanged.Timestamp = now.Add(time.Minute).Unix()
+	newDesc.Ingesters["unchanged"] = unchanged
+
+	diff := DiffRingDescs(oldDesc, newDesc)
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, []string{"added"}, instanceIDs(diff.Added))
+	assert.Equal(t, []string{"removed"}, instanceIDs(diff.Removed))
+	assert.Equal(t, []InstanceStateChange{{Instance: newDesc.Ingesters["leaving"], PreviousState: ACTIVE}}, diff.StateChanged)
+	assert.Equal(t, []string{"retokenized"}, instanceIDs(diff.TokensChanged))
+	assert.Equal(t, []string{"read-only"}, instanceIDs(diff.ReadOnlyChanged))
+	assert.True(t, diff.ReadOnlyChanged[0].ReadOnly)
+
+	assert.True(t, DiffRingDescs(oldDesc, oldDesc).IsEmpty())
+	assert.Equal(t, instanceIDs(DiffRingDescs(nil, oldDesc).Added), instanceIDs(DiffRingDescs(oldDesc, nil).Removed))
+}
+
+func TestDiffPartitionRingDescs(t *testing.T) {
+	now := time.Now()
+
+	oldDesc := NewPartitionRingDesc()
+	oldDesc.AddPartition(1, PartitionActive, now)
+	oldDesc.AddPartition(2, PartitionActive, now)
+	oldDesc.AddOrUpdateOwner("owner-1", OwnerActive, 1, now)
+	oldDesc.AddOrUpdateOwner("owner-2", OwnerActive, 2, now)
+
+	newDesc := oldDesc.Clone().(*PartitionRingDesc)
+	newDesc.RemovePartition(2)
+	newDesc.AddPartition(3, PartitionPending, now)
+	newDesc.UpdatePartitionState(1, PartitionInactive, now.Add(time.Minute))
+	newDesc.RemoveOwner("owner-2")
+	newDesc.AddOrUpdateOwner("owner-1", OwnerActive, 3, now.Add(time.Minute))
+	newDesc.AddOrUpdateOwner("owner-3", OwnerActive, 3, now)
+
+	diff := DiffPartitionRingDescs(oldDesc, newDesc)
+	assert.False(t, diff.IsEmpty())
+	assert.Equal(t, []PartitionDesc{newDesc.Partitions[3]}, diff.PartitionsAdded)
+	assert.Equal(t, []PartitionDesc{oldDesc.Partitions[2]}, diff.PartitionsRemoved)
+	assert.Equal(t, []PartitionStateChange{{Partition: newDesc.Partitions[1], PreviousState: PartitionActive}}, diff.PartitionsStateChanged)
+	assert.Empty(t, diff.PartitionsTokensChanged)
+	assert.Equal(t, []PartitionOwner{{ID: "owner-3", Owner: newDesc.Owners["owner-3"]}}, diff.OwnersAdded)
+	assert.Equal(t, []PartitionOwner{{ID: "owner-2", Owner: oldDesc.Owners["owner-2"]}}, diff.OwnersRemoved)
+	assert.Equal(t, []PartitionOwner{{ID: "owner-1", Owner: newDesc.Owners["owner-1"]}}, diff.OwnersChanged)
+
+	assert.True(t, DiffPartitionRingDescs(oldDesc, oldDesc).IsEmpty())
+}
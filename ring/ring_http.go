@@ -47,6 +47,7 @@ type ingesterDesc struct {
 	ReadOnly                 bool      `json:"read_only"`
 	ReadOnlyUpdatedTimestamp time.Time `json:"read_only_updated_timestamp"`
 	Zone                     string    `json:"zone"`
+	Weight                   uint32    `json:"weight"`
 	Tokens                   []uint32  `json:"tokens"`
 	NumTokens                int       `json:"-"`
 	Ownership                float64   `json:"-"`
@@ -129,6 +130,7 @@ func (h *ringPageHandler) handle(w http.ResponseWriter, req *http.Request) {
 			ReadOnlyUpdatedTimestamp: rots.UTC(),
 			Tokens:                   ing.Tokens,
 			Zone:                     ing.Zone,
+			Weight:                   ing.GetEffectiveWeight(),
 			NumTokens:                len(ing.Tokens),
 			Ownership:                (float64(ownedTokens[id]) / float64(math.MaxUint32)) * 100,
 		})
@@ -69,7 +69,7 @@ func benchmarkBatch(b *testing.B, numInstances, numKeys int) {
 	for i := 0; i < numInstances; i++ {
 		tokens := gen.GenerateTokens(numTokens, takenTokens)
 		takenTokens = append(takenTokens, tokens...)
-		desc.AddIngester(fmt.Sprintf("%d", i), fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, ACTIVE, time.Now(), false, time.Time{})
+		desc.AddIngester(fmt.Sprintf("%d", i), fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 	}
 
 	cfg := Config{}
@@ -162,13 +162,13 @@ func benchmarkUpdateRingState(b *testing.B, numInstances, numTokens int, updateT
 		now := time.Now()
 		zeroTime := time.Time{}
 		id := fmt.Sprintf("%d", i)
-		desc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, ACTIVE, now, false, zeroTime)
+		desc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, ACTIVE, now, false, zeroTime, 0)
 		if updateTokens {
 			otherTokens := gen.GenerateTokens(numTokens, otherTakenTokens)
 			otherTakenTokens = append(otherTakenTokens, otherTokens...)
-			otherDesc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), otherTokens, ACTIVE, now, false, zeroTime)
+			otherDesc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), otherTokens, ACTIVE, now, false, zeroTime, 0)
 		} else {
-			otherDesc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, JOINING, now, false, zeroTime)
+			otherDesc.AddIngester(id, fmt.Sprintf("instance-%d", i), strconv.Itoa(i), tokens, JOINING, now, false, zeroTime, 0)
 		}
 	}
 
@@ -340,6 +340,42 @@ func TestDoBatchWithOptionsContextCancellation(t *testing.T) {
 	}
 }
 
+func TestDoBatch_ConsistencyLevelZoneAware(t *testing.T) {
+	gen := initTokenGenerator(t)
+
+	desc := NewDesc()
+	for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+		for i := 0; i < 2; i++ {
+			instanceID := fmt.Sprintf("instance-%s-%d", zone, i)
+			desc.AddIngester(instanceID, instanceID, zone, gen.GenerateTokens(128, desc.GetTokens()), ACTIVE, time.Now(), false, time.Time{}, 0)
+		}
+	}
+
+	ringConfig := Config{HeartbeatTimeout: time.Hour, ReplicationFactor: 3, ZoneAwarenessEnabled: true}
+	ring, err := NewWithStoreClientAndStrategy(ringConfig, "ingester", ringKey, nil, NewConsistencyLevelReplicationStrategy(ConsistencyLevelQuorum, ""), nil, log.NewNopLogger())
+	require.NoError(t, err)
+	ring.updateRingState(desc)
+
+	keys := make([]uint32, 100)
+	for i := range keys {
+		keys[i] = uint32(i) * (math.MaxUint32 / uint32(len(keys)))
+	}
+	doBatch := func(failedZones ...string) error {
+		done := make(chan struct{})
+		defer func() { <-done }()
+		return DoBatch(context.Background(), Write, ring, keys, func(instance InstanceDesc, _ []int) error {
+			if slices.Contains(failedZones, instance.Zone) {
+				return errors.New("unavailable")
+			}
+			return nil
+		}, func() { close(done) })
+	}
+
+	// A quorum of zones is written when a whole zone fails.
+	require.NoError(t, doBatch("zone-a"))
+	require.EqualError(t, doBatch("zone-a", "zone-b"), "unavailable")
+}
+
 func TestDoBatch_QuorumError(t *testing.T) {
 	const (
 		// we should run several write request to make sure we don't have any race condition on the batchTracker code
@@ -353,7 +389,7 @@ func TestDoBatch_QuorumError(t *testing.T) {
 	for address := 0; address < replicationFactor; address++ {
 		instTokens := gen.GenerateTokens(128, nil)
 		instanceID := fmt.Sprintf("%d", address)
-		desc.AddIngester(instanceID, instanceID, "", instTokens, ACTIVE, time.Now(), false, time.Time{})
+		desc.AddIngester(instanceID, instanceID, "", instTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 	}
 	ringConfig := Config{
 		HeartbeatTimeout:  time.Hour,
@@ -513,7 +549,7 @@ func TestAddIngester(t *testing.T) {
 	now := time.Now()
 	ing1Tokens := initTokenGenerator(t).GenerateTokens(128, nil)
 
-	r.AddIngester(ingName, "addr", "1", ing1Tokens, ACTIVE, now, false, time.Time{})
+	r.AddIngester(ingName, "addr", "1", ing1Tokens, ACTIVE, now, false, time.Time{}, 0)
 
 	assert.Equal(t, "addr", r.Ingesters[ingName].Addr)
 	assert.Equal(t, ing1Tokens, Tokens(r.Ingesters[ingName].Tokens))
@@ -535,7 +571,7 @@ func TestAddIngesterReplacesExistingTokens(t *testing.T) {
 
 	newTokens := initTokenGenerator(t).GenerateTokens(128, nil)
 
-	r.AddIngester(ing1Name, "addr", "1", newTokens, ACTIVE, time.Now(), false, time.Time{})
+	r.AddIngester(ing1Name, "addr", "1", newTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 
 	require.Equal(t, newTokens, Tokens(r.Ingesters[ing1Name].Tokens))
 }
@@ -576,7 +612,7 @@ func TestRing_Get_ZoneAwarenessWithIngesterLeaving(t *testing.T) {
 			var prevTokens []uint32
 			for id, instance := range instances {
 				ingTokens := gen.GenerateTokens(128, prevTokens)
-				r.AddIngester(id, instance.Addr, instance.Zone, ingTokens, instance.State, time.Now(), false, time.Time{})
+				r.AddIngester(id, instance.Addr, instance.Zone, ingTokens, instance.State, time.Now(), false, time.Time{}, 0)
 				prevTokens = append(prevTokens, ingTokens...)
 			}
 			instancesList := make([]InstanceDesc, 0, len(r.GetIngesters()))
@@ -665,7 +701,7 @@ func TestRing_Get_ZoneAwareness(t *testing.T) {
 				name := fmt.Sprintf("ing%v", i)
 				ingTokens := gen.GenerateTokens(128, prevTokens)
 
-				r.AddIngester(name, fmt.Sprintf("127.0.0.%d", i), fmt.Sprintf("zone-%v", i%testData.numZones), ingTokens, ACTIVE, time.Now(), false, time.Time{})
+				r.AddIngester(name, fmt.Sprintf("127.0.0.%d", i), fmt.Sprintf("zone-%v", i%testData.numZones), ingTokens, ACTIVE, time.Now(), false, time.Time{}, 0)
 
 				prevTokens = append(prevTokens, ingTokens...)
 			}
@@ -905,6 +941,33 @@ func TestRing_GetWithOptions(t *testing.T) {
 			expectedSetSize: 0,
 			expectError:     true,
 		},
+		{
+			name: "consistency level ONE, consistency level strategy",
+			ringInstances: map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", Zone: "zone-a", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-2": {Addr: "127.0.0.2", Zone: "zone-a", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-3": {Addr: "127.0.0.3", Zone: "zone-b", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-4": {Addr: "127.0.0.4", Zone: "zone-b", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-5": {Addr: "127.0.0.5", Zone: "zone-c", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-6": {Addr: "127.0.0.6", Zone: "zone-c", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+			},
+			strategy:        NewConsistencyLevelReplicationStrategy(ConsistencyLevelQuorum, "zone-a"),
+			options:         []Option{WithConsistencyLevel(ConsistencyLevelOne)},
+			expectedSetSize: 3,
+			expectError:     false,
+		},
+		{
+			name: "consistency level ONE, default strategy",
+			ringInstances: map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", Zone: "zone-a", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-2": {Addr: "127.0.0.2", Zone: "zone-b", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+				"instance-3": {Addr: "127.0.0.3", Zone: "zone-c", State: ACTIVE, Timestamp: healthyHeartbeat.Unix()},
+			},
+			strategy:        NewDefaultReplicationStrategy(),
+			options:         []Option{WithConsistencyLevel(ConsistencyLevelOne)},
+			expectedSetSize: 0,
+			expectError:     true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -949,6 +1012,40 @@ func TestRing_GetWithOptions(t *testing.T) {
 	}
 }
 
+func TestRing_GetWithOptions_ConsistencyLevel(t *testing.T) {
+	now := time.Now()
+	gen := initTokenGenerator(t)
+
+	desc := NewDesc()
+	var prevTokens []uint32
+	for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+		tokens := gen.GenerateTokens(128, prevTokens)
+		prevTokens = append(prevTokens, tokens...)
+		desc.AddIngester("instance-"+zone, "127.0.0.1", zone, tokens, ACTIVE, now, false, time.Time{}, 0)
+	}
+
+	ring := newRingForTesting(Config{HeartbeatTimeout: time.Minute, ReplicationFactor: 3, ZoneAwarenessEnabled: true}, false)
+	ring.setRingStateFromDesc(desc, false, false, false)
+	ring.strategy = NewConsistencyLevelReplicationStrategy(ConsistencyLevelQuorum, "zone-a")
+
+	set, err := ring.GetWithOptions(1, Read)
+	require.NoError(t, err)
+	assert.Len(t, set.Instances, 3)
+	assert.Equal(t, 1, set.MaxUnavailableZones)
+	assert.Zero(t, set.MaxErrors)
+
+	set, err = ring.GetWithOptions(1, Read, WithConsistencyLevel(ConsistencyLevelOne))
+	require.NoError(t, err)
+	assert.Len(t, set.Instances, 3)
+	assert.Equal(t, 2, set.MaxUnavailableZones)
+
+	set, err = ring.GetWithOptions(1, Read, WithConsistencyLevel(ConsistencyLevelLocalZoneQuorum))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-zone-a"}, set.GetIDs())
+	assert.Zero(t, set.MaxErrors)
+	assert.Zero(t, set.MaxUnavailableZones)
+}
+
 func TestRing_GetAllHealthy(t *testing.T) {
 	const heartbeatTimeout = time.Minute
 	now := time.Now()
@@ -4138,7 +4235,7 @@ func TestUpdateMetrics(t *testing.T) {
 	ringDesc := Desc{
 		Ingesters: map[string]InstanceDesc{
 			"A": {Addr: "127.0.0.1", Timestamp: 22, Tokens: []uint32{math.MaxUint32 / 4, (math.MaxUint32 / 4) * 3}},
-			"B": {Addr: "127.0.0.2", Timestamp: 11, Tokens: []uint32{(math.MaxUint32 / 4) * 2, math.MaxUint32}},
+			"B": {Addr: "127.0.0.2", Timestamp: 11, Tokens: []uint32{(math.MaxUint32 / 4) * 2, math.MaxUint32}, Weight: 3},
 		},
 	}
 	ring.updateRingState(&ringDesc)
@@ -4151,6 +4248,13 @@ func TestUpdateMetrics(t *testing.T) {
 		ring_members{name="test",state="LEAVING"} 0
 		ring_members{name="test",state="PENDING"} 0
 		ring_members{name="test",state="Unhealthy"} 0
+		# HELP ring_members_weight Sum of the weights of the members in the ring
+		# TYPE ring_members_weight gauge
+		ring_members_weight{name="test",state="ACTIVE"} 4
+		ring_members_weight{name="test",state="JOINING"} 0
+		ring_members_weight{name="test",state="LEAVING"} 0
+		ring_members_weight{name="test",state="PENDING"} 0
+		ring_members_weight{name="test",state="Unhealthy"} 0
 		# HELP ring_oldest_member_timestamp Timestamp of the oldest member in the ring.
 		# TYPE ring_oldest_member_timestamp gauge
 		ring_oldest_member_timestamp{name="test",state="ACTIVE"} 11
@@ -4182,7 +4286,7 @@ func TestUpdateMetricsWithRemoval(t *testing.T) {
 	ringDesc := Desc{
 		Ingesters: map[string]InstanceDesc{
 			"A": {Addr: "127.0.0.1", Timestamp: 22, Tokens: []uint32{math.MaxUint32 / 4, (math.MaxUint32 / 4) * 3}},
-			"B": {Addr: "127.0.0.2", Timestamp: 11, Tokens: []uint32{(math.MaxUint32 / 4) * 2, math.MaxUint32}},
+			"B": {Addr: "127.0.0.2", Timestamp: 11, Tokens: []uint32{(math.MaxUint32 / 4) * 2, math.MaxUint32}, Weight: 3},
 		},
 	}
 	ring.updateRingState(&ringDesc)
@@ -4195,6 +4299,13 @@ func TestUpdateMetricsWithRemoval(t *testing.T) {
 		ring_members{name="test",state="LEAVING"} 0
 		ring_members{name="test",state="PENDING"} 0
 		ring_members{name="test",state="Unhealthy"} 0
+		# HELP ring_members_weight Sum of the weights of the members in the ring
+		# TYPE ring_members_weight gauge
+		ring_members_weight{name="test",state="ACTIVE"} 4
+		ring_members_weight{name="test",state="JOINING"} 0
+		ring_members_weight{name="test",state="LEAVING"} 0
+		ring_members_weight{name="test",state="PENDING"} 0
+		ring_members_weight{name="test",state="Unhealthy"} 0
 		# HELP ring_oldest_member_timestamp Timestamp of the oldest member in the ring.
 		# TYPE ring_oldest_member_timestamp gauge
 		ring_oldest_member_timestamp{name="test",state="ACTIVE"} 11
@@ -4223,6 +4334,13 @@ func TestUpdateMetricsWithRemoval(t *testing.T) {
 		ring_members{name="test",state="LEAVING"} 0
 		ring_members{name="test",state="PENDING"} 0
 		ring_members{name="test",state="Unhealthy"} 0
+		# HELP ring_members_weight Sum of the weights of the members in the ring
+		# TYPE ring_members_weight gauge
+		ring_members_weight{name="test",state="ACTIVE"} 1
+		ring_members_weight{name="test",state="JOINING"} 0
+		ring_members_weight{name="test",state="LEAVING"} 0
+		ring_members_weight{name="test",state="PENDING"} 0
+		ring_members_weight{name="test",state="Unhealthy"} 0
 		# HELP ring_oldest_member_timestamp Timestamp of the oldest member in the ring.
 		# TYPE ring_oldest_member_timestamp gauge
 		ring_oldest_member_timestamp{name="test",state="ACTIVE"} 22
@@ -0,0 +1,478 @@
+// Package simulator replays a scripted sequence of topology changes against a ring.Ring, driven by a virtual
+// clock, and reports after every step how the replication sets, the ownership and the shuffle shards changed.
+// It's meant to evaluate offline the effect of topology changes, token generators and shuffle sharding settings
+// before rolling them out.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+)
+
+const ringKey = "ring"
+
+// EventType is the type of a topology change applied by the Simulator.
+type EventType string
+
+const (
+	// Join registers a new instance in the ring, with tokens generated by the configured token generator.
+	Join EventType = "join"
+	// Leave removes an instance from the ring.
+	Leave EventType = "leave"
+	// StopHeartbeat stops the heartbeats of an instance, which becomes unhealthy once its last heartbeat
+	// is older than the heartbeat timeout.
+	StopHeartbeat EventType = "stop-heartbeat"
+	// ResumeHeartbeat resumes the heartbeats of an instance.
+	ResumeHeartbeat EventType = "resume-heartbeat"
+	// ZoneFailure stops the heartbeats of all the instances of a zone.
+	ZoneFailure EventType = "zone-failure"
+	// ZoneRecovery resumes the heartbeats of all the instances of a zone.
+	ZoneRecovery EventType = "zone-recovery"
+	// SetReadOnly switches an instance to read-only mode.
+	SetReadOnly EventType = "set-read-only"
+	// SetWritable switches an instance back to read-write mode.
+	SetWritable EventType = "set-writable"
+	// SetState changes the state of an instance.
+	SetState EventType = "set-state"
+	// Tick only advances the virtual clock.
+	Tick EventType = "tick"
+)
+
+// Event is a single step of a simulation.
+type Event struct {
+	// Advance is the duration the virtual clock is advanced by before applying the event.
+	Advance time.Duration `json:"advance"`
+
+	Type     EventType `json:"type"`
+	Instance string    `json:"instance,omitempty"`
+	Zone     string    `json:"zone,omitempty"`
+
+	// State is the state of the instance for SetState events, and the initial state of the instance for
+	// Join events. The zero value is ACTIVE.
+	State ring.InstanceState `json:"state,omitempty"`
+}
+
+// ShuffleShard is a shuffle shard tracked by the Simulator.
+type ShuffleShard struct {
+	Identifier     string        `json:"identifier"`
+	Size           int           `json:"size"`
+	LookbackPeriod time.Duration `json:"lookback_period"`
+}
+
+// Config configures a Simulator.
+type Config struct {
+	ReplicationFactor    int
+	ZoneAwarenessEnabled bool
+	// HeartbeatTimeout is the heartbeat timeout of the ring. 0 disables the heartbeat check.
+	HeartbeatTimeout time.Duration
+
+	// TokensPerInstance is the number of tokens registered by joining instances.
+	TokensPerInstance int
+	// TokenGenerator returns the token generator used by the given joining instance. If nil, tokens are
+	// generated by a RandomTokenGenerator seeded with Seed.
+	TokenGenerator func(instanceID, zone string) ring.TokenGenerator
+
+	// Keys is the number of random keys whose replication set is tracked.
+	Keys int
+	// Operation is the operation used to look up the replication set of the keys. Defaults to ring.Write.
+	Operation ring.Operation
+	// Strategy is the replication strategy of the ring. Defaults to ring.NewDefaultReplicationStrategy().
+	Strategy ring.ReplicationStrategy
+
+	// ShuffleShards are the shuffle shards tracked by the simulation, computed with ShuffleShardWithLookback().
+	ShuffleShards []ShuffleShard
+
+	// Start is the initial time of the virtual clock.
+	Start time.Time
+	// Seed makes the generated tokens and keys reproducible.
+	Seed int64
+}
+
+func (cfg *Config) validate() error {
+	if cfg.ReplicationFactor <= 0 {
+		return fmt.Errorf("replication factor must be greater than zero: %d", cfg.ReplicationFactor)
+	}
+	if cfg.TokensPerInstance <= 0 {
+		return fmt.Errorf("tokens per instance must be greater than zero: %d", cfg.TokensPerInstance)
+	}
+	if cfg.Keys < 0 {
+		return fmt.Errorf("number of keys must not be negative: %d", cfg.Keys)
+	}
+	for _, shard := range cfg.ShuffleShards {
+		if shard.Size <= 0 {
+			return fmt.Errorf("size of shuffle shard %q must be greater than zero: %d", shard.Identifier, shard.Size)
+		}
+	}
+	return nil
+}
+
+// StepReport describes the ring after a step of the simulation, and how it changed compared to the previous step.
+type StepReport struct {
+	Step  int       `json:"step"`
+	Time  time.Time `json:"time"`
+	Event Event     `json:"event"`
+
+	Instances        int `json:"instances"`
+	HealthyInstances int `json:"healthy_instances"`
+
+	// Ownership is the fraction of the token space owned by each instance within its zone.
+	Ownership map[string]float64 `json:"ownership"`
+	// OwnershipSpread is, for each zone, the difference between the highest and the lowest ownership of
+	// its instances, divided by the highest ownership.
+	OwnershipSpread map[string]float64 `json:"ownership_spread"`
+
+	// ChangedKeys is the number of keys whose replication set changed.
+	ChangedKeys int `json:"changed_keys"`
+	// AddedReplicas and RemovedReplicas are the number of instances added to and removed from the
+	// replication sets of the keys, i.e. the number of replicas of the keys that moved.
+	AddedReplicas   int `json:"added_replicas"`
+	RemovedReplicas int `json:"removed_replicas"`
+	// FailedKeys is the number of keys whose replication set can't be computed, e.g. because of too
+	// many unhealthy instances.
+	FailedKeys int `json:"failed_keys"`
+
+	// ShuffleShards reports the instances of each tracked shuffle shard, by identifier.
+	ShuffleShards map[string]ShuffleShardReport `json:"shuffle_shards,omitempty"`
+}
+
+// ShuffleShardReport describes the instances of a shuffle shard.
+type ShuffleShardReport struct {
+	Instances []string `json:"instances"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+}
+
+type instanceState struct {
+	heartbeating  bool
+	lastHeartbeat time.Time
+}
+
+// Simulator applies events to a ring and reports their effect. Simulations are deterministic: the same
+// Config and events always produce the same reports.
+type Simulator struct {
+	cfg    Config
+	logger log.Logger
+	now    time.Time
+	step   int
+
+	desc      *ring.Desc
+	instances map[string]*instanceState
+	tokenGen  ring.TokenGenerator
+	keys      []uint32
+
+	// Replication set of each key and instances of each shuffle shard at the previous step.
+	replicationSets [][]string
+	shards          map[string][]string
+}
+
+// New returns a Simulator with an empty ring.
+func New(cfg Config, logger log.Logger) (*Simulator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Operation == 0 {
+		cfg.Operation = ring.Write
+	}
+	if cfg.Strategy == nil {
+		cfg.Strategy = ring.NewDefaultReplicationStrategy()
+	}
+
+	random := rand.New(rand.NewSource(cfg.Seed))
+	keys := make([]uint32, cfg.Keys)
+	for i := range keys {
+		keys[i] = random.Uint32()
+	}
+
+	return &Simulator{
+		cfg:             cfg,
+		logger:          logger,
+		now:             cfg.Start,
+		desc:            ring.NewDesc(),
+		instances:       map[string]*instanceState{},
+		tokenGen:        ring.NewRandomTokenGeneratorWithSeed(cfg.Seed),
+		keys:            keys,
+		replicationSets: make([][]string, len(keys)),
+		shards:          map[string][]string{},
+	}, nil
+}
+
+// Now returns the current time of the virtual clock.
+func (s *Simulator) Now() time.Time {
+	return s.now
+}
+
+// Desc returns a copy of the current ring. Heartbeat timestamps are expressed in virtual time.
+func (s *Simulator) Desc() *ring.Desc {
+	desc := s.desc.Clone().(*ring.Desc)
+	for id, instance := range desc.Ingesters {
+		instance.Timestamp = s.instances[id].lastHeartbeat.Unix()
+		desc.Ingesters[id] = instance
+	}
+	return desc
+}
+
+// Run applies the given events in order, and returns the report of each step.
+func (s *Simulator) Run(ctx context.Context, events []Event) ([]StepReport, error) {
+	reports := make([]StepReport, 0, len(events))
+	for _, event := range events {
+		report, err := s.Step(ctx, event)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Step advances the virtual clock, applies the given event and returns the resulting report.
+func (s *Simulator) Step(ctx context.Context, event Event) (StepReport, error) {
+	if event.Advance < 0 {
+		return StepReport{}, fmt.Errorf("the clock can't go backwards: %s", event.Advance)
+	}
+	s.now = s.now.Add(event.Advance)
+
+	if err := s.apply(event); err != nil {
+		return StepReport{}, fmt.Errorf("step %d: %w", s.step, err)
+	}
+	for _, instance := range s.instances {
+		if instance.heartbeating {
+			instance.lastHeartbeat = s.now
+		}
+	}
+
+	report, err := s.report(ctx, event)
+	if err != nil {
+		return StepReport{}, fmt.Errorf("step %d: %w", s.step, err)
+	}
+	s.step++
+	return report, nil
+}
+
+func (s *Simulator) apply(event Event) error {
+	switch event.Type {
+	case Join:
+		if _, ok := s.desc.Ingesters[event.Instance]; ok {
+			return fmt.Errorf("instance %q is already in the ring", event.Instance)
+		}
+		tokens := s.generateTokens(event.Instance, event.Zone)
+		s.desc.AddIngester(event.Instance, event.Instance, event.Zone, tokens, event.State, s.now, false, time.Time{}, 0)
+		s.instances[event.Instance] = &instanceState{heartbeating: true, lastHeartbeat: s.now}
+
+	case Leave:
+		if err := s.checkInstance(event.Instance); err != nil {
+			return err
+		}
+		s.desc.RemoveIngester(event.Instance)
+		delete(s.instances, event.Instance)
+
+	case StopHeartbeat, ResumeHeartbeat:
+		if err := s.checkInstance(event.Instance); err != nil {
+			return err
+		}
+		s.instances[event.Instance].heartbeating = event.Type == ResumeHeartbeat
+
+	case ZoneFailure, ZoneRecovery:
+		found := false
+		for id, instance := range s.desc.Ingesters {
+			if instance.Zone == event.Zone {
+				s.instances[id].heartbeating = event.Type == ZoneRecovery
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("zone %q has no instances", event.Zone)
+		}
+
+	case SetReadOnly, SetWritable:
+		if err := s.checkInstance(event.Instance); err != nil {
+			return err
+		}
+		instance := s.desc.Ingesters[event.Instance]
+		instance.ReadOnly = event.Type == SetReadOnly
+		instance.ReadOnlyUpdatedTimestamp = s.now.Unix()
+		s.desc.Ingesters[event.Instance] = instance
+
+	case SetState:
+		if err := s.checkInstance(event.Instance); err != nil {
+			return err
+		}
+		instance := s.desc.Ingesters[event.Instance]
+		instance.State = event.State
+		s.desc.Ingesters[event.Instance] = instance
+
+	case Tick:
+
+	default:
+		return fmt.Errorf("unknown event type %q", event.Type)
+	}
+	return nil
+}
+
+func (s *Simulator) checkInstance(instanceID string) error {
+	if _, ok := s.desc.Ingesters[instanceID]; !ok {
+		return fmt.Errorf("instance %q is not in the ring", instanceID)
+	}
+	return nil
+}
+
+func (s *Simulator) generateTokens(instanceID, zone string) ring.Tokens {
+	gen := s.tokenGen
+	if s.cfg.TokenGenerator != nil {
+		gen = s.cfg.TokenGenerator(instanceID, zone)
+	}
+	if ringAware, ok := gen.(ring.RingAwareTokenGenerator); ok {
+		return ringAware.GenerateTokensForRing(s.cfg.TokensPerInstance, 0, s.desc)
+	}
+	return gen.GenerateTokens(s.cfg.TokensPerInstance, s.desc.GetTokens())
+}
+
+func (s *Simulator) report(ctx context.Context, event Event) (StepReport, error) {
+	r, stop, err := s.startRing(ctx)
+	if err != nil {
+		return StepReport{}, err
+	}
+	defer stop()
+
+	report := StepReport{
+		Step:            s.step,
+		Time:            s.now,
+		Event:           event,
+		Instances:       len(s.desc.Ingesters),
+		Ownership:       make(map[string]float64, len(s.desc.Ingesters)),
+		OwnershipSpread: map[string]float64{},
+	}
+
+	if healthy, err := r.GetAllHealthy(ring.Reporting); err == nil {
+		report.HealthyInstances = len(healthy.Instances)
+	}
+
+	minByZone := map[string]float64{}
+	for id, owned := range s.desc.CountTokens() {
+		ownership := float64(owned) / (math.MaxUint32 + 1)
+		report.Ownership[id] = ownership
+
+		zone := s.desc.Ingesters[id].Zone
+		if curr, ok := minByZone[zone]; !ok || ownership < curr {
+			minByZone[zone] = ownership
+		}
+		report.OwnershipSpread[zone] = max(report.OwnershipSpread[zone], ownership)
+	}
+	for zone, maxOwnership := range report.OwnershipSpread {
+		if maxOwnership > 0 {
+			report.OwnershipSpread[zone] = (maxOwnership - minByZone[zone]) / maxOwnership
+		}
+	}
+
+	for i, key := range s.keys {
+		var curr []string
+		set, err := r.Get(key, s.cfg.Operation, nil, nil, nil)
+		if err != nil {
+			report.FailedKeys++
+		} else {
+			curr = set.GetIDs()
+			slices.Sort(curr)
+		}
+
+		added, removed := diff(s.replicationSets[i], curr)
+		if len(added) > 0 || len(removed) > 0 {
+			report.ChangedKeys++
+		}
+		report.AddedReplicas += len(added)
+		report.RemovedReplicas += len(removed)
+		s.replicationSets[i] = curr
+	}
+
+	if len(s.cfg.ShuffleShards) > 0 {
+		report.ShuffleShards = make(map[string]ShuffleShardReport, len(s.cfg.ShuffleShards))
+	}
+	for _, shard := range s.cfg.ShuffleShards {
+		subring := r.ShuffleShardWithLookback(shard.Identifier, shard.Size, shard.LookbackPeriod, s.now)
+		var curr []string
+		for id := range s.desc.Ingesters {
+			if subring.HasInstance(id) {
+				curr = append(curr, id)
+			}
+		}
+		slices.Sort(curr)
+
+		added, removed := diff(s.shards[shard.Identifier], curr)
+		report.ShuffleShards[shard.Identifier] = ShuffleShardReport{Instances: curr, Added: added, Removed: removed}
+		s.shards[shard.Identifier] = curr
+	}
+
+	return report, nil
+}
+
+// startRing returns a running ring.Ring reading the current state of the simulated ring, and the function
+// to call to stop it. Since the ring
+// checks the heartbeats against the wall clock, heartbeat timestamps are set either to the current time
+// or to the Unix epoch, depending on whether the instance is healthy according to the virtual clock.
+func (s *Simulator) startRing(ctx context.Context) (*ring.Ring, func(), error) {
+	desc := s.desc.Clone().(*ring.Desc)
+	now := time.Now().Unix()
+	for id, instance := range desc.Ingesters {
+		instance.Timestamp = now
+		if s.cfg.HeartbeatTimeout > 0 && s.now.Sub(s.instances[id].lastHeartbeat) > s.cfg.HeartbeatTimeout {
+			instance.Timestamp = 0
+		}
+		desc.Ingesters[id] = instance
+	}
+
+	store, closer := consul.NewInMemoryClient(ring.GetCodec(), s.logger, nil)
+	err := store.CAS(ctx, ringKey, func(interface{}) (interface{}, bool, error) {
+		return desc, false, nil
+	})
+	if err != nil {
+		closer.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+
+	cfg := ring.Config{
+		ReplicationFactor:    s.cfg.ReplicationFactor,
+		ZoneAwarenessEnabled: s.cfg.ZoneAwarenessEnabled,
+		HeartbeatTimeout:     s.cfg.HeartbeatTimeout,
+		SubringCacheDisabled: true,
+	}
+	r, err := ring.NewWithStoreClientAndStrategy(cfg, "simulator", ringKey, store, s.cfg.Strategy, nil, s.logger)
+	if err != nil {
+		closer.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+	// The ring reads its initial state from the store while starting.
+	if err := services.StartAndAwaitRunning(ctx, r); err != nil {
+		closer.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+
+	stop := func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), r)
+		closer.Close() //nolint:errcheck
+	}
+	return r, stop, nil
+}
+
+// diff returns the elements of the sorted slice curr that are missing in the sorted slice prev,
+// and the elements of prev that are missing in curr.
+func diff(prev, curr []string) (added, removed []string) {
+	for _, id := range curr {
+		if _, found := slices.BinarySearch(prev, id); !found {
+			added = append(added, id)
+		}
+	}
+	for _, id := range prev {
+		if _, found := slices.BinarySearch(curr, id); !found {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,251 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/ring"
+)
+
+func TestSimulator_ZoneFailures(t *testing.T) {
+	const keys = 1000
+
+	sim, err := New(Config{
+		ReplicationFactor:    3,
+		ZoneAwarenessEnabled: true,
+		HeartbeatTimeout:     time.Minute,
+		TokensPerInstance:    64,
+		Keys:                 keys,
+		Start:                time.Unix(1000, 0),
+		Seed:                 1,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+			_, err := sim.Step(ctx, Event{Type: Join, Instance: fmt.Sprintf("instance-%d-%s", i, zone), Zone: zone})
+			require.NoError(t, err)
+		}
+	}
+
+	// Each key is replicated to one instance per zone.
+	report, err := sim.Step(ctx, Event{Advance: time.Second, Type: Tick})
+	require.NoError(t, err)
+	assert.Equal(t, 9, report.Instances)
+	assert.Equal(t, 9, report.HealthyInstances)
+	assert.Zero(t, report.ChangedKeys)
+	assert.Zero(t, report.FailedKeys)
+	assert.Len(t, report.Ownership, 9)
+	for _, ownership := range report.Ownership {
+		assert.Greater(t, ownership, 0.0)
+		assert.Less(t, ownership, 1.0)
+	}
+	assert.Len(t, report.OwnershipSpread, 3)
+
+	// The zone doesn't fail until the heartbeat timeout expires.
+	report, err = sim.Step(ctx, Event{Advance: time.Second, Type: ZoneFailure, Zone: "zone-a"})
+	require.NoError(t, err)
+	assert.Equal(t, 9, report.HealthyInstances)
+	assert.Zero(t, report.ChangedKeys)
+
+	report, err = sim.Step(ctx, Event{Advance: time.Minute, Type: Tick})
+	require.NoError(t, err)
+	assert.Equal(t, 6, report.HealthyInstances)
+	assert.Equal(t, keys, report.ChangedKeys)
+	assert.Equal(t, keys, report.RemovedReplicas)
+	assert.Zero(t, report.AddedReplicas)
+	assert.Zero(t, report.FailedKeys)
+
+	// A second zone failure can't be tolerated.
+	report, err = sim.Step(ctx, Event{Type: ZoneFailure, Zone: "zone-b"})
+	require.NoError(t, err)
+	assert.Zero(t, report.FailedKeys)
+
+	report, err = sim.Step(ctx, Event{Advance: 2 * time.Minute, Type: Tick})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.HealthyInstances)
+	assert.Equal(t, keys, report.FailedKeys)
+
+	// Recovered zones get back their replicas.
+	_, err = sim.Step(ctx, Event{Type: ZoneRecovery, Zone: "zone-b"})
+	require.NoError(t, err)
+	report, err = sim.Step(ctx, Event{Type: ZoneRecovery, Zone: "zone-a"})
+	require.NoError(t, err)
+	assert.Equal(t, 9, report.HealthyInstances)
+	assert.Equal(t, keys, report.ChangedKeys)
+	assert.Equal(t, keys, report.AddedReplicas)
+	assert.Zero(t, report.FailedKeys)
+
+	// The heartbeats of the simulated ring follow the virtual clock.
+	for _, instance := range sim.Desc().Ingesters {
+		assert.Equal(t, sim.Now().Unix(), instance.Timestamp)
+	}
+}
+
+func TestSimulator_KeyMovementOnJoinAndLeave(t *testing.T) {
+	sim, err := New(Config{
+		ReplicationFactor: 1,
+		TokensPerInstance: 128,
+		Keys:              1000,
+		Seed:              1,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		_, err := sim.Step(ctx, Event{Type: Join, Instance: fmt.Sprintf("instance-%d", i)})
+		require.NoError(t, err)
+	}
+
+	// Keys move only to the joining instance, and back when it leaves.
+	report, err := sim.Step(ctx, Event{Type: Join, Instance: "new"})
+	require.NoError(t, err)
+	assert.Greater(t, report.ChangedKeys, 0)
+	assert.Equal(t, report.ChangedKeys, report.AddedReplicas)
+	assert.Equal(t, report.ChangedKeys, report.RemovedReplicas)
+	moved := report.ChangedKeys
+
+	report, err = sim.Step(ctx, Event{Type: Leave, Instance: "new"})
+	require.NoError(t, err)
+	assert.Equal(t, moved, report.ChangedKeys)
+	assert.NotContains(t, report.Ownership, "new")
+
+	// Write operations extend the replication set of the keys owned by a LEAVING instance, and require
+	// the extended replication set to be healthy: with a replication factor of 1 these keys can't be written.
+	report, err = sim.Step(ctx, Event{Type: SetState, Instance: "instance-0", State: ring.LEAVING})
+	require.NoError(t, err)
+	assert.Greater(t, report.FailedKeys, 0)
+	assert.Equal(t, report.FailedKeys, report.ChangedKeys)
+	assert.Equal(t, report.FailedKeys, report.RemovedReplicas)
+}
+
+func TestSimulator_ShuffleShardWithLookback(t *testing.T) {
+	const lookback = time.Hour
+
+	sim, err := New(Config{
+		ReplicationFactor: 1,
+		TokensPerInstance: 32,
+		ShuffleShards:     []ShuffleShard{{Identifier: "tenant", Size: 3, LookbackPeriod: lookback}},
+		Start:             time.Unix(1000, 0),
+		Seed:              1,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var report StepReport
+	for i := 0; i < 6; i++ {
+		report, err = sim.Step(ctx, Event{Type: Join, Instance: fmt.Sprintf("instance-%d", i)})
+		require.NoError(t, err)
+	}
+
+	// Instances registered within the lookback period are all part of the shard.
+	assert.Len(t, report.ShuffleShards["tenant"].Instances, 6)
+
+	// Once the lookback period is over, the shard shrinks to its size.
+	report, err = sim.Step(ctx, Event{Advance: 2 * lookback, Type: Tick})
+	require.NoError(t, err)
+	shard := report.ShuffleShards["tenant"]
+	assert.Len(t, shard.Instances, 3)
+	assert.Len(t, shard.Removed, 3)
+	assert.Empty(t, shard.Added)
+
+	// Joining instances never cause instances to leave the shard during the lookback period.
+	for i := 0; i < 10; i++ {
+		report, err = sim.Step(ctx, Event{Advance: time.Minute, Type: Join, Instance: fmt.Sprintf("new-%d", i)})
+		require.NoError(t, err)
+		assert.Empty(t, report.ShuffleShards["tenant"].Removed)
+		assert.Subset(t, report.ShuffleShards["tenant"].Instances, shard.Instances)
+	}
+
+	// Read-only instances are kept in the shard during the lookback period.
+	readOnly := shard.Instances[0]
+	report, err = sim.Step(ctx, Event{Type: SetReadOnly, Instance: readOnly})
+	require.NoError(t, err)
+	assert.Contains(t, report.ShuffleShards["tenant"].Instances, readOnly)
+
+	report, err = sim.Step(ctx, Event{Advance: 2 * lookback, Type: Tick})
+	require.NoError(t, err)
+	assert.NotContains(t, report.ShuffleShards["tenant"].Instances, readOnly)
+	assert.Len(t, report.ShuffleShards["tenant"].Instances, 3)
+}
+
+func TestSimulator_Deterministic(t *testing.T) {
+	cfg := Config{
+		ReplicationFactor:    3,
+		ZoneAwarenessEnabled: true,
+		HeartbeatTimeout:     time.Minute,
+		TokensPerInstance:    16,
+		TokenGenerator: func(instanceID, zone string) ring.TokenGenerator {
+			return ring.NewZoneAwareSpreadMinimizingTokenGenerator(instanceID, zone, 0, false)
+		},
+		Keys:          100,
+		ShuffleShards: []ShuffleShard{{Identifier: "tenant", Size: 3}},
+		Seed:          42,
+	}
+
+	var events []Event
+	for i := 0; i < 4; i++ {
+		for _, zone := range []string{"zone-a", "zone-b", "zone-c"} {
+			events = append(events, Event{Advance: time.Second, Type: Join, Instance: fmt.Sprintf("instance-%d-%s", i, zone), Zone: zone})
+		}
+	}
+	events = append(events,
+		Event{Type: StopHeartbeat, Instance: "instance-1-zone-a"},
+		Event{Advance: 90 * time.Second, Type: SetReadOnly, Instance: "instance-2-zone-b"},
+		Event{Type: ResumeHeartbeat, Instance: "instance-1-zone-a"},
+		Event{Type: SetWritable, Instance: "instance-2-zone-b"},
+		Event{Type: Leave, Instance: "instance-3-zone-c"},
+	)
+
+	run := func() []StepReport {
+		sim, err := New(cfg, log.NewNopLogger())
+		require.NoError(t, err)
+		reports, err := sim.Run(context.Background(), events)
+		require.NoError(t, err)
+		return reports
+	}
+
+	reports := run()
+	require.Len(t, reports, len(events))
+	assert.Equal(t, reports, run())
+
+	// The zone-aware spread minimizing token generator keeps the ownership balanced.
+	for zone, spread := range reports[11].OwnershipSpread {
+		assert.Less(t, spread, 0.1, zone)
+	}
+	// The instance with stopped heartbeats became unhealthy, and healthy again once resumed.
+	assert.Equal(t, 11, reports[13].HealthyInstances)
+	assert.Equal(t, 12, reports[14].HealthyInstances)
+}
+
+func TestSimulator_InvalidInput(t *testing.T) {
+	_, err := New(Config{ReplicationFactor: 0, TokensPerInstance: 1}, log.NewNopLogger())
+	require.Error(t, err)
+	_, err = New(Config{ReplicationFactor: 1, TokensPerInstance: 0}, log.NewNopLogger())
+	require.Error(t, err)
+
+	sim, err := New(Config{ReplicationFactor: 1, TokensPerInstance: 1}, log.NewNopLogger())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = sim.Step(ctx, Event{Type: Leave, Instance: "unknown"})
+	require.Error(t, err)
+	_, err = sim.Step(ctx, Event{Type: ZoneFailure, Zone: "unknown"})
+	require.Error(t, err)
+	_, err = sim.Step(ctx, Event{Type: "unknown"})
+	require.Error(t, err)
+	_, err = sim.Step(ctx, Event{Advance: -time.Second, Type: Tick})
+	require.Error(t, err)
+
+	_, err = sim.Step(ctx, Event{Type: Join, Instance: "instance"})
+	require.NoError(t, err)
+	_, err = sim.Step(ctx, Event{Type: Join, Instance: "instance"})
+	require.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSubscriptionClosed is returned by Subscription.Next once the subscription has been closed.
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// Subscription delivers the changes applied to a ring as structured diffs of type T, in the order they have been
+// applied. See Ring.Subscribe and PartitionRingWatcher.Subscribe.
+//
+// Publishing changes never blocks the ring: the subscription buffers up to a fixed number of changes, and
+// once the buffer is full, new changes are coalesced with the last buffered one. A coalesced change is
+// delivered as a single diff between the ring before the first change and after the last one.
+type Subscription[T any] struct {
+	diff        func(from, to any) (T, bool)
+	unsubscribe func()
+
+	mtx    sync.Mutex
+	buffer []subscriptionChange
+	size   int
+	closed bool
+	notify chan struct{}
+}
+
+// subscriptionChange is a ring change not delivered yet. Diffs are computed when delivered, which
+// allows to coalesce changes by simply moving the target ring descriptor forward.
+type subscriptionChange struct {
+	from, to any
+}
+
+func newSubscription[T any](size int, diff func(from, to any) (T, bool), unsubscribe func()) *Subscription[T] {
+	return &Subscription[T]{
+		diff:        diff,
+		unsubscribe: unsubscribe,
+		size:        max(size, 1),
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Next blocks until a change is available and returns its diff. Changes which turn out to be empty once diffed,
+// such as heartbeats, are skipped. It returns an error if ctx is done or the subscription has been closed.
+func (s *Subscription[T]) Next(ctx context.Context) (T, error) {
+	var empty T
+
+	for {
+		s.mtx.Lock()
+		if s.closed {
+			s.mtx.Unlock()
+			return empty, ErrSubscriptionClosed
+		}
+		if len(s.buffer) > 0 {
+			change := s.buffer[0]
+			s.buffer = s.buffer[1:]
+			s.mtx.Unlock()
+
+			if diff, changed := s.diff(change.from, change.to); changed {
+				return diff, nil
+			}
+			continue
+		}
+		s.mtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return empty, context.Cause(ctx)
+		case <-s.notify:
+		}
+	}
+}
+
+// Close stops the delivery of changes. Pending and future calls to Next return ErrSubscriptionClosed.
+func (s *Subscription[T]) Close() {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return
+	}
+	s.closed = true
+	s.buffer = nil
+	s.mtx.Unlock()
+
+	s.unsubscribe()
+	s.wakeUp()
+}
+
+func (s *Subscription[T]) publish(from, to any) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	if len(s.buffer) >= s.size {
+		s.buffer[len(s.buffer)-1].to = to
+	} else {
+		s.buffer = append(s.buffer, subscriptionChange{from: from, to: to})
+	}
+	s.wakeUp()
+}
+
+func (s *Subscription[T]) wakeUp() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// subscriptions keeps track of the subscriptions to the changes of a ring. The zero value is ready to use.
+type subscriptions[T any] struct {
+	mtx  sync.Mutex
+	subs map[*Subscription[T]]struct{}
+}
+
+func (s *subscriptions[T]) subscribe(size int, diff func(from, to any) (T, bool)) *Subscription[T] {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var sub *Subscription[T]
+	sub = newSubscription(size, diff, func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		delete(s.subs, sub)
+	})
+	if s.subs == nil {
+		s.subs = map[*Subscription[T]]struct{}{}
+	}
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+func (s *subscriptions[T]) publish(from, to any) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for sub := range s.subs {
+		sub.publish(from, to)
+	}
+}
@@ -0,0 +1,142 @@
+package ring
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing_Subscribe(t *testing.T) {
+	var diff RingDiff
+	ring, err := NewWithStoreClientAndStrategy(Config{HeartbeatTimeout: time.Minute, ReplicationFactor: 1}, "test", ringKey, nil, NewDefaultReplicationStrategy(), nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	sub := ring.Subscribe(10)
+	defer sub.Close()
+
+	now := time.Now()
+	desc := NewDesc()
+	desc.AddIngester("instance-1", "127.0.0.1", "zone-a", []uint32{1, 2}, ACTIVE, now, false, time.Time{}, 0)
+	desc.AddIngester("instance-2", "127.0.0.2", "zone-b", []uint32{3, 4}, JOINING, now, false, time.Time{}, 0)
+	ring.updateRingState(desc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	diff, err = sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-1", "instance-2"}, instanceIDs(diff.Added))
+	assert.Empty(t, diff.Removed)
+
+	// Heartbeats are not delivered.
+	desc = cloneDesc(desc)
+	instance := desc.Ingesters["instance-1"]
+	instance.Timestamp = now.Add(time.Second).Unix()
+	desc.Ingesters["instance-1"] = instance
+	ring.updateRingState(desc)
+
+	desc = cloneDesc(desc)
+	instance = desc.Ingesters["instance-2"]
+	instance.State = ACTIVE
+	desc.Ingesters["instance-2"] = instance
+	ring.updateRingState(desc)
+
+	diff, err = sub.Next(ctx)
+	require.NoError(t, err)
+	require.Len(t, diff.StateChanged, 1)
+	assert.Equal(t, "instance-2", diff.StateChanged[0].Instance.Id)
+	assert.Equal(t, JOINING, diff.StateChanged[0].PreviousState)
+	assert.Equal(t, ACTIVE, diff.StateChanged[0].Instance.State)
+
+	// Closed subscriptions don't receive changes anymore.
+	sub.Close()
+	_, err = sub.Next(ctx)
+	require.ErrorIs(t, err, ErrSubscriptionClosed)
+	assert.Empty(t, ring.subscriptions.subs)
+}
+
+func TestRing_Subscribe_Coalescing(t *testing.T) {
+	var diff RingDiff
+	ring, err := NewWithStoreClientAndStrategy(Config{HeartbeatTimeout: time.Minute, ReplicationFactor: 1}, "test", ringKey, nil, NewDefaultReplicationStrategy(), nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	sub := ring.Subscribe(2)
+	defer sub.Close()
+
+	// The ring is never blocked by the subscriber, and changes beyond the buffer size are coalesced.
+	desc := NewDesc()
+	for i := 1; i <= 5; i++ {
+		desc = cloneDesc(desc)
+		desc.AddIngester(fmt.Sprintf("instance-%d", i), "127.0.0.1", "", []uint32{uint32(i)}, ACTIVE, time.Now(), false, time.Time{}, 0)
+		ring.updateRingState(desc)
+	}
+
+	// The last change is removed by another coalesced change.
+	desc = cloneDesc(desc)
+	desc.RemoveIngester("instance-5")
+	ring.updateRingState(desc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	diff, err = sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-1"}, instanceIDs(diff.Added))
+
+	diff, err = sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-2", "instance-3", "instance-4"}, instanceIDs(diff.Added))
+	assert.Empty(t, diff.Removed)
+
+	// No more changes.
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	_, err = sub.Next(shortCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPartitionRingWatcher_Subscribe(t *testing.T) {
+	watcher := NewPartitionRingWatcher("test", "test", nil, nil, nil)
+	sub := watcher.Subscribe(10)
+	defer sub.Close()
+
+	now := time.Now()
+	desc := NewPartitionRingDesc()
+	desc.AddPartition(1, PartitionActive, now)
+	desc.AddOrUpdateOwner("owner-1", OwnerActive, 1, now)
+	watcher.updatePartitionRing(desc)
+
+	desc = desc.Clone().(*PartitionRingDesc)
+	desc.UpdatePartitionState(1, PartitionInactive, now)
+	watcher.updatePartitionRing(desc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	diff, err := sub.Next(ctx)
+	require.NoError(t, err)
+	require.Len(t, diff.PartitionsAdded, 1)
+	assert.Equal(t, int32(1), diff.PartitionsAdded[0].Id)
+	assert.Equal(t, []PartitionOwner{{ID: "owner-1", Owner: desc.Owners["owner-1"]}}, diff.OwnersAdded)
+
+	diff, err = sub.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []PartitionStateChange{{Partition: desc.Partitions[1], PreviousState: PartitionActive}}, diff.PartitionsStateChanged)
+}
+
+func instanceIDs(instances []InstanceDesc) []string {
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.Id)
+	}
+	return ids
+}
+
+func cloneDesc(desc *Desc) *Desc {
+	return desc.Clone().(*Desc)
+}
@@ -22,6 +22,28 @@ type TokenGenerator interface {
 	CanJoinEnabled() bool
 }
 
+// RingAwareTokenGenerator is a TokenGenerator that takes the whole ring into account, and not only the
+// tokens already taken, when generating new tokens. Lifecyclers call GenerateTokensForRing instead of
+// GenerateTokens on the token generators implementing this interface.
+type RingAwareTokenGenerator interface {
+	TokenGenerator
+
+	// GenerateTokensForRing generates at most requestedTokensCount unique tokens for an instance with the given
+	// weight, none of which clashes with the tokens currently present in the given ring. A weight of 0 is the
+	// default weight of 1. Generated tokens are sorted.
+	GenerateTokensForRing(requestedTokensCount int, weight uint32, ringDesc *Desc) Tokens
+}
+
+// generateTokens generates requestedTokensCount tokens with the given TokenGenerator. If the latter is a
+// RingAwareTokenGenerator, tokens are generated from ringDesc for an instance with the given weight, otherwise
+// from the given allTakenTokens.
+func generateTokens(tokenGenerator TokenGenerator, requestedTokensCount int, weight uint32, ringDesc *Desc, allTakenTokens []uint32) Tokens {
+	if ringAware, ok := tokenGenerator.(RingAwareTokenGenerator); ok {
+		return ringAware.GenerateTokensForRing(requestedTokensCount, weight, ringDesc)
+	}
+	return tokenGenerator.GenerateTokens(requestedTokensCount, allTakenTokens)
+}
+
 type RandomTokenGenerator struct {
 	m sync.Mutex
 	r *rand.Rand
@@ -0,0 +1,292 @@
+package ring
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+var (
+	errorInstanceWaitingToJoin = func(instanceID, zone string) error {
+		return fmt.Errorf("the instance %q in zone %q is waiting to join the ring and it precedes this instance", instanceID, zone)
+	}
+)
+
+// ZoneAwareSpreadMinimizingTokenGenerator is a RingAwareTokenGenerator that generates tokens minimizing the spread
+// of the registered ownership of the instances within a zone. Unlike SpreadMinimizingTokenGenerator it doesn't
+// require instance IDs to follow any pattern, nor the zones to be known in advance: new tokens are computed from
+// the current state of the ring, by taking over the ranges of the instances of the same zone having the highest
+// ownership.
+type ZoneAwareSpreadMinimizingTokenGenerator struct {
+	instanceID       string
+	zone             string
+	heartbeatTimeout time.Duration
+	canJoinEnabled   bool
+}
+
+// NewZoneAwareSpreadMinimizingTokenGenerator returns a ZoneAwareSpreadMinimizingTokenGenerator for the given
+// instance and zone. Instances waiting to join the ring whose heartbeat is older than heartbeatTimeout don't
+// prevent the given instance from joining. A heartbeatTimeout of 0 disables the heartbeat check.
+func NewZoneAwareSpreadMinimizingTokenGenerator(instanceID, zone string, heartbeatTimeout time.Duration, canJoinEnabled bool) *ZoneAwareSpreadMinimizingTokenGenerator {
+	return &ZoneAwareSpreadMinimizingTokenGenerator{
+		instanceID:       instanceID,
+		zone:             zone,
+		heartbeatTimeout: heartbeatTimeout,
+		canJoinEnabled:   canJoinEnabled,
+	}
+}
+
+// GenerateTokens returns at most requestedTokensCount unique tokens, none of which clashes with the given
+// allTakenTokens. Since the owners of allTakenTokens are unknown, they are treated as if they all belonged
+// to a single instance of the same zone of the underlying instance. Lifecyclers call GenerateTokensForRing
+// instead, which takes into account the owners and the zones of the tokens.
+func (t *ZoneAwareSpreadMinimizingTokenGenerator) GenerateTokens(requestedTokensCount int, allTakenTokens []uint32) Tokens {
+	desc := NewDesc()
+	if len(allTakenTokens) > 0 {
+		desc.Ingesters[""] = InstanceDesc{Zone: t.zone, Tokens: allTakenTokens}
+	}
+	return t.GenerateTokensForRing(requestedTokensCount, 0, desc)
+}
+
+// GenerateTokensForRing returns at most requestedTokensCount unique tokens for the underlying instance with the
+// given weight, none of which clashes with the tokens of the given ring. Returned tokens are sorted. Tokens already owned by the underlying instance in
+// the ring are kept into account, and they are not returned.
+//
+// Each new token is placed in the token range with the highest ownership among the ones owned by the instance
+// of the same zone with the highest ownership per unit of weight, so that the new token takes over the ownership needed for the
+// underlying instance to reach the optimal ownership, i.e., the size of the token space divided by the number
+// of instances in the zone, weighted by the instances weight.
+func (t *ZoneAwareSpreadMinimizingTokenGenerator) GenerateTokensForRing(requestedTokensCount int, weight uint32, ringDesc *Desc) Tokens {
+	if requestedTokensCount <= 0 {
+		return Tokens{}
+	}
+
+	var (
+		used           = map[uint32]bool{}
+		instanceIDs    []string
+		ownTokens      []uint32
+		ownWeight      = max(weight, 1)
+		zoneTokenOwner = map[uint32]int{}
+	)
+	if ringDesc != nil {
+		for id, instance := range ringDesc.Ingesters {
+			for _, token := range instance.Tokens {
+				used[token] = true
+			}
+			if instance.Zone != t.zone || len(instance.Tokens) == 0 {
+				continue
+			}
+			if id == t.instanceID {
+				ownTokens = instance.Tokens
+				continue
+			}
+			instanceIDs = append(instanceIDs, id)
+		}
+	}
+
+	if len(instanceIDs) == 0 {
+		return t.generateFirstInstanceTokens(requestedTokensCount, used)
+	}
+
+	// Instances are identified by their position in the sorted slice of instance IDs, so that
+	// the same ring always generates the same tokens. The underlying instance has the last id.
+	slices.Sort(instanceIDs)
+	ownID := len(instanceIDs)
+	for id, instanceID := range instanceIDs {
+		for _, token := range ringDesc.Ingesters[instanceID].Tokens {
+			zoneTokenOwner[token] = id
+		}
+	}
+	for _, token := range ownTokens {
+		zoneTokenOwner[token] = ownID
+	}
+	zoneTokens := make([]uint32, 0, len(zoneTokenOwner))
+	for token := range zoneTokenOwner {
+		zoneTokens = append(zoneTokens, token)
+	}
+	slices.Sort(zoneTokens)
+
+	// tokensQueues is a slice of priority queues. Slice indexes correspond to the ids of the other instances
+	// of the zone, while priority queues represent their tokens, ordered from highest to lowest ownership.
+	tokensQueues := make([]ownershipPriorityQueue[ringToken], len(instanceIDs))
+	for id := range tokensQueues {
+		tokensQueues[id] = newPriorityQueue[ringToken](len(ringDesc.Ingesters[instanceIDs[id]].Tokens))
+	}
+	instancesOwnership := make([]float64, len(instanceIDs))
+	instancesWeight := make([]float64, len(instanceIDs))
+	totalWeight := float64(ownWeight)
+	for id, instanceID := range instanceIDs {
+		instance := ringDesc.Ingesters[instanceID]
+		instancesWeight[id] = float64(instance.GetEffectiveWeight())
+		totalWeight += instancesWeight[id]
+	}
+	currInstanceOwnership := 0.0
+	prev := zoneTokens[len(zoneTokens)-1]
+	for _, token := range zoneTokens {
+		info := newRingTokenOwnershipInfo(token, prev)
+		prev = token
+		owner := zoneTokenOwner[token]
+		if owner == ownID {
+			currInstanceOwnership += info.ownership
+			continue
+		}
+		instancesOwnership[owner] += info.ownership
+		heap.Push(&tokensQueues[owner], info)
+	}
+
+	// instanceQueue is a priority queue of instances such that instances with higher ownership per unit of
+	// weight have a higher priority.
+	instanceQueue := newPriorityQueue[ringInstance](len(instanceIDs))
+	for id, ownership := range instancesOwnership {
+		if tokensQueues[id].Len() == 0 {
+			// All the tokens of this instance are duplicates of tokens owned by other instances,
+			// so it has no token range to split.
+			continue
+		}
+		heap.Push(&instanceQueue, newRingInstanceOwnershipInfo(id, ownership/instancesWeight[id]))
+	}
+
+	// ignoredInstances is a slice of the instances whose tokens don't have enough space to accommodate new tokens.
+	ignoredInstances := make([]ownershipInfo[ringInstance], 0, len(instanceIDs))
+
+	// The optimal ownership of the underlying instance is proportional to its weight.
+	optimalInstanceOwnership := float64(totalTokensCount) * float64(ownWeight) / totalWeight
+	tokens := make(Tokens, 0, requestedTokensCount)
+	for len(tokens) < requestedTokensCount {
+		fallback := false
+		remainingTokensCount := float64(requestedTokensCount - len(tokens))
+		optimalTokenOwnership := max(1, (optimalInstanceOwnership-currInstanceOwnership)/remainingTokensCount)
+
+		highestOwnershipInstance := instanceQueue.Peek()
+		if highestOwnershipInstance == nil {
+			// None of the instances can accommodate a token with the optimal ownership, so we fall back
+			// to splitting in half the token range with the highest ownership of the instance with the
+			// highest ownership.
+			for _, ignoredInstance := range ignoredInstances {
+				heap.Push(&instanceQueue, ignoredInstance)
+			}
+			ignoredInstances = ignoredInstances[:0]
+			highestOwnershipInstance = instanceQueue.Peek()
+			if highestOwnershipInstance == nil {
+				// None of the other instances owns a token range.
+				break
+			}
+			highestOwnershipToken := tokensQueues[highestOwnershipInstance.item.instanceID].Peek()
+			if highestOwnershipToken.ownership < 2 {
+				// There is no space left for new tokens in this zone.
+				break
+			}
+			optimalTokenOwnership = highestOwnershipToken.ownership / 2
+			fallback = true
+		}
+
+		tokensQueue := &tokensQueues[highestOwnershipInstance.item.instanceID]
+		highestOwnershipToken := tokensQueue.Peek()
+		if highestOwnershipToken.ownership <= optimalTokenOwnership {
+			// The token with the highest ownership of the instance with the highest ownership could not
+			// accommodate a new token, hence we ignore this instance and pass to the next instance.
+			ignoredInstances = append(ignoredInstances, heap.Pop(&instanceQueue).(ownershipInfo[ringInstance]))
+			continue
+		}
+
+		token := highestOwnershipToken.item
+		newToken, ok := nextFreeToken(token, token.prevToken+uint32(optimalTokenOwnership), used)
+		if !ok {
+			if fallback {
+				break
+			}
+			ignoredInstances = append(ignoredInstances, heap.Pop(&instanceQueue).(ownershipInfo[ringInstance]))
+			continue
+		}
+		used[newToken] = true
+		tokens = append(tokens, newToken)
+
+		oldTokenOwnership := highestOwnershipToken.ownership
+		newTokenOwnership := float64(tokenDistance(newToken, token.token))
+		currInstanceOwnership += oldTokenOwnership - newTokenOwnership
+
+		// The token with the highest ownership of the instance with the highest ownership has changed,
+		// so we propagate these changes in the corresponding tokens queue.
+		highestOwnershipToken.item.prevToken = newToken
+		highestOwnershipToken.ownership = newTokenOwnership
+		heap.Fix(tokensQueue, 0)
+
+		// The ownership of the instance with the highest ownership has changed,
+		// so we propagate these changes in the instances queue.
+		highestOwnershipInstance.ownership += (newTokenOwnership - oldTokenOwnership) / instancesWeight[highestOwnershipInstance.item.instanceID]
+		heap.Fix(&instanceQueue, 0)
+
+		// The optimal token ownership of the next token has changed, so the ignored instances might
+		// be able to accommodate it: we put them back on the queue.
+		for _, ignoredInstance := range ignoredInstances {
+			heap.Push(&instanceQueue, ignoredInstance)
+		}
+		ignoredInstances = ignoredInstances[:0]
+	}
+
+	sort.Sort(tokens)
+	return tokens
+}
+
+// generateFirstInstanceTokens returns requestedTokensCount tokens evenly distributed in the token space,
+// none of which clashes with the given used tokens.
+func (t *ZoneAwareSpreadMinimizingTokenGenerator) generateFirstInstanceTokens(requestedTokensCount int, used map[uint32]bool) Tokens {
+	distance := uint32(totalTokensCount / requestedTokensCount)
+	tokens := make(Tokens, 0, requestedTokensCount)
+	for i := 0; i < requestedTokensCount; i++ {
+		start := uint32(i) * distance
+		newToken, ok := nextFreeToken(ringToken{token: start + distance, prevToken: start - 1}, start, used)
+		if !ok {
+			continue
+		}
+		used[newToken] = true
+		tokens = append(tokens, newToken)
+	}
+	return tokens
+}
+
+// nextFreeToken returns the first token starting from candidate that is not used and that lies within
+// the range (token.prevToken, token.token). It returns false if there is no such token.
+func nextFreeToken(token ringToken, candidate uint32, used map[uint32]bool) (uint32, bool) {
+	for used[candidate] || candidate == token.prevToken {
+		candidate++
+		if candidate == token.token {
+			return 0, false
+		}
+	}
+	return candidate, true
+}
+
+// CanJoin ensures that the instances of the same zone join the ring one at a time, because the tokens of
+// an instance depend on the tokens of the other instances of the zone. The underlying instance can join
+// the ring only if it is the first instance of its zone waiting to join the ring, i.e., in the PENDING
+// state without tokens, ordered by registration timestamp and then by id.
+func (t *ZoneAwareSpreadMinimizingTokenGenerator) CanJoin(instances map[string]InstanceDesc) error {
+	if !t.canJoinEnabled {
+		return nil
+	}
+
+	own, ok := instances[t.instanceID]
+	now := time.Now()
+	for id, instance := range instances {
+		if id == t.instanceID || instance.Zone != t.zone {
+			continue
+		}
+		if t.heartbeatTimeout > 0 && !instance.IsHeartbeatHealthy(t.heartbeatTimeout, now) {
+			continue
+		}
+		if instance.State != PENDING || len(instance.Tokens) > 0 || !ok {
+			continue
+		}
+		if instance.RegisteredTimestamp < own.RegisteredTimestamp || (instance.RegisteredTimestamp == own.RegisteredTimestamp && id < t.instanceID) {
+			return errorInstanceWaitingToJoin(id, t.zone)
+		}
+	}
+	return nil
+}
+
+func (t *ZoneAwareSpreadMinimizingTokenGenerator) CanJoinEnabled() bool {
+	return t.canJoinEnabled
+}
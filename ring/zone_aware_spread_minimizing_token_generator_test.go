@@ -0,0 +1,266 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_FirstInstance(t *testing.T) {
+	gen := NewZoneAwareSpreadMinimizingTokenGenerator("instance", "zone-a", 0, false)
+
+	tokens := gen.GenerateTokensForRing(4, 0, NewDesc())
+	require.Equal(t, Tokens{0, 1 << 30, 2 << 30, 3 << 30}, tokens)
+
+	// Tokens of other zones are not taken into account, except for avoiding conflicts.
+	desc := NewDesc()
+	desc.AddIngester("other", "", "zone-b", []uint32{0, 1 << 30}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	tokens = gen.GenerateTokensForRing(4, 0, desc)
+	require.Equal(t, Tokens{1, 1<<30 + 1, 2 << 30, 3 << 30}, tokens)
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_OwnershipSpread(t *testing.T) {
+	const (
+		instancesPerZone  = 30
+		tokensPerInstance = 512
+	)
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+
+	desc := NewDesc()
+	for i := 0; i < instancesPerZone; i++ {
+		for _, zone := range zones {
+			// Instance IDs don't need to follow any pattern.
+			instanceID := fmt.Sprintf("host-%x.%s", i*7919, zone)
+			gen := NewZoneAwareSpreadMinimizingTokenGenerator(instanceID, zone, 0, false)
+			tokens := gen.GenerateTokensForRing(tokensPerInstance, 0, desc)
+			require.Len(t, tokens, tokensPerInstance)
+			require.True(t, slices.IsSorted(tokens))
+			desc.AddIngester(instanceID, "", zone, tokens, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+			// All the tokens in the ring are unique.
+			require.Len(t, desc.GetTokens(), len(desc.getTokensInfo()))
+		}
+
+		for _, zone := range zones {
+			require.Less(t, ownershipSpreadByZone(desc)[zone], 0.01, "instances: %d", i+1)
+		}
+	}
+
+	// The generation is deterministic.
+	gen := NewZoneAwareSpreadMinimizingTokenGenerator("new-instance", "zone-a", 0, false)
+	require.Equal(t, gen.GenerateTokensForRing(tokensPerInstance, 0, desc), gen.GenerateTokensForRing(tokensPerInstance, 0, desc))
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_KeepsOwnTokens(t *testing.T) {
+	desc := NewDesc()
+	for _, id := range []string{"first", "second"} {
+		gen := NewZoneAwareSpreadMinimizingTokenGenerator(id, "", 0, false)
+		desc.AddIngester(id, "", "", gen.GenerateTokensForRing(128, 0, desc), ACTIVE, time.Now(), false, time.Time{}, 0)
+	}
+
+	// The third instance registers only half of its tokens.
+	gen := NewZoneAwareSpreadMinimizingTokenGenerator("third", "", 0, false)
+	tokens := gen.GenerateTokensForRing(128, 0, desc)
+	desc.AddIngester("third", "", "", tokens[:64], ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	// Missing tokens complete the ownership of the third instance.
+	missing := gen.GenerateTokensForRing(64, 0, desc)
+	require.Len(t, missing, 64)
+	for _, token := range missing {
+		require.NotContains(t, tokens[:64], token)
+	}
+	desc.AddIngester("third", "", "", append(tokens[:64:64], missing...), ACTIVE, time.Now(), false, time.Time{}, 0)
+	require.Less(t, ownershipSpreadByZone(desc)[""], 0.01)
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_FullZone(t *testing.T) {
+	desc := NewDesc()
+	desc.AddIngester("first", "", "zone", []uint32{0, 2, 4}, ACTIVE, time.Now(), false, time.Time{}, 0)
+	desc.AddIngester("other", "", "other-zone", []uint32{1, 5}, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+	gen := NewZoneAwareSpreadMinimizingTokenGenerator("second", "zone", 0, false)
+	tokens := gen.GenerateTokensForRing(10, 0, desc)
+	require.Len(t, tokens, 10)
+	for _, token := range tokens {
+		require.NotContains(t, []uint32{0, 1, 2, 4, 5}, token)
+	}
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_DuplicateTokens(t *testing.T) {
+	t.Run("instance owning only duplicate tokens", func(t *testing.T) {
+		desc := NewDesc()
+		desc.AddIngester("first", "", "zone", []uint32{1 << 30, 1 << 31}, ACTIVE, time.Now(), false, time.Time{}, 0)
+		desc.AddIngester("second", "", "zone", []uint32{1 << 30, 1 << 31}, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+		gen := NewZoneAwareSpreadMinimizingTokenGenerator("third", "zone", 0, false)
+		tokens := gen.GenerateTokensForRing(512, 0, desc)
+		require.Len(t, tokens, 512)
+		for _, token := range tokens {
+			require.NotContains(t, []uint32{1 << 30, 1 << 31}, token)
+		}
+	})
+
+	t.Run("other instances owning only tokens of the underlying instance", func(t *testing.T) {
+		desc := NewDesc()
+		desc.AddIngester("first", "", "zone", []uint32{1 << 30}, ACTIVE, time.Now(), false, time.Time{}, 0)
+		desc.AddIngester("second", "", "zone", []uint32{1 << 30}, ACTIVE, time.Now(), false, time.Time{}, 0)
+
+		gen := NewZoneAwareSpreadMinimizingTokenGenerator("second", "zone", 0, false)
+		require.Empty(t, gen.GenerateTokensForRing(16, 0, desc))
+	})
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokens(t *testing.T) {
+	gen := NewZoneAwareSpreadMinimizingTokenGenerator("instance", "zone", 0, false)
+
+	first := gen.GenerateTokens(512, nil)
+	require.Len(t, first, 512)
+
+	second := gen.GenerateTokens(512, first)
+	require.Len(t, second, 512)
+	require.True(t, slices.IsSorted(second))
+	for _, token := range second {
+		_, found := slices.BinarySearch(first, token)
+		require.False(t, found)
+	}
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_CanJoin(t *testing.T) {
+	now := time.Now()
+	instances := map[string]InstanceDesc{
+		"b":           {Zone: "zone-a", State: PENDING, RegisteredTimestamp: now.Unix(), Timestamp: now.Unix()},
+		"a":           {Zone: "zone-a", State: PENDING, RegisteredTimestamp: now.Unix(), Timestamp: now.Unix()},
+		"old":         {Zone: "zone-a", State: ACTIVE, RegisteredTimestamp: now.Add(-time.Hour).Unix(), Timestamp: now.Unix(), Tokens: []uint32{1}},
+		"other-zone":  {Zone: "zone-b", State: PENDING, RegisteredTimestamp: now.Add(-time.Hour).Unix(), Timestamp: now.Unix()},
+		"c":           {Zone: "zone-a", State: PENDING, RegisteredTimestamp: now.Add(time.Minute).Unix(), Timestamp: now.Unix()},
+		"unhealthy-d": {Zone: "zone-a", State: PENDING, RegisteredTimestamp: now.Add(-time.Hour).Unix(), Timestamp: now.Add(-time.Hour).Unix()},
+	}
+
+	tests := map[string]struct {
+		instanceID       string
+		heartbeatTimeout time.Duration
+		canJoinEnabled   bool
+		expectedErr      error
+	}{
+		"can join disabled": {
+			instanceID:  "c",
+			expectedErr: nil,
+		},
+		"first waiting instance by registered timestamp and id": {
+			instanceID:       "a",
+			heartbeatTimeout: time.Minute,
+			canJoinEnabled:   true,
+		},
+		"same registered timestamp but higher id": {
+			instanceID:       "b",
+			heartbeatTimeout: time.Minute,
+			canJoinEnabled:   true,
+			expectedErr:      errorInstanceWaitingToJoin("a", "zone-a"),
+		},
+		"unhealthy waiting instance is taken into account without heartbeat timeout": {
+			instanceID:     "a",
+			canJoinEnabled: true,
+			expectedErr:    errorInstanceWaitingToJoin("unhealthy-d", "zone-a"),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			gen := NewZoneAwareSpreadMinimizingTokenGenerator(testData.instanceID, "zone-a", testData.heartbeatTimeout, testData.canJoinEnabled)
+			require.Equal(t, testData.canJoinEnabled, gen.CanJoinEnabled())
+			require.Equal(t, testData.expectedErr, gen.CanJoin(instances))
+		})
+	}
+}
+
+func BenchmarkTokenGenerators_OwnershipSpread(b *testing.B) {
+	const tokensPerInstance = 512
+	zones := []string{"zone-a", "zone-b", "zone-c"}
+
+	generators := map[string]func(instanceID, zone string) TokenGenerator{
+		"random": func(string, string) TokenGenerator {
+			return NewRandomTokenGeneratorWithSeed(1)
+		},
+		"zone-aware-spread-minimizing": func(instanceID, zone string) TokenGenerator {
+			return NewZoneAwareSpreadMinimizingTokenGenerator(instanceID, zone, 0, false)
+		},
+	}
+
+	for _, instancesPerZone := range []int{3, 30, 100} {
+		for name, newGenerator := range generators {
+			b.Run(fmt.Sprintf("generator=%s,instances_per_zone=%d", name, instancesPerZone), func(b *testing.B) {
+				var spread float64
+				for n := 0; n < b.N; n++ {
+					desc := NewDesc()
+					for i := 0; i < instancesPerZone; i++ {
+						for _, zone := range zones {
+							instanceID := fmt.Sprintf("instance-%d.%s", i, zone)
+							tokens := generateTokens(newGenerator(instanceID, zone), tokensPerInstance, 0, desc, desc.GetTokens())
+							desc.AddIngester(instanceID, "", zone, tokens, ACTIVE, time.Now(), false, time.Time{}, 0)
+						}
+					}
+
+					spread = 0
+					for _, zoneSpread := range ownershipSpreadByZone(desc) {
+						spread = max(spread, zoneSpread)
+					}
+				}
+				b.ReportMetric(spread*100, "max_zone_spread_%")
+			})
+		}
+	}
+}
+
+// ownershipSpreadByZone returns, for each zone of the given ring, the relative difference
+// between the highest and the lowest registered ownership of the instances of the zone.
+func ownershipSpreadByZone(desc *Desc) map[string]float64 {
+	tokensInfo := desc.getTokensInfo()
+	ownershipByInstance := map[string]float64{}
+	for _, tokens := range desc.getTokensByZone() {
+		prev := tokens[len(tokens)-1]
+		for _, token := range tokens {
+			ownershipByInstance[tokensInfo[token].InstanceID] += float64(tokenDistance(prev, token))
+			prev = token
+		}
+	}
+
+	minByZone := map[string]float64{}
+	maxByZone := map[string]float64{}
+	for id, ownership := range ownershipByInstance {
+		zone := desc.Ingesters[id].Zone
+		if curr, ok := minByZone[zone]; !ok || ownership < curr {
+			minByZone[zone] = ownership
+		}
+		maxByZone[zone] = math.Max(maxByZone[zone], ownership)
+	}
+
+	spread := make(map[string]float64, len(maxByZone))
+	for zone, maxOwnership := range maxByZone {
+		spread[zone] = (maxOwnership - minByZone[zone]) / maxOwnership
+	}
+	return spread
+}
+
+func TestZoneAwareSpreadMinimizingTokenGenerator_GenerateTokensForRing_Weights(t *testing.T) {
+	const tokensPerInstance = 128
+
+	desc := NewDesc()
+	for i, weight := range []uint32{1, 2, 1, 3} {
+		instanceID := fmt.Sprintf("instance-%d", i)
+		gen := NewZoneAwareSpreadMinimizingTokenGenerator(instanceID, "zone", 0, false)
+		tokens := gen.GenerateTokensForRing(tokensPerInstance*int(weight), weight, desc)
+		require.Len(t, tokens, tokensPerInstance*int(weight))
+		desc.AddIngester(instanceID, "", "zone", tokens, ACTIVE, time.Now(), false, time.Time{}, weight)
+	}
+
+	// The ownership of each instance is proportional to its weight.
+	plan, err := PlanRebalance(desc, 1, 0)
+	require.NoError(t, err)
+	for id, instance := range plan.Instances {
+		require.InDelta(t, float64(instance.Weight)/7, instance.Before, 0.001, id)
+	}
+}
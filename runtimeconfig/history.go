@@ -0,0 +1,134 @@
+package runtimeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigChange is a change of a single value between two versions of the merged runtime configuration document.
+type ConfigChange struct {
+	// Path is the dot-separated path of the value in the document.
+	Path string `json:"path"`
+
+	// Old is the previous value, or nil if the value was added.
+	Old interface{} `json:"old,omitempty"`
+
+	// New is the new value, or nil if the value was removed.
+	New interface{} `json:"new,omitempty"`
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatConfigValue(c.Old), formatConfigValue(c.New))
+}
+
+// ConfigVersion is a version of the runtime configuration applied by the Manager.
+type ConfigVersion struct {
+	// Hash is the SHA-256 hash of the merged runtime configuration document.
+	Hash      string    `json:"sha256"`
+	AppliedAt time.Time `json:"applied_at"`
+
+	// Changes are the changes from the previous version, sorted by path. They're empty for the initial version.
+	Changes []ConfigChange `json:"changes,omitempty"`
+}
+
+// History returns the last applied versions of the runtime configuration, oldest first.
+func (om *Manager) History() []ConfigVersion {
+	om.historyMtx.Lock()
+	defer om.historyMtx.Unlock()
+
+	return append([]ConfigVersion(nil), om.history...)
+}
+
+// HistoryHandler returns an HTTP handler returning the last applied versions of the runtime configuration, with
+// their changes, as JSON, newest first.
+func (om *Manager) HistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		history := om.History()
+		for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+			history[i], history[j] = history[j], history[i]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Versions []ConfigVersion `json:"versions"`
+		}{history}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (om *Manager) addVersion(v ConfigVersion) {
+	if om.cfg.HistorySize <= 0 {
+		return
+	}
+
+	om.historyMtx.Lock()
+	defer om.historyMtx.Unlock()
+
+	om.history = append(om.history, v)
+	if over := len(om.history) - om.cfg.HistorySize; over > 0 {
+		om.history = append(om.history[:0:0], om.history[over:]...)
+	}
+}
+
+// diffConfigMaps returns the changes from a to b, sorted by path. Nested maps are compared key by key, other
+// values as a whole.
+func diffConfigMaps(prefix string, a, b map[string]interface{}) []ConfigChange {
+	var changes []ConfigChange
+	for k, av := range a {
+		path := joinConfigPath(prefix, k)
+		bv, ok := b[k]
+		if !ok {
+			changes = append(changes, ConfigChange{Path: path, Old: av})
+			continue
+		}
+
+		am, aIsMap := av.(map[string]interface{})
+		bm, bIsMap := bv.(map[string]interface{})
+		if aIsMap && bIsMap {
+			changes = append(changes, diffConfigMaps(path, am, bm)...)
+		} else if !reflect.DeepEqual(av, bv) {
+			changes = append(changes, ConfigChange{Path: path, Old: av, New: bv})
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, ConfigChange{Path: joinConfigPath(prefix, k), New: bv})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func joinConfigPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func formatConfigChanges(changes []ConfigChange) string {
+	formatted := make([]string, 0, len(changes))
+	for _, c := range changes {
+		formatted = append(formatted, c.String())
+	}
+	return strings.Join(formatted, "; ")
+}
+
+func formatConfigValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	if out, err := json.Marshal(v); err == nil {
+		return string(out)
+	}
+	return fmt.Sprintf("%v", v)
+}
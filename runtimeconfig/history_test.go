@@ -0,0 +1,125 @@
+package runtimeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+func TestDiffConfigMaps(t *testing.T) {
+	a := map[string]interface{}{
+		"overrides": map[string]interface{}{
+			"user1": map[string]interface{}{"limit1": 100, "limit2": 100},
+			"user2": map[string]interface{}{"limit1": 100},
+		},
+		"list":    []interface{}{1, 2},
+		"removed": "value",
+	}
+	b := map[string]interface{}{
+		"overrides": map[string]interface{}{
+			"user1": map[string]interface{}{"limit1": 100, "limit2": 200},
+			"user3": map[string]interface{}{"limit1": 300},
+		},
+		"list": []interface{}{1, 2, 3},
+	}
+
+	changes := diffConfigMaps("", a, b)
+	assert.Equal(t, []ConfigChange{
+		{Path: "list", Old: []interface{}{1, 2}, New: []interface{}{1, 2, 3}},
+		{Path: "overrides.user1.limit2", Old: 100, New: 200},
+		{Path: "overrides.user2", Old: map[string]interface{}{"limit1": 100}},
+		{Path: "overrides.user3", New: map[string]interface{}{"limit1": 300}},
+		{Path: "removed", Old: "value"},
+	}, changes)
+	assert.Equal(t, `list: [1,2] -> [1,2,3]; overrides.user1.limit2: 100 -> 200; overrides.user2: {"limit1":100} -> <none>; overrides.user3: <none> -> {"limit1":300}; removed: "value" -> <none>`, formatConfigChanges(changes))
+
+	assert.Empty(t, diffConfigMaps("", a, a))
+}
+
+func TestManager_ValidatorAndHistory(t *testing.T) {
+	cfg := newTestOverridesManagerConfig(t, time.Hour, testLoadOverrides)
+	cfg.HistorySize = 2
+	cfg.Validator = func(config interface{}) error {
+		for _, limits := range config.(*testOverrides).Overrides {
+			if limits.Limit2 > 1000 {
+				return errors.New("limit2 is too high")
+			}
+		}
+		return nil
+	}
+	writeConfig := func(config string) {
+		require.NoError(t, os.WriteFile(cfg.LoadPath[0], []byte(config), 0600))
+	}
+
+	writeConfig(`overrides:
+    user1:
+        limit2: 100
+`)
+
+	reg := prometheus.NewPedanticRegistry()
+	manager, err := New(cfg, "overrides", reg, log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), manager))
+	})
+
+	// The reload period is long, so the test reloads the config itself.
+	writeConfig(`overrides:
+    user1:
+        limit2: 2000
+`)
+	require.ErrorContains(t, manager.loadConfig(context.Background()), "limit2 is too high")
+	assert.Equal(t, 100, manager.GetConfig().(*testOverrides).Overrides["user1"].Limit2)
+	assert.Equal(t, float64(0), testutil.ToFloat64(manager.configLoadSuccess))
+	require.Len(t, manager.History(), 1)
+	assert.Empty(t, manager.History()[0].Changes)
+
+	writeConfig(`overrides:
+    user1:
+        limit2: 200
+`)
+	require.NoError(t, manager.loadConfig(context.Background()))
+	assert.Equal(t, 200, manager.GetConfig().(*testOverrides).Overrides["user1"].Limit2)
+	assert.Equal(t, float64(1), testutil.ToFloat64(manager.configLoadSuccess))
+
+	writeConfig(`overrides:
+    user1:
+        limit2: 200
+    user2:
+        limit1: 10
+`)
+	require.NoError(t, manager.loadConfig(context.Background()))
+
+	// The history only keeps the last 2 versions.
+	history := manager.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, []ConfigChange{{Path: "overrides.user1.limit2", Old: 100, New: 200}}, history[0].Changes)
+	assert.Equal(t, []ConfigChange{{Path: "overrides.user2", New: map[string]interface{}{"limit1": 10}}}, history[1].Changes)
+	assert.NotEqual(t, history[0].Hash, history[1].Hash)
+
+	rec := httptest.NewRecorder()
+	manager.HistoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/runtime_config/history", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Versions []ConfigVersion `json:"versions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Versions, 2)
+	assert.Equal(t, history[1].Hash, resp.Versions[0].Hash)
+	assert.Equal(t, "overrides.user2", resp.Versions[0].Changes[0].Path)
+}
@@ -8,7 +8,6 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -35,45 +34,73 @@ type Config struct {
 	// Requires a non-empty value
 	LoadPath flagext.StringSliceCSV `yaml:"file"`
 	Loader   Loader                 `yaml:"-"`
+
+	// Sources are additional sources of runtime configuration, merged in order after the files in LoadPath.
+	Sources []Source `yaml:"-"`
+
+	// Validator validates the loaded configuration before it's applied. If it returns an error, the configuration
+	// is rejected and the last good configuration is kept.
+	Validator func(config interface{}) error `yaml:"-"`
+
+	// HistorySize is the number of applied configuration versions kept in the history.
+	HistorySize int `yaml:"history_size" category:"advanced"`
 }
 
 // RegisterFlags registers flags.
 func (mc *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&mc.LoadPath, "runtime-config.file", "Comma separated list of yaml files with the configuration that can be updated at runtime. Runtime config files will be merged from left to right.")
 	f.DurationVar(&mc.ReloadPeriod, "runtime-config.reload-period", 10*time.Second, "How often to check runtime config files.")
+	f.IntVar(&mc.HistorySize, "runtime-config.history-size", 10, "Number of applied runtime config versions, with their changes, kept in the history. 0 to disable.")
 }
 
-// Manager periodically reloads the configuration from specified files, and keeps this
+// Manager periodically reloads the configuration from specified files and sources, and keeps this
 // configuration available for clients.
 type Manager struct {
 	services.Service
 
-	cfg    Config
-	logger log.Logger
+	cfg     Config
+	logger  log.Logger
+	sources []Source
 
 	listenersMtx sync.Mutex
 	listeners    []chan interface{}
 
+	// onConfig is called synchronously with each newly applied config, if set before the Manager starts.
+	onConfig func(config interface{})
+
 	configMtx sync.RWMutex
 	config    interface{}
 
 	configLoadSuccess prometheus.Gauge
 	configHash        *prometheus.GaugeVec
 
-	// Maps path to hash. Only used by loadConfig in Starting and Running states, so it doesn't need synchronization.
-	fileHashes map[string]string
+	// Maps source name to hash. Only used by loadConfig in Starting and Running states, so it doesn't need synchronization.
+	sourceHashes map[string]string
+
+	// Last applied merged yaml document, to compute the changes of the next one. Only used by loadConfig.
+	appliedDocument map[string]interface{}
+
+	historyMtx sync.Mutex
+	history    []ConfigVersion
 }
 
 // New creates an instance of Manager. Manager is a services.Service, and must be explicitly started to perform any work.
 func New(cfg Config, configName string, registerer prometheus.Registerer, logger log.Logger) (*Manager, error) {
-	if len(cfg.LoadPath) == 0 {
+	if len(cfg.LoadPath) == 0 && len(cfg.Sources) == 0 {
 		return nil, errors.New("LoadPath is empty")
 	}
 
+	sources := make([]Source, 0, len(cfg.LoadPath)+len(cfg.Sources))
+	for _, path := range cfg.LoadPath {
+		sources = append(sources, NewFileSource(path))
+	}
+	sources = append(sources, cfg.Sources...)
+
 	registerer = prometheus.WrapRegistererWith(prometheus.Labels{"config": configName}, registerer)
 
 	mgr := Manager{
-		cfg: cfg,
+		cfg:     cfg,
+		sources: sources,
 		configLoadSuccess: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
 			Name: "runtime_config_last_reload_successful",
 			Help: "Whether the last runtime-config reload attempt was successful.",
@@ -89,12 +116,12 @@ func New(cfg Config, configName string, registerer prometheus.Registerer, logger
 	return &mgr, nil
 }
 
-func (om *Manager) starting(_ context.Context) error {
-	if len(om.cfg.LoadPath) == 0 {
+func (om *Manager) starting(ctx context.Context) error {
+	if len(om.sources) == 0 {
 		return nil
 	}
 
-	return errors.Wrap(om.loadConfig(), "failed to load runtime config")
+	return errors.Wrap(om.loadConfig(ctx), "failed to load runtime config")
 }
 
 // CreateListenerChannel creates new channel that can be used to receive new config values.
@@ -128,7 +155,7 @@ func (om *Manager) CloseListenerChannel(listener <-chan interface{}) {
 }
 
 func (om *Manager) loop(ctx context.Context) error {
-	if len(om.cfg.LoadPath) == 0 {
+	if len(om.sources) == 0 {
 		level.Info(om.logger).Log("msg", "runtime config disabled: file not specified")
 		<-ctx.Done()
 		return nil
@@ -137,41 +164,73 @@ func (om *Manager) loop(ctx context.Context) error {
 	ticker := time.NewTicker(om.cfg.ReloadPeriod)
 	defer ticker.Stop()
 
+	// Watching sources trigger a reload as soon as they change.
+	changed := make(chan struct{}, 1)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for _, s := range om.sources {
+		if ws, ok := s.(WatchingSource); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ws.Watch(ctx, func() {
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				})
+			}()
+		}
+	}
+
 	for {
 		select {
 		case <-ticker.C:
-			err := om.loadConfig()
-			if err != nil {
-				// Log but don't stop on error - we don't want to halt all ingesters because of a typo
-				level.Error(om.logger).Log("msg", "failed to load config", "err", err)
-			}
+		case <-changed:
 		case <-ctx.Done():
 			return nil
 		}
+
+		err := om.loadConfig(ctx)
+		if err != nil {
+			// Log but don't stop on error - we don't want to halt all ingesters because of a typo
+			level.Error(om.logger).Log("msg", "failed to load config", "err", err)
+		}
+	}
+}
+
+// readSource reads the document of s. The read is bounded by the reload period, so that a stalled source
+// doesn't block the start of the manager or the following reloads.
+func (om *Manager) readSource(ctx context.Context, s Source) ([]byte, error) {
+	if om.cfg.ReloadPeriod > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, om.cfg.ReloadPeriod)
+		defer cancel()
 	}
+	return s.Read(ctx)
 }
 
-// loadConfig loads all configuration files using the loader function then merges the yaml configuration files into one yaml document.
-// and notifies listeners if successful.
-func (om *Manager) loadConfig() error {
+// loadConfig reads all configuration sources, merges their yaml documents into one yaml document, loads it using
+// the loader function, and notifies listeners if successful.
+func (om *Manager) loadConfig(ctx context.Context) error {
 	rawData := map[string][]byte{}
 	hashes := map[string]string{}
 
-	for _, f := range om.cfg.LoadPath {
-		buf, err := os.ReadFile(f)
+	for _, s := range om.sources {
+		buf, err := om.readSource(ctx, s)
 		if err != nil {
 			om.configLoadSuccess.Set(0)
-			return errors.Wrapf(err, "read file %q", f)
+			return errors.Wrapf(err, "read %q", s.Name())
 		}
 
-		rawData[f] = buf
-		hashes[f] = fmt.Sprintf("%x", sha256.Sum256(buf))
+		rawData[s.Name()] = buf
+		hashes[s.Name()] = fmt.Sprintf("%x", sha256.Sum256(buf))
 	}
 
 	// check if new hashes are the same as before
 	sameHashes := true
 	for f, h := range hashes {
-		if om.fileHashes[f] != h {
+		if om.sourceHashes[f] != h {
 			sameHashes = false
 			break
 		}
@@ -184,12 +243,12 @@ func (om *Manager) loadConfig() error {
 	}
 
 	mergedConfig := map[string]interface{}{}
-	for _, f := range om.cfg.LoadPath {
-		data := rawData[f]
-		yamlFile, err := om.unmarshalMaybeGzipped(f, data)
+	for _, s := range om.sources {
+		data := rawData[s.Name()]
+		yamlFile, err := om.unmarshalMaybeGzipped(s.Name(), data)
 		if err != nil {
 			om.configLoadSuccess.Set(0)
-			return errors.Wrapf(err, "unmarshal file %q", f)
+			return errors.Wrapf(err, "unmarshal %q", s.Name())
 		}
 		mergedConfig = mergeConfigMaps(mergedConfig, yamlFile)
 	}
@@ -206,17 +265,36 @@ func (om *Manager) loadConfig() error {
 		om.configLoadSuccess.Set(0)
 		return errors.Wrap(err, "load file")
 	}
+
+	if om.cfg.Validator != nil {
+		if err := om.cfg.Validator(cfg); err != nil {
+			om.configLoadSuccess.Set(0)
+			return errors.Wrap(err, "validate config")
+		}
+	}
 	om.configLoadSuccess.Set(1)
 
 	om.setConfig(cfg)
 	om.callListeners(cfg)
+	if om.onConfig != nil {
+		om.onConfig(cfg)
+	}
+
+	// The initial configuration isn't reported as a change.
+	var changes []ConfigChange
+	if om.appliedDocument != nil {
+		changes = diffConfigMaps("", om.appliedDocument, mergedConfig)
+		level.Info(om.logger).Log("msg", "runtime config changed", "sha256", fmt.Sprintf("%x", hash), "changes", len(changes), "diff", formatConfigChanges(changes))
+	}
+	om.appliedDocument = mergedConfig
+	om.addVersion(ConfigVersion{Hash: fmt.Sprintf("%x", hash), AppliedAt: time.Now(), Changes: changes})
 
 	// expose hash of runtime config
 	om.configHash.Reset()
 	om.configHash.WithLabelValues(fmt.Sprintf("%x", hash)).Set(1)
 
 	// preserve hashes for next loop
-	om.fileHashes = hashes
+	om.sourceHashes = hashes
 	return nil
 }
 
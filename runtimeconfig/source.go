@@ -0,0 +1,151 @@
+package runtimeconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/grafana/dskit/kv"
+)
+
+// Source is a source of runtime configuration, providing a YAML document. Documents of all sources are merged in
+// order. Documents are gzipped if the source name ends with .gz.
+type Source interface {
+	// Name identifies the source in logs and errors.
+	Name() string
+
+	// Read returns the current document of the source. The Manager cancels ctx if the read takes longer
+	// than the reload period.
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// WatchingSource is a Source which notifies about changes of its document, so that the runtime configuration is
+// reloaded immediately instead of at the next reload period.
+type WatchingSource interface {
+	Source
+
+	// Watch calls notify whenever the document may have changed, until ctx is done.
+	Watch(ctx context.Context, notify func())
+}
+
+type fileSource struct {
+	path string
+}
+
+// NewFileSource returns a Source reading the file at path.
+func NewFileSource(path string) Source {
+	return fileSource{path: path}
+}
+
+func (s fileSource) Name() string {
+	return s.path
+}
+
+func (s fileSource) Read(_ context.Context) ([]byte, error) {
+	return os.ReadFile(s.path)
+}
+
+type httpSource struct {
+	url    string
+	client *http.Client
+
+	// ETag and body of the last response, used to avoid downloading an unchanged document.
+	mtx  sync.Mutex
+	etag string
+	body []byte
+}
+
+// NewHTTPSource returns a Source fetching the document from url with a GET request. If the server returns an ETag
+// header, the document is only downloaded again when it changes, by sending an If-None-Match header. If client is
+// nil, http.DefaultClient is used: the requests have no timeout other than the reload period of the Manager.
+func NewHTTPSource(url string, client *http.Client) Source {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpSource{url: url, client: client}
+}
+
+func (s *httpSource) Name() string {
+	return s.url
+}
+
+func (s *httpSource) Read(ctx context.Context) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if s.etag != "" {
+			return s.body, nil
+		}
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "read response body")
+		}
+		s.etag = resp.Header.Get("ETag")
+		s.body = body
+		return body, nil
+	}
+	return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+}
+
+type kvSource struct {
+	client kv.Client
+	key    string
+}
+
+// NewKVSource returns a WatchingSource reading the document stored under key in the KV store. The client must use
+// a codec decoding values to strings or byte slices, such as codec.String. A missing key is read as an empty
+// document.
+func NewKVSource(client kv.Client, key string) WatchingSource {
+	return kvSource{client: client, key: key}
+}
+
+func (s kvSource) Name() string {
+	return "kv:" + s.key
+}
+
+func (s kvSource) Read(ctx context.Context) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unexpected value of type %T", value)
+	}
+}
+
+func (s kvSource) Watch(ctx context.Context, notify func()) {
+	s.client.WatchKey(ctx, s.key, func(interface{}) bool {
+		notify()
+		return true
+	})
+}
@@ -0,0 +1,153 @@
+package runtimeconfig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/dskit/kv/codec"
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/services"
+)
+
+func TestHTTPSource(t *testing.T) {
+	var document atomic.String
+	document.Store("value: 1\n")
+	var downloads, notModified atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		etag := `"` + strings.TrimSpace(document.Load()) + `"`
+		if req.Header.Get("If-None-Match") == etag {
+			notModified.Inc()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Inc()
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(document.Load()))
+	}))
+	t.Cleanup(server.Close)
+
+	source := NewHTTPSource(server.URL, nil)
+	assert.Equal(t, server.URL, source.Name())
+
+	for i := 0; i < 3; i++ {
+		body, err := source.Read(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "value: 1\n", string(body))
+	}
+	assert.Equal(t, int32(1), downloads.Load())
+	assert.Equal(t, int32(2), notModified.Load())
+
+	document.Store("value: 2\n")
+	body, err := source.Read(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "value: 2\n", string(body))
+	assert.Equal(t, int32(2), downloads.Load())
+}
+
+func TestHTTPSource_UnexpectedStatusCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := NewHTTPSource(server.URL, nil).Read(context.Background())
+	require.ErrorContains(t, err, "unexpected status code 404")
+}
+
+func TestManager_StalledHTTPSource(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		select {
+		case <-stalled:
+		case <-req.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stalled) })
+
+	// The read is bounded by the reload period, so the manager fails to start instead of blocking.
+	manager, err := New(Config{ReloadPeriod: 100 * time.Millisecond, Loader: valueLoader, Sources: []Source{NewHTTPSource(server.URL, nil)}}, "overrides", nil, log.NewNopLogger())
+	require.NoError(t, err)
+	err = services.StartAndAwaitRunning(context.Background(), manager)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestManager_MergesSourcesInOrder(t *testing.T) {
+	cfg := newTestOverridesManagerConfig(t, time.Hour, testLoadOverrides)
+	require.NoError(t, os.WriteFile(cfg.LoadPath[0], []byte(`overrides:
+    user1:
+        limit1: 100
+        limit2: 100
+`), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`overrides:
+    user1:
+        limit2: 200
+    user2:
+        limit1: 300
+`))
+	}))
+	t.Cleanup(server.Close)
+	cfg.Sources = []Source{NewHTTPSource(server.URL, nil)}
+
+	manager, err := New(cfg, "overrides", nil, log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), manager))
+	})
+
+	overrides := manager.GetConfig().(*testOverrides).Overrides
+	assert.Equal(t, TestLimits{Limit1: 100, Limit2: 200}, *overrides["user1"])
+	assert.Equal(t, TestLimits{Limit1: 300}, *overrides["user2"])
+}
+
+func TestManager_KVSourceWatch(t *testing.T) {
+	client, closer := consul.NewInMemoryClient(codec.String{}, log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	put := func(document string) {
+		require.NoError(t, client.CAS(context.Background(), "runtime", func(interface{}) (interface{}, bool, error) {
+			return document, false, nil
+		}))
+	}
+
+	// A missing key is an empty document.
+	source := NewKVSource(client, "runtime")
+	body, err := source.Read(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	put("value: 1\n")
+
+	// The reload period is long, so updates are only picked up by watching the key.
+	manager, err := New(Config{ReloadPeriod: time.Hour, Loader: valueLoader, Sources: []Source{source}}, "overrides", nil, log.NewNopLogger())
+	require.NoError(t, err)
+	ch := manager.CreateListenerChannel(1)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), manager))
+	})
+	assert.Equal(t, value{Value: 1}, manager.GetConfig())
+	<-ch
+
+	put("value: 2\n")
+	select {
+	case v := <-ch:
+		assert.Equal(t, value{Value: 2}, v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener was not called")
+	}
+}
@@ -0,0 +1,119 @@
+package runtimeconfig
+
+import (
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TypedLoader loads a configuration of type T.
+type TypedLoader[T any] func(r io.Reader) (T, error)
+
+// TypedManager is a Manager whose configuration is of type T, so that consumers don't need to type-assert it.
+type TypedManager[T any] struct {
+	*Manager
+
+	subscriptionsMtx sync.Mutex
+	subscriptions    []*typedSubscription[T]
+}
+
+type typedSubscription[T any] struct {
+	notify func(config T)
+}
+
+// NewTypedManager creates a TypedManager loading its configuration with loader. Config.Loader is ignored.
+// TypedManager is a services.Service, and must be explicitly started to perform any work.
+func NewTypedManager[T any](cfg Config, loader TypedLoader[T], configName string, registerer prometheus.Registerer, logger log.Logger) (*TypedManager[T], error) {
+	cfg.Loader = func(r io.Reader) (interface{}, error) {
+		return loader(r)
+	}
+
+	mgr, err := New(cfg, configName, registerer, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	tm := &TypedManager[T]{Manager: mgr}
+	mgr.onConfig = func(config interface{}) {
+		tm.notifySubscriptions(config.(T))
+	}
+	return tm, nil
+}
+
+// Get returns the last loaded configuration, or the zero value of T if no configuration has been loaded yet.
+func (tm *TypedManager[T]) Get() T {
+	config, _ := tm.get()
+	return config
+}
+
+// get returns the last loaded configuration, and whether a configuration has been loaded yet.
+func (tm *TypedManager[T]) get() (T, bool) {
+	config, ok := tm.GetConfig().(T)
+	return config, ok
+}
+
+// Subscribe calls fn with the new configuration whenever it's reloaded. fn is called synchronously by the
+// reload, so it must not block. Returned function cancels the subscription.
+func (tm *TypedManager[T]) Subscribe(fn func(config T)) func() {
+	return tm.subscribe(&typedSubscription[T]{notify: fn})
+}
+
+// SubscribeProjection calls fn with the projection of the new configuration whenever the projection changes,
+// compared with reflect.DeepEqual. For example, a projection returning the overrides of a single tenant only
+// notifies about changes of these overrides. If no configuration has been loaded yet, fn is called with the
+// projection of the first one. fn is called synchronously by the reload, so it must not block.
+// Returned function cancels the subscription.
+func SubscribeProjection[T, P any](tm *TypedManager[T], project func(config T) P, fn func(projection P)) func() {
+	// Only changes after the subscription are notified. The configuration isn't projected until it's loaded,
+	// since project may not handle the zero value of T.
+	mtx := sync.Mutex{}
+	var last P
+	config, loaded := tm.get()
+	if loaded {
+		last = project(config)
+	}
+
+	return tm.subscribe(&typedSubscription[T]{notify: func(config T) {
+		next := project(config)
+
+		mtx.Lock()
+		changed := !loaded || !reflect.DeepEqual(last, next)
+		last, loaded = next, true
+		mtx.Unlock()
+
+		if changed {
+			fn(next)
+		}
+	}})
+}
+
+func (tm *TypedManager[T]) subscribe(s *typedSubscription[T]) func() {
+	tm.subscriptionsMtx.Lock()
+	defer tm.subscriptionsMtx.Unlock()
+
+	tm.subscriptions = append(tm.subscriptions, s)
+	return func() {
+		tm.subscriptionsMtx.Lock()
+		defer tm.subscriptionsMtx.Unlock()
+
+		for ix, sub := range tm.subscriptions {
+			if sub == s {
+				tm.subscriptions = append(tm.subscriptions[:ix], tm.subscriptions[ix+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (tm *TypedManager[T]) notifySubscriptions(config T) {
+	tm.subscriptionsMtx.Lock()
+	subscriptions := append([]*typedSubscription[T](nil), tm.subscriptions...)
+	tm.subscriptionsMtx.Unlock()
+
+	for _, s := range subscriptions {
+		s.notify(config)
+	}
+}
@@ -0,0 +1,127 @@
+package runtimeconfig
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/services"
+)
+
+func TestTypedManager(t *testing.T) {
+	cfg := newTestOverridesManagerConfig(t, time.Hour, nil)
+	writeConfig := func(config string) {
+		require.NoError(t, os.WriteFile(cfg.LoadPath[0], []byte(config), 0600))
+	}
+	writeConfig(`overrides:
+    user1:
+        limit1: 1
+`)
+
+	loader := func(r io.Reader) (*testOverrides, error) {
+		config, err := testLoadOverrides(r)
+		if err != nil {
+			return nil, err
+		}
+		return config.(*testOverrides), nil
+	}
+
+	manager, err := NewTypedManager[*testOverrides](cfg, loader, "overrides", nil, log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Nil(t, manager.Get())
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), manager))
+	})
+	assert.Equal(t, 1, manager.Get().Overrides["user1"].Limit1)
+
+	var all []*testOverrides
+	unsubscribe := manager.Subscribe(func(config *testOverrides) {
+		all = append(all, config)
+	})
+
+	var user1, user2 []*TestLimits
+	SubscribeProjection(manager, func(config *testOverrides) *TestLimits {
+		return config.Overrides["user1"]
+	}, func(limits *TestLimits) {
+		user1 = append(user1, limits)
+	})
+	SubscribeProjection(manager, func(config *testOverrides) *TestLimits {
+		return config.Overrides["user2"]
+	}, func(limits *TestLimits) {
+		user2 = append(user2, limits)
+	})
+
+	// The reload period is long, so the test reloads the config itself.
+	writeConfig(`overrides:
+    user1:
+        limit1: 1
+    user2:
+        limit1: 2
+`)
+	require.NoError(t, manager.loadConfig(context.Background()))
+
+	writeConfig(`overrides:
+    user1:
+        limit1: 10
+    user2:
+        limit1: 2
+`)
+	require.NoError(t, manager.loadConfig(context.Background()))
+
+	unsubscribe()
+	writeConfig(`overrides:
+    user2:
+        limit1: 2
+`)
+	require.NoError(t, manager.loadConfig(context.Background()))
+
+	require.Len(t, all, 2)
+	assert.Equal(t, 10, all[1].Overrides["user1"].Limit1)
+	assert.Nil(t, manager.Get().Overrides["user1"])
+	assert.Equal(t, []*TestLimits{{Limit1: 10}, nil}, user1)
+	assert.Equal(t, []*TestLimits{{Limit1: 2}}, user2)
+}
+
+func TestSubscribeProjection_BeforeStart(t *testing.T) {
+	cfg := newTestOverridesManagerConfig(t, time.Hour, nil)
+	require.NoError(t, os.WriteFile(cfg.LoadPath[0], []byte(`overrides:
+    user1:
+        limit1: 1
+`), 0600))
+
+	loader := func(r io.Reader) (*testOverrides, error) {
+		config, err := testLoadOverrides(r)
+		if err != nil {
+			return nil, err
+		}
+		return config.(*testOverrides), nil
+	}
+
+	manager, err := NewTypedManager[*testOverrides](cfg, loader, "overrides", nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	// The projection dereferences the config, which is nil until the first load.
+	var user1 []*TestLimits
+	SubscribeProjection(manager, func(config *testOverrides) *TestLimits {
+		return config.Overrides["user1"]
+	}, func(limits *TestLimits) {
+		user1 = append(user1, limits)
+	})
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), manager))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), manager))
+	})
+
+	// The first loaded config is notified.
+	require.Len(t, user1, 1)
+	assert.Equal(t, 1, user1[0].Limit1)
+}
@@ -2,12 +2,19 @@ package server
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync"
 
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/tap"
+
+	"github.com/grafana/dskit/limiter"
 )
 
 type GrpcInflightMethodLimiter interface {
@@ -109,3 +116,113 @@ func isMethodNameValid(method string) bool {
 	pos := strings.LastIndex(method, "/")
 	return pos >= 0
 }
+
+// AdaptiveConcurrencyMethodLimiter is a GrpcInflightMethodLimiter admitting gRPC calls through an
+// AdaptiveConcurrencyLimiter. Calls over the limit are rejected with RESOURCE_EXHAUSTED before the request is read.
+//
+// Streaming calls hold a slot for their whole lifetime, and their latency isn't a sign of overload, so they're
+// never limited when the AdaptiveConcurrencyMethodLimiter is the Config.GrpcMethodLimiter of a Server. Otherwise,
+// streaming methods must be exempted explicitly.
+type AdaptiveConcurrencyMethodLimiter struct {
+	limiter       *limiter.AdaptiveConcurrencyLimiter
+	exemptMethods map[string]struct{}
+
+	// serviceInfo returns the services of the gRPC server, to find the streaming methods. It may be nil.
+	serviceInfo     func() map[string]grpc.ServiceInfo
+	streamingOnce   sync.Once
+	streamingMethod map[string]struct{}
+}
+
+// NewAdaptiveConcurrencyMethodLimiter makes a new AdaptiveConcurrencyMethodLimiter. Calls to exemptMethods, such as
+// health checks, are never rejected nor counted.
+func NewAdaptiveConcurrencyMethodLimiter(l *limiter.AdaptiveConcurrencyLimiter, exemptMethods ...string) *AdaptiveConcurrencyMethodLimiter {
+	exempt := make(map[string]struct{}, len(exemptMethods))
+	for _, m := range exemptMethods {
+		exempt[m] = struct{}{}
+	}
+	return &AdaptiveConcurrencyMethodLimiter{limiter: l, exemptMethods: exempt}
+}
+
+type adaptiveCallKey struct{}
+
+// adaptiveCall tracks a call admitted by AdaptiveConcurrencyMethodLimiter until it finishes.
+type adaptiveCall struct {
+	release func(limiter.Outcome)
+
+	// Calls which haven't been handled, for example because the method is unknown, don't adjust the limit.
+	outcome atomic.Int32
+}
+
+// setServiceInfo sets the function returning the services of the gRPC server, whose streaming methods are not limited.
+func (m *AdaptiveConcurrencyMethodLimiter) setServiceInfo(serviceInfo func() map[string]grpc.ServiceInfo) {
+	m.serviceInfo = serviceInfo
+}
+
+// isStreaming returns whether the method is a streaming method of the gRPC server.
+func (m *AdaptiveConcurrencyMethodLimiter) isStreaming(methodName string) bool {
+	if m.serviceInfo == nil {
+		return false
+	}
+
+	// Services can't be registered once the server serves calls, so they're only listed once.
+	m.streamingOnce.Do(func() {
+		m.streamingMethod = map[string]struct{}{}
+		for service, info := range m.serviceInfo() {
+			for _, method := range info.Methods {
+				if method.IsClientStream || method.IsServerStream {
+					m.streamingMethod["/"+service+"/"+method.Name] = struct{}{}
+				}
+			}
+		}
+	})
+	_, ok := m.streamingMethod[methodName]
+	return ok
+}
+
+func (m *AdaptiveConcurrencyMethodLimiter) RPCCallStarting(ctx context.Context, methodName string, _ metadata.MD) (context.Context, error) {
+	if _, ok := m.exemptMethods[methodName]; ok || m.isStreaming(methodName) {
+		return ctx, nil
+	}
+
+	release, ok := m.limiter.Acquire()
+	if !ok {
+		return ctx, status.Error(codes.ResourceExhausted, "too many concurrent requests")
+	}
+	call := &adaptiveCall{release: release}
+	call.outcome.Store(int32(limiter.OutcomeIgnored))
+	return context.WithValue(ctx, adaptiveCallKey{}, call), nil
+}
+
+func (m *AdaptiveConcurrencyMethodLimiter) RPCCallProcessing(ctx context.Context, _ string) (func(error), error) {
+	call, ok := ctx.Value(adaptiveCallKey{}).(*adaptiveCall)
+	if !ok {
+		return nil, nil
+	}
+	return func(err error) {
+		call.outcome.Store(int32(grpcOutcome(err)))
+	}, nil
+}
+
+func (m *AdaptiveConcurrencyMethodLimiter) RPCCallFinished(ctx context.Context) {
+	if call, ok := ctx.Value(adaptiveCallKey{}).(*adaptiveCall); ok {
+		call.release(limiter.Outcome(call.outcome.Load()))
+	}
+}
+
+func grpcOutcome(err error) limiter.Outcome {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return limiter.OutcomeDropped
+	case errors.Is(err, context.Canceled):
+		return limiter.OutcomeIgnored
+	}
+
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return limiter.OutcomeDropped
+	case codes.Canceled:
+		return limiter.OutcomeIgnored
+	default:
+		return limiter.OutcomeSuccess
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/grafana/dskit/limiter"
 	"github.com/grafana/dskit/test"
 )
 
@@ -334,3 +335,66 @@ func (m *methodLimiter) RPCCallFinished(ctx context.Context) {
 		m.protectedMethodInflight.Dec()
 	}
 }
+
+func TestAdaptiveConcurrencyMethodLimiter(t *testing.T) {
+	const exemptMethodName = "/server.FakeServer/Sleep"
+
+	l := limiter.NewAdaptiveConcurrencyLimiterWithAlgorithm(&limiter.AIMDAlgorithm{BackoffRatio: 0.5}, 2, 1, 2, "test", nil)
+	methodLimiter := NewAdaptiveConcurrencyMethodLimiter(l, exemptMethodName)
+	limitCheck := newGrpcInflightLimitCheck(methodLimiter)
+
+	ts := &testServer{finishRequest: make(chan struct{}), msgPerStreamCall: 1}
+	server := grpc.NewServer(
+		grpc.InTapHandle(limitCheck.TapHandle),
+		grpc.StatsHandler(limitCheck),
+		grpc.ChainUnaryInterceptor(limitCheck.UnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(limitCheck.StreamServerInterceptor),
+	)
+	RegisterFakeServerServer(server, ts)
+	methodLimiter.setServiceInfo(server.GetServiceInfo)
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	c := NewFakeServerClient(cc)
+
+	wg := sync.WaitGroup{}
+	for _, call := range []func(ctx context.Context, c FakeServerClient) error{callToSucceed, callToSucceed, callToSleep, callToStreaming(1)} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, call(context.Background(), c))
+		}()
+	}
+
+	// Calls to exempt and streaming methods are not limited.
+	test.Poll(t, time.Second, 2, func() interface{} {
+		return l.Inflight()
+	})
+	checkGrpcStatusError(t, callToSucceed(context.Background(), c), codes.ResourceExhausted, "too many concurrent requests")
+
+	close(ts.finishRequest)
+	wg.Wait()
+	test.Poll(t, time.Second, 0, func() interface{} {
+		return l.Inflight()
+	})
+
+	// Calls are admitted again once in-flight calls finished.
+	require.NoError(t, callToSucceed(context.Background(), c))
+}
+
+func TestGrpcOutcome(t *testing.T) {
+	require.Equal(t, limiter.OutcomeSuccess, grpcOutcome(nil))
+	require.Equal(t, limiter.OutcomeSuccess, grpcOutcome(status.Error(codes.Internal, "failed")))
+	require.Equal(t, limiter.OutcomeDropped, grpcOutcome(status.Error(codes.Unavailable, "unavailable")))
+	require.Equal(t, limiter.OutcomeDropped, grpcOutcome(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)))
+	require.Equal(t, limiter.OutcomeIgnored, grpcOutcome(status.Error(codes.Canceled, "canceled")))
+}
@@ -36,6 +36,7 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 
 	"github.com/grafana/dskit/clusterutil"
+	dstls "github.com/grafana/dskit/crypto/tls"
 	"github.com/grafana/dskit/httpgrpc"
 	httpgrpc_server "github.com/grafana/dskit/httpgrpc/server"
 	"github.com/grafana/dskit/log"
@@ -92,10 +93,11 @@ type Config struct {
 	GRPCConnLimit        int    `yaml:"grpc_listen_conn_limit"`
 	ProxyProtocolEnabled bool   `yaml:"proxy_protocol_enabled"`
 
-	CipherSuites  string    `yaml:"tls_cipher_suites"`
-	MinVersion    string    `yaml:"tls_min_version"`
-	HTTPTLSConfig TLSConfig `yaml:"http_tls_config"`
-	GRPCTLSConfig TLSConfig `yaml:"grpc_tls_config"`
+	CipherSuites      string        `yaml:"tls_cipher_suites"`
+	MinVersion        string        `yaml:"tls_min_version"`
+	HTTPTLSConfig     TLSConfig     `yaml:"http_tls_config"`
+	GRPCTLSConfig     TLSConfig     `yaml:"grpc_tls_config"`
+	TLSReloadInterval time.Duration `yaml:"tls_reload_interval" category:"experimental"`
 
 	RegisterInstrumentation                  bool `yaml:"register_instrumentation"`
 	ReportGRPCCodesInInstrumentationLabel    bool `yaml:"report_grpc_codes_in_instrumentation_label_enabled"`
@@ -160,6 +162,10 @@ type Config struct {
 	Throughput Throughput `yaml:"-"`
 
 	ClusterValidation clusterutil.ServerClusterValidationConfig `yaml:"cluster_validation" category:"experimental"`
+	// Full names of the streaming gRPC methods whose cluster validation label is checked, when gRPC cluster
+	// validation is enabled, in addition to the stream of the memberlist GRPCTransport which is always checked.
+	// Other streaming methods are not checked.
+	ClusterValidationStreamMethods []string `yaml:"-"`
 }
 
 type Throughput struct {
@@ -175,6 +181,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.HTTPListenNetwork, "server.http-listen-network", DefaultNetwork, "HTTP server listen network, default tcp")
 	f.StringVar(&cfg.CipherSuites, "server.tls-cipher-suites", "", "Comma-separated list of cipher suites to use. If blank, the default Go cipher suites is used.")
 	f.StringVar(&cfg.MinVersion, "server.tls-min-version", "", "Minimum TLS version to use. Allowed values: VersionTLS10, VersionTLS11, VersionTLS12, VersionTLS13. If blank, the Go TLS minimum version is used.")
+	f.DurationVar(&cfg.TLSReloadInterval, "server.tls-reload-interval", 0, "How often to check the certificate, key and client CA files of the HTTP and gRPC servers for changes, and reload them. Files are checked when accepting connections. 0 to let the certificate files be read on every connection and the client CA files only once.")
 	f.StringVar(&cfg.HTTPTLSConfig.TLSCertPath, "server.http-tls-cert-path", "", "HTTP server cert path.")
 	f.StringVar(&cfg.HTTPTLSConfig.TLSKeyPath, "server.http-tls-key-path", "", "HTTP server key path.")
 	f.StringVar(&cfg.HTTPTLSConfig.ClientAuth, "server.http-tls-client-auth", "", "HTTP TLS Client Auth type.")
@@ -230,6 +237,28 @@ func (cfg *Config) Validate() error {
 	return cfg.ClusterValidation.Validate()
 }
 
+// setupCertReloader makes tlsConfig serve certificates and verify client certificates with CA certificates
+// reloaded when their files change, if TLSReloadInterval is set.
+func (cfg *Config) setupCertReloader(name string, tlsCfg TLSConfig, tlsConfig *tls.Config, logger gokit_log.Logger) error {
+	if cfg.TLSReloadInterval <= 0 || tlsCfg.TLSCertPath == "" {
+		return nil
+	}
+
+	reloader, err := dstls.NewCertReloader(dstls.CertReloaderConfig{
+		CertPath:       tlsCfg.TLSCertPath,
+		KeyPath:        tlsCfg.TLSKeyPath,
+		CAPath:         tlsCfg.ClientCAs,
+		ReloadInterval: cfg.TLSReloadInterval,
+	}, logger, prometheus.WrapRegistererWith(prometheus.Labels{"name": name}, cfg.registererOrDefault()))
+	if err != nil {
+		return err
+	}
+
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	tlsConfig.GetConfigForClient = reloader.GetConfigForClient(tlsConfig)
+	return nil
+}
+
 func (cfg *Config) registererOrDefault() prometheus.Registerer {
 	// If user doesn't supply a Registerer/gatherer, use Prometheus' by default.
 	if cfg.Registerer != nil {
@@ -346,6 +375,9 @@ func newServer(cfg Config, metrics *Metrics) (*Server, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error generating http tls config: %v", err)
 		}
+		if err := cfg.setupCertReloader("http", cfg.HTTPTLSConfig, httpTLSConfig, logger); err != nil {
+			return nil, fmt.Errorf("error setting up http tls certificate reloading: %w", err)
+		}
 	}
 	var grpcTLSConfig *tls.Config
 	if (len(cfg.GRPCTLSConfig.TLSCertPath) > 0 || len(cfg.GRPCTLSConfig.TLSCert) > 0) &&
@@ -365,6 +397,9 @@ func newServer(cfg Config, metrics *Metrics) (*Server, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error generating grpc tls config: %v", err)
 		}
+		if err := cfg.setupCertReloader("grpc", cfg.GRPCTLSConfig, grpcTLSConfig, logger); err != nil {
+			return nil, fmt.Errorf("error setting up grpc tls certificate reloading: %w", err)
+		}
 	}
 
 	level.Info(logger).Log("msg", "server listening on addresses", "http", httpListener.Addr(), "grpc", grpcListener.Addr())
@@ -439,6 +474,9 @@ func newServer(cfg Config, metrics *Metrics) (*Server, error) {
 		middleware.StreamServerInstrumentInterceptor(metrics.RequestDuration, grpcInstrumentationOptions...),
 	)
 	grpcStreamMiddleware = append(grpcStreamMiddleware, cfg.GRPCStreamMiddleware...)
+	if cfg.ClusterValidation.GRPC.Enabled {
+		grpcStreamMiddleware = append(grpcStreamMiddleware, clusterStreamServerInterceptor(cfg, metrics, logger))
+	}
 
 	grpcKeepAliveOptions := keepalive.ServerParameters{
 		MaxConnectionIdle:     cfg.GRPCServerMaxConnectionIdle,
@@ -501,6 +539,9 @@ func newServer(cfg Config, metrics *Metrics) (*Server, error) {
 		grpcOptions = append(grpcOptions, grpc.Creds(grpcCreds))
 	}
 	grpcServer := grpc.NewServer(grpcOptions...)
+	if l, ok := cfg.GrpcMethodLimiter.(*AdaptiveConcurrencyMethodLimiter); ok {
+		l.setServiceInfo(grpcServer.GetServiceInfo)
+	}
 
 	httpMiddleware, err := BuildHTTPMiddleware(cfg, router, metrics, logger)
 	if err != nil {
@@ -538,6 +579,31 @@ func newServer(cfg Config, metrics *Metrics) (*Server, error) {
 	}, nil
 }
 
+// memberlistTransportStreamMethod is the streaming method of memberlist.GRPCTransport. It's the same as
+// memberlist.GRPCTransportStreamMethod, which isn't referenced so that the server doesn't depend on memberlist.
+const memberlistTransportStreamMethod = "/memberlist.MemberlistTransport/Stream"
+
+// clusterStreamServerInterceptor checks the cluster validation label of the memberlist GRPCTransport stream
+// and of the streaming methods listed in ClusterValidationStreamMethods only.
+func clusterStreamServerInterceptor(cfg Config, metrics *Metrics, logger gokit_log.Logger) grpc.StreamServerInterceptor {
+	methods := make(map[string]struct{}, len(cfg.ClusterValidationStreamMethods)+1)
+	methods[memberlistTransportStreamMethod] = struct{}{}
+	for _, m := range cfg.ClusterValidationStreamMethods {
+		methods[m] = struct{}{}
+	}
+
+	interceptor := middleware.ClusterStreamServerInterceptor(
+		cfg.ClusterValidation.Label, cfg.ClusterValidation.GRPC.SoftValidation,
+		metrics.InvalidClusterRequests, logger,
+	)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := methods[info.FullMethod]; !ok {
+			return handler(srv, ss)
+		}
+		return interceptor(srv, ss, info, handler)
+	}
+}
+
 // RegisterInstrumentation on the given router.
 func RegisterInstrumentation(router *mux.Router) {
 	RegisterInstrumentationWithGatherer(router, prometheus.DefaultGatherer)
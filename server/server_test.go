@@ -26,6 +26,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/config"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/peer"
@@ -660,6 +661,74 @@ func TestTLSServer(t *testing.T) {
 	require.EqualValues(t, &empty, grpcRes)
 }
 
+func TestTLSServerWithCertReloading(t *testing.T) {
+	var level log.Level
+	require.NoError(t, level.Set("info"))
+
+	genCerts := func() string {
+		dir := t.TempDir()
+		cmd := exec.Command("bash", filepath.Join("certs", "genCerts.sh"), dir, "1")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return dir
+	}
+	certsDir, rotatedCertsDir := genCerts(), genCerts()
+
+	cfg := Config{
+		HTTPTLSConfig: TLSConfig{
+			TLSCertPath: filepath.Join(certsDir, "server.crt"),
+			TLSKeyPath:  filepath.Join(certsDir, "server.key"),
+			ClientAuth:  "RequireAndVerifyClientCert",
+			ClientCAs:   filepath.Join(certsDir, "root.crt"),
+		},
+		TLSReloadInterval: time.Nanosecond,
+		MetricsNamespace:  "testing_tls",
+		LogLevel:          level,
+		Registerer:        prometheus.NewPedanticRegistry(),
+	}
+	setAutoAssignedPorts(DefaultNetwork, &cfg)
+
+	server, err := New(cfg)
+	require.NoError(t, err)
+
+	server.HTTP.HandleFunc("/testhttps", func(w http.ResponseWriter, _ *http.Request) {
+		_, err := w.Write([]byte("Hello World!"))
+		require.NoError(t, err)
+	})
+
+	go func() {
+		require.NoError(t, server.Run())
+	}()
+	defer server.Shutdown()
+
+	get := func(clientCertsDir string) error {
+		clientCert, err := tls.LoadX509KeyPair(filepath.Join(clientCertsDir, "client.crt"), filepath.Join(clientCertsDir, "client.key"))
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}},
+			DisableKeepAlives: true,
+		}}
+		res, err := client.Get(httpsTarget(server, "/testhttps"))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		return nil
+	}
+	require.NoError(t, get(certsDir))
+
+	// Rotate the server certificate and the client CA.
+	for _, name := range []string{"server.crt", "server.key", "root.crt"} {
+		data, err := os.ReadFile(filepath.Join(rotatedCertsDir, name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(certsDir, name), data, 0600))
+	}
+	require.NoError(t, get(rotatedCertsDir))
+	require.Error(t, get(certsDir), "client certificates signed by the previous CA are rejected")
+}
+
 func TestTLSServerWithInlineCerts(t *testing.T) {
 	var level log.Level
 	require.NoError(t, level.Set("info"))
@@ -1070,3 +1139,31 @@ func httpTarget(srv *Server, path string) string {
 func httpsTarget(srv *Server, path string) string {
 	return fmt.Sprintf("https://%s%s", srv.HTTPListenAddr().String(), path)
 }
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestClusterStreamServerInterceptor(t *testing.T) {
+	var cfg Config
+	cfg.ClusterValidation.Label = "cluster"
+	cfg.ClusterValidation.GRPC.Enabled = true
+	cfg.ClusterValidationStreamMethods = []string{"/test.Service/Validated"}
+	metrics := NewServerMetrics(Config{Registerer: prometheus.NewPedanticRegistry()})
+	interceptor := clusterStreamServerInterceptor(cfg, metrics, gokit_log.NewNopLogger())
+
+	handler := func(interface{}, grpc.ServerStream) error { return nil }
+	stream := contextServerStream{ctx: context.Background()}
+
+	// Only the listed streaming methods and the memberlist transport are checked.
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Validated"}, handler)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	err = interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/memberlist.MemberlistTransport/Stream"}, handler)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.NoError(t, interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Other"}, handler))
+}
@@ -1,12 +1,18 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"runtime/pprof"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"go.uber.org/atomic"
 )
 
@@ -386,3 +392,64 @@ func StopManagerAndAwaitStopped(ctx context.Context, manager *Manager) error {
 	manager.StopAsync()
 	return manager.AwaitStopped(ctx)
 }
+
+// ErrStopTimeout is the error returned when services don't stop before their stop deadline.
+var ErrStopTimeout = errors.New("services did not stop before the deadline")
+
+// StopTimeouts configures the deadlines of StopAndAwaitStoppedWithTimeouts.
+type StopTimeouts struct {
+	// Timeout is the maximum time for all services to stop. Zero means no timeout.
+	Timeout time.Duration
+
+	// PerService overrides the maximum time for individual services to stop. It's capped by Timeout.
+	PerService map[Service]time.Duration
+}
+
+// StopAndAwaitStoppedWithTimeouts asks the manager to stop its services, and waits until they're stopped or their
+// stop deadline is reached. Services which are still not stopped after their deadline are logged together with a
+// goroutine dump, and returned error wraps ErrStopTimeout. Stuck services are not waited for anymore, but keep
+// stopping in the background.
+func (m *Manager) StopAndAwaitStoppedWithTimeouts(ctx context.Context, timeouts StopTimeouts, logger log.Logger) error {
+	m.StopAsync()
+
+	start := time.Now()
+	var stuck []Service
+	for _, s := range m.services {
+		timeout := timeouts.Timeout
+		if t, ok := timeouts.PerService[s]; ok && (timeout == 0 || t < timeout) {
+			timeout = t
+		}
+
+		waitCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			waitCtx, cancel = context.WithDeadline(ctx, start.Add(timeout))
+		}
+		_ = s.AwaitTerminated(waitCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if state := s.State(); state != Terminated && state != Failed {
+			stuck = append(stuck, s)
+		}
+	}
+
+	if len(stuck) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(stuck))
+	for _, s := range stuck {
+		names = append(names, DescribeService(s))
+	}
+	level.Error(logger).Log("msg", "services did not stop before the deadline", "services", strings.Join(names, ", "), "goroutines", GoroutineDump())
+	return fmt.Errorf("%w: %s", ErrStopTimeout, strings.Join(names, ", "))
+}
+
+// GoroutineDump returns the stack traces of all goroutines, to troubleshoot services which don't stop.
+func GoroutineDump() string {
+	buf := bytes.Buffer{}
+	_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	return buf.String()
+}
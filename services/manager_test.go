@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 )
@@ -441,3 +443,37 @@ func TestManagerListenerCancellationHealthyManager(t *testing.T) {
 	m.mu.Unlock()
 	require.Equal(t, listenersCount, 0)
 }
+
+func TestManagerStopAndAwaitStoppedWithTimeouts(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	fast := NewIdleService(nil, nil).WithName("fast")
+	stuck := NewIdleService(nil, func(_ error) error {
+		<-release
+		return nil
+	}).WithName("stuck")
+	slow := NewIdleService(nil, func(_ error) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}).WithName("slow")
+
+	m, err := NewManager(fast, stuck, slow)
+	require.NoError(t, err)
+	require.NoError(t, StartManagerAndAwaitHealthy(context.Background(), m))
+
+	err = m.StopAndAwaitStoppedWithTimeouts(context.Background(), StopTimeouts{
+		Timeout:    time.Second,
+		PerService: map[Service]time.Duration{stuck: 100 * time.Millisecond},
+	}, log.NewNopLogger())
+	require.ErrorIs(t, err, ErrStopTimeout)
+	assert.ErrorContains(t, err, "stuck")
+	assert.NotContains(t, err.Error(), "slow")
+
+	assert.Equal(t, Terminated, fast.State())
+	assert.Equal(t, Terminated, slow.State())
+	assert.Equal(t, Stopping, stuck.State())
+
+	close(release)
+	require.NoError(t, m.StopAndAwaitStoppedWithTimeouts(context.Background(), StopTimeouts{}, log.NewNopLogger()))
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/dskit/backoff"
+)
+
+// RestartPolicy defines when a Supervisor restarts its child service.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the child service when it fails. If the child service terminates without failure,
+	// the supervisor terminates too.
+	RestartOnFailure RestartPolicy = iota
+
+	// RestartAlways restarts the child service whenever it stops, with or without failure.
+	RestartAlways
+)
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(p))
+	}
+}
+
+// SupervisorConfig configures a Supervisor.
+type SupervisorConfig struct {
+	Policy RestartPolicy
+
+	// MaxRestarts is the maximum number of restarts within RestartWindow. When the child service stops once more,
+	// the supervisor gives up and fails with the child failure. Zero means unlimited restarts.
+	MaxRestarts int
+
+	// RestartWindow is the window over which restarts are counted for MaxRestarts. Zero means the whole lifetime
+	// of the supervisor.
+	RestartWindow time.Duration
+
+	// Backoff configures the delay between restarts. The backoff is reset once the child service has been running
+	// for at least MaxBackoff. MaxRetries is ignored, see MaxRestarts instead. Defaults to a backoff from 100ms to 10s.
+	Backoff backoff.Config
+}
+
+// ServiceFactory creates a new instance of a child service, in New state.
+type ServiceFactory func() (Service, error)
+
+// SupervisorListener receives notifications about the restarts of the child service of a Supervisor. Notifications
+// are sent synchronously, so listeners must not block.
+type SupervisorListener interface {
+	// ChildStopped is called when the child service stops. The failure is nil if it terminated without failure.
+	ChildStopped(failure error)
+
+	// Restarting is called before restarting the child service for the restarts-th time, after delay.
+	Restarting(restarts int, delay time.Duration)
+
+	// Restarted is called once the restarted child service is running.
+	Restarted(restarts int)
+
+	// GaveUp is called when the supervisor stops restarting the child service, because of MaxRestarts.
+	GaveUp(failure error)
+}
+
+// NewSupervisorListener provides a simple way to build a SupervisorListener from supplied functions.
+// Functions are only called when not nil.
+func NewSupervisorListener(childStopped func(failure error), restarting func(restarts int, delay time.Duration), restarted func(restarts int), gaveUp func(failure error)) SupervisorListener {
+	return &funcBasedSupervisorListener{
+		childStoppedFn: childStopped,
+		restartingFn:   restarting,
+		restartedFn:    restarted,
+		gaveUpFn:       gaveUp,
+	}
+}
+
+type funcBasedSupervisorListener struct {
+	childStoppedFn func(failure error)
+	restartingFn   func(restarts int, delay time.Duration)
+	restartedFn    func(restarts int)
+	gaveUpFn       func(failure error)
+}
+
+func (f funcBasedSupervisorListener) ChildStopped(failure error) {
+	if f.childStoppedFn != nil {
+		f.childStoppedFn(failure)
+	}
+}
+
+func (f funcBasedSupervisorListener) Restarting(restarts int, delay time.Duration) {
+	if f.restartingFn != nil {
+		f.restartingFn(restarts, delay)
+	}
+}
+
+func (f funcBasedSupervisorListener) Restarted(restarts int) {
+	if f.restartedFn != nil {
+		f.restartedFn(restarts)
+	}
+}
+
+func (f funcBasedSupervisorListener) GaveUp(failure error) {
+	if f.gaveUpFn != nil {
+		f.gaveUpFn(failure)
+	}
+}
+
+// Supervisor is a service running a child service, and restarting it with a new instance created by a
+// ServiceFactory when it stops, according to the RestartPolicy. This allows flaky background loops to
+// self-heal, instead of bringing down the whole process through the Manager.
+//
+// The supervisor is Running once the first child service is Running, and fails if the first child service fails
+// to start. Stopping the supervisor stops the current child service.
+type Supervisor struct {
+	*BasicService
+
+	cfg     SupervisorConfig
+	factory ServiceFactory
+	logger  log.Logger
+
+	mtx       sync.Mutex
+	child     Service
+	restarts  int
+	listeners []SupervisorListener
+
+	// Restart times within the restart window.
+	restartTimes []time.Time
+
+	restartsTotal      prometheus.Counter
+	childFailuresTotal prometheus.Counter
+	childUp            prometheus.Gauge
+}
+
+// NewSupervisor creates a Supervisor named name.
+func NewSupervisor(name string, cfg SupervisorConfig, factory ServiceFactory, logger log.Logger, reg prometheus.Registerer) *Supervisor {
+	if cfg.Backoff.MinBackoff == 0 && cfg.Backoff.MaxBackoff == 0 {
+		cfg.Backoff.MinBackoff = 100 * time.Millisecond
+		cfg.Backoff.MaxBackoff = 10 * time.Second
+	}
+	cfg.Backoff.MaxRetries = 0
+
+	s := &Supervisor{
+		cfg:     cfg,
+		factory: factory,
+		logger:  log.With(logger, "supervisor", name),
+		restartsTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "supervisor_restarts_total",
+			Help:        "Total number of restarts of the supervised service.",
+			ConstLabels: map[string]string{"name": name},
+		}),
+		childFailuresTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        "supervisor_child_failures_total",
+			Help:        "Total number of failures of the supervised service.",
+			ConstLabels: map[string]string{"name": name},
+		}),
+		childUp: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name:        "supervisor_child_up",
+			Help:        "Whether the supervised service is running.",
+			ConstLabels: map[string]string{"name": name},
+		}),
+	}
+
+	s.BasicService = NewBasicService(s.starting, s.running, s.stopping).WithName(name)
+	return s
+}
+
+// AddSupervisorListener adds a listener for the restarts of the child service. Returned function can be used to
+// remove the listener.
+func (s *Supervisor) AddSupervisorListener(listener SupervisorListener) func() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+	return func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		for i, l := range s.listeners {
+			if l == listener {
+				s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Child returns the current child service.
+func (s *Supervisor) Child() Service {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.child
+}
+
+// Restarts returns the number of times the child service has been restarted.
+func (s *Supervisor) Restarts() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.restarts
+}
+
+func (s *Supervisor) starting(ctx context.Context) error {
+	return s.startChild(ctx)
+}
+
+// startChild creates a new child service and waits until it's Running.
+func (s *Supervisor) startChild(ctx context.Context) error {
+	child, err := s.factory()
+	if err != nil {
+		return errors.Wrap(err, "failed to create service")
+	}
+
+	s.mtx.Lock()
+	s.child = child
+	s.mtx.Unlock()
+
+	// The child service may stop right after reaching Running, which is handled while running, so we rely on
+	// the listener notifications, delivered in order, rather than on AwaitRunning.
+	running := make(chan struct{})
+	startFailed := make(chan error, 1)
+	stopListener := child.AddListener(NewListener(nil, func() {
+		close(running)
+	}, nil, nil, func(from State, failure error) {
+		if from == Starting {
+			startFailed <- failure
+		}
+	}))
+	defer stopListener()
+
+	// The child service context must not be canceled with the context of the supervisor, because the child
+	// service is stopped by the supervisor when it stops.
+	if err := child.StartAsync(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+
+	select {
+	case <-running:
+	case failure := <-startFailed:
+		return failure
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.childUp.Set(1)
+	return nil
+}
+
+func (s *Supervisor) running(ctx context.Context) error {
+	bo := backoff.New(ctx, s.cfg.Backoff)
+
+	for {
+		startedAt := time.Now()
+		child := s.Child()
+
+		// Wait until the child service stops, or the supervisor is stopped.
+		if err := child.AwaitTerminated(ctx); err != nil && ctx.Err() != nil {
+			return nil
+		}
+
+		failure := child.FailureCase()
+		s.childUp.Set(0)
+		s.notifyListeners(func(l SupervisorListener) { l.ChildStopped(failure) })
+
+		if failure != nil {
+			s.childFailuresTotal.Inc()
+			level.Warn(s.logger).Log("msg", "supervised service failed", "service", DescribeService(child), "err", failure)
+		} else if s.cfg.Policy == RestartOnFailure {
+			level.Info(s.logger).Log("msg", "supervised service terminated, not restarting it", "service", DescribeService(child))
+			return nil
+		}
+
+		for {
+			if err := s.checkRestartAllowed(failure); err != nil {
+				return err
+			}
+
+			if time.Since(startedAt) >= s.cfg.Backoff.MaxBackoff {
+				bo.Reset()
+			}
+			delay := bo.NextDelay()
+
+			restarts := s.incRestarts()
+			s.notifyListeners(func(l SupervisorListener) { l.Restarting(restarts, delay) })
+			level.Info(s.logger).Log("msg", "restarting supervised service", "restarts", restarts, "delay", delay, "policy", s.cfg.Policy)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+
+			startedAt = time.Now()
+			if failure = s.startChild(ctx); failure == nil {
+				s.notifyListeners(func(l SupervisorListener) { l.Restarted(restarts) })
+				break
+			}
+
+			s.childFailuresTotal.Inc()
+			level.Warn(s.logger).Log("msg", "supervised service failed to restart", "restarts", restarts, "err", failure)
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// checkRestartAllowed returns an error if the maximum number of restarts within the window has been reached.
+func (s *Supervisor) checkRestartAllowed(failure error) error {
+	if s.cfg.MaxRestarts <= 0 {
+		return nil
+	}
+
+	s.mtx.Lock()
+	now := time.Now()
+	if s.cfg.RestartWindow > 0 {
+		kept := s.restartTimes[:0]
+		for _, t := range s.restartTimes {
+			if now.Sub(t) < s.cfg.RestartWindow {
+				kept = append(kept, t)
+			}
+		}
+		s.restartTimes = kept
+	}
+	reached := len(s.restartTimes) >= s.cfg.MaxRestarts
+	s.mtx.Unlock()
+
+	if !reached {
+		return nil
+	}
+
+	if failure == nil {
+		failure = errors.New("service terminated")
+	}
+	err := errors.Wrapf(failure, "giving up after %d restarts", s.cfg.MaxRestarts)
+	level.Error(s.logger).Log("msg", "giving up restarting supervised service", "err", err)
+	s.notifyListeners(func(l SupervisorListener) { l.GaveUp(err) })
+	return err
+}
+
+func (s *Supervisor) incRestarts() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.restarts++
+	s.restartTimes = append(s.restartTimes, time.Now())
+	s.restartsTotal.Inc()
+	return s.restarts
+}
+
+func (s *Supervisor) stopping(_ error) error {
+	defer s.childUp.Set(0)
+
+	child := s.Child()
+	if child == nil {
+		return nil
+	}
+
+	// Failures of the child service before the supervisor is stopped have already been handled while running.
+	if state := child.State(); state == Terminated || state == Failed {
+		return nil
+	}
+
+	child.StopAsync()
+	_ = child.AwaitTerminated(context.Background())
+	return child.FailureCase()
+}
+
+func (s *Supervisor) notifyListeners(fn func(l SupervisorListener)) {
+	s.mtx.Lock()
+	listeners := append([]SupervisorListener(nil), s.listeners...)
+	s.mtx.Unlock()
+
+	for _, l := range listeners {
+		fn(l)
+	}
+}
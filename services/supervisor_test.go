@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/dskit/backoff"
+)
+
+// flakyServices creates services which run until their run function returns.
+type flakyServices struct {
+	created atomic.Int32
+	run     func(ctx context.Context, n int) error
+}
+
+func (f *flakyServices) factory() (Service, error) {
+	n := int(f.created.Inc())
+	return NewBasicService(nil, func(ctx context.Context) error {
+		return f.run(ctx, n)
+	}, nil), nil
+}
+
+func testSupervisorConfig(policy RestartPolicy) SupervisorConfig {
+	return SupervisorConfig{
+		Policy:  policy,
+		Backoff: backoff.Config{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+	}
+}
+
+func TestSupervisor_RestartOnFailure(t *testing.T) {
+	t.Parallel()
+
+	// The first two instances fail, the third one runs until stopped.
+	services := &flakyServices{run: func(ctx context.Context, n int) error {
+		if n <= 2 {
+			return errors.New("failed")
+		}
+		<-ctx.Done()
+		return nil
+	}}
+
+	reg := prometheus.NewPedanticRegistry()
+	s := NewSupervisor("test", testSupervisorConfig(RestartOnFailure), services.factory, log.NewNopLogger(), reg)
+
+	var stopped, restarted atomic.Int32
+	s.AddSupervisorListener(NewSupervisorListener(func(failure error) {
+		assert.Error(t, failure)
+		stopped.Inc()
+	}, nil, func(int) {
+		restarted.Inc()
+	}, nil))
+
+	require.NoError(t, StartAndAwaitRunning(context.Background(), s))
+	require.Eventually(t, func() bool {
+		return restarted.Load() == 2 && s.Child().State() == Running
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, Running, s.State())
+	assert.Equal(t, 2, s.Restarts())
+	assert.Equal(t, int32(2), stopped.Load())
+	assert.Equal(t, float64(2), testutil.ToFloat64(s.restartsTotal))
+	assert.Equal(t, float64(2), testutil.ToFloat64(s.childFailuresTotal))
+	assert.Equal(t, float64(1), testutil.ToFloat64(s.childUp))
+
+	child := s.Child()
+	require.NoError(t, StopAndAwaitTerminated(context.Background(), s))
+	assert.Equal(t, Terminated, child.State())
+	assert.Equal(t, float64(0), testutil.ToFloat64(s.childUp))
+}
+
+func TestSupervisor_RestartOnFailureTerminatesWithChild(t *testing.T) {
+	t.Parallel()
+
+	services := &flakyServices{run: func(context.Context, int) error {
+		return nil
+	}}
+
+	s := NewSupervisor("test", testSupervisorConfig(RestartOnFailure), services.factory, log.NewNopLogger(), nil)
+	require.NoError(t, s.StartAsync(context.Background()))
+	require.NoError(t, s.AwaitTerminated(context.Background()))
+	assert.Equal(t, 0, s.Restarts())
+}
+
+func TestSupervisor_RestartAlways(t *testing.T) {
+	t.Parallel()
+
+	services := &flakyServices{run: func(ctx context.Context, n int) error {
+		if n <= 3 {
+			return nil
+		}
+		<-ctx.Done()
+		return nil
+	}}
+
+	s := NewSupervisor("test", testSupervisorConfig(RestartAlways), services.factory, log.NewNopLogger(), nil)
+	require.NoError(t, StartAndAwaitRunning(context.Background(), s))
+	require.Eventually(t, func() bool {
+		return s.Restarts() == 3 && s.Child().State() == Running
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, StopAndAwaitTerminated(context.Background(), s))
+}
+
+func TestSupervisor_MaxRestarts(t *testing.T) {
+	t.Parallel()
+
+	services := &flakyServices{run: func(context.Context, int) error {
+		return errors.New("always failing")
+	}}
+
+	cfg := testSupervisorConfig(RestartOnFailure)
+	cfg.MaxRestarts = 3
+	cfg.RestartWindow = time.Minute
+
+	s := NewSupervisor("test", cfg, services.factory, log.NewNopLogger(), nil)
+
+	var gaveUp atomic.Bool
+	s.AddSupervisorListener(NewSupervisorListener(nil, nil, nil, func(failure error) {
+		gaveUp.Store(true)
+	}))
+
+	require.NoError(t, s.StartAsync(context.Background()))
+	err := s.AwaitTerminated(context.Background())
+	require.Error(t, err)
+
+	assert.Equal(t, Failed, s.State())
+	assert.ErrorContains(t, s.FailureCase(), "giving up after 3 restarts: always failing")
+	assert.Equal(t, 3, s.Restarts())
+	assert.Equal(t, int32(4), services.created.Load())
+	assert.True(t, gaveUp.Load())
+}
+
+func TestSupervisor_RestartWindow(t *testing.T) {
+	t.Parallel()
+
+	// Instances fail slower than the window, so the maximum number of restarts is never reached.
+	services := &flakyServices{run: func(ctx context.Context, n int) error {
+		if n > 4 {
+			<-ctx.Done()
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("failed")
+	}}
+
+	cfg := testSupervisorConfig(RestartOnFailure)
+	cfg.MaxRestarts = 1
+	cfg.RestartWindow = 10 * time.Millisecond
+
+	s := NewSupervisor("test", cfg, services.factory, log.NewNopLogger(), nil)
+	require.NoError(t, StartAndAwaitRunning(context.Background(), s))
+	require.Eventually(t, func() bool {
+		return s.Restarts() == 4 && s.Child().State() == Running
+	}, 5*time.Second, time.Millisecond)
+
+	assert.Equal(t, Running, s.State())
+	require.NoError(t, StopAndAwaitTerminated(context.Background(), s))
+}
+
+func TestSupervisor_FirstStartFailure(t *testing.T) {
+	t.Parallel()
+
+	factory := func() (Service, error) {
+		return NewBasicService(func(context.Context) error {
+			return errors.New("failed to start")
+		}, nil, nil), nil
+	}
+
+	s := NewSupervisor("test", testSupervisorConfig(RestartAlways), factory, log.NewNopLogger(), nil)
+	require.ErrorContains(t, StartAndAwaitRunning(context.Background(), s), "failed to start")
+	assert.Equal(t, Failed, s.State())
+}
+
+func TestSupervisor_RestartStartFailure(t *testing.T) {
+	t.Parallel()
+
+	// The second instance fails to start, the third one runs until stopped.
+	var created atomic.Int32
+	factory := func() (Service, error) {
+		switch created.Inc() {
+		case 1:
+			return NewBasicService(nil, func(context.Context) error {
+				return errors.New("failed")
+			}, nil), nil
+		case 2:
+			return nil, errors.New("failed to create")
+		default:
+			return NewIdleService(nil, nil), nil
+		}
+	}
+
+	s := NewSupervisor("test", testSupervisorConfig(RestartOnFailure), factory, log.NewNopLogger(), nil)
+	require.NoError(t, StartAndAwaitRunning(context.Background(), s))
+	require.Eventually(t, func() bool {
+		return s.Restarts() == 2 && s.Child().State() == Running
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, StopAndAwaitTerminated(context.Background(), s))
+}
+
+func TestSupervisor_StopWhileBackingOff(t *testing.T) {
+	t.Parallel()
+
+	services := &flakyServices{run: func(context.Context, int) error {
+		return errors.New("failed")
+	}}
+
+	cfg := testSupervisorConfig(RestartOnFailure)
+	cfg.Backoff = backoff.Config{MinBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	s := NewSupervisor("test", cfg, services.factory, log.NewNopLogger(), nil)
+	restarting := make(chan struct{})
+	s.AddSupervisorListener(NewSupervisorListener(nil, func(int, time.Duration) {
+		close(restarting)
+	}, nil, nil))
+
+	require.NoError(t, StartAndAwaitRunning(context.Background(), s))
+	<-restarting
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, StopAndAwaitTerminated(ctx, s))
+}
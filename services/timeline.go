@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("dskit/services")
+
+// StateTransition is a state transition of a service, recorded by a TimelineRecorder.
+type StateTransition struct {
+	From State
+	To   State
+	Time time.Time
+
+	// Failure is the failure case of the service, for transitions to Failed.
+	Failure string
+}
+
+func (t StateTransition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		From    string    `json:"from"`
+		To      string    `json:"to"`
+		Time    time.Time `json:"time"`
+		Failure string    `json:"failure,omitempty"`
+	}{t.From.String(), t.To.String(), t.Time, t.Failure})
+}
+
+// ServiceTimeline is the list of state transitions of a service, in order.
+type ServiceTimeline struct {
+	Name        string            `json:"name"`
+	Transitions []StateTransition `json:"transitions"`
+}
+
+// TransitionTo returns the time of the first transition of the service to state, if any.
+func (t ServiceTimeline) TransitionTo(state State) (time.Time, bool) {
+	for _, tr := range t.Transitions {
+		if tr.To == state {
+			return tr.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// StartingDuration returns how long the service has been Starting, until it reached Running or failed. It
+// returns false if the service has not started, or is still Starting.
+func (t ServiceTimeline) StartingDuration() (time.Duration, bool) {
+	starting, ok := t.TransitionTo(Starting)
+	if !ok {
+		return 0, false
+	}
+	for _, tr := range t.Transitions {
+		if tr.From == Starting {
+			return tr.Time.Sub(starting), true
+		}
+	}
+	return 0, false
+}
+
+// TimelineRecorder records the state transitions of services, with their timestamps, to troubleshoot
+// slow startups and shutdowns. Transitions are recorded through service listeners, so services must
+// be watched before they're started to record their startup.
+//
+// Listeners are notified asynchronously, so recorded timestamps may slightly lag the actual transitions.
+type TimelineRecorder struct {
+	mtx       sync.Mutex
+	timelines map[string]*ServiceTimeline
+	order     []string
+	stops     []func()
+}
+
+// NewTimelineRecorder creates a TimelineRecorder.
+func NewTimelineRecorder() *TimelineRecorder {
+	return &TimelineRecorder{
+		timelines: map[string]*ServiceTimeline{},
+	}
+}
+
+// WatchService records the state transitions of service under name. Returned function can be used to stop
+// recording.
+func (r *TimelineRecorder) WatchService(name string, service Service) func() {
+	r.mtx.Lock()
+	if _, ok := r.timelines[name]; !ok {
+		r.timelines[name] = &ServiceTimeline{Name: name}
+		r.order = append(r.order, name)
+	}
+	r.mtx.Unlock()
+
+	stop := service.AddListener(NewListener(
+		func() { r.record(name, New, Starting, nil) },
+		func() { r.record(name, Starting, Running, nil) },
+		func(from State) { r.record(name, from, Stopping, nil) },
+		func(from State) { r.record(name, from, Terminated, nil) },
+		func(from State, failure error) { r.record(name, from, Failed, failure) },
+	))
+
+	r.mtx.Lock()
+	r.stops = append(r.stops, stop)
+	r.mtx.Unlock()
+	return stop
+}
+
+// WatchManager records the state transitions of all the services of the manager, named after DescribeService.
+func (r *TimelineRecorder) WatchManager(manager *Manager) {
+	for _, service := range manager.services {
+		r.WatchService(DescribeService(service), service)
+	}
+}
+
+// Close stops recording the state transitions of all watched services.
+func (r *TimelineRecorder) Close() {
+	r.mtx.Lock()
+	stops := r.stops
+	r.stops = nil
+	r.mtx.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+func (r *TimelineRecorder) record(name string, from, to State, failure error) {
+	transition := StateTransition{From: from, To: to, Time: time.Now()}
+	if failure != nil {
+		transition.Failure = failure.Error()
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	timeline := r.timelines[name]
+	timeline.Transitions = append(timeline.Transitions, transition)
+}
+
+// Timeline returns the timeline of the service watched under name.
+func (r *TimelineRecorder) Timeline(name string) (ServiceTimeline, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	timeline, ok := r.timelines[name]
+	if !ok {
+		return ServiceTimeline{}, false
+	}
+	return timeline.clone(), true
+}
+
+// Timelines returns the timelines of all the watched services, sorted by the time they started.
+// Services which have not started yet are last.
+func (r *TimelineRecorder) Timelines() []ServiceTimeline {
+	r.mtx.Lock()
+	result := make([]ServiceTimeline, 0, len(r.order))
+	for _, name := range r.order {
+		result = append(result, r.timelines[name].clone())
+	}
+	r.mtx.Unlock()
+
+	sort.SliceStable(result, func(i, j int) bool {
+		ti, iok := result[i].TransitionTo(Starting)
+		tj, jok := result[j].TransitionTo(Starting)
+		if iok != jok {
+			return iok
+		}
+		return ti.Before(tj)
+	})
+	return result
+}
+
+func (t *ServiceTimeline) clone() ServiceTimeline {
+	return ServiceTimeline{Name: t.Name, Transitions: append([]StateTransition(nil), t.Transitions...)}
+}
+
+// EmitStartupSpans emits the recorded startup of the services as OpenTelemetry spans: a "services startup" span
+// covering the startup of all services, with a child span per service covering its Starting state.
+func (r *TimelineRecorder) EmitStartupSpans(ctx context.Context) {
+	timelines := r.Timelines()
+
+	var first, last time.Time
+	for _, t := range timelines {
+		starting, ok := t.TransitionTo(Starting)
+		if !ok {
+			continue
+		}
+		duration, ok := t.StartingDuration()
+		if !ok {
+			continue
+		}
+		if first.IsZero() || starting.Before(first) {
+			first = starting
+		}
+		if end := starting.Add(duration); end.After(last) {
+			last = end
+		}
+	}
+	if first.IsZero() {
+		return
+	}
+
+	ctx, root := tracer.Start(ctx, "services startup", trace.WithTimestamp(first))
+	defer root.End(trace.WithTimestamp(last))
+
+	for _, t := range timelines {
+		starting, ok := t.TransitionTo(Starting)
+		if !ok {
+			continue
+		}
+		duration, ok := t.StartingDuration()
+		if !ok {
+			continue
+		}
+
+		_, span := tracer.Start(ctx, "start "+t.Name, trace.WithTimestamp(starting), trace.WithAttributes(attribute.String("service", t.Name)))
+		if _, failed := t.TransitionTo(Failed); failed {
+			if _, running := t.TransitionTo(Running); !running {
+				span.SetStatus(codes.Error, "service failed to start")
+			}
+		}
+		span.End(trace.WithTimestamp(starting.Add(duration)))
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTimelineRecorder(t *testing.T) {
+	recorder := NewTimelineRecorder()
+	t.Cleanup(recorder.Close)
+
+	slow := NewIdleService(func(context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}, nil)
+	failing := NewIdleService(func(context.Context) error {
+		return errors.New("failed to start")
+	}, nil)
+	unstarted := NewIdleService(nil, nil)
+
+	recorder.WatchService("slow", slow)
+	recorder.WatchService("failing", failing)
+	recorder.WatchService("unstarted", unstarted)
+
+	require.NoError(t, StartAndAwaitRunning(context.Background(), slow))
+	require.Error(t, StartAndAwaitRunning(context.Background(), failing))
+	require.NoError(t, StopAndAwaitTerminated(context.Background(), slow))
+
+	// Listeners are notified asynchronously.
+	require.Eventually(t, func() bool {
+		timeline, _ := recorder.Timeline("slow")
+		_, terminated := timeline.TransitionTo(Terminated)
+		return terminated
+	}, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		timeline, _ := recorder.Timeline("failing")
+		_, failed := timeline.TransitionTo(Failed)
+		return failed
+	}, time.Second, time.Millisecond)
+
+	timeline, ok := recorder.Timeline("slow")
+	require.True(t, ok)
+	states := []State{}
+	for _, tr := range timeline.Transitions {
+		states = append(states, tr.To)
+	}
+	assert.Equal(t, []State{Starting, Running, Stopping, Terminated}, states)
+
+	duration, ok := timeline.StartingDuration()
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, duration, 40*time.Millisecond)
+
+	timeline, _ = recorder.Timeline("failing")
+	require.Len(t, timeline.Transitions, 2)
+	assert.Equal(t, Starting, timeline.Transitions[1].From)
+	assert.Equal(t, "failed to start", timeline.Transitions[1].Failure)
+
+	// Services are sorted by start time, services not started last.
+	timelines := recorder.Timelines()
+	require.Len(t, timelines, 3)
+	assert.Equal(t, "slow", timelines[0].Name)
+	assert.Equal(t, "failing", timelines[1].Name)
+	assert.Equal(t, "unstarted", timelines[2].Name)
+	_, ok = timelines[2].StartingDuration()
+	assert.False(t, ok)
+
+	encoded, err := json.Marshal(timelines[1].Transitions[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"from":"Starting","to":"Failed"`)
+}
+
+func TestTimelineRecorder_WatchManager(t *testing.T) {
+	recorder := NewTimelineRecorder()
+	t.Cleanup(recorder.Close)
+
+	s1 := NewIdleService(nil, nil).WithName("first")
+	s2 := NewIdleService(nil, nil).WithName("second")
+	manager, err := NewManager(s1, s2)
+	require.NoError(t, err)
+	recorder.WatchManager(manager)
+
+	require.NoError(t, StartManagerAndAwaitHealthy(context.Background(), manager))
+	require.NoError(t, StopManagerAndAwaitStopped(context.Background(), manager))
+
+	for _, name := range []string{"first", "second"} {
+		require.Eventually(t, func() bool {
+			timeline, _ := recorder.Timeline(name)
+			_, terminated := timeline.TransitionTo(Terminated)
+			return terminated
+		}, time.Second, time.Millisecond)
+	}
+}
+
+var (
+	timelineSpanExporter     = tracetest.NewInMemoryExporter()
+	timelineSpanExporterOnce sync.Once
+)
+
+func TestTimelineRecorder_EmitStartupSpans(t *testing.T) {
+	// The package tracer delegates to the first global tracer provider set, so it's only set once.
+	timelineSpanExporterOnce.Do(func() {
+		otel.SetTracerProvider(tracesdk.NewTracerProvider(tracesdk.WithSyncer(timelineSpanExporter)))
+	})
+	exporter := timelineSpanExporter
+	exporter.Reset()
+
+	origin := time.Now()
+	recorder := NewTimelineRecorder()
+	recorder.timelines = map[string]*ServiceTimeline{
+		"a": {Name: "a", Transitions: []StateTransition{
+			{From: New, To: Starting, Time: origin},
+			{From: Starting, To: Running, Time: origin.Add(time.Second)},
+		}},
+		"b": {Name: "b", Transitions: []StateTransition{
+			{From: New, To: Starting, Time: origin.Add(time.Second)},
+			{From: Starting, To: Failed, Time: origin.Add(3 * time.Second), Failure: "failed"},
+		}},
+		"c": {Name: "c"},
+	}
+	recorder.order = []string{"a", "b", "c"}
+
+	recorder.EmitStartupSpans(context.Background())
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	root := byName["services startup"]
+	assert.Equal(t, origin, root.StartTime)
+	assert.Equal(t, origin.Add(3*time.Second), root.EndTime)
+
+	assert.Equal(t, root.SpanContext.SpanID(), byName["start a"].Parent.SpanID())
+	assert.Equal(t, time.Second, byName["start a"].EndTime.Sub(byName["start a"].StartTime))
+	assert.Equal(t, codes.Unset, byName["start a"].Status.Code)
+	assert.Equal(t, codes.Error, byName["start b"].Status.Code)
+}